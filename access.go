@@ -0,0 +1,270 @@
+package simpledbsql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
+	"github.com/jjeffery/errors"
+)
+
+// accessAdvice describes the error codes that AWS returns when a request
+// is not authorized, or when its credentials cannot be authenticated.
+type accessAdvice struct {
+	authorized bool   // the request was authenticated, but is not authorized
+	advice     string // what to check
+}
+
+var accessErrorCodes = map[string]accessAdvice{
+	"AccessDenied":          {authorized: true, advice: "check that an IAM policy allows the action on the domain"},
+	"AccessFailure":         {authorized: true, advice: "check that an IAM policy allows the action on the domain"},
+	"AuthFailure":           {advice: "check the access key id"},
+	"AuthMissingFailure":    {advice: "check that AWS credentials are configured"},
+	"InvalidClientTokenId":  {advice: "check the access key id"},
+	"MissingClientTokenId":  {advice: "check that AWS credentials are configured"},
+	"SignatureDoesNotMatch": {advice: "check the secret access key and the system clock"},
+	"ExpiredToken":          {advice: "refresh the temporary credentials"},
+	"RequestExpired":        {advice: "check the system clock"},
+}
+
+// accessError is the error for a request that fails because it is not
+// authorized or not authenticated. It identifies the SimpleDB action and
+// domain of the request, which are what an IAM policy has to allow. It
+// implements awserr.Error, so its code is the code returned by AWS.
+type accessError struct {
+	err    awserr.Error // error returned by the AWS SDK
+	action string       // SimpleDB API action, such as "PutAttributes"
+	domain string       // domain name, blank if not known
+}
+
+// checkAccessError returns an accessError if err is an AWS error
+// for a request that is not authorized or not authenticated.
+func checkAccessError(err error, action string, domainName string) error {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+	if _, ok := accessErrorCodes[awsErr.Code()]; !ok {
+		return err
+	}
+	return &accessError{err: awsErr, action: action, domain: domainName}
+}
+
+func (e *accessError) Error() string {
+	var sb strings.Builder
+	if accessErrorCodes[e.err.Code()].authorized {
+		sb.WriteString("not authorized for sdb:")
+	} else {
+		sb.WriteString("cannot authenticate request for sdb:")
+	}
+	sb.WriteString(e.action)
+	if e.domain != "" {
+		fmt.Fprintf(&sb, " on domain %q", e.domain)
+	}
+	fmt.Fprintf(&sb, " (%s): %v", accessErrorCodes[e.err.Code()].advice, e.err)
+	return sb.String()
+}
+
+// Code returns the error code returned by AWS.
+func (e *accessError) Code() string {
+	return e.err.Code()
+}
+
+// Message returns the error message returned by AWS.
+func (e *accessError) Message() string {
+	return e.err.Message()
+}
+
+// OrigErr returns the original error of the AWS error, if any.
+func (e *accessError) OrigErr() error {
+	return e.err.OrigErr()
+}
+
+// Cause returns the error returned by the AWS SDK,
+// for compatibility with errors.Cause.
+func (e *accessError) Cause() error {
+	return e.err
+}
+
+// Unwrap returns the error returned by the AWS SDK.
+func (e *accessError) Unwrap() error {
+	return e.err
+}
+
+// checks that the wrapper implements the SimpleDBAPI interface
+var _ simpledbiface.SimpleDBAPI = (*accessAPI)(nil)
+
+// accessAPI returns an accessError for each request that fails because
+// it is not authorized or not authenticated.
+type accessAPI struct {
+	simpledbiface.SimpleDBAPI
+}
+
+func (api *accessAPI) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	output, err := api.SimpleDBAPI.SelectWithContext(ctx, input, opts...)
+	if err != nil {
+		err = checkAccessError(err, "Select", selectDomainName(derefString(input.SelectExpression)))
+	}
+	return output, err
+}
+
+func (api *accessAPI) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.GetAttributesWithContext(ctx, input, opts...)
+	return output, checkAccessError(err, "GetAttributes", derefString(input.DomainName))
+}
+
+func (api *accessAPI) PutAttributesWithContext(ctx aws.Context, input *simpledb.PutAttributesInput, opts ...request.Option) (*simpledb.PutAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.PutAttributesWithContext(ctx, input, opts...)
+	return output, checkAccessError(err, "PutAttributes", derefString(input.DomainName))
+}
+
+func (api *accessAPI) DeleteAttributesWithContext(ctx aws.Context, input *simpledb.DeleteAttributesInput, opts ...request.Option) (*simpledb.DeleteAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.DeleteAttributesWithContext(ctx, input, opts...)
+	return output, checkAccessError(err, "DeleteAttributes", derefString(input.DomainName))
+}
+
+func (api *accessAPI) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.BatchPutAttributesWithContext(ctx, input, opts...)
+	return output, checkAccessError(err, "BatchPutAttributes", derefString(input.DomainName))
+}
+
+func (api *accessAPI) BatchDeleteAttributesWithContext(ctx aws.Context, input *simpledb.BatchDeleteAttributesInput, opts ...request.Option) (*simpledb.BatchDeleteAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.BatchDeleteAttributesWithContext(ctx, input, opts...)
+	return output, checkAccessError(err, "BatchDeleteAttributes", derefString(input.DomainName))
+}
+
+func (api *accessAPI) CreateDomainWithContext(ctx aws.Context, input *simpledb.CreateDomainInput, opts ...request.Option) (*simpledb.CreateDomainOutput, error) {
+	output, err := api.SimpleDBAPI.CreateDomainWithContext(ctx, input, opts...)
+	return output, checkAccessError(err, "CreateDomain", derefString(input.DomainName))
+}
+
+func (api *accessAPI) DeleteDomainWithContext(ctx aws.Context, input *simpledb.DeleteDomainInput, opts ...request.Option) (*simpledb.DeleteDomainOutput, error) {
+	output, err := api.SimpleDBAPI.DeleteDomainWithContext(ctx, input, opts...)
+	return output, checkAccessError(err, "DeleteDomain", derefString(input.DomainName))
+}
+
+func (api *accessAPI) ListDomainsWithContext(ctx aws.Context, input *simpledb.ListDomainsInput, opts ...request.Option) (*simpledb.ListDomainsOutput, error) {
+	output, err := api.SimpleDBAPI.ListDomainsWithContext(ctx, input, opts...)
+	return output, checkAccessError(err, "ListDomains", "")
+}
+
+// Names of the item and attribute used by CheckAccess to probe the
+// write actions. The requests have a condition that fails unless the
+// item exists, so nothing is written.
+const (
+	accessCheckItemName = "simpledbsql.access-check"
+	accessCheckAttrName = "simpledbsql.access-check"
+)
+
+// checkAccess sends a request for each action checked by CheckAccess.
+func (c *conn) checkAccess(ctx context.Context, tableName string) error {
+	domainName, err := c.resolveDomainName(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	expected := &simpledb.UpdateCondition{
+		Name:  aws.String(accessCheckAttrName),
+		Value: aws.String("0"),
+	}
+	attributes := []*simpledb.DeletableAttribute{
+		{Name: aws.String(accessCheckAttrName)},
+	}
+	probes := []struct {
+		action string
+		send   func() error
+	}{
+		{
+			action: "Select",
+			send: func() error {
+				_, err := c.SimpleDB.SelectWithContext(ctx, &simpledb.SelectInput{
+					SelectExpression: aws.String("select itemName() from " + quoteIdentifier(domainName) + " limit 1"),
+				})
+				return err
+			},
+		},
+		{
+			action: "GetAttributes",
+			send: func() error {
+				_, err := c.SimpleDB.GetAttributesWithContext(ctx, &simpledb.GetAttributesInput{
+					DomainName: aws.String(domainName),
+					ItemName:   aws.String(accessCheckItemName),
+				})
+				return err
+			},
+		},
+		{
+			action: "PutAttributes",
+			send: func() error {
+				_, err := c.SimpleDB.PutAttributesWithContext(ctx, &simpledb.PutAttributesInput{
+					DomainName: aws.String(domainName),
+					ItemName:   aws.String(accessCheckItemName),
+					Attributes: []*simpledb.ReplaceableAttribute{
+						{Name: aws.String(accessCheckAttrName), Value: aws.String("1"), Replace: aws.Bool(true)},
+					},
+					Expected: expected,
+				})
+				return err
+			},
+		},
+		{
+			action: "DeleteAttributes",
+			send: func() error {
+				_, err := c.SimpleDB.DeleteAttributesWithContext(ctx, &simpledb.DeleteAttributesInput{
+					DomainName: aws.String(domainName),
+					ItemName:   aws.String(accessCheckItemName),
+					Attributes: attributes,
+					Expected:   expected,
+				})
+				return err
+			},
+		},
+		{
+			action: "BatchDeleteAttributes",
+			send: func() error {
+				// deletes an attribute that the probe item does not have
+				_, err := c.SimpleDB.BatchDeleteAttributesWithContext(ctx, &simpledb.BatchDeleteAttributesInput{
+					DomainName: aws.String(domainName),
+					Items: []*simpledb.DeletableItem{
+						{Name: aws.String(accessCheckItemName), Attributes: attributes},
+					},
+				})
+				return err
+			},
+		},
+	}
+
+	var denied []string
+	var cause error
+	for _, probe := range probes {
+		err := probe.send()
+		if err == nil || hasCode(err, attributeDoesNotExist) || hasCode(err, conditionalCheckFailed) {
+			// the condition was checked, so the request was allowed
+			continue
+		}
+		if _, ok := err.(*accessError); ok {
+			denied = append(denied, "sdb:"+probe.action)
+			if cause == nil {
+				cause = err
+			}
+			continue
+		}
+		return errors.Wrap(err, "cannot check access").With(
+			"table", tableName,
+			"domain", domainName,
+			"action", probe.action,
+		)
+	}
+	if cause != nil {
+		return errors.Wrap(cause, "access denied").With(
+			"table", tableName,
+			"domain", domainName,
+			"actions", strings.Join(denied, ","),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+//go:build go1.17
+// +build go1.17
+
+package simpledbsql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jjeffery/errors"
+)
+
+// CheckAccess checks that the AWS credentials used by db are allowed to
+// perform the SimpleDB actions that the driver uses for a table, which
+// are Select, GetAttributes, PutAttributes, DeleteAttributes and
+// BatchDeleteAttributes. It sends a request for each action to the
+// table's domain, and none of the requests modifies the domain.
+// BatchPutAttributes, which is used by bulk inserts and the TableWriter,
+// cannot be checked without writing an item, so it is not checked.
+//
+// If any action is not allowed, the error lists the actions, and its
+// cause is the error for the first of them. CheckAccess is useful as a
+// diagnostic when deploying with a new IAM policy, and is not intended
+// to be called before each statement.
+//
+// The requests are sent on a connection from the pool of db, which must
+// have been opened with a Connector, or with the "simpledb" driver name.
+// CheckAccess requires go 1.17 or later.
+func CheckAccess(ctx context.Context, db *sql.DB, table string) error {
+	sc, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+	return sc.Raw(func(dc interface{}) error {
+		c, ok := dc.(*conn)
+		if !ok {
+			return errors.New("database does not use the simpledb driver")
+		}
+		return c.checkAccess(ctx, table)
+	})
+}
@@ -0,0 +1,90 @@
+//go:build go1.17
+// +build go1.17
+
+package simpledbsql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/fakesdb"
+)
+
+// deniedAPI is a fake SimpleDB API that fails requests for
+// the denied actions with AccessDenied.
+type deniedAPI struct {
+	*fakesdb.DB
+	denied map[string]bool
+}
+
+func (api *deniedAPI) deny(action string) error {
+	if api.denied[action] {
+		return awserr.New("AccessDenied", "User is not authorized to perform: sdb:"+action, nil)
+	}
+	return nil
+}
+
+func (api *deniedAPI) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	if err := api.deny("Select"); err != nil {
+		return nil, err
+	}
+	return api.DB.SelectWithContext(ctx, input, opts...)
+}
+
+func (api *deniedAPI) PutAttributesWithContext(ctx aws.Context, input *simpledb.PutAttributesInput, opts ...request.Option) (*simpledb.PutAttributesOutput, error) {
+	if err := api.deny("PutAttributes"); err != nil {
+		return nil, err
+	}
+	return api.DB.PutAttributesWithContext(ctx, input, opts...)
+}
+
+func (api *deniedAPI) BatchDeleteAttributesWithContext(ctx aws.Context, input *simpledb.BatchDeleteAttributesInput, opts ...request.Option) (*simpledb.BatchDeleteAttributesOutput, error) {
+	if err := api.deny("BatchDeleteAttributes"); err != nil {
+		return nil, err
+	}
+	return api.DB.BatchDeleteAttributesWithContext(ctx, input, opts...)
+}
+
+func TestCheckAccess(t *testing.T) {
+	ctx := context.Background()
+	api := &deniedAPI{DB: fakesdb.New()}
+	db := sql.OpenDB(&Connector{SimpleDB: api})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl; insert into tbl(id, a) values('ID1', 'x')")
+	wantNoError(t, err)
+
+	wantNoError(t, CheckAccess(ctx, db, "tbl"))
+	if got := api.Item("tbl", accessCheckItemName); len(got) != 0 {
+		t.Errorf("got=%v, want no item", got)
+	}
+	err = CheckAccess(ctx, db, "missing")
+	wantErrorMessageContaining(t, err, "cannot check access")
+
+	api.denied = map[string]bool{"PutAttributes": true, "BatchDeleteAttributes": true}
+	err = CheckAccess(ctx, db, "tbl")
+	wantErrorMessageContaining(t, err, "access denied")
+	wantErrorMessageContaining(t, err, `actions="sdb:PutAttributes,sdb:BatchDeleteAttributes"`)
+
+	// errors identify the action and domain that are not authorized
+	_, err = db.ExecContext(ctx, "insert into tbl(id, a) values('ID2', 'y')")
+	wantErrorMessageContaining(t, err, `not authorized for sdb:PutAttributes on domain "tbl" (check that an IAM policy allows`)
+	if !hasCode(errors.Cause(err), "AccessDenied") {
+		t.Errorf("got=%v, want AccessDenied code", errors.Cause(err))
+	}
+	api.denied = map[string]bool{"Select": true}
+	_, err = db.QueryContext(ctx, "select id from tbl where a = 'x'")
+	wantErrorMessageContaining(t, err, `not authorized for sdb:Select on domain "tbl"`)
+
+	// the requests are sent on a connection of a database opened with sql.Open
+	api.denied = map[string]bool{"Select": true}
+	db = openDriverDB(t, api)
+	defer db.Close()
+	err = CheckAccess(ctx, db, "tbl")
+	wantErrorMessageContaining(t, err, `actions="sdb:Select"`)
+}
@@ -0,0 +1,333 @@
+package simpledbsql
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// defaultMaxGroups is the default maximum number of groups of a select
+// statement with a group by clause.
+const defaultMaxGroups = 1000
+
+// aggregate runs a select query whose select list contains aggregate
+// functions, such as "select max(a) from tbl", or that has a group by
+// clause. SimpleDB cannot compute aggregates, so the driver selects the
+// aggregated and grouped columns and computes the aggregates as it reads
+// the rows. Without a group by clause, it returns a single row. With one,
+// it returns a row for each group, in order of the grouped values. Values
+// are compared and summed using their decoded types, so that numbers are
+// aggregated numerically. Null values are ignored, and an aggregate other
+// than count is null if there are no values.
+func (c *conn) aggregate(ctx context.Context, q *parse.SelectQuery, args []driver.Value) (driver.Rows, error) {
+	columnsQuery := *q
+	columnsQuery.Aggregates = nil
+	var (
+		rows driver.Rows
+		err  error
+	)
+	if q.Key == nil {
+		rows, err = c.selectQuery(ctx, &columnsQuery, args)
+	} else {
+		rows, err = c.getAttributes(ctx, &columnsQuery, args)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columnIndex := make(map[string]int, len(q.ColumnNames))
+	for i, columnName := range q.ColumnNames {
+		columnIndex[columnName] = i
+	}
+	maxGroups := c.maxGroups
+	if q.MaxGroups > 0 {
+		maxGroups = q.MaxGroups
+	}
+	groups := make(map[string]*aggregateGroup)
+	var ordered []*aggregateGroup
+	if len(q.GroupBy) == 0 {
+		// a single row, even if there are no values
+		g := &aggregateGroup{aggregators: make([]aggregator, len(q.Aggregates))}
+		groups[""] = g
+		ordered = append(ordered, g)
+	}
+	values := make([]driver.Value, len(q.ColumnNames))
+	for {
+		if err := rows.Next(values); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		var key strings.Builder
+		for _, columnName := range q.GroupBy {
+			// the type distinguishes values with the same text
+			v := values[columnIndex[columnName]]
+			fmt.Fprintf(&key, "%T:%v\x00", v, v)
+		}
+		g := groups[key.String()]
+		if g == nil {
+			if maxGroups > 0 && len(ordered) >= maxGroups {
+				return nil, errors.New("too many groups").With(
+					"maxGroups", maxGroups,
+				)
+			}
+			g = &aggregateGroup{aggregators: make([]aggregator, len(q.Aggregates))}
+			for _, columnName := range q.GroupBy {
+				g.values = append(g.values, values[columnIndex[columnName]])
+			}
+			groups[key.String()] = g
+			ordered = append(ordered, g)
+		}
+		for i, agg := range q.Aggregates {
+			if agg.Function == "" {
+				continue
+			}
+			var v driver.Value = true // counted by count(*)
+			if agg.ColumnName != "*" {
+				v = values[columnIndex[agg.ColumnName]]
+			}
+			if err := g.aggregators[i].add(agg.Function, v); err != nil {
+				return nil, errors.Wrap(err, "cannot compute aggregate").With(
+					"aggregate", agg.String(),
+				)
+			}
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].less(ordered[j])
+	})
+
+	result := &valueRows{}
+	for _, agg := range q.Aggregates {
+		result.columns = append(result.columns, agg.String())
+	}
+	for _, g := range ordered {
+		row := make([]driver.Value, len(q.Aggregates))
+		for i, agg := range q.Aggregates {
+			if agg.Function == "" {
+				row[i] = g.values[indexOf(q.GroupBy, agg.ColumnName)]
+			} else {
+				row[i] = g.aggregators[i].result(agg.Function)
+			}
+		}
+		result.values = append(result.values, row)
+	}
+	return result, nil
+}
+
+// aggregateGroup holds the aggregates of the rows that have the same values
+// in the columns of the group by clause.
+type aggregateGroup struct {
+	values      []driver.Value // values of the group by columns
+	aggregators []aggregator
+}
+
+// less reports whether the values of group g sort before those of group h.
+// Null values sort first, and values that cannot be compared are sorted by
+// the names of their types.
+func (g *aggregateGroup) less(h *aggregateGroup) bool {
+	for i, v1 := range g.values {
+		v2 := h.values[i]
+		switch {
+		case v1 == nil && v2 == nil:
+			continue
+		case v1 == nil:
+			return true
+		case v2 == nil:
+			return false
+		}
+		cmp, err := compareValues(v1, v2)
+		if err != nil {
+			cmp = strings.Compare(reflect.TypeOf(v1).String(), reflect.TypeOf(v2).String())
+		}
+		if cmp != 0 {
+			return cmp < 0
+		}
+	}
+	return false
+}
+
+func indexOf(columnNames []string, name string) int {
+	for i, columnName := range columnNames {
+		if columnName == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// describeAggregates describes the aggregates computed by the driver
+// for the explain statement, or returns a blank string if there are none.
+func describeAggregates(q *parse.SelectQuery) string {
+	var names []string
+	for _, agg := range q.Aggregates {
+		if agg.Function != "" {
+			names = append(names, agg.String())
+		}
+	}
+	var description string
+	if len(names) > 0 {
+		description = "aggregated by driver: " + strings.Join(names, ", ")
+	}
+	if len(q.GroupBy) > 0 {
+		if description != "" {
+			description += ", "
+		}
+		description += "grouped by driver: " + strings.Join(q.GroupBy, ", ")
+	}
+	return description
+}
+
+// aggregator computes an aggregate of the values of a column.
+type aggregator struct {
+	count int64        // number of values
+	value driver.Value // min or max value, or nil
+	sum   *big.Rat     // exact sum, or nil
+	float bool         // sum includes float64 values
+	exact bool         // sum includes decimal values
+}
+
+// add adds a value to the aggregate. Null values are ignored.
+func (a *aggregator) add(function string, v driver.Value) error {
+	if v == nil {
+		return nil
+	}
+	a.count++
+	switch function {
+	case "count":
+	case "min", "max":
+		if a.value == nil {
+			a.value = v
+			return nil
+		}
+		cmp, err := compareValues(v, a.value)
+		if err != nil {
+			return err
+		}
+		if (function == "min" && cmp < 0) || (function == "max" && cmp > 0) {
+			a.value = v
+		}
+	case "sum":
+		r, err := numberValue(v)
+		if err != nil {
+			return err
+		}
+		if a.sum == nil {
+			a.sum = new(big.Rat)
+		}
+		a.sum.Add(a.sum, r)
+		switch v.(type) {
+		case float64:
+			a.float = true
+		case *big.Rat:
+			a.exact = true
+		}
+	default:
+		return errors.New("unknown aggregate function").With("function", function)
+	}
+	return nil
+}
+
+// result returns the value of the aggregate. The sum of integers is an int64,
+// or a *big.Int if it overflows. The sum of values that include a decimal is
+// a *big.Rat, unless they include a float64, in which case it is a float64.
+func (a *aggregator) result(function string) driver.Value {
+	if function == "count" {
+		return a.count
+	}
+	if a.sum == nil {
+		return a.value
+	}
+	switch {
+	case a.float:
+		f, _ := a.sum.Float64()
+		return f
+	case a.exact:
+		return a.sum
+	}
+	n := a.sum.Num()
+	if n.IsInt64() {
+		return n.Int64()
+	}
+	return new(big.Int).Set(n)
+}
+
+// numberValue returns the value of a number as a *big.Rat.
+func numberValue(v driver.Value) (*big.Rat, error) {
+	switch n := v.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(n), nil
+	case uint64:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(n)), nil
+	case *big.Int:
+		return new(big.Rat).SetInt(n), nil
+	case *big.Rat:
+		return n, nil
+	case float64:
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, errors.New("cannot aggregate infinite or NaN value")
+		}
+		return new(big.Rat).SetFloat64(n), nil
+	}
+	return nil, errors.New("cannot aggregate value as a number").With(
+		"type", reflect.TypeOf(v).String(),
+	)
+}
+
+// compareValues returns -1, 0 or 1 as v1 is less than, equal to or greater
+// than v2. Numbers of different types are compared numerically, but other
+// values can only be compared with values of the same type.
+func compareValues(v1, v2 driver.Value) (int, error) {
+	if r1, err := numberValue(v1); err == nil {
+		if r2, err := numberValue(v2); err == nil {
+			return r1.Cmp(r2), nil
+		}
+	}
+	switch x1 := v1.(type) {
+	case string:
+		if x2, ok := v2.(string); ok {
+			return strings.Compare(x1, x2), nil
+		}
+	case []byte:
+		if x2, ok := v2.([]byte); ok {
+			return bytes.Compare(x1, x2), nil
+		}
+	case bool:
+		if x2, ok := v2.(bool); ok {
+			switch {
+			case x1 == x2:
+				return 0, nil
+			case x2:
+				return -1, nil
+			}
+			return 1, nil
+		}
+	case time.Time:
+		if x2, ok := v2.(time.Time); ok {
+			switch {
+			case x1.Before(x2):
+				return -1, nil
+			case x1.After(x2):
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return 0, errors.New("cannot compare values of different types").With(
+		"type1", reflect.TypeOf(v1).String(),
+		"type2", reflect.TypeOf(v2).String(),
+	)
+}
@@ -0,0 +1,251 @@
+package simpledbsql
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
+)
+
+// The types in this file wrap the SimpleDB API used by the driver in order
+// to add behaviour to every API call. They embed the SimpleDBAPI interface
+// and override only the WithContext methods that the driver calls.
+
+// checks that the wrappers implement the SimpleDBAPI interface
+var (
+	_ simpledbiface.SimpleDBAPI = (*loggingAPI)(nil)
+	_ simpledbiface.SimpleDBAPI = (*dryRunAPI)(nil)
+	_ simpledbiface.SimpleDBAPI = (*contextAPI)(nil)
+	_ simpledbiface.SimpleDBAPI = (*optionsAPI)(nil)
+)
+
+// loggingAPI calls a log function before each SimpleDB request.
+type loggingAPI struct {
+	simpledbiface.SimpleDBAPI
+	log func(ctx aws.Context, operation string, input interface{})
+}
+
+func (api *loggingAPI) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	api.log(ctx, "Select", input)
+	return api.SimpleDBAPI.SelectWithContext(ctx, input, opts...)
+}
+
+func (api *loggingAPI) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	api.log(ctx, "GetAttributes", input)
+	return api.SimpleDBAPI.GetAttributesWithContext(ctx, input, opts...)
+}
+
+func (api *loggingAPI) PutAttributesWithContext(ctx aws.Context, input *simpledb.PutAttributesInput, opts ...request.Option) (*simpledb.PutAttributesOutput, error) {
+	api.log(ctx, "PutAttributes", input)
+	return api.SimpleDBAPI.PutAttributesWithContext(ctx, input, opts...)
+}
+
+func (api *loggingAPI) DeleteAttributesWithContext(ctx aws.Context, input *simpledb.DeleteAttributesInput, opts ...request.Option) (*simpledb.DeleteAttributesOutput, error) {
+	api.log(ctx, "DeleteAttributes", input)
+	return api.SimpleDBAPI.DeleteAttributesWithContext(ctx, input, opts...)
+}
+
+func (api *loggingAPI) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	api.log(ctx, "BatchPutAttributes", input)
+	return api.SimpleDBAPI.BatchPutAttributesWithContext(ctx, input, opts...)
+}
+
+func (api *loggingAPI) BatchDeleteAttributesWithContext(ctx aws.Context, input *simpledb.BatchDeleteAttributesInput, opts ...request.Option) (*simpledb.BatchDeleteAttributesOutput, error) {
+	api.log(ctx, "BatchDeleteAttributes", input)
+	return api.SimpleDBAPI.BatchDeleteAttributesWithContext(ctx, input, opts...)
+}
+
+func (api *loggingAPI) CreateDomainWithContext(ctx aws.Context, input *simpledb.CreateDomainInput, opts ...request.Option) (*simpledb.CreateDomainOutput, error) {
+	api.log(ctx, "CreateDomain", input)
+	return api.SimpleDBAPI.CreateDomainWithContext(ctx, input, opts...)
+}
+
+func (api *loggingAPI) DeleteDomainWithContext(ctx aws.Context, input *simpledb.DeleteDomainInput, opts ...request.Option) (*simpledb.DeleteDomainOutput, error) {
+	api.log(ctx, "DeleteDomain", input)
+	return api.SimpleDBAPI.DeleteDomainWithContext(ctx, input, opts...)
+}
+
+func (api *loggingAPI) ListDomainsWithContext(ctx aws.Context, input *simpledb.ListDomainsInput, opts ...request.Option) (*simpledb.ListDomainsOutput, error) {
+	api.log(ctx, "ListDomains", input)
+	return api.SimpleDBAPI.ListDomainsWithContext(ctx, input, opts...)
+}
+
+// dryRunAPI does not send requests that modify SimpleDB. Instead it
+// returns an empty output as if the request had succeeded. Read requests
+// are sent as normal.
+type dryRunAPI struct {
+	simpledbiface.SimpleDBAPI
+}
+
+func (api *dryRunAPI) PutAttributesWithContext(ctx aws.Context, input *simpledb.PutAttributesInput, opts ...request.Option) (*simpledb.PutAttributesOutput, error) {
+	return &simpledb.PutAttributesOutput{}, nil
+}
+
+func (api *dryRunAPI) DeleteAttributesWithContext(ctx aws.Context, input *simpledb.DeleteAttributesInput, opts ...request.Option) (*simpledb.DeleteAttributesOutput, error) {
+	return &simpledb.DeleteAttributesOutput{}, nil
+}
+
+func (api *dryRunAPI) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	return &simpledb.BatchPutAttributesOutput{}, nil
+}
+
+func (api *dryRunAPI) BatchDeleteAttributesWithContext(ctx aws.Context, input *simpledb.BatchDeleteAttributesInput, opts ...request.Option) (*simpledb.BatchDeleteAttributesOutput, error) {
+	return &simpledb.BatchDeleteAttributesOutput{}, nil
+}
+
+func (api *dryRunAPI) CreateDomainWithContext(ctx aws.Context, input *simpledb.CreateDomainInput, opts ...request.Option) (*simpledb.CreateDomainOutput, error) {
+	return &simpledb.CreateDomainOutput{}, nil
+}
+
+func (api *dryRunAPI) DeleteDomainWithContext(ctx aws.Context, input *simpledb.DeleteDomainInput, opts ...request.Option) (*simpledb.DeleteDomainOutput, error) {
+	return &simpledb.DeleteDomainOutput{}, nil
+}
+
+// contextAPI returns a contextError for each request that fails because its
+// context is done, so that the error can be identified as the context's
+// error, such as context.Canceled.
+type contextAPI struct {
+	simpledbiface.SimpleDBAPI
+}
+
+// contextError is the error for a request that fails because its context
+// is done. It unwraps to the context's error, and also satisfies errors.As
+// for the awserr.Error returned by the AWS SDK.
+type contextError struct {
+	err    error // error returned by the AWS SDK
+	ctxErr error // error of the request's context
+}
+
+// checkContext returns a contextError if err was caused by ctx being done.
+func checkContext(ctx aws.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	return &contextError{err: err, ctxErr: ctx.Err()}
+}
+
+func (e *contextError) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns the error returned by the AWS SDK,
+// for compatibility with errors.Cause.
+func (e *contextError) Cause() error {
+	return e.err
+}
+
+// Unwrap returns the error of the request's context.
+func (e *contextError) Unwrap() error {
+	return e.ctxErr
+}
+
+// As sets target to the error returned by the AWS SDK if target
+// is an *awserr.Error.
+func (e *contextError) As(target interface{}) bool {
+	if p, ok := target.(*awserr.Error); ok {
+		if err, ok := e.err.(awserr.Error); ok {
+			*p = err
+			return true
+		}
+	}
+	return false
+}
+
+func (api *contextAPI) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	output, err := api.SimpleDBAPI.SelectWithContext(ctx, input, opts...)
+	return output, checkContext(ctx, err)
+}
+
+func (api *contextAPI) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.GetAttributesWithContext(ctx, input, opts...)
+	return output, checkContext(ctx, err)
+}
+
+func (api *contextAPI) PutAttributesWithContext(ctx aws.Context, input *simpledb.PutAttributesInput, opts ...request.Option) (*simpledb.PutAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.PutAttributesWithContext(ctx, input, opts...)
+	return output, checkContext(ctx, err)
+}
+
+func (api *contextAPI) DeleteAttributesWithContext(ctx aws.Context, input *simpledb.DeleteAttributesInput, opts ...request.Option) (*simpledb.DeleteAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.DeleteAttributesWithContext(ctx, input, opts...)
+	return output, checkContext(ctx, err)
+}
+
+func (api *contextAPI) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.BatchPutAttributesWithContext(ctx, input, opts...)
+	return output, checkContext(ctx, err)
+}
+
+func (api *contextAPI) BatchDeleteAttributesWithContext(ctx aws.Context, input *simpledb.BatchDeleteAttributesInput, opts ...request.Option) (*simpledb.BatchDeleteAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.BatchDeleteAttributesWithContext(ctx, input, opts...)
+	return output, checkContext(ctx, err)
+}
+
+func (api *contextAPI) CreateDomainWithContext(ctx aws.Context, input *simpledb.CreateDomainInput, opts ...request.Option) (*simpledb.CreateDomainOutput, error) {
+	output, err := api.SimpleDBAPI.CreateDomainWithContext(ctx, input, opts...)
+	return output, checkContext(ctx, err)
+}
+
+func (api *contextAPI) DeleteDomainWithContext(ctx aws.Context, input *simpledb.DeleteDomainInput, opts ...request.Option) (*simpledb.DeleteDomainOutput, error) {
+	output, err := api.SimpleDBAPI.DeleteDomainWithContext(ctx, input, opts...)
+	return output, checkContext(ctx, err)
+}
+
+func (api *contextAPI) ListDomainsWithContext(ctx aws.Context, input *simpledb.ListDomainsInput, opts ...request.Option) (*simpledb.ListDomainsOutput, error) {
+	output, err := api.SimpleDBAPI.ListDomainsWithContext(ctx, input, opts...)
+	return output, checkContext(ctx, err)
+}
+
+// optionsAPI adds the Connector's request options to every request, after
+// the options of the driver.
+type optionsAPI struct {
+	simpledbiface.SimpleDBAPI
+	opts []request.Option
+}
+
+// options returns the options of a request followed by the Connector's options,
+// without modifying the array of the request's options.
+func (api *optionsAPI) options(opts []request.Option) []request.Option {
+	return append(opts[:len(opts):len(opts)], api.opts...)
+}
+
+func (api *optionsAPI) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	return api.SimpleDBAPI.SelectWithContext(ctx, input, api.options(opts)...)
+}
+
+func (api *optionsAPI) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	return api.SimpleDBAPI.GetAttributesWithContext(ctx, input, api.options(opts)...)
+}
+
+func (api *optionsAPI) PutAttributesWithContext(ctx aws.Context, input *simpledb.PutAttributesInput, opts ...request.Option) (*simpledb.PutAttributesOutput, error) {
+	return api.SimpleDBAPI.PutAttributesWithContext(ctx, input, api.options(opts)...)
+}
+
+func (api *optionsAPI) DeleteAttributesWithContext(ctx aws.Context, input *simpledb.DeleteAttributesInput, opts ...request.Option) (*simpledb.DeleteAttributesOutput, error) {
+	return api.SimpleDBAPI.DeleteAttributesWithContext(ctx, input, api.options(opts)...)
+}
+
+func (api *optionsAPI) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	return api.SimpleDBAPI.BatchPutAttributesWithContext(ctx, input, api.options(opts)...)
+}
+
+func (api *optionsAPI) BatchDeleteAttributesWithContext(ctx aws.Context, input *simpledb.BatchDeleteAttributesInput, opts ...request.Option) (*simpledb.BatchDeleteAttributesOutput, error) {
+	return api.SimpleDBAPI.BatchDeleteAttributesWithContext(ctx, input, api.options(opts)...)
+}
+
+func (api *optionsAPI) CreateDomainWithContext(ctx aws.Context, input *simpledb.CreateDomainInput, opts ...request.Option) (*simpledb.CreateDomainOutput, error) {
+	return api.SimpleDBAPI.CreateDomainWithContext(ctx, input, api.options(opts)...)
+}
+
+func (api *optionsAPI) DeleteDomainWithContext(ctx aws.Context, input *simpledb.DeleteDomainInput, opts ...request.Option) (*simpledb.DeleteDomainOutput, error) {
+	return api.SimpleDBAPI.DeleteDomainWithContext(ctx, input, api.options(opts)...)
+}
+
+func (api *optionsAPI) ListDomainsWithContext(ctx aws.Context, input *simpledb.ListDomainsInput, opts ...request.Option) (*simpledb.ListDomainsOutput, error) {
+	return api.SimpleDBAPI.ListDomainsWithContext(ctx, input, api.options(opts)...)
+}
+
+func (api *optionsAPI) DomainMetadataWithContext(ctx aws.Context, input *simpledb.DomainMetadataInput, opts ...request.Option) (*simpledb.DomainMetadataOutput, error) {
+	return api.SimpleDBAPI.DomainMetadataWithContext(ctx, input, api.options(opts)...)
+}
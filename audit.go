@@ -0,0 +1,300 @@
+package simpledbsql
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// Status values of audit items.
+const (
+	AuditPending   = "pending"   // statement has not completed
+	AuditApplied   = "applied"   // statement modified the item
+	AuditUnchanged = "unchanged" // item did not exist, so was not modified
+	AuditFailed    = "failed"    // statement returned an error
+)
+
+// maxAttributeValueLength is the maximum length of a SimpleDB attribute value.
+const maxAttributeValueLength = 1024
+
+// auditLog keeps track of the audit domains that have been created
+// by a Connector.
+type auditLog struct {
+	tableName string
+	mutex     sync.Mutex
+	created   map[string]bool
+}
+
+func newAuditLog(tableName string) *auditLog {
+	return &auditLog{
+		tableName: tableName,
+		created:   make(map[string]bool),
+	}
+}
+
+// auditEntry is an item in the audit table.
+type auditEntry struct {
+	domainName string // domain of the audit table
+	itemName   string // name of the audit item
+
+	changedAt time.Time
+	tableName string
+	itemID    string
+	operation string
+	statement string
+	status    string
+	oldValues map[string]interface{}
+	newValues map[string]interface{}
+}
+
+// auditDomain returns the domain name of the audit table, creating
+// the domain if it has not already been created by the Connector.
+func (c *conn) auditDomain(ctx context.Context) (string, error) {
+	domainName, err := c.resolveDomainName(ctx, c.audit.tableName)
+	if err != nil {
+		return "", err
+	}
+	c.audit.mutex.Lock()
+	created := c.audit.created[domainName]
+	c.audit.mutex.Unlock()
+	if created {
+		return domainName, nil
+	}
+	input := &simpledb.CreateDomainInput{
+		DomainName: aws.String(domainName),
+	}
+	if _, err := c.SimpleDB.CreateDomainWithContext(ctx, input, requestOptions(ctx)...); err != nil {
+		return "", errors.Wrap(err, "cannot create audit domain").With(
+			"domain", domainName,
+			"table", c.audit.tableName,
+		)
+	}
+	c.audit.mutex.Lock()
+	c.audit.created[domainName] = true
+	c.audit.mutex.Unlock()
+	return domainName, nil
+}
+
+// auditExec runs an insert, update or delete statement, recording it in the
+// audit table. The audit item is written before the statement is run, and its
+// status is updated after the statement completes.
+func (c *conn) auditExec(ctx context.Context, stmt string, q *parse.Query, args []driver.Value) (driver.Result, error) {
+	entry, err := c.newAuditEntry(ctx, stmt, q, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.putAuditEntry(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	result, err := c.exec(ctx, q, args)
+
+	var rowsAffected int64
+	if err == nil {
+		rowsAffected, err = result.RowsAffected()
+	}
+	if q.Insert != nil && q.Insert.OnDuplicateKeyUpdate != nil {
+		columns := q.Insert.Columns
+		if rowsAffected == 2 {
+			// updated using the "on duplicate key update" clause
+			entry.operation = "update"
+			columns = q.Insert.OnDuplicateKeyUpdate
+		}
+		entry.newValues = newChange(q.Insert.TableName, nil, nil, columns, args).Values
+	}
+	switch {
+	case err != nil:
+		entry.status = AuditFailed
+	case q.Delete != nil && entry.oldValues != nil:
+		entry.status = AuditApplied
+	case rowsAffected > 0:
+		entry.status = AuditApplied
+	default:
+		entry.status = AuditUnchanged
+	}
+	if auditErr := c.putAuditEntry(ctx, entry); auditErr != nil && err == nil {
+		// the statement has been applied, but its audit item remains pending
+		return nil, auditErr
+	}
+	return result, err
+}
+
+// newAuditEntry returns the audit entry for a statement, including
+// the values of the columns that the statement will modify.
+func (c *conn) newAuditEntry(ctx context.Context, stmt string, q *parse.Query, args []driver.Value) (*auditEntry, error) {
+	auditDomainName, err := c.auditDomain(ctx)
+	if err != nil {
+		return nil, err
+	}
+	itemName, err := newAuditItemName()
+	if err != nil {
+		return nil, err
+	}
+	entry := &auditEntry{
+		domainName: auditDomainName,
+		itemName:   itemName,
+		changedAt:  time.Now(),
+		statement:  truncateValue(stmt),
+		status:     AuditPending,
+	}
+
+	var (
+		key         parse.Key
+		columnNames []string
+		readOld     bool
+	)
+	switch {
+	case q.Insert != nil:
+		entry.tableName, key, entry.operation = q.Insert.TableName, q.Insert.Key, "insert"
+		if q.Insert.OnDuplicateKeyUpdate == nil {
+			entry.newValues = newChange(q.Insert.TableName, nil, nil, q.Insert.Columns, args).Values
+		} else {
+			// the new values are not known until the statement has run,
+			// and the old values are only needed if the item exists
+			readOld = true
+			columnNames = appendColumnNames(columnNames, q.Insert.Columns)
+			columnNames = appendColumnNames(columnNames, q.Insert.OnDuplicateKeyUpdate)
+		}
+	case q.Update != nil:
+		entry.tableName, key, entry.operation = q.Update.TableName, q.Update.Key, "update"
+		entry.newValues = newChange(q.Update.TableName, nil, nil, q.Update.Columns, args).Values
+		readOld = true
+		columnNames = appendColumnNames(columnNames, q.Update.Columns)
+	case q.Delete != nil:
+		entry.tableName, key, entry.operation = q.Delete.TableName, q.Delete.Key, "delete"
+		readOld = true
+	}
+	if entry.itemID, err = key.String(args); err != nil {
+		return nil, err
+	}
+	if readOld {
+		entry.oldValues, err = c.getOldValues(ctx, entry.tableName, entry.itemID, columnNames)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+func appendColumnNames(names []string, columns []parse.Column) []string {
+	for _, col := range columns {
+		names = append(names, col.ColumnName)
+	}
+	return names
+}
+
+// getOldValues returns the values of the columns of an item before it is
+// modified, or all columns if columnNames is empty, for the audit table and
+// the Connector's hooks. It returns nil if the item does not exist.
+func (c *conn) getOldValues(ctx context.Context, tableName string, itemName string, columnNames []string) (map[string]interface{}, error) {
+	domainName, err := c.resolveDomainName(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	input := &simpledb.GetAttributesInput{
+		DomainName:     aws.String(domainName),
+		ItemName:       aws.String(itemName),
+		ConsistentRead: aws.Bool(true),
+	}
+	if len(columnNames) > 0 {
+		attributeNames := c.meta.attributeNames(columnNames)
+		if c.meta.packed {
+			attributeNames = append(attributeNames, c.meta.packedAttr())
+		}
+		input.AttributeNames = aws.StringSlice(attributeNames)
+	}
+	output, err := c.SimpleDB.GetAttributesWithContext(ctx, input, requestOptions(ctx)...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get old values").With(
+			"itemName", c.redact(itemName),
+		)
+	}
+	if len(output.Attributes) == 0 {
+		return nil, nil
+	}
+	values := decodeItem(&simpledb.Item{
+		Name:       aws.String(itemName),
+		Attributes: output.Attributes,
+	}, c.meta)
+	delete(values, "id")
+	return values, nil
+}
+
+// putAuditEntry writes an audit entry to the audit table.
+func (c *conn) putAuditEntry(ctx context.Context, entry *auditEntry) error {
+	li := newLoadItem(c.meta)
+	li.item.Name = aws.String(entry.itemName)
+	putValues := func(prefix string, values map[string]interface{}) error {
+		for name, v := range values {
+			if err := li.putValue(prefix+name, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := putValues("", map[string]interface{}{
+		"changedAt": entry.changedAt,
+		"tableName": entry.tableName,
+		"itemId":    entry.itemID,
+		"operation": entry.operation,
+		"statement": entry.statement,
+		"status":    entry.status,
+	}); err != nil {
+		return err
+	}
+	if err := putValues("old.", entry.oldValues); err != nil {
+		return err
+	}
+	if err := putValues("new.", entry.newValues); err != nil {
+		return err
+	}
+	attrs, err := c.meta.pack(li.item.Attributes, "")
+	if err != nil {
+		return err
+	}
+	input := &simpledb.PutAttributesInput{
+		DomainName: aws.String(entry.domainName),
+		ItemName:   li.item.Name,
+		Attributes: attrs,
+	}
+	if _, err := c.SimpleDB.PutAttributesWithContext(ctx, input, requestOptions(ctx)...); err != nil {
+		return errors.Wrap(err, "cannot put audit item").With(
+			"domain", entry.domainName,
+			"itemName", c.redact(entry.itemName),
+			"status", entry.status,
+		)
+	}
+	return nil
+}
+
+// newAuditItemName returns a unique item name for an audit item. Item names
+// sort in the order that they were created.
+func newAuditItemName() (string, error) {
+	var suffix [8]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return "", errors.Wrap(err, "cannot generate audit item name")
+	}
+	return time.Now().UTC().Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(suffix[:]), nil
+}
+
+// truncateValue truncates s to the maximum length of an attribute value,
+// without splitting a UTF-8 encoded character.
+func truncateValue(s string) string {
+	if len(s) <= maxAttributeValueLength {
+		return s
+	}
+	n := maxAttributeValueLength
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
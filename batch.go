@@ -0,0 +1,337 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/lex"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// inList is the location of an in list in the lexemes of a where clause.
+type inList struct {
+	open   int        // index of "("
+	close  int        // index of ")"
+	values [][]string // lexemes of each value
+}
+
+// findInLists returns the in lists in the lexemes of a where clause.
+func findInLists(whereClause []string) []inList {
+	var lists []inList
+	for i := 0; i < len(whereClause); i++ {
+		if !strings.EqualFold(whereClause[i], "in") {
+			continue
+		}
+		open := i + 1
+		for open < len(whereClause) && whereClause[open] == " " {
+			open++
+		}
+		if open >= len(whereClause) || whereClause[open] != "(" {
+			continue
+		}
+		list := inList{open: open}
+		var value []string
+		for j := open + 1; j < len(whereClause); j++ {
+			lexeme := whereClause[j]
+			if lexeme == ")" || lexeme == "," {
+				list.values = append(list.values, value)
+				value = nil
+				if lexeme == ")" {
+					list.close = j
+					break
+				}
+				continue
+			}
+			if lexeme != " " {
+				value = append(value, lexeme)
+			}
+		}
+		if list.close > 0 {
+			lists = append(lists, list)
+			i = list.close
+		}
+	}
+	return lists
+}
+
+// numberPlaceholders replaces "?" placeholders with the equivalent numbered
+// placeholders, so that the lexemes refer to the same args after the values
+// of an in list are split between queries.
+func numberPlaceholders(whereClause []string) []string {
+	numbered := make([]string, len(whereClause))
+	var ordinal int
+	for i, lexeme := range whereClause {
+		if lexeme == "?" {
+			ordinal++
+			lexeme = "$" + strconv.Itoa(ordinal)
+		}
+		numbered[i] = lexeme
+	}
+	return numbered
+}
+
+// splitInList returns the queries that together select the same items as
+// a query whose in list has more values than SimpleDB accepts. Each query
+// has a batch of the in list values. Queries without a long in list are
+// returned unchanged.
+func splitInList(q *parse.SelectQuery) ([]*parse.SelectQuery, error) {
+	var long *inList
+	whereClause := numberPlaceholders(q.WhereClause)
+	lists := findInLists(whereClause)
+	for i := range lists {
+		if len(lists[i].values) <= maxInValues {
+			continue
+		}
+		if long != nil {
+			return nil, errors.New("cannot split more than one long in list")
+		}
+		long = &lists[i]
+	}
+	if long == nil {
+		return []*parse.SelectQuery{q}, nil
+	}
+
+	var queries []*parse.SelectQuery
+	for start := 0; start < len(long.values); start += maxInValues {
+		end := start + maxInValues
+		if end > len(long.values) {
+			end = len(long.values)
+		}
+		batch := append([]string(nil), whereClause[:long.open+1]...)
+		for i, value := range long.values[start:end] {
+			if i > 0 {
+				batch = append(batch, ",", " ")
+			}
+			batch = append(batch, value...)
+		}
+		batch = append(batch, whereClause[long.close:]...)
+		query := *q
+		query.WhereClause = batch
+		queries = append(queries, &query)
+	}
+	return queries, nil
+}
+
+// orderBy describes the order by clause of a where clause.
+type orderBy struct {
+	column string // blank if there is no order by clause
+	desc   bool
+}
+
+// parseOrderBy returns the order by clause in the lexemes of a where clause.
+func parseOrderBy(whereClause []string) orderBy {
+	var lexemes []string
+	for _, lexeme := range whereClause {
+		if lexeme != " " {
+			lexemes = append(lexemes, lexeme)
+		}
+	}
+	var ob orderBy
+	for i := 0; i < len(lexemes); i++ {
+		if !strings.EqualFold(lexemes[i], "order") {
+			continue
+		}
+		if i+2 >= len(lexemes) || !strings.EqualFold(lexemes[i+1], "by") {
+			continue
+		}
+		i += 2
+		ob.column = lex.Unquote(lexemes[i])
+		if strings.EqualFold(ob.column, "itemName") {
+			// "itemName()" is equivalent to "id"
+			ob.column = "id"
+			i += 2
+		}
+		if i+1 < len(lexemes) && strings.EqualFold(lexemes[i+1], "desc") {
+			ob.desc = true
+			i++
+		}
+	}
+	return ob
+}
+
+// sortValue returns the value that SimpleDB sorts an item by.
+func (ob orderBy) sortValue(item *simpledb.Item) string {
+	if parse.IsID(ob.column) {
+		return derefString(item.Name)
+	}
+	for _, attr := range item.Attributes {
+		if derefString(attr.Name) == ob.column {
+			return derefString(attr.Value)
+		}
+	}
+	return ""
+}
+
+// sortQuery returns a query that also selects the order by column, if
+// the query does not select it, so that the batches can be merged in
+// order. The column is not returned, because the rows only return the
+// columns of the original query.
+func (ob orderBy) sortQuery(q *parse.SelectQuery) *parse.SelectQuery {
+	if ob.column == "" || parse.IsID(ob.column) || q.AllColumns {
+		return q
+	}
+	for _, columnName := range q.ColumnNames {
+		if columnName == ob.column {
+			return q
+		}
+	}
+	query := *q
+	query.ColumnNames = append(append([]string(nil), q.ColumnNames...), ob.column)
+	return &query
+}
+
+// before returns true if item a sorts before item b.
+func (ob orderBy) before(a, b *simpledb.Item) bool {
+	if ob.desc {
+		return ob.sortValue(a) > ob.sortValue(b)
+	}
+	return ob.sortValue(a) < ob.sortValue(b)
+}
+
+// batchRows implements the sql.Rows interface for a select query whose long
+// in list is split into batches. Without an order by clause, each batch is
+// selected after the previous batch has been read. With an order by clause,
+// each batch is sorted by SimpleDB, and the batches are merged so that the
+// rows are in order. Items selected by more than one batch are only returned
+// once. A limit clause is the page size of each batch's select, as it is for
+// other select queries, and does not limit the number of merged rows.
+type batchRows struct {
+	ctx     context.Context
+	cm      columnMap
+	batches []*batchStream
+	order   orderBy
+	guard   *selectGuard
+	seen    map[string]bool // names of items returned
+}
+
+// batchStream is the result of the select query for one batch.
+type batchStream struct {
+	rows    *selectQueryRows
+	started bool
+	head    *simpledb.Item // next item, if read but not yet returned
+	done    bool
+}
+
+// peek returns the next item of the batch without consuming it. The first
+// page of results is selected when the item is first requested.
+func (bs *batchStream) peek() (*simpledb.Item, error) {
+	if bs.head != nil || bs.done {
+		return bs.head, nil
+	}
+	if !bs.started {
+		bs.started = true
+		if err := bs.rows.selectNext(); err != nil {
+			return nil, err
+		}
+	}
+	item, err := bs.rows.nextItem()
+	if err == io.EOF {
+		bs.done = true
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	bs.head = item
+	return item, nil
+}
+
+// selectBatches runs a select query for each batch of a long in list.
+func (c *conn) selectBatches(ctx context.Context, queries []*parse.SelectQuery, args []driver.Value) (driver.Rows, error) {
+	rows := &batchRows{
+		ctx:   ctx,
+		order: parseOrderBy(queries[0].WhereClause),
+		guard: c.newSelectGuard(queries[0]),
+		seen:  make(map[string]bool),
+	}
+	rows.cm.setColumns(queries[0].ColumnNames, c.meta)
+	repair, err := c.newRepairer(ctx, queries[0].TableName)
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range queries {
+		selectExpression, err := c.makeSelectExpression(ctx, rows.order.sortQuery(q), args)
+		if err != nil {
+			return nil, err
+		}
+		selectInput := &simpledb.SelectInput{
+			ConsistentRead:   aws.Bool(q.ConsistentRead),
+			SelectExpression: aws.String(selectExpression),
+		}
+		batch := newRows(ctx, c.SimpleDB, q.ColumnNames, c.meta, selectInput)
+		batch.ttl = c.newTTLFilter()
+		batch.guard = rows.guard
+		batch.repair = repair
+		rows.batches = append(rows.batches, &batchStream{rows: batch})
+	}
+	// report an error selecting the first batch when the query is run
+	if _, err := rows.batches[0].peek(); err != nil {
+		return nil, rows.guard.deadlineError(ctx, err)
+	}
+	return rows, nil
+}
+
+func (rows *batchRows) Columns() []string {
+	return rows.cm.columns
+}
+
+func (rows *batchRows) Close() error {
+	rows.batches = nil
+	return nil
+}
+
+func (rows *batchRows) Next(dest []driver.Value) error {
+	for {
+		item, err := rows.nextItem()
+		if err == io.EOF {
+			return err
+		}
+		if err != nil {
+			return rows.guard.deadlineError(rows.ctx, err)
+		}
+		if rows.seen[derefString(item.Name)] {
+			continue
+		}
+		rows.seen[derefString(item.Name)] = true
+		if err := rows.guard.row(); err != nil {
+			return err
+		}
+		rows.cm.setValues(item, dest)
+		return nil
+	}
+}
+
+// nextItem returns the next item from the batches. Without an order by
+// clause, it is the next item of the first batch that has not been read.
+// Otherwise it is the first item in order of the next items of all batches.
+func (rows *batchRows) nextItem() (*simpledb.Item, error) {
+	var next *batchStream
+	for _, batch := range rows.batches {
+		item, err := batch.peek()
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			continue
+		}
+		if rows.order.column == "" {
+			next = batch
+			break
+		}
+		if next == nil || rows.order.before(item, next.head) {
+			next = batch
+		}
+	}
+	if next == nil {
+		return nil, io.EOF
+	}
+	item := next.head
+	next.head = nil
+	return item, nil
+}
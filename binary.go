@@ -0,0 +1,29 @@
+package simpledbsql
+
+import (
+	"encoding/ascii85"
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+)
+
+// ascii85Encoding is the qualifier of the type of binary values that are
+// Ascii85 encoded. Binary values without a qualifier are base64 encoded.
+const ascii85Encoding = "ascii85"
+
+// encodeCompactBinary returns the type name and attribute value for a binary
+// value, using whichever of base64 and Ascii85 encoding is shorter.
+func encodeCompactBinary(data []byte) (typeName string, value string) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	buf := make([]byte, ascii85.MaxEncodedLen(len(data)))
+	buf = buf[:ascii85.Encode(buf, data)]
+	if len(buf) < len(encoded) {
+		return "binary:" + ascii85Encoding, string(buf)
+	}
+	return "binary", encoded
+}
+
+// decodeASCII85 decodes a binary value written by encodeCompactBinary.
+func decodeASCII85(value string) ([]byte, error) {
+	return ioutil.ReadAll(ascii85.NewDecoder(strings.NewReader(value)))
+}
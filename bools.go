@@ -0,0 +1,82 @@
+package simpledbsql
+
+import (
+	"strings"
+)
+
+// translateBools returns the lexemes of a where clause with its boolean
+// shorthand predicates translated to comparisons with the stored encoding
+// of bool values:
+//
+//	flag      =>  flag = 'true'
+//	not flag  =>  flag = 'false'
+//
+// A column is a shorthand predicate if it is neither compared with a value
+// nor an argument of a function, such as "where a = 1 and flag".
+func translateBools(whereClause []string) []string {
+	var translated []string
+	prev := -1 // index in translated of the previous lexeme that is not white space
+	for i, lexeme := range whereClause {
+		if isBoolShorthand(whereClause, i) {
+			value := "'true'"
+			if prev >= 0 && strings.EqualFold(translated[prev], "not") {
+				translated = translated[:prev]
+				value = "'false'"
+			}
+			translated = append(translated, lexeme, " ", "=", " ", value)
+			prev = len(translated) - 1
+			continue
+		}
+		translated = append(translated, lexeme)
+		if !isSpaceLexeme(lexeme) {
+			prev = len(translated) - 1
+		}
+	}
+	return translated
+}
+
+// isBoolShorthand returns true if the lexeme at index i of a where clause is
+// a column that forms a predicate by itself.
+func isBoolShorthand(whereClause []string, i int) bool {
+	if !isIdentLexeme(whereClause[i]) || isIDLexeme(whereClause[i]) {
+		return false
+	}
+	prev := adjacentIndex(whereClause, i, -1)
+	if prev < 0 {
+		return false
+	}
+	switch strings.ToLower(whereClause[prev]) {
+	case "and":
+		// the upper bound of "between x and y" is a value, not a predicate
+		if j := adjacentIndex(whereClause, adjacentIndex(whereClause, prev, -1), -1); j >= 0 && strings.EqualFold(whereClause[j], "between") {
+			return false
+		}
+	case "where", "or", "not", "(":
+	default:
+		return false
+	}
+	next := adjacentIndex(whereClause, i, 1)
+	if next < 0 {
+		return true
+	}
+	switch strings.ToLower(whereClause[next]) {
+	case "and", "or", ")", "order", "limit":
+		return true
+	}
+	return false
+}
+
+// adjacentIndex returns the index of the nearest lexeme before (step -1) or
+// after (step 1) index i of a where clause that is not white space, or -1 if
+// there is none.
+func adjacentIndex(whereClause []string, i int, step int) int {
+	if i < 0 {
+		return -1
+	}
+	for j := i + step; j >= 0 && j < len(whereClause); j += step {
+		if !isSpaceLexeme(whereClause[j]) {
+			return j
+		}
+	}
+	return -1
+}
@@ -0,0 +1,126 @@
+package simpledbsql
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// BoxUsage accumulates the BoxUsage reported by SimpleDB for each
+// API call made while executing statements. BoxUsage is the measure
+// of machine hours that SimpleDB uses for billing, so it can be used
+// to attribute SimpleDB costs to individual statements.
+//
+// Attach a BoxUsage to a context using WithBoxUsage, and pass that
+// context to the QueryContext or ExecContext methods of sql.DB.
+// A BoxUsage is safe for concurrent use.
+type BoxUsage struct {
+	mutex    sync.Mutex
+	hours    float64
+	apiCalls int
+}
+
+// Hours returns the total machine hours reported by SimpleDB.
+func (u *BoxUsage) Hours() float64 {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.hours
+}
+
+// APICalls returns the number of SimpleDB API calls that have
+// reported a BoxUsage.
+func (u *BoxUsage) APICalls() int {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.apiCalls
+}
+
+// Reset sets the accumulated BoxUsage back to zero.
+func (u *BoxUsage) Reset() {
+	u.mutex.Lock()
+	u.hours = 0
+	u.apiCalls = 0
+	u.mutex.Unlock()
+}
+
+func (u *BoxUsage) add(hours float64) {
+	u.mutex.Lock()
+	u.hours += hours
+	u.apiCalls++
+	u.mutex.Unlock()
+}
+
+type boxUsageKeyT struct{}
+
+var boxUsageKey = boxUsageKeyT{}
+
+// WithBoxUsage returns a copy of ctx that accumulates the SimpleDB BoxUsage
+// for all statements executed using the returned context into u.
+func WithBoxUsage(ctx context.Context, u *BoxUsage) context.Context {
+	return context.WithValue(ctx, boxUsageKey, u)
+}
+
+// boxUsageFromContext returns the BoxUsage attached to ctx, or nil.
+func boxUsageFromContext(ctx context.Context) *BoxUsage {
+	u, _ := ctx.Value(boxUsageKey).(*BoxUsage)
+	return u
+}
+
+// boxUsageRegexp matches the BoxUsage element in both successful
+// and error responses from the SimpleDB API.
+var boxUsageRegexp = regexp.MustCompile(`<BoxUsage>\s*([0-9.eE+-]+)\s*</BoxUsage>`)
+
+// parseBoxUsage returns the total of all BoxUsage elements in the
+// XML response body.
+func parseBoxUsage(body []byte) (hours float64, ok bool) {
+	for _, match := range boxUsageRegexp.FindAllSubmatch(body, -1) {
+		v, err := strconv.ParseFloat(string(match[1]), 64)
+		if err != nil {
+			continue
+		}
+		hours += v
+		ok = true
+	}
+	return hours, ok
+}
+
+// requestOptions returns the AWS SDK request options to use for
+// each SimpleDB API call made using ctx.
+func requestOptions(ctx context.Context) []request.Option {
+	var opts []request.Option
+	if u := boxUsageFromContext(ctx); u != nil {
+		opts = append(opts, boxUsageOption(u.add))
+	}
+	if s := queryStatsFromContext(ctx); s != nil {
+		opts = append(opts, boxUsageOption(s.addBoxUsage))
+	}
+	return opts
+}
+
+// boxUsageOption returns an AWS SDK request option that reads the BoxUsage
+// from the SimpleDB response and passes it to add. The AWS SDK does not include BoxUsage in its
+// output structures, so the response body is read before it is unmarshaled
+// and then replaced so that unmarshaling proceeds as normal.
+func boxUsageOption(add func(hours float64)) request.Option {
+	return func(r *request.Request) {
+		r.Handlers.UnmarshalMeta.PushBack(func(r *request.Request) {
+			if r.HTTPResponse == nil || r.HTTPResponse.Body == nil {
+				return
+			}
+			body, err := ioutil.ReadAll(r.HTTPResponse.Body)
+			r.HTTPResponse.Body.Close()
+			r.HTTPResponse.Body = ioutil.NopCloser(bytes.NewReader(body))
+			if err != nil {
+				return
+			}
+			if hours, ok := parseBoxUsage(body); ok {
+				add(hours)
+			}
+		})
+	}
+}
@@ -0,0 +1,478 @@
+// Package builder builds SQL statements in the dialect of the simpledbsql
+// driver, for programs that prefer composing statements from method calls to
+// writing them as strings. Each builder quotes the table and column names it
+// is given, and its Build method checks the statement with the driver's parser,
+// so that a statement that builds without error is accepted by the driver.
+//
+// The predicates of a select statement are passed to Where as SQL expressions
+// with "?" placeholders, and several calls to Where are combined with "and".
+// Update and delete statements select their items by id, or by a subquery.
+//
+//	query, args, err := builder.Select("id", "name").
+//		From("users").
+//		Where("status in (?, ?)", "active", "pending").
+//		Where("name > ?", "m").
+//		OrderBy("name").
+//		Limit(10).
+//		Build()
+//	if err != nil {
+//		return err
+//	}
+//	rows, err := db.QueryContext(ctx, query, args...)
+//
+//	query, args, err = builder.Update("users").
+//		Set("status", "inactive").
+//		In(builder.Select("id").From("users").Where("expires < ?", now)).
+//		Build()
+//
+// Builders are not safe for concurrent use, and each method modifies the
+// builder it is called on, as well as returning it.
+package builder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jjeffery/simpledbsql/internal/lex"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// SelectBuilder builds a select statement.
+type SelectBuilder struct {
+	consistent bool
+	columns    []string
+	table      string
+	where      whereClause
+	orderBy    string
+	desc       bool
+	limit      int
+	err        error
+}
+
+// Select starts a select statement that returns the columns. A column can
+// be "*", or an aggregate function such as "count(*)" or "max(price)", which
+// are not quoted.
+func Select(columns ...string) *SelectBuilder {
+	return &SelectBuilder{columns: columns}
+}
+
+// Consistent causes the statement to perform a consistent read.
+func (b *SelectBuilder) Consistent() *SelectBuilder {
+	b.consistent = true
+	return b
+}
+
+// From sets the table to select from.
+func (b *SelectBuilder) From(table string) *SelectBuilder {
+	b.table = table
+	return b
+}
+
+// Where adds a predicate to the where clause, with an arg for each
+// placeholder in the predicate.
+func (b *SelectBuilder) Where(expr string, args ...interface{}) *SelectBuilder {
+	b.where.add(expr, args)
+	return b
+}
+
+// OrderBy sorts the rows by a column in ascending order. Unless the
+// connector sets ConstrainSortColumn, the where clause must have
+// a predicate on the column, such as "is not null".
+func (b *SelectBuilder) OrderBy(column string) *SelectBuilder {
+	b.orderBy = column
+	b.desc = false
+	return b
+}
+
+// OrderByDesc sorts the rows by a column in descending order.
+func (b *SelectBuilder) OrderByDesc(column string) *SelectBuilder {
+	b.orderBy = column
+	b.desc = true
+	return b
+}
+
+// Limit sets the limit clause, which SimpleDB treats as the
+// number of rows in each page of results.
+func (b *SelectBuilder) Limit(n int) *SelectBuilder {
+	if n < 1 && b.err == nil {
+		b.err = fmt.Errorf("invalid limit %d", n)
+	}
+	b.limit = n
+	return b
+}
+
+// Build returns the statement and its args, or an error if the
+// statement is not valid.
+func (b *SelectBuilder) Build() (string, []interface{}, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	if len(b.columns) == 0 {
+		return "", nil, fmt.Errorf("no columns to select")
+	}
+	if b.table == "" {
+		return "", nil, fmt.Errorf("missing table name")
+	}
+	if b.where.err != nil {
+		return "", nil, b.where.err
+	}
+	var sb strings.Builder
+	if b.consistent {
+		sb.WriteString("consistent ")
+	}
+	sb.WriteString("select ")
+	for i, column := range b.columns {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(quoteColumn(column))
+	}
+	sb.WriteString(" from ")
+	sb.WriteString(quoteTable(b.table))
+	b.where.writeTo(&sb)
+	if b.orderBy != "" {
+		sb.WriteString(" order by ")
+		sb.WriteString(quoteIdentifier(b.orderBy))
+		if b.desc {
+			sb.WriteString(" desc")
+		}
+	}
+	if b.limit > 0 {
+		sb.WriteString(" limit ")
+		sb.WriteString(strconv.Itoa(b.limit))
+	}
+	return build(sb.String(), b.where.args)
+}
+
+// InsertBuilder builds an insert statement.
+type InsertBuilder struct {
+	table   string
+	columns []string
+	args    []interface{}
+}
+
+// Insert starts an insert statement for a table. Unless the connector
+// has an IDGenerator, one of the columns set must be "id".
+func Insert(table string) *InsertBuilder {
+	return &InsertBuilder{table: table}
+}
+
+// Set sets the value of a column of the inserted row.
+func (b *InsertBuilder) Set(column string, value interface{}) *InsertBuilder {
+	b.columns = append(b.columns, column)
+	b.args = append(b.args, value)
+	return b
+}
+
+// Build returns the statement and its args, or an error if the
+// statement is not valid.
+func (b *InsertBuilder) Build() (string, []interface{}, error) {
+	if b.table == "" {
+		return "", nil, fmt.Errorf("missing table name")
+	}
+	if len(b.columns) == 0 {
+		return "", nil, fmt.Errorf("no columns to insert")
+	}
+	var sb strings.Builder
+	sb.WriteString("insert into ")
+	sb.WriteString(quoteTable(b.table))
+	sb.WriteString("(")
+	for i, column := range b.columns {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(quoteIdentifier(column))
+	}
+	sb.WriteString(") values (")
+	for i := range b.columns {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("?")
+	}
+	sb.WriteString(")")
+	return build(sb.String(), b.args)
+}
+
+// UpdateBuilder builds an update statement.
+type UpdateBuilder struct {
+	table   string
+	columns []string
+	args    []interface{}
+	key     keyClause
+}
+
+// Update starts an update statement for a table.
+func Update(table string) *UpdateBuilder {
+	return &UpdateBuilder{table: table}
+}
+
+// Set sets the value of a column of the updated rows.
+func (b *UpdateBuilder) Set(column string, value interface{}) *UpdateBuilder {
+	b.columns = append(b.columns, column)
+	b.args = append(b.args, value)
+	return b
+}
+
+// ID updates the item with the id.
+func (b *UpdateBuilder) ID(id interface{}) *UpdateBuilder {
+	b.key.id = id
+	return b
+}
+
+// In updates the items whose ids are selected by a subquery,
+// which must select the id column from the same table.
+func (b *UpdateBuilder) In(subquery *SelectBuilder) *UpdateBuilder {
+	b.key.subquery = subquery
+	return b
+}
+
+// If makes the update of the item with the id conditional on
+// the current value of a column.
+func (b *UpdateBuilder) If(column string, value interface{}) *UpdateBuilder {
+	b.key.ifColumn = column
+	b.key.ifValue = value
+	return b
+}
+
+// Build returns the statement and its args, or an error if the
+// statement is not valid.
+func (b *UpdateBuilder) Build() (string, []interface{}, error) {
+	if b.table == "" {
+		return "", nil, fmt.Errorf("missing table name")
+	}
+	if len(b.columns) == 0 {
+		return "", nil, fmt.Errorf("no columns to update")
+	}
+	var sb strings.Builder
+	sb.WriteString("update ")
+	sb.WriteString(quoteTable(b.table))
+	sb.WriteString(" set ")
+	for i, column := range b.columns {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(quoteIdentifier(column))
+		sb.WriteString(" = ?")
+	}
+	args := append([]interface{}{}, b.args...)
+	args, err := b.key.writeTo(&sb, args)
+	if err != nil {
+		return "", nil, err
+	}
+	return build(sb.String(), args)
+}
+
+// DeleteBuilder builds a delete statement.
+type DeleteBuilder struct {
+	table string
+	key   keyClause
+}
+
+// Delete starts a delete statement for a table.
+func Delete(table string) *DeleteBuilder {
+	return &DeleteBuilder{table: table}
+}
+
+// ID deletes the item with the id.
+func (b *DeleteBuilder) ID(id interface{}) *DeleteBuilder {
+	b.key.id = id
+	return b
+}
+
+// In deletes the items whose ids are selected by a subquery,
+// which must select the id column from the same table.
+func (b *DeleteBuilder) In(subquery *SelectBuilder) *DeleteBuilder {
+	b.key.subquery = subquery
+	return b
+}
+
+// If makes the delete of the item with the id conditional on
+// the current value of a column.
+func (b *DeleteBuilder) If(column string, value interface{}) *DeleteBuilder {
+	b.key.ifColumn = column
+	b.key.ifValue = value
+	return b
+}
+
+// Build returns the statement and its args, or an error if the
+// statement is not valid.
+func (b *DeleteBuilder) Build() (string, []interface{}, error) {
+	if b.table == "" {
+		return "", nil, fmt.Errorf("missing table name")
+	}
+	var sb strings.Builder
+	sb.WriteString("delete from ")
+	sb.WriteString(quoteTable(b.table))
+	args, err := b.key.writeTo(&sb, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return build(sb.String(), args)
+}
+
+// keyClause holds the where and if clauses of an update or delete
+// statement, which select the items by id or by subquery.
+type keyClause struct {
+	id       interface{}
+	subquery *SelectBuilder
+	ifColumn string
+	ifValue  interface{}
+}
+
+func (k *keyClause) writeTo(sb *strings.Builder, args []interface{}) ([]interface{}, error) {
+	switch {
+	case k.id != nil && k.subquery != nil:
+		return nil, fmt.Errorf("cannot use both an id and a subquery")
+	case k.id != nil:
+		sb.WriteString(" where id = ?")
+		args = append(args, k.id)
+		if k.ifColumn != "" {
+			sb.WriteString(" if ")
+			sb.WriteString(quoteIdentifier(k.ifColumn))
+			sb.WriteString(" = ?")
+			args = append(args, k.ifValue)
+		}
+	case k.subquery != nil:
+		if k.ifColumn != "" {
+			return nil, fmt.Errorf("cannot use if clause with subquery")
+		}
+		query, subargs, err := k.subquery.Build()
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString(" where id in (")
+		sb.WriteString(query)
+		sb.WriteString(")")
+		args = append(args, subargs...)
+	default:
+		return nil, fmt.Errorf("missing id or subquery")
+	}
+	return args, nil
+}
+
+// whereClause holds the predicates added by calls to Where.
+type whereClause struct {
+	exprs []string
+	args  []interface{}
+	err   error // first invalid predicate
+}
+
+func (w *whereClause) add(expr string, args []interface{}) {
+	if w.err != nil {
+		return
+	}
+	if err := checkExpr(expr, len(args)); err != nil {
+		w.err = err
+		return
+	}
+	w.exprs = append(w.exprs, strings.TrimSpace(expr))
+	w.args = append(w.args, args...)
+}
+
+func (w *whereClause) writeTo(sb *strings.Builder) {
+	if len(w.exprs) == 0 {
+		return
+	}
+	sb.WriteString(" where ")
+	if len(w.exprs) == 1 {
+		sb.WriteString(w.exprs[0])
+		return
+	}
+	for i, expr := range w.exprs {
+		if i > 0 {
+			sb.WriteString(" and ")
+		}
+		sb.WriteString("(")
+		sb.WriteString(expr)
+		sb.WriteString(")")
+	}
+}
+
+// checkExpr checks that a predicate passed to Where is a single
+// expression, which cannot change the statement outside its
+// parentheses, and that it has a placeholder for each arg.
+func checkExpr(expr string, args int) error {
+	scanner := lex.New(strings.NewReader(expr))
+	var depth, placeholders, words int
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch scanner.Token() {
+		case lex.TokenWhiteSpace:
+			continue
+		case lex.TokenComment:
+			return fmt.Errorf("unexpected comment in where predicate %q", expr)
+		case lex.TokenPlaceholder:
+			if text != "?" {
+				return fmt.Errorf("unexpected placeholder %q in where predicate %q, use ?", text, expr)
+			}
+			placeholders++
+		case lex.TokenKeyword, lex.TokenIdent:
+			switch strings.ToLower(text) {
+			case "select", "from", "order", "limit", "group":
+				return fmt.Errorf("unexpected %q in where predicate %q", text, expr)
+			}
+		case lex.TokenOperator:
+			switch text {
+			case "(":
+				depth++
+			case ")":
+				depth--
+				if depth < 0 {
+					return fmt.Errorf("unbalanced parentheses in where predicate %q", expr)
+				}
+			case ";":
+				return fmt.Errorf("unexpected %q in where predicate %q", text, expr)
+			}
+		}
+		words++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("invalid where predicate %q: %v", expr, err)
+	}
+	if words == 0 {
+		return fmt.Errorf("empty where predicate")
+	}
+	if depth != 0 {
+		return fmt.Errorf("unbalanced parentheses in where predicate %q", expr)
+	}
+	if placeholders != args {
+		return fmt.Errorf("where predicate %q has %d placeholders, but %d args", expr, placeholders, args)
+	}
+	return nil
+}
+
+// build checks a statement with the driver's parser.
+func build(query string, args []interface{}) (string, []interface{}, error) {
+	q, err := parse.Parse(query)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid statement %q: %v", query, err)
+	}
+	if q.Placeholders != len(args) {
+		return "", nil, fmt.Errorf("statement %q has %d placeholders, but %d args", query, q.Placeholders, len(args))
+	}
+	return query, args, nil
+}
+
+// quoteColumn quotes a column name in the output list of a select
+// statement. A "*", or an aggregate function, is not quoted.
+func quoteColumn(column string) string {
+	if column == "*" || strings.HasSuffix(column, ")") {
+		return column
+	}
+	return quoteIdentifier(column)
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// quoteTable quotes a table name. The "@" that marks a domain name
+// is not quoted.
+func quoteTable(table string) string {
+	if strings.HasPrefix(table, "@") {
+		return "@" + quoteIdentifier(table[1:])
+	}
+	return quoteIdentifier(table)
+}
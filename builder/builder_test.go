@@ -0,0 +1,212 @@
+package builder
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jjeffery/simpledbsql"
+	"github.com/jjeffery/simpledbsql/internal/fakesdb"
+)
+
+type builder interface {
+	Build() (string, []interface{}, error)
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		builder builder
+		query   string
+		args    []interface{}
+	}{
+		{
+			builder: Select("a", "b").From("tbl").Where("a > ?", 1).OrderBy("a").Limit(10),
+			query:   "select `a`, `b` from `tbl` where a > ? order by `a` limit 10",
+			args:    []interface{}{1},
+		},
+		{
+			builder: Select("id").Consistent().From("@dom").Where("a = ?", "x").Where("b in (?, ?) or c is null", 2, 3).OrderByDesc("b"),
+			query:   "consistent select `id` from @`dom` where (a = ?) and (b in (?, ?) or c is null) order by `b` desc",
+			args:    []interface{}{"x", 2, 3},
+		},
+		{
+			builder: Select("count(*)", "max(price)").From("orders"),
+			query:   "select count(*), max(price) from `orders`",
+		},
+		{
+			builder: Insert("tbl").Set("id", "ID1").Set("a", 1),
+			query:   "insert into `tbl`(`id`, `a`) values (?, ?)",
+			args:    []interface{}{"ID1", 1},
+		},
+		{
+			builder: Update("tbl").Set("a", 1).Set("b", "x").ID("ID1"),
+			query:   "update `tbl` set `a` = ?, `b` = ? where id = ?",
+			args:    []interface{}{1, "x", "ID1"},
+		},
+		{
+			builder: Update("tbl").Set("a", 1).ID("ID1").If("version", 3),
+			query:   "update `tbl` set `a` = ? where id = ? if `version` = ?",
+			args:    []interface{}{1, "ID1", 3},
+		},
+		{
+			builder: Update("tbl").Set("a", 1).In(Select("id").From("tbl").Where("b = ?", "x")),
+			query:   "update `tbl` set `a` = ? where id in (select `id` from `tbl` where b = ?)",
+			args:    []interface{}{1, "x"},
+		},
+		{
+			builder: Delete("tbl").ID("ID1"),
+			query:   "delete from `tbl` where id = ?",
+			args:    []interface{}{"ID1"},
+		},
+		{
+			builder: Delete("tbl").In(Select("id").From("tbl").Where("a = ?", "1").Where("b > ?", "2")),
+			query:   "delete from `tbl` where id in (select `id` from `tbl` where (a = ?) and (b > ?))",
+			args:    []interface{}{"1", "2"},
+		},
+	}
+	for i, tt := range tests {
+		query, args, err := tt.builder.Build()
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if got, want := query, tt.query; got != want {
+			t.Errorf("%d: got=%q\nwant=%q", i, got, want)
+		}
+		if got, want := args, tt.args; !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: got=%v, want=%v", i, got, want)
+		}
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		builder builder
+		errtext string
+	}{
+		{
+			builder: Select("a").Where("a = ?", 1),
+			errtext: "missing table name",
+		},
+		{
+			builder: Select().From("tbl"),
+			errtext: "no columns to select",
+		},
+		{
+			builder: Select("a").From("tbl").Limit(0),
+			errtext: "invalid limit 0",
+		},
+		{
+			builder: Select("a").From("tbl").Where("a = ? and b = ?", 1),
+			errtext: "has 2 placeholders, but 1 args",
+		},
+		{
+			builder: Select("a").From("tbl").Where("a = $1", 1),
+			errtext: `unexpected placeholder "$1"`,
+		},
+		{
+			builder: Select("a").From("tbl").Where("a = ? order by a", 1),
+			errtext: `unexpected "order"`,
+		},
+		{
+			builder: Select("a").From("tbl").Where("a = ?) or (b = ?", 1, 2),
+			errtext: "unbalanced parentheses",
+		},
+		{
+			builder: Select("a").From("tbl").Where("a = ?; drop table tbl", 1),
+			errtext: `unexpected ";"`,
+		},
+		{
+			builder: Select("a").From("tbl").Where(" "),
+			errtext: "empty where predicate",
+		},
+		{
+			builder: Insert("tbl").Set("id", 1).Set("id", 2),
+			errtext: "invalid statement",
+		},
+		{
+			builder: Update("tbl").Set("a", 1),
+			errtext: "missing id or subquery",
+		},
+		{
+			builder: Delete("tbl").ID("ID1").In(Select("id").From("tbl")),
+			errtext: "cannot use both an id and a subquery",
+		},
+		{
+			builder: Delete("tbl").In(Select("id").From("tbl")).If("a", 1),
+			errtext: "cannot use if clause with subquery",
+		},
+		{
+			builder: Delete("tbl").In(Select("a").From("other")),
+			errtext: "invalid statement",
+		},
+		{
+			builder: Update("tbl").ID("ID1"),
+			errtext: "no columns to update",
+		},
+		{
+			builder: Insert("tbl"),
+			errtext: "no columns to insert",
+		},
+	}
+	for i, tt := range tests {
+		_, _, err := tt.builder.Build()
+		if err == nil {
+			t.Errorf("%d: got nil, want error", i)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.errtext) {
+			t.Errorf("%d: got=%q, want containing %q", i, err.Error(), tt.errtext)
+		}
+	}
+}
+
+func TestBuildQuery(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&simpledbsql.Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, "create table users"); err != nil {
+		t.Fatal(err)
+	}
+	exec := func(b builder) {
+		t.Helper()
+		query, args, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.ExecContext(ctx, query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec(Insert("users").Set("id", "U1").Set("name", "alice").Set("age", 30))
+	exec(Insert("users").Set("id", "U2").Set("name", "bob").Set("age", 20))
+	exec(Insert("users").Set("id", "U3").Set("name", "carol").Set("age", 40))
+	exec(Update("users").Set("name", "robert").ID("U2"))
+	exec(Delete("users").ID("U3"))
+
+	query, args, err := Select("id", "name").Consistent().From("users").Where("name > ?", "a").OrderByDesc("name").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, id+"="+name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"U2=robert", "U1=alice"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
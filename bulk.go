@@ -0,0 +1,204 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// bulkMaxRetries is the number of times a failed batch request of a bulk
+// update is retried, if the error indicates that it can succeed.
+const bulkMaxRetries = 3
+
+// BulkProgress describes the progress of an update or delete statement whose
+// where clause has a subquery. It is passed to the OnBulkProgress hook of the
+// Connector after each batch of items is modified.
+type BulkProgress struct {
+	Table     string // table name in the statement
+	Operation string // "update" or "delete"
+	Count     int    // number of items modified so far
+	Total     int    // number of items selected by the subquery
+}
+
+// selectSubqueryIDs returns the names of the items selected by the subquery
+// of an update or delete statement, using a consistent read. All of the names
+// are selected before any item is modified, so that modifying items does not
+// affect the pages of the select. The schema item and expired items are not
+// selected.
+func (c *conn) selectSubqueryIDs(ctx context.Context, q *parse.SelectQuery, ordinal int, args []driver.Value) ([]*string, error) {
+	if ordinal > len(args) {
+		return nil, errors.New("not enough args for select query")
+	}
+	selectExpression, err := c.makeSelectExpression(ctx, q, args[ordinal:])
+	if err != nil {
+		return nil, err
+	}
+	input := &simpledb.SelectInput{
+		ConsistentRead:   aws.Bool(true),
+		SelectExpression: aws.String(selectExpression),
+	}
+	filter := c.newTTLFilter()
+	var names []*string
+	err = c.selectPages(ctx, input, func(items []*simpledb.Item) error {
+		for _, item := range items {
+			if !isSchemaItem(item) && !filter.expired(item) {
+				names = append(names, item.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot select subquery").With(
+			"table", q.TableName,
+		)
+	}
+	return names, nil
+}
+
+// bulkUpdate runs an update statement whose where clause has a subquery. The
+// attributes of the update are put and deleted in batches of items, using the
+// SimpleDB BatchPutAttributes and BatchDeleteAttributes APIs. Batch requests
+// have no conditions, so an item deleted after it is selected is put again
+// with the attributes of the update.
+func (c *conn) bulkUpdate(ctx context.Context, q *parse.UpdateQuery, args []driver.Value) (*resultT, error) {
+	if c.meta.checksum || c.meta.packed {
+		// each item's attributes depend on those it already has
+		return nil, errors.New("subquery is not supported with checksums or packed metadata")
+	}
+	if err := c.validateWrite(q.TableName, nil, q.Columns, args); err != nil {
+		return nil, err
+	}
+	// the attributes are the same for every item
+	putInput, deleteInput, err := c.newPutDeleteInputs(ctx, q.TableName, q.Columns, parse.Key{Value: aws.String("")}, args)
+	if err != nil {
+		return nil, err
+	}
+	if c.meta.txn && len(putInput.Attributes) > 0 && len(deleteInput.Attributes) > 0 {
+		return nil, errors.New("subquery cannot set columns to null with two-phase updates")
+	}
+	names, err := c.selectSubqueryIDs(ctx, q.Subquery, q.SubqueryArgs, args)
+	if err != nil {
+		return nil, err
+	}
+	domainName := putInput.DomainName
+	var count int
+	for remaining := names; len(remaining) > 0; {
+		n := len(remaining)
+		if n > maxBatchItems {
+			n = maxBatchItems
+		}
+		batch := remaining[:n]
+		remaining = remaining[n:]
+		old := make(map[string]map[string]interface{})
+		if c.hooks.AfterUpdate != nil {
+			for _, name := range batch {
+				if old[*name], err = c.oldColumnValues(ctx, q.TableName, *name, q.Columns); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if len(putInput.Attributes) > 0 {
+			input := &simpledb.BatchPutAttributesInput{DomainName: domainName}
+			for _, name := range batch {
+				input.Items = append(input.Items, &simpledb.ReplaceableItem{
+					Name:       name,
+					Attributes: putInput.Attributes,
+				})
+			}
+			err = c.batchPut(ctx, input, bulkMaxRetries)
+		}
+		if err == nil && len(deleteInput.Attributes) > 0 {
+			input := &simpledb.BatchDeleteAttributesInput{DomainName: domainName}
+			for _, name := range batch {
+				input.Items = append(input.Items, &simpledb.DeletableItem{
+					Name:       name,
+					Attributes: deleteInput.Attributes,
+				})
+			}
+			_, err = c.SimpleDB.BatchDeleteAttributesWithContext(ctx, input, requestOptions(ctx)...)
+		}
+		if err == nil && count == 0 {
+			err = c.recordSchema(ctx, domainName, putInput.Attributes)
+		}
+		for _, name := range batch {
+			c.invalidateItem(domainName, name)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot update items").With(
+				"table", q.TableName,
+				"count", count,
+			)
+		}
+		for _, name := range batch {
+			c.afterUpdate(ctx, q, domainName, name, args, old[*name])
+		}
+		count += len(batch)
+		c.bulkProgressed(ctx, q.TableName, "update", count, len(names))
+	}
+	return newResult(count), nil
+}
+
+// bulkDelete runs a delete statement whose where clause has a subquery. The
+// items are deleted in batches, using the SimpleDB BatchDeleteAttributes API.
+func (c *conn) bulkDelete(ctx context.Context, q *parse.DeleteQuery, args []driver.Value) (*resultT, error) {
+	domainName, err := c.resolveDomainName(ctx, q.TableName)
+	if err != nil {
+		return nil, err
+	}
+	names, err := c.selectSubqueryIDs(ctx, q.Subquery, q.SubqueryArgs, args)
+	if err != nil {
+		return nil, err
+	}
+	var count int
+	for remaining := names; len(remaining) > 0; {
+		n := len(remaining)
+		if n > maxBatchItems {
+			n = maxBatchItems
+		}
+		batch := remaining[:n]
+		remaining = remaining[n:]
+		old := make(map[string]map[string]interface{})
+		for _, name := range batch {
+			if old[*name], err = c.oldDeleteValues(ctx, q.TableName, *name); err != nil {
+				return nil, err
+			}
+		}
+		input := &simpledb.BatchDeleteAttributesInput{DomainName: aws.String(domainName)}
+		for _, name := range batch {
+			input.Items = append(input.Items, &simpledb.DeletableItem{Name: name})
+		}
+		_, err = c.SimpleDB.BatchDeleteAttributesWithContext(ctx, input, requestOptions(ctx)...)
+		for _, name := range batch {
+			c.invalidateItem(input.DomainName, name)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot delete items").With(
+				"table", q.TableName,
+				"count", count,
+			)
+		}
+		for _, name := range batch {
+			c.afterDelete(ctx, q, input.DomainName, name, old[*name])
+		}
+		count += len(batch)
+		c.bulkProgressed(ctx, q.TableName, "delete", count, len(names))
+	}
+	return newResult(count), nil
+}
+
+// bulkProgressed calls the OnBulkProgress hook, if any.
+func (c *conn) bulkProgressed(ctx context.Context, tableName string, operation string, count int, total int) {
+	if c.bulkProgress == nil {
+		return
+	}
+	c.bulkProgress(ctx, &BulkProgress{
+		Table:     tableName,
+		Operation: operation,
+		Count:     count,
+		Total:     total,
+	})
+}
@@ -0,0 +1,197 @@
+package simpledbsql
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/simpledb"
+)
+
+// ItemCache is a cache of SimpleDB items, which is consulted by select
+// statements of the form "select ... where id = ?" before calling the
+// SimpleDB GetAttributes API.
+//
+// The driver invalidates cached items whenever it modifies them, but it
+// cannot know about modifications made by other programs, so an ItemCache
+// is only suitable for items that are modified through the same Connector.
+// Consistent-read select statements always bypass the cache.
+type ItemCache interface {
+	// Get returns the cached attributes for an item. If ok is true and
+	// attrs is empty, then the item is cached as not existing.
+	Get(domainName, itemName string) (attrs []*simpledb.Attribute, ok bool)
+
+	// Put stores the attributes for an item. The consistentRead flag
+	// indicates whether the attributes were obtained using a consistent
+	// read, in which case they are known to be the latest values.
+	Put(domainName, itemName string, attrs []*simpledb.Attribute, consistentRead bool)
+
+	// Invalidate removes an item from the cache. It is called whenever
+	// the driver modifies the item.
+	Invalidate(domainName, itemName string)
+
+	// InvalidateDomain removes all items in a domain from the cache.
+	// It is called whenever the driver drops the domain.
+	InvalidateDomain(domainName string)
+}
+
+// LRUItemCache is an in-memory ItemCache that evicts the least recently
+// used items when it is full. It is safe for concurrent use.
+//
+// Because SimpleDB is eventually consistent, a read performed shortly after
+// a write can return the value prior to the write. For this reason
+// LRUItemCache ignores items obtained using an eventually consistent read
+// for a short time after the item has been invalidated.
+type LRUItemCache struct {
+	// Size is the maximum number of items in the cache.
+	// If not specified, defaults to 1000.
+	Size int
+
+	// TTL is the maximum duration that an item remains in the cache.
+	// If zero, items remain in the cache until evicted or invalidated.
+	TTL time.Duration
+
+	// ConsistencyWindow is the time after an item is invalidated during which
+	// eventually consistent reads of the item are not cached.
+	// If not specified, defaults to one second.
+	ConsistencyWindow time.Duration
+
+	mutex sync.Mutex
+	lru   *list.List
+	items map[itemKey]*list.Element
+
+	now func() time.Time // for testing
+}
+
+type itemKey struct {
+	domainName string
+	itemName   string
+}
+
+type cacheEntry struct {
+	key         itemKey
+	attrs       []*simpledb.Attribute
+	expires     time.Time // zero means never expires
+	invalidated bool      // if true, entry is a marker for an invalidated item
+}
+
+// checks that LRUItemCache implements the ItemCache interface
+var _ ItemCache = (*LRUItemCache)(nil)
+
+func (c *LRUItemCache) init() {
+	if c.lru == nil {
+		c.lru = list.New()
+		c.items = make(map[itemKey]*list.Element)
+	}
+	if c.now == nil {
+		c.now = time.Now
+	}
+}
+
+func (c *LRUItemCache) size() int {
+	if c.Size <= 0 {
+		return 1000
+	}
+	return c.Size
+}
+
+func (c *LRUItemCache) consistencyWindow() time.Duration {
+	if c.ConsistencyWindow <= 0 {
+		return time.Second
+	}
+	return c.ConsistencyWindow
+}
+
+// Get implements the ItemCache interface.
+func (c *LRUItemCache) Get(domainName, itemName string) ([]*simpledb.Attribute, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.init()
+	key := itemKey{domainName: domainName, itemName: itemName}
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if entry.invalidated {
+		return nil, false
+	}
+	if !entry.expires.IsZero() && c.now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.attrs, true
+}
+
+// Put implements the ItemCache interface.
+func (c *LRUItemCache) Put(domainName, itemName string, attrs []*simpledb.Attribute, consistentRead bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.init()
+	key := itemKey{domainName: domainName, itemName: itemName}
+	now := c.now()
+	entry := &cacheEntry{
+		key:   key,
+		attrs: attrs,
+	}
+	if c.TTL > 0 {
+		entry.expires = now.Add(c.TTL)
+	}
+	if elem, ok := c.items[key]; ok {
+		prev := elem.Value.(*cacheEntry)
+		if prev.invalidated && !consistentRead && now.Before(prev.expires) {
+			// an eventually consistent read might not include the
+			// change that caused the item to be invalidated
+			return
+		}
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.lru.PushFront(entry)
+	c.evict()
+}
+
+// Invalidate implements the ItemCache interface.
+func (c *LRUItemCache) Invalidate(domainName, itemName string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.init()
+	key := itemKey{domainName: domainName, itemName: itemName}
+	entry := &cacheEntry{
+		key:         key,
+		expires:     c.now().Add(c.consistencyWindow()),
+		invalidated: true,
+	}
+	if elem, ok := c.items[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.lru.PushFront(entry)
+	c.evict()
+}
+
+// InvalidateDomain implements the ItemCache interface.
+func (c *LRUItemCache) InvalidateDomain(domainName string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.init()
+	for key, elem := range c.items {
+		if key.domainName == domainName {
+			c.remove(elem)
+		}
+	}
+}
+
+func (c *LRUItemCache) evict() {
+	for c.lru.Len() > c.size() {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *LRUItemCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.items, entry.key)
+}
@@ -0,0 +1,86 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// newIfCondition returns the condition of the requests of an update or delete
+// statement with an "if col = value" clause, which is that the column's attribute has
+// the value, encoded as it would be written by an insert or update statement.
+func (c *conn) newIfCondition(col *parse.Column, args []driver.Value) (*simpledb.UpdateCondition, error) {
+	_, value, err := c.encodeColumnValue(*col, args)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		// SimpleDB does not store null values or empty strings
+		return nil, errors.New("if clause cannot expect a null or empty value").With(
+			"column", col.ColumnName,
+		)
+	}
+	return &simpledb.UpdateCondition{
+		Name:  aws.String(col.ColumnName),
+		Value: aws.String(value),
+	}, nil
+}
+
+// updateConditionalRow updates an item using an update statement with an
+// "if" clause. Both the put and delete requests have the condition of the
+// clause, so they are sent one after the other, with the request that changes
+// the column of the clause sent last. If the first request's condition fails,
+// the item is unchanged, and no rows are affected.
+func (c *conn) updateConditionalRow(ctx context.Context, q *parse.UpdateQuery, args []driver.Value, putInput *simpledb.PutAttributesInput, deleteInput *simpledb.DeleteAttributesInput, old map[string]interface{}) (*resultT, error) {
+	put := func() error {
+		_, err := c.SimpleDB.PutAttributesWithContext(ctx, putInput, requestOptions(ctx)...)
+		return err
+	}
+	del := func() error {
+		_, err := c.SimpleDB.DeleteAttributesWithContext(ctx, deleteInput, requestOptions(ctx)...)
+		return err
+	}
+	var requests []func() error
+	if len(putInput.Attributes) > 0 {
+		requests = append(requests, put)
+	}
+	if len(deleteInput.Attributes) > 0 {
+		if deletesAttribute(deleteInput, q.If.ColumnName) {
+			requests = append(requests, del)
+		} else {
+			requests = append([]func() error{del}, requests...)
+		}
+	}
+	for i, request := range requests {
+		err := request()
+		c.invalidateItem(putInput.DomainName, putInput.ItemName)
+		if err != nil {
+			if i == 0 && (hasCode(err, conditionalCheckFailed) || hasCode(err, attributeDoesNotExist)) {
+				// not an error, the item does not have the expected value
+				return newResult(0), nil
+			}
+			return nil, errors.Wrap(err, "cannot update item").With(
+				"itemName", c.redact(derefString(putInput.ItemName)),
+			)
+		}
+	}
+	if err := c.recordSchema(ctx, putInput.DomainName, putInput.Attributes); err != nil {
+		return nil, err
+	}
+	c.afterUpdate(ctx, q, putInput.DomainName, putInput.ItemName, args, old)
+	return newResult(1), nil
+}
+
+// deletesAttribute returns true if a delete request deletes the named attribute.
+func deletesAttribute(input *simpledb.DeleteAttributesInput, name string) bool {
+	for _, attr := range input.Attributes {
+		if derefString(attr.Name) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package simpledbsql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"hash"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// checksumColumn is the name of the checksum attribute without the
+// metadata prefix. It cannot be the name of a column with type attributes.
+const checksumColumn = "checksum"
+
+// ChecksumMismatch describes an item whose checksum does not match its
+// attributes, which usually means that an update was interrupted after
+// some of its requests succeeded. It is passed to the OnChecksumMismatch
+// hook of the Connector.
+type ChecksumMismatch struct {
+	Table    string // table name in the statement
+	ID       string // item name
+	Expected string // checksum recorded in the item
+	Actual   string // checksum of the item's attributes
+}
+
+// checksumAttr returns the name of the attribute containing the checksum.
+func (m metadata) checksumAttr() string {
+	return m.namePrefix() + checksumColumn
+}
+
+// attributeValues returns the values of attributes, keyed by attribute name.
+func attributeValues(attrs []*simpledb.Attribute) map[string][]string {
+	values := make(map[string][]string, len(attrs))
+	for _, attr := range attrs {
+		name := derefString(attr.Name)
+		values[name] = append(values[name], derefString(attr.Value))
+	}
+	return values
+}
+
+// mergeAttributes returns the values of an item's attributes after the
+// attributes of put and delete requests are applied.
+func mergeAttributes(values map[string][]string, put []*simpledb.ReplaceableAttribute, del []*simpledb.DeletableAttribute) map[string][]string {
+	merged := make(map[string][]string, len(values)+len(put))
+	for name, v := range values {
+		merged[name] = v
+	}
+	replaced := make(map[string]bool, len(put))
+	for _, attr := range put {
+		name := derefString(attr.Name)
+		if aws.BoolValue(attr.Replace) && !replaced[name] {
+			merged[name] = nil
+			replaced[name] = true
+		}
+		merged[name] = append(merged[name], derefString(attr.Value))
+	}
+	for _, attr := range del {
+		delete(merged, derefString(attr.Name))
+	}
+	return merged
+}
+
+// itemChecksum returns the checksum of an item's attributes, other than the
+// checksum attribute, the marker of a pending update and the lease of a lock.
+// It is the hex encoded SHA-256 hash of the quoted names and values of the
+// attributes, in sorted order.
+func (m metadata) itemChecksum(values map[string][]string) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if name != m.checksumAttr() && !(m.txn && name == m.txnAttr()) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		v := append([]string(nil), values[name]...)
+		sort.Strings(v)
+		for _, value := range v {
+			if !m.isLease(name, value) {
+				writeChecksumLine(h, name, value)
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeChecksumLine(h hash.Hash, name string, value string) {
+	io.WriteString(h, strconv.Quote(name))
+	io.WriteString(h, "=")
+	io.WriteString(h, strconv.Quote(value))
+	io.WriteString(h, "\n")
+}
+
+// addChecksum returns the attributes of a put request with an attribute
+// containing the checksum of the item's attributes after the request.
+func (m metadata) addChecksum(attrs []*simpledb.ReplaceableAttribute, item map[string][]string) []*simpledb.ReplaceableAttribute {
+	return append(attrs, &simpledb.ReplaceableAttribute{
+		Name:    aws.String(m.checksumAttr()),
+		Value:   aws.String(m.itemChecksum(item)),
+		Replace: aws.Bool(true),
+	})
+}
+
+// checksumCondition returns the condition of the put request that updates
+// an item, which is that the item has not changed since it was read.
+func (m metadata) checksumCondition(values map[string][]string, exists bool) *simpledb.UpdateCondition {
+	if !exists {
+		return &simpledb.UpdateCondition{
+			Name:   aws.String(m.idAttr()),
+			Exists: aws.Bool(false),
+		}
+	}
+	if checksum := values[m.checksumAttr()]; len(checksum) > 0 {
+		return &simpledb.UpdateCondition{
+			Name:  aws.String(m.checksumAttr()),
+			Value: aws.String(checksum[0]),
+		}
+	}
+	// the item was written before checksums were enabled
+	return &simpledb.UpdateCondition{
+		Name:   aws.String(m.checksumAttr()),
+		Exists: aws.Bool(false),
+	}
+}
+
+// updateChecksumRow updates an item with a checksum. The item is read with a
+// consistent read, and the checksum is calculated from its attributes merged
+// with those of the update. The put request has a condition that the item's
+// checksum has not changed in the meantime. If it has, the update is retried.
+// The delete request, if any, is sent after the put request succeeds, so that
+// the item's checksum does not match if the delete request fails.
+func (c *conn) updateChecksumRow(ctx context.Context, q *parse.UpdateQuery, args []driver.Value, old map[string]interface{}) (*resultT, error) {
+	putInput, deleteInput, err := c.newUpdateInputs(ctx, q, args)
+	if err != nil {
+		return nil, err
+	}
+	attrs := putInput.Attributes
+	var marker *simpledb.ReplaceableAttribute
+	if c.meta.txn && len(deleteInput.Attributes) > 0 {
+		if marker, err = c.meta.pendingMarker(deleteInput.Attributes); err != nil {
+			return nil, err
+		}
+	}
+	for retry := 0; ; retry++ {
+		values, err := c.getItemValues(ctx, putInput.DomainName, putInput.ItemName)
+		if err != nil {
+			return nil, err
+		}
+		_, exists := values[c.meta.idAttr()]
+		if !exists && !q.Upsert {
+			return newResult(0), nil
+		}
+		var oldTypes string
+		if packed := values[c.meta.packedAttr()]; len(packed) > 0 {
+			oldTypes = packed[0]
+		}
+		if putInput.Attributes, err = c.meta.pack(attrs, oldTypes); err != nil {
+			return nil, err
+		}
+		item := mergeAttributes(values, putInput.Attributes, deleteInput.Attributes)
+		putInput.Attributes = c.meta.addChecksum(putInput.Attributes, item)
+		if marker != nil {
+			putInput.Attributes = append(putInput.Attributes, marker)
+		}
+		putInput.Expected = c.meta.checksumCondition(values, exists)
+		_, err = c.SimpleDB.PutAttributesWithContext(ctx, putInput, requestOptions(ctx)...)
+		c.invalidateItem(putInput.DomainName, putInput.ItemName)
+		if err == nil {
+			break
+		}
+		retryable := hasCode(err, conditionalCheckFailed) || hasCode(err, attributeDoesNotExist)
+		if !retryable || retry >= maxPackedRetries {
+			return nil, errors.Wrap(err, "cannot put attributes").With(
+				"itemName", c.redact(derefString(putInput.ItemName)),
+			)
+		}
+	}
+	deleteInput.Expected = nil
+	if marker != nil {
+		if err := c.deletePending(ctx, deleteInput, marker); err != nil {
+			return nil, err
+		}
+	} else if len(deleteInput.Attributes) > 0 {
+		_, err = c.SimpleDB.DeleteAttributesWithContext(ctx, deleteInput, requestOptions(ctx)...)
+		c.invalidateItem(deleteInput.DomainName, deleteInput.ItemName)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot delete attributes").With(
+				"itemName", c.redact(derefString(deleteInput.ItemName)),
+			)
+		}
+	}
+	if err := c.recordSchema(ctx, putInput.DomainName, putInput.Attributes); err != nil {
+		return nil, err
+	}
+	c.afterUpdate(ctx, q, putInput.DomainName, putInput.ItemName, args, old)
+	return newResult(1), nil
+}
+
+// getItemValues returns the values of all of an item's attributes, using a
+// consistent read. There are no values if the item does not exist.
+func (c *conn) getItemValues(ctx context.Context, domainName *string, itemName *string) (map[string][]string, error) {
+	input := &simpledb.GetAttributesInput{
+		DomainName:     domainName,
+		ItemName:       itemName,
+		ConsistentRead: aws.Bool(true),
+	}
+	output, err := c.SimpleDB.GetAttributesWithContext(ctx, input, requestOptions(ctx)...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get item").With(
+			"itemName", c.redact(derefString(itemName)),
+		)
+	}
+	return attributeValues(output.Attributes), nil
+}
+
+// verifyChecksum calls the OnChecksumMismatch hook if the checksum of an item
+// does not match its attributes. The item must have all of its attributes.
+// Items without a checksum, such as those written by Load, are not verified.
+func (c *conn) verifyChecksum(ctx context.Context, tableName string, item *simpledb.Item) {
+	if !c.meta.checksum || c.checksumMismatch == nil {
+		return
+	}
+	values := attributeValues(c.meta.completeItem(item).Attributes)
+	expected := values[c.meta.checksumAttr()]
+	if len(expected) == 0 {
+		return
+	}
+	if actual := c.meta.itemChecksum(values); actual != expected[0] {
+		c.checksumMismatch(ctx, &ChecksumMismatch{
+			Table:    tableName,
+			ID:       derefString(item.Name),
+			Expected: expected[0],
+			Actual:   actual,
+		})
+	}
+}
@@ -0,0 +1,348 @@
+// Package client reads and writes SimpleDB items as structs, without the
+// database/sql package. It uses the parser and encodings of the simpledbsql
+// driver, so items written by the client can be read by SQL statements, and
+// vice versa, but it avoids the overhead of a connection pool and of scanning
+// rows. It suits services that want typed results and control over paging.
+//
+// Each column is stored in the struct field with a matching "sql" struct tag,
+// or if there is no such field, the exported field whose name matches the
+// column name ignoring case. Fields without a tag are written to the column
+// named by the lowercased field name. Fields tagged `sql:"-"` are ignored, as
+// are columns without a matching field. Every struct must have a field for
+// the "id" column, which is the item name.
+//
+//	type User struct {
+//		ID   string `sql:"id"`
+//		Name string `sql:"name"`
+//		Age  *int64 `sql:"age"` // nil if null
+//	}
+//
+//	c := client.New(connector)
+//	err := c.PutItem(ctx, "users", &User{ID: "U1", Name: "alice"})
+//
+//	var user User
+//	found, err := c.GetItem(ctx, "users", "U1", &user)
+package client
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jjeffery/simpledbsql"
+)
+
+// Client reads and writes the items of SimpleDB tables as structs.
+type Client struct {
+	// ConsistentRead, if true, causes GetItem to perform a consistent read.
+	// Select and SelectPage queries request consistent reads themselves.
+	ConsistentRead bool
+
+	connector *simpledbsql.Connector
+}
+
+// New returns a client that uses the connector's SimpleDB API and options,
+// such as its table name resolution, metadata and hooks.
+func New(connector *simpledbsql.Connector) *Client {
+	return &Client{connector: connector}
+}
+
+// GetItem reads the item with the id from a table into the struct that dest
+// points to. It returns false if the item does not exist, in which case dest
+// is unchanged.
+func (c *Client) GetItem(ctx context.Context, table string, id string, dest interface{}) (bool, error) {
+	v, err := structValue(dest)
+	if err != nil {
+		return false, err
+	}
+	query := "select * from " + quoteTable(table) + " where id = ?"
+	if c.ConsistentRead {
+		query = "consistent " + query
+	}
+	rows, err := c.connector.QueryMaps(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	if err := setFields(v, rows.Map()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PutItem writes the fields of the struct that src points to as an item in
+// a table, creating the item if it does not exist. Columns whose fields are
+// nil pointers are set to null, and columns without fields are unchanged.
+func (c *Client) PutItem(ctx context.Context, table string, src interface{}) error {
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("expect struct or pointer to struct, got %T", src)
+	}
+	fields := fieldsOf(v.Type())
+	idIndex, ok := fields.lookup("id")
+	if !ok {
+		return fmt.Errorf("no field in %v for column %q", v.Type(), "id")
+	}
+	id, ok := v.FieldByIndex(idIndex).Interface().(string)
+	if !ok || id == "" {
+		return fmt.Errorf("id field of %v must be a non-blank string", v.Type())
+	}
+
+	var (
+		columns []string
+		args    []interface{}
+	)
+	for _, f := range fields {
+		if strings.EqualFold(f.column, "id") {
+			continue
+		}
+		value, err := fieldValue(v.FieldByIndex(f.index))
+		if err != nil {
+			return fmt.Errorf("cannot get value of column %q: %v", f.column, err)
+		}
+		columns = append(columns, quoteIdentifier(f.column)+" = ?")
+		args = append(args, value)
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("no columns in %v other than id", v.Type())
+	}
+	query := "upsert " + quoteTable(table) +
+		" set " + strings.Join(columns, ", ") +
+		" where id = ?"
+	_, err := c.connector.Exec(ctx, query, append(args, id)...)
+	return err
+}
+
+// DeleteItem deletes the item with the id from a table.
+func (c *Client) DeleteItem(ctx context.Context, table string, id string) error {
+	_, err := c.connector.Exec(ctx, "delete from "+quoteTable(table)+" where id = ?", id)
+	return err
+}
+
+// Select runs a select query and appends each row to the slice that dest
+// points to, whose elements are structs or pointers to structs. Unlike the
+// QueryContext method of a sql.DB, Select accepts "select *" queries.
+func (c *Client) Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	slice, err := sliceValue(dest)
+	if err != nil {
+		return err
+	}
+	rows, err := c.connector.QueryMaps(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := appendRow(slice, rows.Map()); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// SelectPage runs a select query and appends a page of at most limit rows
+// to the slice that dest points to, in order of id, starting after the row
+// whose id is cursor. It returns the cursor of the next page, which is blank
+// if there are no more rows. See Connector.QueryPage for the form of the
+// query and its limit.
+func (c *Client) SelectPage(ctx context.Context, dest interface{}, query string, cursor string, limit int, args ...interface{}) (string, error) {
+	slice, err := sliceValue(dest)
+	if err != nil {
+		return "", err
+	}
+	page, err := c.connector.QueryPage(ctx, query, cursor, limit, args...)
+	if err != nil {
+		return "", err
+	}
+	for _, row := range page.Rows {
+		if err := appendRow(slice, row); err != nil {
+			return "", err
+		}
+	}
+	return page.Next, nil
+}
+
+// structValue returns the struct that dest points to.
+func structValue(dest interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("expect pointer to struct, got %T", dest)
+	}
+	return v.Elem(), nil
+}
+
+// sliceValue returns the slice that dest points to.
+func sliceValue(dest interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return reflect.Value{}, fmt.Errorf("expect pointer to slice, got %T", dest)
+	}
+	elem := v.Elem().Type().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("expect slice of structs, got %T", dest)
+	}
+	return v.Elem(), nil
+}
+
+// appendRow appends a struct containing the values of a row to a slice.
+func appendRow(slice reflect.Value, row map[string]interface{}) error {
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	elem := reflect.New(elemType)
+	if err := setFields(elem.Elem(), row); err != nil {
+		return err
+	}
+	if !isPtr {
+		elem = elem.Elem()
+	}
+	slice.Set(reflect.Append(slice, elem))
+	return nil
+}
+
+// field is a struct field that contains a column.
+type field struct {
+	column string
+	index  []int
+}
+
+type fields []field
+
+// fieldsOf returns the fields of a struct type that contain columns.
+func fieldsOf(typ reflect.Type) fields {
+	var fs fields
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" || f.Anonymous {
+			// unexported or embedded
+			continue
+		}
+		column := f.Tag.Get("sql")
+		switch column {
+		case "-":
+			continue
+		case "":
+			column = strings.ToLower(f.Name)
+		}
+		fs = append(fs, field{column: column, index: f.Index})
+	}
+	return fs
+}
+
+// lookup returns the index of the field for a column, which is the field
+// tagged with its name, or else the field whose name matches ignoring case.
+func (fs fields) lookup(column string) ([]int, bool) {
+	var index []int
+	for _, f := range fs {
+		if f.column == column {
+			return f.index, true
+		}
+		if index == nil && strings.EqualFold(f.column, column) {
+			index = f.index
+		}
+	}
+	return index, index != nil
+}
+
+// setFields sets the fields of a struct to the values of a row.
+func setFields(v reflect.Value, row map[string]interface{}) error {
+	fs := fieldsOf(v.Type())
+	for column, value := range row {
+		index, ok := fs.lookup(column)
+		if !ok {
+			continue
+		}
+		if err := setField(v.FieldByIndex(index), value); err != nil {
+			return fmt.Errorf("cannot set field for column %q: %v", column, err)
+		}
+	}
+	return nil
+}
+
+// scanner is implemented by types such as sql.NullString and
+// simpledbsql.Decimal, which convert values themselves.
+type scanner interface {
+	Scan(src interface{}) error
+}
+
+// setField sets a struct field to a value decoded by the driver.
+func setField(f reflect.Value, value interface{}) error {
+	if s, ok := f.Addr().Interface().(scanner); ok {
+		return s.Scan(value)
+	}
+	if value == nil {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+	if f.Kind() == reflect.Ptr {
+		p := reflect.New(f.Type().Elem())
+		if err := setField(p.Elem(), value); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Type().AssignableTo(f.Type()):
+		f.Set(v)
+	case isNumber(v.Kind()) && isNumber(f.Kind()),
+		v.Kind() == f.Kind() && v.Type().ConvertibleTo(f.Type()):
+		// such as an int64 value for an int field
+		f.Set(v.Convert(f.Type()))
+	default:
+		return fmt.Errorf("cannot store %T in %v", value, f.Type())
+	}
+	return nil
+}
+
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// fieldValue returns the value of a struct field as an argument for the
+// driver, which is nil for a nil pointer.
+func fieldValue(f reflect.Value) (interface{}, error) {
+	if f.Kind() == reflect.Ptr && f.IsNil() {
+		return nil, nil
+	}
+	if valuer, ok := f.Interface().(driver.Valuer); ok {
+		return valuer.Value()
+	}
+	if f.Kind() == reflect.Ptr {
+		return fieldValue(f.Elem())
+	}
+	return f.Interface(), nil
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// quoteTable quotes a table name. The "@" that marks a domain name
+// is not quoted.
+func quoteTable(table string) string {
+	if strings.HasPrefix(table, "@") {
+		return "@" + quoteIdentifier(table[1:])
+	}
+	return quoteIdentifier(table)
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jjeffery/simpledbsql"
+	"github.com/jjeffery/simpledbsql/internal/fakesdb"
+)
+
+type user struct {
+	ID       string `sql:"id"`
+	Name     string
+	Age      *int64 `sql:"age"`
+	Balance  *simpledbsql.Decimal
+	Nickname sql.NullString
+	Created  time.Time
+	Ignored  string `sql:"-"`
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	connector := &simpledbsql.Connector{SimpleDB: fakesdb.New()}
+	if _, err := connector.Exec(ctx, "create table users"); err != nil {
+		t.Fatal(err)
+	}
+	c := New(connector)
+	c.ConsistentRead = true
+	created := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	age := int64(30)
+	balance := simpledbsql.Decimal("12.5")
+	users := []user{
+		{ID: "U1", Name: "alice", Age: &age, Balance: &balance, Created: created, Ignored: "x"},
+		{ID: "U2", Name: "bob", Nickname: sql.NullString{String: "bobby", Valid: true}, Created: created},
+		{ID: "U3", Name: "carol", Created: created},
+	}
+	for i := range users {
+		if err := c.PutItem(ctx, "users", &users[i]); err != nil {
+			t.Fatal(err)
+		}
+		users[i].Ignored = ""
+	}
+
+	var got user
+	found, err := c.GetItem(ctx, "users", "U1", &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatal("got not found, want found")
+	}
+	if want := users[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%+v\nwant=%+v", got, want)
+	}
+	found, err = c.GetItem(ctx, "users", "U9", &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Error("got found, want not found")
+	}
+
+	// setting a nil pointer deletes the column
+	users[0].Age = nil
+	if err := c.PutItem(ctx, "users", users[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	var all []*user
+	if err := c.Select(ctx, &all, "consistent select * from users where name >= ? order by name", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(all), 3; got != want {
+		t.Fatalf("got=%v, want=%v", got, want)
+	}
+	for i := range users {
+		if got, want := *all[i], users[i]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: got=%+v\nwant=%+v", i, got, want)
+		}
+	}
+
+	var page []user
+	cursor, err := c.SelectPage(ctx, &page, "consistent select id, name from users", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cursor, "U2"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	cursor, err = c.SelectPage(ctx, &page, "consistent select id, name from users", cursor, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cursor, ""; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	var names []string
+	for _, u := range page {
+		names = append(names, u.Name)
+	}
+	if got, want := names, []string{"alice", "bob", "carol"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	if err := c.DeleteItem(ctx, "users", "U2"); err != nil {
+		t.Fatal(err)
+	}
+	found, err = c.GetItem(ctx, "users", "U2", &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Error("got found, want deleted")
+	}
+}
+
+func TestPutItemErrors(t *testing.T) {
+	ctx := context.Background()
+	c := New(&simpledbsql.Connector{SimpleDB: fakesdb.New()})
+	tests := []struct {
+		src     interface{}
+		errtext string
+	}{
+		{
+			src:     "not a struct",
+			errtext: "expect struct or pointer to struct, got string",
+		},
+		{
+			src:     &struct{ Name string }{Name: "x"},
+			errtext: `no field in struct { Name string } for column "id"`,
+		},
+		{
+			src:     &user{Name: "x"},
+			errtext: "id field of client.user must be a non-blank string",
+		},
+	}
+	for tn, tt := range tests {
+		err := c.PutItem(ctx, "users", tt.src)
+		if err == nil {
+			t.Errorf("%d: got=nil, want=non-nil", tn)
+			continue
+		}
+		if got, want := err.Error(), tt.errtext; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+	}
+}
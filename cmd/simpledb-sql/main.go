@@ -0,0 +1,172 @@
+// Command simpledb-sql runs SQL statements against AWS SimpleDB using the
+// simpledbsql driver.
+//
+// Usage:
+//
+//	simpledb-sql [flags] [file.sql ...]
+//
+// Statements are read from each file in turn, or interactively from standard
+// input if no files are specified. Statements are separated by semicolons.
+// The results of select and explain statements are printed as tables.
+//
+// Statements can refer to parameters set with the -D flag. A parameter is
+// referred to by its name prefixed with a colon, and is passed to the driver
+// as a placeholder argument, so it does not need to be quoted:
+//
+//	simpledb-sql -D user=U123 <<EOF
+//	select id, name from users where id = :user;
+//	EOF
+//
+// In addition to the SQL supported by the driver, the following
+// statements are available:
+//
+//	show tables           -- list the tables in the schema
+//	describe table_name   -- list the columns of a table
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/simpledbsql"
+)
+
+// params is a flag.Value that collects parameters of the form name=value.
+type params map[string]string
+
+func (p params) String() string {
+	var list []string
+	for name, value := range p {
+		list = append(list, name+"="+value)
+	}
+	return strings.Join(list, ",")
+}
+
+func (p params) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("expect name=value, got %q", s)
+	}
+	p[s[:i]] = s[i+1:]
+	return nil
+}
+
+func main() {
+	var (
+		region = flag.String("region", "", "AWS region")
+		schema = flag.String("schema", "", "schema prefixed to table names")
+		dryRun = flag.Bool("dry-run", false, "do not send requests that modify SimpleDB")
+		params = params{}
+	)
+	flag.Var(params, "D", "set parameter `name=value`; may be repeated")
+	flag.Parse()
+
+	cfg := aws.NewConfig()
+	if *region != "" {
+		cfg = cfg.WithRegion(*region)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *cfg,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		fatal(err)
+	}
+	sdb := simpledb.New(sess)
+	connector := &simpledbsql.Connector{
+		SimpleDB: sdb,
+		Schema:   *schema,
+		DryRun:   *dryRun,
+	}
+	r := &runner{
+		db:     sql.OpenDB(connector),
+		sdb:    sdb,
+		schema: *schema,
+		params: params,
+		out:    os.Stdout,
+	}
+	defer r.db.Close()
+
+	ctx := context.Background()
+	if flag.NArg() == 0 {
+		r.interactive(ctx, os.Stdin)
+		return
+	}
+	for _, filename := range flag.Args() {
+		if err := r.runFile(ctx, filename); err != nil {
+			fatal(err)
+		}
+	}
+}
+
+func (r *runner) runFile(ctx context.Context, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	stmts, err := splitStatements(string(data))
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	for i, stmt := range stmts {
+		if err := r.run(ctx, stmt); err != nil {
+			return fmt.Errorf("%s: statement %d: %v", filename, i+1, err)
+		}
+	}
+	return nil
+}
+
+// interactive reads statements from in until end of file. Errors are
+// printed, and do not stop subsequent statements from running.
+func (r *runner) interactive(ctx context.Context, in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	var buf strings.Builder
+	prompt := func() {
+		if buf.Len() == 0 {
+			fmt.Fprint(os.Stderr, "simpledb> ")
+		} else {
+			fmt.Fprint(os.Stderr, "       -> ")
+		}
+	}
+	prompt()
+	for scanner.Scan() {
+		buf.WriteString(scanner.Text())
+		buf.WriteString("\n")
+		if !strings.HasSuffix(strings.TrimSpace(scanner.Text()), ";") {
+			prompt()
+			continue
+		}
+		stmts, err := splitStatements(buf.String())
+		buf.Reset()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		for _, stmt := range stmts {
+			if err := r.run(ctx, stmt); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+			}
+		}
+		prompt()
+	}
+	fmt.Fprintln(os.Stderr)
+	if strings.TrimSpace(buf.String()) != "" {
+		if err := r.run(ctx, buf.String()); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "simpledb-sql:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
+	"github.com/jjeffery/simpledbsql"
+	"github.com/jjeffery/simpledbsql/internal/lex"
+)
+
+// runner runs statements and prints their results.
+type runner struct {
+	db     *sql.DB
+	sdb    simpledbiface.SimpleDBAPI
+	schema string
+	params map[string]string
+	out    io.Writer
+}
+
+// run runs a single statement.
+func (r *runner) run(ctx context.Context, stmt string) error {
+	query, args, err := substituteParams(stmt, r.params)
+	if err != nil {
+		return err
+	}
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return nil
+	}
+	switch words[0] {
+	case "show":
+		if len(words) == 2 && words[1] == "tables" {
+			return r.showTables(ctx)
+		}
+		// show columns is run by the driver
+		return r.query(ctx, query, args)
+	case "describe":
+		if len(words) != 2 {
+			return fmt.Errorf("expect describe table_name")
+		}
+		return r.describe(ctx, lex.Unquote(strings.Fields(query)[1]))
+	case "select", "consistent", "explain":
+		return r.query(ctx, query, args)
+	default:
+		result, err := r.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(r.out, "%d row(s) affected\n", n)
+		return nil
+	}
+}
+
+// query runs a statement that returns rows, and prints the rows.
+func (r *runner) query(ctx context.Context, query string, args []interface{}) error {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return printRows(r.out, rows)
+}
+
+// domainName returns the domain name for a table name,
+// using the same convention as the driver.
+func (r *runner) domainName(tableName string) string {
+	if r.schema == "" {
+		return tableName
+	}
+	return r.schema + "." + tableName
+}
+
+func (r *runner) showTables(ctx context.Context) error {
+	var tableNames []string
+	input := &simpledb.ListDomainsInput{}
+	for {
+		output, err := r.sdb.ListDomainsWithContext(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, domainName := range output.DomainNames {
+			name := aws.StringValue(domainName)
+			if r.schema == "" {
+				tableNames = append(tableNames, name)
+			} else if prefix := r.schema + "."; strings.HasPrefix(name, prefix) {
+				tableNames = append(tableNames, strings.TrimPrefix(name, prefix))
+			}
+		}
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+	sort.Strings(tableNames)
+	tw := newTabWriter(r.out)
+	fmt.Fprintln(tw, "table")
+	for _, name := range tableNames {
+		fmt.Fprintln(tw, name)
+	}
+	return tw.Flush()
+}
+
+// describeSampleSize is the number of items examined by describe.
+const describeSampleSize = 100
+
+// describe prints the columns of a table and their types. SimpleDB does not
+// keep a schema, so the columns are determined from a sample of items.
+func (r *runner) describe(ctx context.Context, tableName string) error {
+	domainName := r.domainName(tableName)
+	metadata, err := r.sdb.DomainMetadataWithContext(ctx, &simpledb.DomainMetadataInput{
+		DomainName: aws.String(domainName),
+	})
+	if err != nil {
+		return err
+	}
+	output, err := r.sdb.SelectWithContext(ctx, &simpledb.SelectInput{
+		SelectExpression: aws.String(fmt.Sprintf("select * from `%s` limit %d",
+			strings.Replace(domainName, "`", "``", -1), describeSampleSize)),
+	})
+	if err != nil {
+		return err
+	}
+	types := make(map[string]map[string]bool)
+	for _, item := range output.Items {
+		for _, attr := range item.Attributes {
+			name := aws.StringValue(attr.Name)
+			prefix := simpledbsql.DefaultMetadataPrefix
+			if !strings.HasPrefix(name, prefix) || name == prefix+"id" {
+				continue
+			}
+			column := strings.TrimPrefix(name, prefix)
+			if types[column] == nil {
+				types[column] = make(map[string]bool)
+			}
+			types[column][aws.StringValue(attr.Value)] = true
+		}
+	}
+	columns := make([]string, 0, len(types))
+	for column := range types {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	tw := newTabWriter(r.out)
+	fmt.Fprintln(tw, "column\ttypes")
+	fmt.Fprintln(tw, "id\tstring")
+	for _, column := range columns {
+		var typeNames []string
+		for typeName := range types[column] {
+			typeNames = append(typeNames, typeName)
+		}
+		sort.Strings(typeNames)
+		fmt.Fprintf(tw, "%s\t%s\n", column, strings.Join(typeNames, ", "))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "domain %s: %d items, %d columns sampled from %d items\n",
+		domainName, aws.Int64Value(metadata.ItemCount), len(columns)+1, len(output.Items))
+	return nil
+}
+
+func newTabWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+}
+
+// printRows prints rows as a table, followed by the number of rows.
+func printRows(w io.Writer, rows *sql.Rows) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	tw := newTabWriter(w)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	var count int
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		cells := make([]string, len(values))
+		for i, v := range values {
+			cells[i] = formatValue(v)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d row(s)\n", count)
+	return nil
+}
+
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return fmt.Sprintf("%x", val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	default:
+		s := fmt.Sprint(val)
+		// tabs and newlines would break the table layout
+		return strings.NewReplacer("\t", `\t`, "\n", `\n`).Replace(s)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/jjeffery/simpledbsql"
+	"github.com/jjeffery/simpledbsql/internal/fakesdb"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	var out strings.Builder
+	r := &runner{
+		db:     sql.OpenDB(&simpledbsql.Connector{SimpleDB: sdb, Schema: "dev"}),
+		sdb:    sdb,
+		schema: "dev",
+		params: map[string]string{"id": "U1"},
+		out:    &out,
+	}
+	defer r.db.Close()
+
+	tests := []struct {
+		stmt string
+		want string
+	}{
+		{
+			stmt: "create table users",
+			want: "1 row(s) affected\n",
+		},
+		{
+			stmt: "insert into users(id, name) values(:id, 'alice')",
+			want: "1 row(s) affected\n",
+		},
+		{
+			stmt: "select id, name, age from users where id = :id",
+			want: "id  name   age\nU1  alice  NULL\n1 row(s)\n",
+		},
+		{
+			stmt: "show tables",
+			want: "table\nusers\n",
+		},
+		{
+			stmt: "describe users",
+			want: "column  types\nid      string\nname    string\n" +
+				"domain dev.users: 1 items, 2 columns sampled from 1 items\n",
+		},
+	}
+	for tn, tt := range tests {
+		out.Reset()
+		if err := r.run(ctx, tt.stmt); err != nil {
+			t.Errorf("%d: unexpected error: %v", tn, err)
+			continue
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%d: got=%q, want=%q", tn, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jjeffery/simpledbsql/internal/lex"
+)
+
+// splitStatements splits text into statements separated by semicolons.
+// Semicolons inside quotes and comments do not separate statements.
+func splitStatements(text string) ([]string, error) {
+	var (
+		stmts []string
+		buf   strings.Builder
+	)
+	add := func() {
+		if stmt := strings.TrimSpace(buf.String()); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		buf.Reset()
+	}
+	scanner := lex.New(strings.NewReader(text))
+	for scanner.Scan() {
+		switch {
+		case scanner.Token() == lex.TokenComment:
+			// comments are not sent to the driver
+			buf.WriteString("\n")
+		case scanner.Text() == ";":
+			add()
+		default:
+			buf.WriteString(scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	add()
+	return stmts, nil
+}
+
+// substituteParams replaces each parameter reference of the form ":name" in
+// the statement with a placeholder, and returns the corresponding arguments.
+func substituteParams(stmt string, params map[string]string) (string, []interface{}, error) {
+	var (
+		buf  strings.Builder
+		args []interface{}
+	)
+	scanner := lex.New(strings.NewReader(stmt))
+	var colon bool
+	for scanner.Scan() {
+		text := scanner.Text()
+		if colon {
+			colon = false
+			if scanner.Token() == lex.TokenIdent {
+				value, ok := params[text]
+				if !ok {
+					return "", nil, fmt.Errorf("parameter %q is not set", text)
+				}
+				buf.WriteString("?")
+				args = append(args, value)
+				continue
+			}
+			buf.WriteString(":")
+		}
+		if text == ":" {
+			colon = true
+			continue
+		}
+		if scanner.Token() == lex.TokenPlaceholder {
+			return "", nil, fmt.Errorf("use :name parameters instead of placeholders")
+		}
+		buf.WriteString(text)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+	if colon {
+		buf.WriteString(":")
+	}
+	return buf.String(), args, nil
+}
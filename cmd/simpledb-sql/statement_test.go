@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{
+			text: "select a from t; delete from t where id = 'x;y'",
+			want: []string{"select a from t", "delete from t where id = 'x;y'"},
+		},
+		{
+			text: "-- comment; with semicolon\ncreate table t;\n\n;",
+			want: []string{"create table t"},
+		},
+		{
+			text: "   ",
+			want: nil,
+		},
+	}
+	for tn, tt := range tests {
+		got, err := splitStatements(tt.text)
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", tn, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d: got=%q, want=%q", tn, got, tt.want)
+		}
+	}
+}
+
+func TestSubstituteParams(t *testing.T) {
+	params := map[string]string{"id": "X1", "name": "it's"}
+	tests := []struct {
+		stmt    string
+		want    string
+		args    []interface{}
+		errText string
+	}{
+		{
+			stmt: "update t set name = :name where id = :id",
+			want: "update t set name = ? where id = ?",
+			args: []interface{}{"it's", "X1"},
+		},
+		{
+			stmt: "select a from t where b = 'a:id'",
+			want: "select a from t where b = 'a:id'",
+		},
+		{
+			stmt:    "select a from t where id = :missing",
+			errText: `parameter "missing" is not set`,
+		},
+		{
+			stmt:    "select a from t where id = ?",
+			errText: "use :name parameters instead of placeholders",
+		},
+	}
+	for tn, tt := range tests {
+		got, args, err := substituteParams(tt.stmt, params)
+		if tt.errText != "" {
+			if err == nil || err.Error() != tt.errText {
+				t.Errorf("%d: got=%v, want=%v", tn, err, tt.errText)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", tn, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%d: got=%q, want=%q", tn, got, tt.want)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%d: got=%v, want=%v", tn, args, tt.args)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// fileData is the data for the template of the generated file.
+type fileData struct {
+	Package string
+	Decimal bool // imports simpledbsql
+	Strconv bool // imports strconv
+	Time    bool // imports time
+	Tables  []tableData
+}
+
+type tableData struct {
+	Name          string
+	Type          string
+	Plural        string
+	Columns       []columnData
+	Filters       []filterData
+	GetQuery      string
+	PutQuery      string
+	DeleteQuery   string
+	SelectColumns string // args of builder.Select
+	ScanArgs      string // args of rows.Scan
+}
+
+type columnData struct {
+	Field     string
+	FieldType string
+	Nilable   bool   // if true, a nil field is stored as null
+	Arg       string // expression for the stored value of the field
+}
+
+type filterData struct {
+	Name   string
+	Column string
+	Doc    string
+	Param  string // type of the parameter, or blank
+	Expr   string // predicate of the where clause
+	Arg    string // expression for the arg of the predicate
+}
+
+// filterOps are the names and descriptions of the filters for each operator.
+var filterOps = map[string]struct{ suffix, doc string }{
+	"=":    {"Eq", "equals v"},
+	"<>":   {"Ne", "does not equal v"},
+	"<":    {"Lt", "is less than v"},
+	"<=":   {"Le", "is less than or equal to v"},
+	">":    {"Gt", "is greater than v"},
+	">=":   {"Ge", "is greater than or equal to v"},
+	"like": {"Like", "matches the like pattern v"},
+}
+
+// generate writes the Go source for the tables of a schema.
+func generate(w io.Writer, s *schema) error {
+	data := fileData{Package: s.Package}
+	for _, t := range s.Tables {
+		td, err := newTableData(t)
+		if err != nil {
+			return fmt.Errorf("table %s: %v", t.Name, err)
+		}
+		for _, c := range t.Columns {
+			switch c.Type {
+			case "decimal":
+				data.Decimal = true
+			case "time":
+				data.Time = true
+			case "int64", "float64":
+				data.Strconv = true
+			}
+		}
+		data.Tables = append(data.Tables, td)
+	}
+	var buf bytes.Buffer
+	if err := fileTemplate.Execute(&buf, data); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("cannot format generated code: %v", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+func newTableData(t table) (tableData, error) {
+	td := tableData{
+		Name:   t.Name,
+		Type:   t.Type,
+		Plural: t.Plural,
+	}
+	names := []string{quoteIdentifier("id")}
+	selectColumns := []string{strconv.Quote("id")}
+	scanArgs := []string{"&row.ID"}
+	var sets []string
+	for _, c := range t.Columns {
+		ct := columnTypes[c.Type]
+		cd := columnData{
+			Field:     c.Field,
+			FieldType: ct.goType,
+			Nilable:   c.Nullable || c.Type == "binary",
+			Arg:       "row." + c.Field,
+		}
+		if c.Nullable && c.Type != "binary" {
+			cd.FieldType = "*" + ct.goType
+			cd.Arg = "*row." + c.Field
+		}
+		if c.Type == "time" {
+			// stored in UTC, so that the values sort in time order
+			cd.Arg = "row." + c.Field + ".UTC()"
+		}
+		td.Columns = append(td.Columns, cd)
+
+		quoted := quoteIdentifier(c.Name)
+		names = append(names, quoted)
+		selectColumns = append(selectColumns, strconv.Quote(c.Name))
+		scanArgs = append(scanArgs, "&row."+c.Field)
+		sets = append(sets, quoted+" = ?")
+
+		prefix := t.Type + c.Field
+		for _, op := range ct.ops {
+			fd := filterData{
+				Name:   prefix + filterOps[op].suffix,
+				Column: c.Name,
+				Doc:    filterOps[op].doc,
+				Param:  ct.goType,
+				Expr:   quoted + " " + op + " ?",
+				Arg:    filterArg(c.Type),
+			}
+			td.Filters = append(td.Filters, fd)
+		}
+		if c.Nullable {
+			td.Filters = append(td.Filters,
+				filterData{Name: prefix + "IsNull", Column: c.Name, Doc: "is null", Expr: quoted + " is null"},
+				filterData{Name: prefix + "IsNotNull", Column: c.Name, Doc: "is not null", Expr: quoted + " is not null"},
+			)
+		}
+	}
+	table := quoteIdentifier(t.Name)
+	td.GetQuery = "consistent select " + strings.Join(names, ", ") + " from " + table + " where id = ?"
+	td.PutQuery = "upsert " + table + " set " + strings.Join(sets, ", ") + " where id = ?"
+	td.DeleteQuery = "delete from " + table + " where id = ?"
+	td.SelectColumns = strings.Join(selectColumns, ", ")
+	td.ScanArgs = strings.Join(scanArgs, ", ")
+
+	// check that the driver accepts the statements
+	for _, query := range []string{td.GetQuery, td.PutQuery, td.DeleteQuery} {
+		if _, err := parse.Parse(query); err != nil {
+			return tableData{}, fmt.Errorf("invalid statement %q: %v", query, err)
+		}
+	}
+	return td, nil
+}
+
+// filterArg returns the expression for the arg of a filter on a column
+// of the type, which is compared with the stored values of the column.
+func filterArg(columnType string) string {
+	switch columnType {
+	case "time":
+		return "v.UTC().Format(timeFormat)"
+	case "int64":
+		return "strconv.FormatInt(v, 10)"
+	case "float64":
+		return "strconv.FormatFloat(v, 'g', -1, 64)"
+	}
+	return "v"
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+var fileTemplate = template.Must(template.New("file").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+}).Parse(`// Code generated by simpledb-sqlgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+	"database/sql"
+{{- if .Strconv}}
+	"strconv"
+{{- end}}
+{{- if .Time}}
+	"time"
+{{- end}}
+{{if .Decimal}}
+	"github.com/jjeffery/simpledbsql"
+{{- end}}
+	"github.com/jjeffery/simpledbsql/builder"
+)
+
+// DB runs statements. It is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type DB interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+{{if .Time}}
+// timeFormat is the format of the times stored by the driver. Times are
+// stored in UTC, so that the stored values sort in time order.
+const timeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+{{end}}
+{{- range $t := .Tables}}
+// {{.Type}} is a row of the {{.Name}} table.
+type {{.Type}} struct {
+	ID string
+{{- range .Columns}}
+	{{.Field}} {{.FieldType}}
+{{- end}}
+}
+
+// {{.Type}}Filter selects the rows returned by Query{{.Plural}}.
+type {{.Type}}Filter struct {
+	expr string
+	args []interface{}
+}
+
+// Get{{.Type}} reads the row of the {{.Name}} table with the id, using a
+// consistent read. It returns sql.ErrNoRows if there is no such row.
+func Get{{.Type}}(ctx context.Context, db DB, id string) (*{{.Type}}, error) {
+	var row {{.Type}}
+	err := db.QueryRowContext(ctx, {{quote .GetQuery}}, id).Scan({{.ScanArgs}})
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// Put{{.Type}} inserts a row into the {{.Name}} table, or replaces the
+// row with the same id.
+func Put{{.Type}}(ctx context.Context, db DB, row *{{.Type}}) error {
+	var args []interface{}
+{{- range .Columns}}
+{{- if .Nilable}}
+	if row.{{.Field}} != nil {
+		args = append(args, {{.Arg}})
+	} else {
+		args = append(args, nil)
+	}
+{{- else}}
+	args = append(args, {{.Arg}})
+{{- end}}
+{{- end}}
+	args = append(args, row.ID)
+	_, err := db.ExecContext(ctx, {{quote .PutQuery}}, args...)
+	return err
+}
+
+// Delete{{.Type}} deletes the row of the {{.Name}} table with the id.
+func Delete{{.Type}}(ctx context.Context, db DB, id string) error {
+	_, err := db.ExecContext(ctx, {{quote .DeleteQuery}}, id)
+	return err
+}
+
+// Query{{.Plural}} returns the rows of the {{.Name}} table that
+// are selected by all of the filters.
+func Query{{.Plural}}(ctx context.Context, db DB, filters ...{{.Type}}Filter) ([]*{{.Type}}, error) {
+	b := builder.Select({{.SelectColumns}}).From({{quote .Name}})
+	for _, f := range filters {
+		b.Where(f.expr, f.args...)
+	}
+	query, args, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []*{{.Type}}
+	for rows.Next() {
+		var row {{.Type}}
+		if err := rows.Scan({{.ScanArgs}}); err != nil {
+			return nil, err
+		}
+		list = append(list, &row)
+	}
+	return list, rows.Err()
+}
+{{- range .Filters}}
+
+// {{.Name}} selects the rows whose {{.Column}} column {{.Doc}}.
+func {{.Name}}({{if .Param}}v {{.Param}}{{end}}) {{$t.Type}}Filter {
+	return {{$t.Type}}Filter{expr: {{quote .Expr}}{{if .Param}}, args: []interface{}{ {{- .Arg -}} }{{end}}}
+}
+{{- end}}
+{{end}}`))
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	s := &schema{
+		Package: "store",
+		Tables: []table{
+			{
+				Name: "users",
+				Type: "User",
+				Columns: []column{
+					{Name: "name", Type: "string"},
+					{Name: "age", Type: "int64", Nullable: true},
+					{Name: "balance", Type: "decimal", Nullable: true},
+					{Name: "created_at", Type: "time"},
+					{Name: "photo", Type: "binary"},
+				},
+			},
+		},
+	}
+	if err := s.validate(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := generate(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+	for _, want := range []string{
+		"package store\n",
+		"\t\"strconv\"\n",
+		"\t\"time\"\n",
+		"\t\"github.com/jjeffery/simpledbsql\"\n",
+		"\tAge       *int64\n",
+		"\tBalance   *simpledbsql.Decimal\n",
+		"\tCreatedAt time.Time\n",
+		"\tPhoto     []byte\n",
+		"func GetUser(ctx context.Context, db DB, id string) (*User, error) {",
+		"\"consistent select `id`, `name`, `age`, `balance`, `created_at`, `photo` from `users` where id = ?\"",
+		"func PutUser(ctx context.Context, db DB, row *User) error {",
+		"\"upsert `users` set `name` = ?, `age` = ?, `balance` = ?, `created_at` = ?, `photo` = ? where id = ?\"",
+		"args = append(args, *row.Age)",
+		"args = append(args, row.CreatedAt.UTC())",
+		"func DeleteUser(ctx context.Context, db DB, id string) error {",
+		"func QueryUsers(ctx context.Context, db DB, filters ...UserFilter) ([]*User, error) {",
+		"func UserNameLike(v string) UserFilter {",
+		"return UserFilter{expr: \"`age` = ?\", args: []interface{}{strconv.FormatInt(v, 10)}}",
+		"func UserBalanceGe(v simpledbsql.Decimal) UserFilter {",
+		"return UserFilter{expr: \"`created_at` < ?\", args: []interface{}{v.UTC().Format(timeFormat)}}",
+		"func UserAgeIsNull() UserFilter {",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+	for _, unwanted := range []string{"func UserAgeLt(", "func UserPhotoEq(", "func UserNameIsNull("} {
+		if strings.Contains(src, unwanted) {
+			t.Errorf("unexpected %q", unwanted)
+		}
+	}
+}
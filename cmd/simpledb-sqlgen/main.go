@@ -0,0 +1,72 @@
+// Command simpledb-sqlgen generates typed Go functions for reading and
+// writing the rows of SimpleDB tables using the simpledbsql driver.
+//
+// Usage:
+//
+//	simpledb-sqlgen [-o file.go] schema.json
+//
+// The schema is a JSON file that names the package of the generated code,
+// and describes each table and its columns other than id:
+//
+//	{
+//		"package": "store",
+//		"tables": [{
+//			"name": "users",
+//			"type": "User",
+//			"columns": [
+//				{"name": "name", "type": "string"},
+//				{"name": "balance", "type": "decimal", "nullable": true},
+//				{"name": "created", "type": "time"}
+//			]
+//		}]
+//	}
+//
+// The column types are string, decimal, time, int64, float64, bool and
+// binary. The fields of nullable columns are pointers, which are nil for
+// null, and binary columns are null if their fields are nil.
+//
+// For each table, the generated code has a struct type with a field for each
+// column, and the functions GetUser, PutUser, DeleteUser and QueryUsers, where
+// User is the type name, and Users is its plural. The rows returned by
+// QueryUsers are selected by filters, such as UserNameEq("alice"), which pass
+// their args in the encoding of the column. Times are stored in UTC, so that
+// they can be compared by range. Because int64 and float64 values are not
+// stored in numeric order, their columns only have equality filters.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+func main() {
+	output := flag.String("o", "", "write the generated code to `file` instead of standard output")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: simpledb-sqlgen [-o file.go] schema.json")
+		os.Exit(2)
+	}
+	s, err := readSchema(flag.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := generate(&buf, s); err != nil {
+		fatal(err)
+	}
+	if *output == "" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	if err := ioutil.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "simpledb-sqlgen:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// schema describes the tables for which code is generated.
+type schema struct {
+	Package string  `json:"package"`
+	Tables  []table `json:"tables"`
+}
+
+// table describes a table, whose rows are represented by a struct type.
+type table struct {
+	Name    string   `json:"name"`   // name of the table
+	Type    string   `json:"type"`   // name of the struct type
+	Plural  string   `json:"plural"` // plural of the type name, defaults to Type + "s"
+	Columns []column `json:"columns"`
+}
+
+// column describes a column of a table other than id.
+type column struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`     // one of the keys of columnTypes
+	Field    string `json:"field"`    // name of the struct field, defaults to the column name in camel case
+	Nullable bool   `json:"nullable"` // if true, the field is a pointer that is nil for null
+}
+
+// columnType describes how values of a column type are stored and compared.
+type columnType struct {
+	goType string   // type of the struct field
+	ops    []string // comparison operators available as filters
+}
+
+// columnTypes are the column types that a schema can use. The operators
+// of each type are those for which the driver compares the stored values
+// correctly: int64 and float64 values are not stored in numeric order.
+var columnTypes = map[string]columnType{
+	"string":  {goType: "string", ops: []string{"=", "<>", "<", "<=", ">", ">=", "like"}},
+	"decimal": {goType: "simpledbsql.Decimal", ops: []string{"=", "<>", "<", "<=", ">", ">="}},
+	"time":    {goType: "time.Time", ops: []string{"=", "<>", "<", "<=", ">", ">="}},
+	"int64":   {goType: "int64", ops: []string{"=", "<>"}},
+	"float64": {goType: "float64", ops: []string{"=", "<>"}},
+	"bool":    {goType: "bool", ops: []string{"=", "<>"}},
+	"binary":  {goType: "[]byte"},
+}
+
+// readSchema reads a schema from a JSON file.
+func readSchema(filename string) (*schema, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var s schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return &s, nil
+}
+
+// validate checks the schema, and sets the defaults of its tables and columns.
+func (s *schema) validate() error {
+	if !isIdentifier(s.Package) {
+		return fmt.Errorf("invalid package name %q", s.Package)
+	}
+	if len(s.Tables) == 0 {
+		return fmt.Errorf("no tables")
+	}
+	types := make(map[string]bool)
+	for i := range s.Tables {
+		t := &s.Tables[i]
+		if t.Name == "" {
+			return fmt.Errorf("table %d: missing name", i+1)
+		}
+		if t.Type == "" {
+			return fmt.Errorf("table %s: missing type", t.Name)
+		}
+		if t.Plural == "" {
+			t.Plural = t.Type + "s"
+		}
+		for _, name := range []string{t.Type, t.Plural} {
+			if !isExported(name) {
+				return fmt.Errorf("table %s: invalid type name %q", t.Name, name)
+			}
+			if types[name] {
+				return fmt.Errorf("table %s: duplicate type name %q", t.Name, name)
+			}
+			types[name] = true
+		}
+		if len(t.Columns) == 0 {
+			return fmt.Errorf("table %s: no columns", t.Name)
+		}
+		names := map[string]bool{"id": true}
+		fields := map[string]bool{"ID": true}
+		for j := range t.Columns {
+			c := &t.Columns[j]
+			if c.Name == "" {
+				return fmt.Errorf("table %s: column %d: missing name", t.Name, j+1)
+			}
+			if names[strings.ToLower(c.Name)] {
+				return fmt.Errorf("table %s: duplicate column %q", t.Name, c.Name)
+			}
+			names[strings.ToLower(c.Name)] = true
+			if _, ok := columnTypes[c.Type]; !ok {
+				return fmt.Errorf("table %s: column %s: unknown type %q", t.Name, c.Name, c.Type)
+			}
+			if c.Field == "" {
+				c.Field = camelCase(c.Name)
+			}
+			if !isExported(c.Field) {
+				return fmt.Errorf("table %s: column %s: invalid field name %q", t.Name, c.Name, c.Field)
+			}
+			if fields[c.Field] {
+				return fmt.Errorf("table %s: column %s: duplicate field name %q", t.Name, c.Name, c.Field)
+			}
+			fields[c.Field] = true
+		}
+	}
+	return nil
+}
+
+var identifierRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// isIdentifier reports whether name is a Go identifier that is not a keyword.
+func isIdentifier(name string) bool {
+	return identifierRE.MatchString(name) && !token.Lookup(name).IsKeyword()
+}
+
+// isExported reports whether name is an exported Go identifier.
+func isExported(name string) bool {
+	return isIdentifier(name) && name[0] >= 'A' && name[0] <= 'Z'
+}
+
+// initialisms are the words that camelCase writes in upper case.
+var initialisms = map[string]bool{
+	"ID": true, "URL": true, "URI": true, "UUID": true, "HTTP": true, "JSON": true,
+	"API": true, "IP": true, "SQL": true, "UTC": true, "TTL": true,
+}
+
+// camelCase converts a name such as "user_id" to an exported
+// Go identifier such as "UserID".
+func camelCase(name string) string {
+	var sb strings.Builder
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == ' ' || r == '.'
+	})
+	for _, word := range words {
+		if upper := strings.ToUpper(word); initialisms[upper] {
+			sb.WriteString(upper)
+			continue
+		}
+		sb.WriteString(strings.ToUpper(word[:1]))
+		sb.WriteString(word[1:])
+	}
+	return sb.String()
+}
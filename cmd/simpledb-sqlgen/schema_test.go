@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		schema  schema
+		errtext string
+	}{
+		{
+			schema:  schema{Package: "func"},
+			errtext: `invalid package name "func"`,
+		},
+		{
+			schema:  schema{Package: "store"},
+			errtext: "no tables",
+		},
+		{
+			schema:  schema{Package: "store", Tables: []table{{Name: "users"}}},
+			errtext: "table users: missing type",
+		},
+		{
+			schema:  schema{Package: "store", Tables: []table{{Name: "users", Type: "user"}}},
+			errtext: `table users: invalid type name "user"`,
+		},
+		{
+			schema: schema{Package: "store", Tables: []table{
+				{Name: "users", Type: "User", Columns: []column{{Name: "a", Type: "string"}}},
+				{Name: "people", Type: "User"},
+			}},
+			errtext: `table people: duplicate type name "User"`,
+		},
+		{
+			schema:  schema{Package: "store", Tables: []table{{Name: "users", Type: "User"}}},
+			errtext: "table users: no columns",
+		},
+		{
+			schema:  schema{Package: "store", Tables: []table{{Name: "users", Type: "User", Columns: []column{{Name: "ID", Type: "string"}}}}},
+			errtext: `table users: duplicate column "ID"`,
+		},
+		{
+			schema:  schema{Package: "store", Tables: []table{{Name: "users", Type: "User", Columns: []column{{Name: "a", Type: "int"}}}}},
+			errtext: `table users: column a: unknown type "int"`,
+		},
+		{
+			schema: schema{Package: "store", Tables: []table{{Name: "users", Type: "User", Columns: []column{
+				{Name: "user_name", Type: "string"},
+				{Name: "user-name", Type: "string"},
+			}}}},
+			errtext: `table users: column user-name: duplicate field name "UserName"`,
+		},
+	}
+	for i, tt := range tests {
+		err := tt.schema.validate()
+		if err == nil {
+			t.Errorf("%d: got nil, want error", i)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.errtext) {
+			t.Errorf("%d: got=%q, want containing %q", i, err.Error(), tt.errtext)
+		}
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	tests := map[string]string{
+		"name":        "Name",
+		"user_id":     "UserID",
+		"home-url":    "HomeURL",
+		"createdAt":   "CreatedAt",
+		"ttl_seconds": "TTLSeconds",
+	}
+	for name, want := range tests {
+		if got := camelCase(name); got != want {
+			t.Errorf("%s: got=%q, want=%q", name, got, want)
+		}
+	}
+}
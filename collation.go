@@ -0,0 +1,178 @@
+package simpledbsql
+
+import (
+	"database/sql/driver"
+	"strings"
+	"unicode"
+
+	"github.com/jjeffery/simpledbsql/internal/lex"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// foldedPrefix follows the metadata prefix in the names of the attributes
+// that hold the folded values of case-insensitive columns.
+const foldedPrefix = "folded:"
+
+// foldCase returns s with its letters folded, so that strings that are
+// equal ignoring case have the same folded form. Each rune is mapped to
+// the lower case of its upper case, which folds runes such as 'ſ' and 'K'
+// (the Kelvin sign) that have no lower case of their own.
+func foldCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		return unicode.ToLower(unicode.ToUpper(r))
+	}, s)
+}
+
+// isFolded returns true if a column is compared ignoring case.
+func (m metadata) isFolded(columnName string) bool {
+	return m.folded[columnName]
+}
+
+// foldedAttr returns the name of the attribute containing the folded
+// value of a case-insensitive column.
+func (m metadata) foldedAttr(columnName string) string {
+	return m.namePrefix() + foldedPrefix + columnName
+}
+
+// isFoldedAttr returns true if the named attribute contains the folded
+// value of a case-insensitive column, rather than a column type.
+func (m metadata) isFoldedAttr(name string) bool {
+	return len(m.folded) > 0 && strings.HasPrefix(name, m.namePrefix()+foldedPrefix)
+}
+
+// translateFolded returns the lexemes of a where clause with its comparisons
+// of case-insensitive columns translated to compare the columns' folded
+// attributes, together with the args with the values they are compared
+// with folded:
+//
+//	name = ?              =>  `sql:folded:name` = ?
+//	name like 'Smi%'      =>  `sql:folded:name` like 'smi%'
+//	name in ('A', 'B')    =>  `sql:folded:name` in ('a', 'b')
+//
+// Only the =, !=, <>, like, not like and in operators are translated, and
+// only when the column is compared with string literals or placeholders.
+// As with translateNulls, predicates on the order by column are not
+// translated, because SimpleDB requires the sort column to be constrained
+// by the where clause.
+func (m metadata) translateFolded(whereClause []string, args []driver.Value) ([]string, []driver.Value) {
+	if len(m.folded) == 0 {
+		return whereClause, args
+	}
+	orderColumn := parseOrderBy(whereClause).column
+	var (
+		translated []string
+		folded     []driver.Value
+	)
+	foldArg := func(ordinal int) {
+		if ordinal >= len(args) {
+			// reported when the arg is substituted
+			return
+		}
+		if folded == nil {
+			folded = append([]driver.Value(nil), args...)
+		}
+		if s, ok := folded[ordinal].(string); ok {
+			folded[ordinal] = foldCase(s)
+		}
+	}
+	var argIndex int // index of the next "?" placeholder
+	for i := 0; i < len(whereClause); i++ {
+		if whereClause[i] == "?" {
+			argIndex++
+			continue
+		}
+		columnName := lex.Unquote(whereClause[i])
+		if !isIdentLexeme(whereClause[i]) || !m.isFolded(columnName) || columnName == orderColumn {
+			continue
+		}
+		first, last := matchFoldedValues(whereClause, i)
+		if first < 0 {
+			continue
+		}
+		if translated == nil {
+			translated = append([]string(nil), whereClause...)
+		}
+		translated[i] = quoteIdentifier(m.foldedAttr(columnName))
+		for j := first; j <= last; j++ {
+			lexeme := whereClause[j]
+			switch {
+			case lexeme == "?":
+				foldArg(argIndex)
+				argIndex++
+			case isStringLexeme(lexeme):
+				translated[j] = foldCase(lexeme)
+			default:
+				if ordinal, ok := parse.NumberedPlaceholder(lexeme); ok {
+					foldArg(ordinal)
+				}
+			}
+		}
+		i = last
+	}
+	if translated == nil {
+		return whereClause, args
+	}
+	if folded == nil {
+		folded = args
+	}
+	return translated, folded
+}
+
+// matchFoldedValues reports whether the column at index i of a where clause
+// is compared with values that can be folded. It returns the indexes of the
+// first and last lexemes of the values, or -1 if there is no match.
+func matchFoldedValues(whereClause []string, i int) (first, last int) {
+	op := adjacentIndex(whereClause, i, 1)
+	if op < 0 {
+		return -1, -1
+	}
+	switch strings.ToLower(whereClause[op]) {
+	case "!":
+		if op+1 >= len(whereClause) || whereClause[op+1] != "=" {
+			return -1, -1
+		}
+		op++
+	case "not":
+		op = adjacentIndex(whereClause, op, 1)
+		if op < 0 || !strings.EqualFold(whereClause[op], "like") {
+			return -1, -1
+		}
+	case "in":
+		open := adjacentIndex(whereClause, op, 1)
+		if open < 0 || whereClause[open] != "(" {
+			return -1, -1
+		}
+		for j := open + 1; j < len(whereClause); j++ {
+			switch lexeme := whereClause[j]; {
+			case lexeme == ")":
+				return open + 1, j - 1
+			case lexeme == ",", isSpaceLexeme(lexeme), isFoldableLexeme(lexeme):
+			default:
+				return -1, -1
+			}
+		}
+		return -1, -1
+	case "=", "<>", "like":
+	default:
+		return -1, -1
+	}
+	value := adjacentIndex(whereClause, op, 1)
+	if value < 0 || !isFoldableLexeme(whereClause[value]) {
+		return -1, -1
+	}
+	return value, value
+}
+
+// isFoldableLexeme returns true if a lexeme is a string literal or a placeholder.
+func isFoldableLexeme(lexeme string) bool {
+	if lexeme == "?" || isStringLexeme(lexeme) {
+		return true
+	}
+	_, ok := parse.NumberedPlaceholder(lexeme)
+	return ok
+}
+
+// isStringLexeme returns true if a lexeme is a quoted string literal.
+func isStringLexeme(lexeme string) bool {
+	return strings.HasPrefix(lexeme, "'") || strings.HasPrefix(lexeme, `"`)
+}
@@ -0,0 +1,165 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// maxSelectLimit is the largest limit accepted by a SimpleDB select request.
+const maxSelectLimit = 2500
+
+// errSampled stops reading pages once a show columns query has sampled
+// enough items.
+var errSampled = errors.New("items sampled")
+
+// columnStats accumulates the types and number of occurrences of the
+// columns in the items read by a show columns query.
+type columnStats struct {
+	meta   metadata
+	types  map[string]map[string]bool
+	counts map[string]int64
+}
+
+func newColumnStats(meta metadata) *columnStats {
+	return &columnStats{
+		meta:   meta,
+		types:  make(map[string]map[string]bool),
+		counts: make(map[string]int64),
+	}
+}
+
+// add counts the columns of an item. Columns without type metadata
+// have their type inferred from their value.
+func (cs *columnStats) add(item *simpledb.Item) {
+	colTypes := cs.meta.columnTypes(item.Attributes)
+	itemTypes := make(map[string]string, len(colTypes))
+	for columnName, colType := range colTypes {
+		typeName, _ := splitType(colType)
+		if typeName == "empty" {
+			typeName = "string"
+		}
+		itemTypes[columnName] = typeName
+	}
+	for _, attr := range item.Attributes {
+		name := derefString(attr.Name)
+		if cs.meta.isMetadata(name) {
+			continue
+		}
+		if _, ok := itemTypes[name]; !ok {
+			itemTypes[name] = inferType(derefString(attr.Value))
+		}
+	}
+	for columnName, typeName := range itemTypes {
+		if parse.IsID(columnName) {
+			continue
+		}
+		if cs.types[columnName] == nil {
+			cs.types[columnName] = make(map[string]bool)
+		}
+		cs.types[columnName][typeName] = true
+		cs.counts[columnName]++
+	}
+}
+
+// rows returns a row for each column, in order of column name.
+func (cs *columnStats) rows() *valueRows {
+	columnNames := make([]string, 0, len(cs.counts))
+	for columnName := range cs.counts {
+		columnNames = append(columnNames, columnName)
+	}
+	sort.Strings(columnNames)
+	rows := &valueRows{
+		columns: []string{"column", "types", "count"},
+	}
+	for _, columnName := range columnNames {
+		typeNames := make([]string, 0, len(cs.types[columnName]))
+		for typeName := range cs.types[columnName] {
+			typeNames = append(typeNames, typeName)
+		}
+		sort.Strings(typeNames)
+		rows.values = append(rows.values, []driver.Value{
+			columnName,
+			strings.Join(typeNames, ","),
+			cs.counts[columnName],
+		})
+	}
+	return rows
+}
+
+// inferType returns the type of a value that has no type metadata,
+// such as a value written by another SimpleDB client.
+func inferType(value string) string {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return "int64"
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return "float64"
+	}
+	if value == "true" || value == "false" {
+		return "bool"
+	}
+	if _, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return "time"
+	}
+	return "string"
+}
+
+// showColumns returns the columns of a table, with the types and number of
+// occurrences of each column. If the query has a limit, only that many items
+// are sampled, otherwise all items in the domain are read.
+func (c *conn) showColumns(ctx context.Context, q *parse.ShowColumnsQuery) (driver.Rows, error) {
+	input, err := c.newShowColumnsInput(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	stats := newColumnStats(c.meta)
+	ttl := c.newTTLFilter()
+	var sampled int
+	err = c.selectPages(ctx, input, func(items []*simpledb.Item) error {
+		for _, item := range items {
+			if isSchemaItem(item) || ttl.expired(item) {
+				continue
+			}
+			if q.Limit > 0 && sampled >= q.Limit {
+				return errSampled
+			}
+			stats.add(item)
+			sampled++
+		}
+		return nil
+	})
+	if err != nil && err != errSampled {
+		return nil, errors.Wrap(err, "cannot show columns").With(
+			"table", q.TableName,
+		)
+	}
+	return stats.rows(), nil
+}
+
+func (c *conn) newShowColumnsInput(ctx context.Context, q *parse.ShowColumnsQuery) (*simpledb.SelectInput, error) {
+	domainName, err := c.resolveDomainName(ctx, q.TableName)
+	if err != nil {
+		return nil, err
+	}
+	selectExpression := "select * from " + quoteIdentifier(domainName)
+	if q.Limit > 0 {
+		// one more item, in case the schema item is selected
+		limit := q.Limit + 1
+		if limit > maxSelectLimit {
+			limit = maxSelectLimit
+		}
+		selectExpression += " limit " + strconv.Itoa(limit)
+	}
+	return &simpledb.SelectInput{
+		SelectExpression: aws.String(selectExpression),
+	}, nil
+}
@@ -0,0 +1,129 @@
+package simpledbsql
+
+import (
+	"database/sql/driver"
+	"reflect"
+)
+
+// checks that the rows of select statements describe their column types,
+// which libraries that scan rows into structs, such as sqlx and scany,
+// obtain using sql.Rows.ColumnTypes
+var (
+	_ driver.RowsColumnTypeScanType         = (*selectQueryRows)(nil)
+	_ driver.RowsColumnTypeNullable         = (*selectQueryRows)(nil)
+	_ driver.RowsColumnTypeDatabaseTypeName = (*selectQueryRows)(nil)
+)
+
+var (
+	stringType    = reflect.TypeOf("")
+	interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// scanType returns the type of the values of a column. The id column is
+// always a string. Other columns can have values of any type, because the
+// type of a column is recorded separately in each item.
+func (cm *columnMap) scanType(index int) reflect.Type {
+	if index == cm.itemNameIndex {
+		return stringType
+	}
+	return interfaceType
+}
+
+// nullable reports whether a column can be null, which is true of every
+// column except id, because an item can be missing any of its attributes.
+func (cm *columnMap) nullable(index int) bool {
+	return index != cm.itemNameIndex
+}
+
+// databaseTypeName returns the type name of a column, which is blank for
+// columns other than id, whose types are not known until each item is read.
+func (cm *columnMap) databaseTypeName(index int) string {
+	if index == cm.itemNameIndex {
+		return "STRING"
+	}
+	return ""
+}
+
+func (rows *selectQueryRows) ColumnTypeScanType(index int) reflect.Type {
+	return rows.cm.scanType(index)
+}
+
+func (rows *selectQueryRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return rows.cm.nullable(index), true
+}
+
+func (rows *selectQueryRows) ColumnTypeDatabaseTypeName(index int) string {
+	return rows.cm.databaseTypeName(index)
+}
+
+func (rows *getAttributesRows) ColumnTypeScanType(index int) reflect.Type {
+	return rows.cm.scanType(index)
+}
+
+func (rows *getAttributesRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return rows.cm.nullable(index), true
+}
+
+func (rows *getAttributesRows) ColumnTypeDatabaseTypeName(index int) string {
+	return rows.cm.databaseTypeName(index)
+}
+
+func (rows *batchRows) ColumnTypeScanType(index int) reflect.Type {
+	return rows.cm.scanType(index)
+}
+
+func (rows *batchRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return rows.cm.nullable(index), true
+}
+
+func (rows *batchRows) ColumnTypeDatabaseTypeName(index int) string {
+	return rows.cm.databaseTypeName(index)
+}
+
+// columnTypeScanType returns the scan type of a column of rows that wrap
+// other rows, such as timeoutRows and multiRows, which is interface{} if
+// the wrapped rows do not describe their column types.
+func columnTypeScanType(rows driver.Rows, index int) reflect.Type {
+	if ct, ok := rows.(driver.RowsColumnTypeScanType); ok {
+		return ct.ColumnTypeScanType(index)
+	}
+	return interfaceType
+}
+
+func columnTypeNullable(rows driver.Rows, index int) (nullable, ok bool) {
+	if ct, ok := rows.(driver.RowsColumnTypeNullable); ok {
+		return ct.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func columnTypeDatabaseTypeName(rows driver.Rows, index int) string {
+	if ct, ok := rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return ct.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (rows *timeoutRows) ColumnTypeScanType(index int) reflect.Type {
+	return columnTypeScanType(rows.Rows, index)
+}
+
+func (rows *timeoutRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return columnTypeNullable(rows.Rows, index)
+}
+
+func (rows *timeoutRows) ColumnTypeDatabaseTypeName(index int) string {
+	return columnTypeDatabaseTypeName(rows.Rows, index)
+}
+
+func (rows *multiRows) ColumnTypeScanType(index int) reflect.Type {
+	return columnTypeScanType(rows.rows, index)
+}
+
+func (rows *multiRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return columnTypeNullable(rows.rows, index)
+}
+
+func (rows *multiRows) ColumnTypeDatabaseTypeName(index int) string {
+	return columnTypeDatabaseTypeName(rows.rows, index)
+}
@@ -0,0 +1,72 @@
+package simpledbsql
+
+import (
+	"context"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// semaphore limits the number of concurrent SimpleDB requests.
+// A nil semaphore does not impose any limit.
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+func (s semaphore) acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// requestGroup sends the SimpleDB requests for a single statement concurrently,
+// subject to the limit on in-flight requests per connection.
+type requestGroup struct {
+	group   *errgroup.Group
+	ctx     context.Context
+	connSem semaphore
+}
+
+// newRequestGroup returns a request group for a statement, and a context that
+// is canceled when the first request in the group fails.
+func (c *conn) newRequestGroup(ctx context.Context) (*requestGroup, context.Context) {
+	group, ctx := errgroup.WithContext(ctx)
+	rg := &requestGroup{
+		group:   group,
+		ctx:     ctx,
+		connSem: c.requestSem,
+	}
+	return rg, ctx
+}
+
+// Go calls fn in a new goroutine once the limits permit another request.
+func (rg *requestGroup) Go(fn func() error) {
+	rg.group.Go(func() error {
+		if err := rg.connSem.acquire(rg.ctx); err != nil {
+			return err
+		}
+		defer rg.connSem.release()
+		return fn()
+	})
+}
+
+// Wait blocks until all requests have completed, and returns the first error.
+func (rg *requestGroup) Wait() error {
+	return rg.group.Wait()
+}
@@ -5,6 +5,8 @@ import (
 	"database/sql/driver"
 	"encoding/base64"
 	"fmt"
+	"math/big"
+	"path"
 	"reflect"
 	"strconv"
 	"strings"
@@ -15,7 +17,6 @@ import (
 	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
 	"github.com/jjeffery/errors"
 	"github.com/jjeffery/simpledbsql/internal/parse"
-	"golang.org/x/sync/errgroup"
 )
 
 // SimpleDB error codes
@@ -40,9 +41,111 @@ var (
 )
 
 type conn struct {
-	SimpleDB simpledbiface.SimpleDBAPI
-	Schema   string
-	Synonyms map[string]string
+	SimpleDB         simpledbiface.SimpleDBAPI
+	Schema           string
+	Synonyms         map[string]string
+	SchemaExclusions []string
+	SynonymResolver  SynonymResolver
+	TableNameFunc    func(ctx context.Context, tableName string) (string, error)
+	ItemCache        ItemCache
+
+	// limits the number of in-flight requests for the connection
+	requestSem semaphore
+
+	// records column types if not nil
+	schemas *schemaRecorder
+
+	// called after items are modified
+	hooks hooks
+
+	// batch of modified items for the Invalidator
+	invalidations         []Invalidation
+	batchingInvalidations bool
+
+	// records modifications if not nil
+	audit *auditLog
+
+	// column containing the expiry time of items
+	ttlColumn string
+
+	// write times in the format of earlier versions
+	legacyTimeFormat bool
+
+	// stored in place of empty strings if not blank
+	emptyStringSentinel string
+
+	// attributes containing column types
+	meta metadata
+
+	// limits of select statements, if greater than zero
+	maxSelectRows  int
+	maxSelectPages int
+
+	// redacts item names and values in errors if not nil
+	redactor Redactor
+
+	// verify duplicate keys of retried inserts
+	idempotentInserts bool
+
+	// retry key lookups that find no item with a consistent read
+	retryMissingItems bool
+
+	// error codes of eventually consistent selects that are retried
+	// with a consistent read
+	consistentRetryCodes []string
+
+	// store binary values in the more compact of two encodings
+	compactBinary bool
+
+	// called when an item's checksum does not match, if not nil
+	checksumMismatch func(ctx context.Context, mismatch *ChecksumMismatch)
+
+	// complete the pending two-phase updates of items that are read
+	repairPending bool
+
+	// called after each batch of a statement with a subquery, if not nil
+	bulkProgress func(ctx context.Context, progress *BulkProgress)
+
+	// maximum number of groups of a select statement, or zero for no limit
+	maxGroups int
+
+	// add a predicate to select statements whose order by column is not
+	// constrained by the where clause
+	constrainSort bool
+
+	// report a select deadline exceeded after rows were returned
+	// with ErrPartialResult
+	partialResults bool
+
+	// generates the item names of inserts without an id column, if not nil
+	idGenerator IDGenerator
+
+	// column set to the time that items are inserted, if not blank
+	createdColumn string
+
+	// policy for select statements that scan an entire table, and
+	// the function called if the policy is ScanWarn
+	scanPolicy ScanPolicy
+	onScan     func(ctx context.Context, scan *Scan)
+
+	// default values of the columns of each table, if not nil
+	columnDefaults map[string]map[string]interface{}
+
+	// parsed statements shared by connections, if not nil
+	parseCache *parseCache
+
+	// domain names shared by connections, if not nil
+	domains *domainCache
+
+	// fetch select pages in the background, buffering rows beyond
+	// the threshold in a file in the directory, if threshold > 0
+	spoolThreshold int
+	spoolDir       string
+
+	// defaults of statements that do not override them
+	defaultSelectLimit int
+	consistentRead     bool
+	statementTimeout   time.Duration
 }
 
 func (c *conn) Prepare(query string) (driver.Stmt, error) {
@@ -72,63 +175,230 @@ func (c *conn) Exec(query string, args []driver.Value) (driver.Result, error) {
 }
 
 func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
-	q, err := parse.Parse(query)
+	stmts, err := parse.Split(query)
+	if err != nil {
+		return nil, err
+	}
+	var q *parse.Query
+	if len(stmts) <= 1 {
+		if len(stmts) == 1 {
+			// removes any trailing semicolon
+			query = stmts[0].Text
+		}
+		if q, err = c.parseCache.parse(query); err != nil {
+			return nil, err
+		}
+		if err := checkQuery(q); err != nil {
+			return nil, err
+		}
+		if err := checkArgs(q.Placeholders, len(args)); err != nil {
+			return nil, err
+		}
+		c.applyDefaults(q)
+	} else if err := checkMultiArgs(stmts, len(args)); err != nil {
+		return nil, err
+	}
+	ctx, cancel := c.withTimeout(ctx, q)
+	var rows driver.Rows
+	if q == nil {
+		rows, err = c.queryMulti(ctx, stmts, getArgs(args))
+	} else {
+		rows, err = c.query(ctx, query, q, getArgs(args))
+	}
+	if cancel == nil {
+		return rows, err
+	}
 	if err != nil {
+		cancel()
 		return nil, err
 	}
-	if q.Select == nil {
-		return nil, errors.New("expect select query for QueryContext")
+	return &timeoutRows{Rows: rows, cancel: cancel}, nil
+}
+
+// checkQuery returns an error if q cannot be run by QueryContext.
+func checkQuery(q *parse.Query) error {
+	if q.Select == nil && q.ShowColumns == nil && q.ShowTables == nil && !q.Explain && !hasReturning(q) {
+		return errors.New("expect select query for QueryContext")
+	}
+	if q.Select != nil && q.Select.AllColumns && !q.Explain {
+		return errors.New("select * is not supported by QueryContext, use Connector.QueryMaps")
 	}
+	return nil
+}
 
+// hasReturning returns true if q is an insert or update statement with
+// a returning clause.
+func hasReturning(q *parse.Query) bool {
+	return (q.Insert != nil && q.Insert.Returning != nil) || (q.Update != nil && q.Update.Returning != nil)
+}
+
+func (c *conn) query(ctx context.Context, stmt string, q *parse.Query, args []driver.Value) (driver.Rows, error) {
+	if q.Explain {
+		return c.explain(ctx, q, args)
+	}
+	if hasReturning(q) {
+		return c.returning(ctx, stmt, q, args)
+	}
+	if q.ShowColumns != nil {
+		return c.showColumns(ctx, q.ShowColumns)
+	}
+	if q.ShowTables != nil {
+		return c.showTables(ctx)
+	}
+	if len(q.Select.Aggregates) > 0 {
+		return c.aggregate(ctx, q.Select, args)
+	}
 	if q.Select.Key == nil {
-		return c.selectQuery(ctx, q.Select, getArgs(args))
+		return c.selectQuery(ctx, q.Select, args)
+	}
+	return c.getAttributes(ctx, q.Select, args)
+}
+
+// queryMulti runs a query containing multiple statements, each of which
+// produces a result set. All of the statements are parsed before any are run.
+func (c *conn) queryMulti(ctx context.Context, stmts []parse.Statement, args []driver.Value) (driver.Rows, error) {
+	rows := &multiRows{
+		ctx:  ctx,
+		conn: c,
+	}
+	for i, stmt := range stmts {
+		q, err := c.parseCache.parse(stmt.Text)
+		if err == nil {
+			err = checkQuery(q)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid statement").With("index", i)
+		}
+		c.applyDefaults(q)
+		rows.stmts = append(rows.stmts, stmt.Text)
+		rows.queries = append(rows.queries, q)
+		rows.args = append(rows.args, splitArgs(&args, stmt.Placeholders))
+	}
+	if err := rows.NextResultSet(); err != nil {
+		return nil, err
 	}
+	return rows, nil
+}
 
-	return c.getAttributes(ctx, q.Select, getArgs(args))
+// splitArgs removes the first n args from the list and returns them.
+func splitArgs(args *[]driver.Value, n int) []driver.Value {
+	if n > len(*args) {
+		n = len(*args)
+	}
+	list := (*args)[:n]
+	*args = (*args)[n:]
+	return list
 }
 
 func (c *conn) getAttributes(ctx context.Context, q *parse.SelectQuery, args []driver.Value) (driver.Rows, error) {
-	itemName, err := q.Key.String(args)
+	getAttributesInput, err := c.newGetAttributesInput(ctx, q, args)
 	if err != nil {
 		return nil, err
 	}
-	domainName := c.getDomainName(q.TableName)
+	itemName := derefString(getAttributesInput.ItemName)
+	domainName := derefString(getAttributesInput.DomainName)
+	rows := newGetAttributeRows(q.ColumnNames, c.meta)
+	filter := c.newTTLFilter()
 
-	getAttributesInput := simpledb.GetAttributesInput{
-		ConsistentRead: aws.Bool(q.ConsistentRead),
-		DomainName:     aws.String(domainName),
-		ItemName:       aws.String(itemName),
-		AttributeNames: make([]*string, 0, len(q.ColumnNames)*2+1),
+	if c.ItemCache != nil && !q.ConsistentRead {
+		if attrs, ok := c.ItemCache.Get(domainName, itemName); ok && (len(attrs) > 0 || !(c.retryMissingItems || q.ExpectRows)) {
+			rows.setItem(itemName, attrs, filter)
+			c.verifyItemChecksum(ctx, q, getAttributesInput, rows)
+			c.repairGetItem(ctx, domainName, rows)
+			return rows, nil
+		}
 	}
 
-	for _, columnName := range q.ColumnNames {
-		getAttributesInput.AttributeNames = append(getAttributesInput.AttributeNames,
-			aws.String(columnName),
-			aws.String("sql:"+columnName),
-		)
+	getAttributesOutput, err := c.SimpleDB.GetAttributesWithContext(ctx, getAttributesInput, requestOptions(ctx)...)
+	missing := err == nil && len(getAttributesOutput.Attributes) == 0
+	if (missing && c.retryMissingItems && !q.ConsistentRead) || c.retryConsistent(q, err, missing) {
+		// the item might have been inserted too recently to be visible
+		// to an eventually consistent read
+		getAttributesInput.ConsistentRead = aws.Bool(true)
+		getAttributesOutput, err = c.SimpleDB.GetAttributesWithContext(ctx, getAttributesInput, requestOptions(ctx)...)
 	}
-	getAttributesInput.AttributeNames = append(getAttributesInput.AttributeNames, aws.String("sql:id"))
-
-	getAttributesOutput, err := c.SimpleDB.GetAttributesWithContext(ctx, &getAttributesInput)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot get item").With(
-			"itemName", itemName,
+			"itemName", c.redact(itemName),
 			"table", q.TableName,
 			"domain", domainName,
 		)
 	}
-	rows := newGetAttributeRows(q.ColumnNames)
-	if len(getAttributesOutput.Attributes) > 0 {
-		rows.item = &simpledb.Item{
-			Name:       aws.String(itemName),
-			Attributes: getAttributesOutput.Attributes,
-		}
+	if c.ItemCache != nil {
+		c.ItemCache.Put(domainName, itemName, getAttributesOutput.Attributes, aws.BoolValue(getAttributesInput.ConsistentRead))
 	}
+	rows.setItem(itemName, getAttributesOutput.Attributes, filter)
+	c.verifyItemChecksum(ctx, q, getAttributesInput, rows)
+	c.repairGetItem(ctx, domainName, rows)
 	return rows, nil
 }
 
+// repairGetItem completes the pending update, if any, of the item returned
+// by a "where id = ?" select query.
+func (c *conn) repairGetItem(ctx context.Context, domainName string, rows *getAttributesRows) {
+	if rows.item != nil {
+		c.repairItem(ctx, domainName, rows.item)
+	}
+}
+
+// verifyItemChecksum verifies the checksum of the item returned by a
+// "where id = ?" select query, if all of its attributes were read.
+func (c *conn) verifyItemChecksum(ctx context.Context, q *parse.SelectQuery, input *simpledb.GetAttributesInput, rows *getAttributesRows) {
+	if rows.item != nil && len(input.AttributeNames) == 0 {
+		c.verifyChecksum(ctx, q.TableName, rows.item)
+	}
+}
+
+// newGetAttributesInput returns the get attributes request for a "where id = ?" select query.
+func (c *conn) newGetAttributesInput(ctx context.Context, q *parse.SelectQuery, args []driver.Value) (*simpledb.GetAttributesInput, error) {
+	itemName, err := q.Key.String(args)
+	if err != nil {
+		return nil, err
+	}
+	domainName, err := c.resolveDomainName(ctx, q.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	getAttributesInput := &simpledb.GetAttributesInput{
+		ConsistentRead: aws.Bool(q.ConsistentRead),
+		DomainName:     aws.String(domainName),
+		ItemName:       aws.String(itemName),
+	}
+	if c.ItemCache != nil || q.AllColumns {
+		// the item cache holds all of the item's attributes, so that
+		// it can satisfy any subsequent query for the item
+		return getAttributesInput, nil
+	}
+	if c.meta.raw {
+		// raw items have no attribute that is always present, so all
+		// attributes are needed to tell whether the item exists
+		return getAttributesInput, nil
+	}
+	attributeNames := c.meta.attributeNames(q.ColumnNames)
+	if idAttr := c.meta.idAttr(); idAttr != "" {
+		attributeNames = append(attributeNames, idAttr)
+	}
+	attributeNames = c.appendTTLColumn(attributeNames, q.ColumnNames)
+	if c.meta.txn {
+		attributeNames = append(attributeNames, c.meta.txnAttr())
+	}
+	getAttributesInput.AttributeNames = aws.StringSlice(attributeNames)
+	return getAttributesInput, nil
+}
+
 func (c *conn) selectQuery(ctx context.Context, q *parse.SelectQuery, args []driver.Value) (driver.Rows, error) {
-	selectExpression, err := c.makeSelectExpression(q, args)
+	if err := c.checkScan(ctx, q); err != nil {
+		return nil, err
+	}
+	queries, err := splitInList(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(queries) > 1 {
+		return c.selectBatches(ctx, queries, args)
+	}
+	selectExpression, err := c.makeSelectExpression(ctx, q, args)
 	if err != nil {
 		return nil, err
 	}
@@ -138,28 +408,112 @@ func (c *conn) selectQuery(ctx context.Context, q *parse.SelectQuery, args []dri
 		SelectExpression: aws.String(selectExpression),
 	}
 
-	rows := newRows(ctx, c.SimpleDB, q.ColumnNames, selectInput)
-	if err := rows.selectNext(); err != nil {
+	rows := newRows(ctx, c.SimpleDB, q.ColumnNames, c.meta, selectInput)
+	rows.ttl = c.newTTLFilter()
+	rows.guard = c.newSelectGuard(q)
+	rows.guard.statement = c.redactExpression(selectExpression)
+	if rows.repair, err = c.newRepairer(ctx, q.TableName); err != nil {
 		return nil, err
 	}
+	err = rows.selectNext()
+	if c.retryConsistent(q, err, err == nil && len(rows.items) == 0 && selectInput.NextToken == nil) {
+		selectInput.ConsistentRead = aws.Bool(true)
+		selectInput.NextToken = nil
+		rows.guard = c.newSelectGuard(q)
+		rows.guard.statement = c.redactExpression(selectExpression)
+		err = rows.selectNext()
+	}
+	if err != nil {
+		return nil, rows.guard.deadlineError(ctx, err)
+	}
+	if c.spoolThreshold > 0 && selectInput.NextToken != nil {
+		rows.spool = startSpool(rows, c.spoolThreshold, c.spoolDir)
+	}
 
 	return rows, nil
 }
 
+// invalidateItem removes an item that has been modified from the item cache.
+func (c *conn) invalidateItem(domainName, itemName *string) {
+	if c.ItemCache != nil {
+		c.ItemCache.Invalidate(derefString(domainName), derefString(itemName))
+	}
+}
+
+// domainNameMarker is the prefix of a table name that is a SimpleDB domain
+// name, such as "@prod.tbl", which is not resolved by TableNameFunc,
+// SynonymResolver, Synonyms or Schema.
+const domainNameMarker = "@"
+
+// resolveDomainName returns the SimpleDB domain name for a table name. If the
+// SynonymResolver returns a domain name for the table, it takes precedence.
+func (c *conn) resolveDomainName(ctx context.Context, tableName string) (string, error) {
+	if strings.HasPrefix(tableName, domainNameMarker) {
+		return strings.TrimPrefix(tableName, domainNameMarker), nil
+	}
+	if c.TableNameFunc != nil {
+		derived, err := c.TableNameFunc(ctx, tableName)
+		if err != nil {
+			return "", errors.Wrap(err, "cannot derive table name").With(
+				"table", tableName,
+			)
+		}
+		tableName = derived
+	}
+	if c.SynonymResolver != nil {
+		domainName, err := c.SynonymResolver.Resolve(ctx, tableName)
+		if err != nil {
+			return "", errors.Wrap(err, "cannot resolve synonym").With(
+				"table", tableName,
+			)
+		}
+		if domainName != "" {
+			return domainName, nil
+		}
+	}
+	return c.getDomainName(tableName), nil
+}
+
 func (c *conn) getDomainName(tableName string) string {
 	if dn, ok := c.Synonyms[tableName]; ok {
 		return dn
 	}
-	if c.Schema != "" {
+	if c.Schema != "" && !c.isSchemaExcluded(tableName) && !strings.Contains(tableName, ".") {
 		return c.Schema + "." + tableName
 	}
 	return tableName
 }
 
-func (c *conn) makeSelectExpression(q *parse.SelectQuery, args []driver.Value) (string, error) {
-	quoteIdentifier := func(columnName string) string {
-		s := strings.Replace(columnName, "`", "``", -1)
-		return "`" + s + "`"
+func (c *conn) isSchemaExcluded(tableName string) bool {
+	for _, pattern := range c.SchemaExclusions {
+		if matched, _ := path.Match(pattern, tableName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// selectsOnlyID returns true if a select query needs no attributes, because
+// it selects only the id column, and there is no TTL column to check. The
+// query selects "itemName()", which returns every matching item without
+// any of its attributes. Otherwise each item's id attribute is selected,
+// so that every matching item is returned.
+func (c *conn) selectsOnlyID(q *parse.SelectQuery) bool {
+	if q.AllColumns || c.ttlColumn != "" {
+		return false
+	}
+	for _, columnName := range q.ColumnNames {
+		if !parse.IsID(columnName) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *conn) makeSelectExpression(ctx context.Context, q *parse.SelectQuery, args []driver.Value) (string, error) {
+	domainName, err := c.resolveDomainName(ctx, q.TableName)
+	if err != nil {
+		return "", err
 	}
 	getArg := func(index int) (string, error) {
 		if index >= len(args) {
@@ -169,54 +523,235 @@ func (c *conn) makeSelectExpression(q *parse.SelectQuery, args []driver.Value) (
 		if s, ok := v.(string); ok {
 			return s, nil
 		}
+		if b, ok := v.(bool); ok {
+			// compared with the encoding of bool columns
+			return strconv.FormatBool(b), nil
+		}
+		if r, ok := v.(*big.Rat); ok {
+			// compared with the sortable encoding of decimal columns
+			value, err := encodeDecimal(r)
+			if err != nil {
+				return "", c.withValue(err, r.RatString())
+			}
+			return value, nil
+		}
+		switch v.(type) {
+		case uint64, *big.Int:
+			// compared with the encoding of integer columns
+			_, value, err := encodeValue(v)
+			return value, err
+		}
 		vv := reflect.ValueOf(v)
 		if vv.Kind() == reflect.String {
 			return vv.String(), nil
 		}
-		return "", errors.New("all args to a select query must be strings")
+		return "", errors.New("all args to a select query must be strings, integers, decimals or bools")
 	}
-	columnNames := make([]string, 0, len(q.ColumnNames)*2+1)
-	columnNames = append(columnNames, quoteIdentifier("sql:id"))
-	for _, columnName := range q.ColumnNames {
-		if !parse.IsID(columnName) {
-			columnNames = append(columnNames, quoteIdentifier(columnName))
-			columnNames = append(columnNames, quoteIdentifier("sql:"+columnName))
+	getIDArg := func(index int) (string, error) {
+		// item names are compared as strings, so other args would not
+		// match the encoding of the id column
+		if index < len(args) {
+			if vv := reflect.ValueOf(args[index]); vv.Kind() != reflect.String {
+				return "", errors.New("args compared with id must be strings").With("index", index)
+			}
 		}
+		return getArg(index)
+	}
+	var attributeNames []string
+	if idAttr := c.meta.idAttr(); idAttr != "" && !c.selectsOnlyID(q) {
+		attributeNames = append(attributeNames, idAttr)
+	}
+	attributeNames = append(attributeNames, c.meta.attributeNames(q.ColumnNames)...)
+	attributeNames = c.appendTTLColumn(attributeNames, q.ColumnNames)
+	if c.meta.txn && !c.selectsOnlyID(q) {
+		attributeNames = append(attributeNames, c.meta.txnAttr())
+	}
+	columnNames := make([]string, 0, len(attributeNames))
+	for _, attributeName := range attributeNames {
+		columnNames = append(columnNames, quoteIdentifier(attributeName))
+	}
+	if len(columnNames) == 0 {
+		// only the item name is selected
+		columnNames = append(columnNames, "itemName()")
+	}
+
+	if q.AllColumns {
+		columnNames = []string{"*"}
 	}
 
 	var sb strings.Builder
 	sb.WriteString("select ")
 	sb.WriteString(strings.Join(columnNames, ", "))
 	sb.WriteString(" from ")
-	sb.WriteString(quoteIdentifier(c.getDomainName(q.TableName)))
+	sb.WriteString(quoteIdentifier(domainName))
 	sb.WriteString(" ")
 	var argIndex int
-	for _, lexeme := range q.WhereClause {
-		switch lexeme {
-		case "id", "`id`":
+	whereClause, err := c.checkSort(q)
+	if err != nil {
+		return "", err
+	}
+	whereClause = c.meta.translateNulls(translateBools(whereClause))
+	whereClause, args, err = c.meta.translateMatches(whereClause, args)
+	if err != nil {
+		return "", err
+	}
+	whereClause, args = c.meta.translateFolded(whereClause, args)
+	var comparesID bool // true if the last column is the id column
+	for _, lexeme := range whereClause {
+		argFunc := getArg
+		if comparesID {
+			argFunc = getIDArg
+		}
+		switch {
+		case isIDLexeme(lexeme):
 			sb.WriteString("itemName()")
-		case "?":
-			arg, err := getArg(argIndex)
+			comparesID = true
+		case lexeme == "?":
+			arg, err := argFunc(argIndex)
 			if err != nil {
 				return "", err
 			}
 			sb.WriteString(quoteString(arg))
 			argIndex++
 		default:
-			sb.WriteString(lexeme)
+			if ordinal, ok := parse.NumberedPlaceholder(lexeme); ok {
+				arg, err := argFunc(ordinal)
+				if err != nil {
+					return "", err
+				}
+				sb.WriteString(quoteString(arg))
+			} else {
+				if isIdentLexeme(lexeme) {
+					comparesID = strings.EqualFold(lexeme, "itemName")
+				}
+				sb.WriteString(lexeme)
+			}
+		}
+	}
+	if q.Key != nil {
+		// the where clause of a "where id = ?" query is held in the key
+		itemName, err := q.Key.String(args)
+		if err != nil {
+			return "", err
 		}
+		sb.WriteString("where itemName() = ")
+		sb.WriteString(quoteString(itemName))
+	}
+	selectExpression := sb.String()
+	if err := checkSelectLimits(whereClause, selectExpression); err != nil {
+		return "", err
 	}
-	return sb.String(), nil
+	return selectExpression, nil
 }
 
 func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
-	q, err := parse.Parse(query)
+	defer c.beginInvalidations(ctx)()
+	stmts, err := parse.Split(query)
 	if err != nil {
 		return nil, err
 	}
+	if len(stmts) > 1 {
+		if err := checkMultiArgs(stmts, len(args)); err != nil {
+			return nil, err
+		}
+		ctx, cancel := c.withTimeout(ctx, nil)
+		if cancel != nil {
+			defer cancel()
+		}
+		return c.execMulti(ctx, stmts, getArgs(args))
+	}
+	if len(stmts) == 1 {
+		// removes any trailing semicolon
+		query = stmts[0].Text
+	}
+	q, err := c.parseCache.parse(query)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkExec(q); err != nil {
+		return nil, err
+	}
+	if err := checkArgs(q.Placeholders, len(args)); err != nil {
+		return nil, err
+	}
+	ctx, cancel := c.withTimeout(ctx, q)
+	if cancel != nil {
+		defer cancel()
+	}
+	return c.execStatement(ctx, query, q, getArgs(args))
+}
+
+// checkArgs returns an error if the number of args supplied is not the
+// number used by the placeholders of a statement, before the statement
+// uses any of them.
+func checkArgs(placeholders int, args int) error {
+	var err errors.Error
+	switch {
+	case args < placeholders:
+		err = errors.New("not enough args supplied")
+	case args > placeholders:
+		err = errors.New("too many args supplied")
+	default:
+		return nil
+	}
+	return err.With(
+		"placeholders", placeholders,
+		"args", args,
+	)
+}
+
+// checkMultiArgs returns an error if the number of args supplied is not
+// the number used by the placeholders of all of the statements of a query.
+func checkMultiArgs(stmts []parse.Statement, args int) error {
+	var placeholders int
+	for _, stmt := range stmts {
+		placeholders += stmt.Placeholders
+	}
+	return checkArgs(placeholders, args)
+}
+
+// checkExec returns an error if q cannot be run by ExecContext.
+func checkExec(q *parse.Query) error {
+	if q.Explain {
+		return errors.New("unexpected explain query for ExecContext")
+	}
 	if q.Select != nil {
-		return nil, errors.New("unexpected select query for ExecContext")
+		return errors.New("unexpected select query for ExecContext")
+	}
+	if q.ShowColumns != nil {
+		return errors.New("unexpected show columns query for ExecContext")
+	}
+	if hasReturning(q) {
+		return errors.New("unexpected returning clause for ExecContext, use QueryContext")
+	}
+	return nil
+}
+
+// execStatement runs a statement, recording it in the audit table if the
+// Connector has an AuditTable and the statement modifies an item. Statements
+// with a subquery, which modify many items, are not recorded.
+func (c *conn) execStatement(ctx context.Context, stmt string, q *parse.Query, args []driver.Value) (driver.Result, error) {
+	q, args, err := c.completeInsert(q, args)
+	if err != nil {
+		return nil, err
 	}
+	if c.audit != nil && (q.Insert != nil || isItemUpdate(q) || isItemDelete(q)) {
+		return c.auditExec(ctx, stmt, q, args)
+	}
+	return c.exec(ctx, q, args)
+}
+
+// isItemUpdate returns true if q is an update statement that modifies a single item.
+func isItemUpdate(q *parse.Query) bool {
+	return q.Update != nil && q.Update.Subquery == nil
+}
+
+// isItemDelete returns true if q is a delete statement that deletes a single item.
+func isItemDelete(q *parse.Query) bool {
+	return q.Delete != nil && q.Delete.Subquery == nil
+}
+
+func (c *conn) exec(ctx context.Context, q *parse.Query, args []driver.Value) (driver.Result, error) {
 	if q.CreateTable != nil {
 		return c.createTable(ctx, q.CreateTable)
 	}
@@ -224,35 +759,121 @@ func (c *conn) ExecContext(ctx context.Context, query string, args []driver.Name
 		return c.dropTable(ctx, q.DropTable)
 	}
 	if q.Insert != nil {
-		return c.insertRow(ctx, q.Insert, getArgs(args))
+		return c.insertRow(ctx, q.Insert, args)
 	}
 	if q.Update != nil {
-		return c.updateRow(ctx, q.Update, getArgs(args))
+		if q.Update.Subquery != nil {
+			return c.bulkUpdate(ctx, q.Update, args)
+		}
+		return c.updateRow(ctx, q.Update, args)
 	}
 	if q.Delete != nil {
-		return c.deleteRow(ctx, q.Delete, getArgs(args))
+		if q.Delete.Subquery != nil {
+			return c.bulkDelete(ctx, q.Delete, args)
+		}
+		return c.deleteRow(ctx, q.Delete, args)
 	}
 
 	return nil, errors.New("unsupported query")
 }
 
+// execMulti runs a query containing multiple statements in order, and returns
+// the total number of rows affected. All of the statements are parsed before
+// any are run. If a statement fails, the statements before it remain applied.
+func (c *conn) execMulti(ctx context.Context, stmts []parse.Statement, args []driver.Value) (driver.Result, error) {
+	queries := make([]*parse.Query, len(stmts))
+	stmtArgs := make([][]driver.Value, len(stmts))
+	for i, stmt := range stmts {
+		q, err := c.parseCache.parse(stmt.Text)
+		if err == nil {
+			err = checkExec(q)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid statement").With("index", i)
+		}
+		queries[i] = q
+		stmtArgs[i] = splitArgs(&args, stmt.Placeholders)
+	}
+
+	var rowsAffected int64
+	for i, q := range queries {
+		result, err := c.execStatement(ctx, stmts[i].Text, q, stmtArgs[i])
+		if err == nil {
+			var n int64
+			n, err = result.RowsAffected()
+			rowsAffected += n
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot execute statement").With(
+				"index", i,
+				"rowsAffected", rowsAffected,
+			)
+		}
+	}
+	return &resultT{rowsAffected: rowsAffected}, nil
+}
+
 func (c *conn) CheckNamedValue(arg *driver.NamedValue) (err error) {
 	if arg.Name != "" {
 		return errors.New("named args are not implemented")
 	}
-	arg.Value, err = driver.DefaultParameterConverter.ConvertValue(arg.Value)
+	switch v := arg.Value.(type) {
+	case uint64:
+		// the default converter rejects values greater than math.MaxInt64
+		return nil
+	case *big.Int:
+		if v == nil {
+			arg.Value = nil
+		}
+		return nil
+	case big.Int:
+		arg.Value = &v
+		return nil
+	case *big.Rat:
+		if v == nil {
+			arg.Value = nil
+		}
+		return nil
+	case big.Rat:
+		arg.Value = &v
+		return nil
+	case Decimal:
+		if arg.Value, err = parseDecimal(v); err != nil {
+			return c.withValue(err, string(v))
+		}
+		return nil
+	}
+	arg.Value, err = convertValue(arg.Value)
 	if err != nil {
+		if e, ok := err.(errors.Error); ok {
+			return e.With("ordinal", arg.Ordinal)
+		}
 		return err
 	}
 	return nil
 }
 
 func (c *conn) createTable(ctx context.Context, q *parse.CreateTableQuery) (driver.Result, error) {
-	domainName := c.getDomainName(q.TableName)
+	domainName, err := c.resolveDomainName(ctx, q.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if q.IfNotExists && c.domains != nil {
+		// creating a domain that exists has no effect, but listing
+		// cached domain names avoids the request
+		exists, err := c.domainExists(ctx, domainName)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return newResult(0), nil
+		}
+	}
 	input := simpledb.CreateDomainInput{
 		DomainName: aws.String(domainName),
 	}
-	_, err := c.SimpleDB.CreateDomainWithContext(ctx, &input)
+	_, err = c.SimpleDB.CreateDomainWithContext(ctx, &input, requestOptions(ctx)...)
+	c.domains.invalidate()
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot create simpledb domain").With(
 			"domain", domainName,
@@ -263,11 +884,21 @@ func (c *conn) createTable(ctx context.Context, q *parse.CreateTableQuery) (driv
 }
 
 func (c *conn) dropTable(ctx context.Context, q *parse.DropTableQuery) (driver.Result, error) {
-	domainName := c.getDomainName(q.TableName)
+	domainName, err := c.resolveDomainName(ctx, q.TableName)
+	if err != nil {
+		return nil, err
+	}
 	input := simpledb.DeleteDomainInput{
-		DomainName: aws.String(c.getDomainName(domainName)),
+		DomainName: aws.String(domainName),
+	}
+	_, err = c.SimpleDB.DeleteDomainWithContext(ctx, &input, requestOptions(ctx)...)
+	c.domains.invalidate()
+	if c.ItemCache != nil {
+		c.ItemCache.InvalidateDomain(domainName)
+	}
+	if c.schemas != nil {
+		c.schemas.forgetDomain(domainName)
 	}
-	_, err := c.SimpleDB.DeleteDomainWithContext(ctx, &input)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot delete simpledb domain").With(
 			"domain", domainName,
@@ -278,69 +909,216 @@ func (c *conn) dropTable(ctx context.Context, q *parse.DropTableQuery) (driver.R
 }
 
 func (c *conn) deleteRow(ctx context.Context, q *parse.DeleteQuery, args []driver.Value) (driver.Result, error) {
-	itemName, err := q.Key.String(args)
+	deleteInput, err := c.newDeleteInput(ctx, q, args)
 	if err != nil {
 		return nil, err
 	}
-	deleteInput := simpledb.DeleteAttributesInput{
-		DomainName: aws.String(c.getDomainName(q.TableName)),
-		ItemName:   aws.String(itemName),
+	old, err := c.oldDeleteValues(ctx, q.TableName, derefString(deleteInput.ItemName))
+	if err != nil {
+		return nil, err
 	}
-	_, err = c.SimpleDB.DeleteAttributesWithContext(ctx, &deleteInput)
+	_, err = c.SimpleDB.DeleteAttributesWithContext(ctx, deleteInput, requestOptions(ctx)...)
+	c.invalidateItem(deleteInput.DomainName, deleteInput.ItemName)
 	if err != nil {
+		if q.If != nil && (hasCode(err, conditionalCheckFailed) || hasCode(err, attributeDoesNotExist)) {
+			// not an error, the item does not have the expected value
+			return newResult(0), nil
+		}
 		return nil, errors.Wrap(err, "cannot delete attributes").With(
-			"itemName", itemName,
+			"itemName", c.redact(derefString(deleteInput.ItemName)),
 		)
 	}
+	c.afterDelete(ctx, q, deleteInput.DomainName, deleteInput.ItemName, old)
+	if q.If != nil {
+		// the condition shows that the item existed
+		return newResult(1), nil
+	}
 	// TODO(jpj): would have to perform a get first to know if we deleted something
 	return newResult(0), nil
 }
 
+// newDeleteInput returns the delete attributes request for a delete query.
+func (c *conn) newDeleteInput(ctx context.Context, q *parse.DeleteQuery, args []driver.Value) (*simpledb.DeleteAttributesInput, error) {
+	itemName, err := q.Key.String(args)
+	if err != nil {
+		return nil, err
+	}
+	domainName, err := c.resolveDomainName(ctx, q.TableName)
+	if err != nil {
+		return nil, err
+	}
+	deleteInput := &simpledb.DeleteAttributesInput{
+		DomainName: aws.String(domainName),
+		ItemName:   aws.String(itemName),
+	}
+	if q.If != nil {
+		if deleteInput.Expected, err = c.newIfCondition(q.If, args); err != nil {
+			return nil, err
+		}
+	}
+	return deleteInput, nil
+}
+
 func (c *conn) insertRow(ctx context.Context, q *parse.InsertQuery, args []driver.Value) (driver.Result, error) {
-	putInput, _, err := c.newPutDeleteInputs(ctx, q.TableName, q.Columns, q.Key, args)
+	if err := c.validateWrite(q.TableName, &q.Key, q.Columns, args); err != nil {
+		return nil, err
+	}
+	putInput, err := c.newInsertInput(ctx, q, args)
 	if err != nil {
 		return nil, err
 	}
-	// Add a condition that the item must not already exist.
-	// The `sql:id` attribute is added to every item.
-	putInput.Expected = &simpledb.UpdateCondition{
-		Exists: aws.Bool(false),
-		Name:   aws.String("sql:id"),
+	if c.meta.raw {
+		// raw items have no attribute for the put request's condition
+		exists, err := c.itemExists(ctx, putInput.DomainName, putInput.ItemName)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return c.insertDuplicate(ctx, q, args, putInput)
+		}
 	}
 
-	_, err = c.SimpleDB.PutAttributesWithContext(ctx, putInput)
+	var retries int
+	opts := requestOptions(ctx)
+	if c.idempotentInserts {
+		opts = append(opts, retryCountOption(&retries))
+	}
+	_, err = c.SimpleDB.PutAttributesWithContext(ctx, putInput, opts...)
+	c.invalidateItem(putInput.DomainName, putInput.ItemName)
 	if err != nil {
-		if hasCode(err, conditionalCheckFailed) {
-			msg := fmt.Sprintf(
-				"cannot insert duplicate key table=%q itemName=%q",
-				derefString(putInput.DomainName),
-				derefString(putInput.ItemName),
+		if !hasCode(err, conditionalCheckFailed) {
+			return nil, errors.Wrap(err, "cannot put attributes").With(
+				"itemName", c.redact(derefString(putInput.ItemName)),
 			)
-			return nil, duplicateKeyError(msg)
 		}
-		return nil, errors.Wrap(err, "cannot put attributes").With(
-			"itemName", derefString(putInput.ItemName),
-		)
+		if retries == 0 {
+			return c.insertDuplicate(ctx, q, args, putInput)
+		}
+		inserted, err := c.insertApplied(ctx, putInput)
+		if err != nil {
+			return nil, err
+		}
+		if !inserted {
+			return c.insertDuplicate(ctx, q, args, putInput)
+		}
+	}
+	if err := c.recordSchema(ctx, putInput.DomainName, putInput.Attributes); err != nil {
+		return nil, err
 	}
+	c.afterInsert(ctx, q, putInput.DomainName, putInput.ItemName, args)
 
 	return newResult(1), nil
 }
 
-func (c *conn) updateRow(ctx context.Context, q *parse.UpdateQuery, args []driver.Value) (driver.Result, error) {
-	putInput, deleteInput, err := c.newPutDeleteInputs(ctx, q.TableName, q.Columns, q.Key, args)
+// completeInsert returns an insert statement with the values that the
+// driver adds to the item, which are a generated id if the statement has
+// no id column, the created time, and the defaults of columns that it does
+// not set. Other statements are returned unchanged.
+func (c *conn) completeInsert(q *parse.Query, args []driver.Value) (*parse.Query, []driver.Value, error) {
+	q, err := c.generateKey(q)
+	if err != nil {
+		return nil, nil, err
+	}
+	q, args = c.addCreated(q, args)
+	return c.addColumnDefaults(q, args)
+}
+
+// insertDuplicate handles an insert query for an item that already exists.
+func (c *conn) insertDuplicate(ctx context.Context, q *parse.InsertQuery, args []driver.Value, putInput *simpledb.PutAttributesInput) (driver.Result, error) {
+	if q.OnDuplicateKeyUpdate != nil {
+		return c.duplicateKeyUpdate(ctx, q, args)
+	}
+	if q.Ignore {
+		return newResult(0), nil
+	}
+	msg := fmt.Sprintf(
+		"cannot insert duplicate key table=%q itemName=%q",
+		derefString(putInput.DomainName),
+		c.redact(derefString(putInput.ItemName)),
+	)
+	return nil, duplicateKeyError(msg)
+}
+
+// itemExists reports whether an item exists, using a consistent read. It is
+// used for raw items, which cannot be the subject of an update condition.
+// Because the item can be changed between the read and a subsequent write,
+// the result is advisory.
+func (c *conn) itemExists(ctx context.Context, domainName *string, itemName *string) (bool, error) {
+	input := &simpledb.GetAttributesInput{
+		DomainName:     domainName,
+		ItemName:       itemName,
+		ConsistentRead: aws.Bool(true),
+	}
+	output, err := c.SimpleDB.GetAttributesWithContext(ctx, input, requestOptions(ctx)...)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot get item").With(
+			"itemName", c.redact(derefString(itemName)),
+		)
+	}
+	return len(output.Attributes) > 0, nil
+}
+
+// duplicateKeyUpdate updates an item that could not be inserted because
+// it already exists. Like MySQL, the number of rows affected is 2 if the
+// item was updated.
+func (c *conn) duplicateKeyUpdate(ctx context.Context, q *parse.InsertQuery, args []driver.Value) (driver.Result, error) {
+	result, err := c.updateRow(ctx, newDuplicateKeyUpdateQuery(q), args)
 	if err != nil {
 		return nil, err
 	}
-	if !q.Upsert {
-		// Add a condition that the item must already exist.
-		// The `sql:id` attribute is added to every item.
-		putInput.Expected = &simpledb.UpdateCondition{
-			Exists: aws.Bool(true),
-			Name:   aws.String("sql:id"),
-			// TODO(jpj): if/when we allow int64 keys, we need to get the key type from the query
-			Value: aws.String("string"),
+	if result.rowsAffected > 0 {
+		result.rowsAffected = 2
+	}
+	return result, nil
+}
+
+// newDuplicateKeyUpdateQuery returns the update query for the
+// "on duplicate key update" clause of an insert query.
+func newDuplicateKeyUpdateQuery(q *parse.InsertQuery) *parse.UpdateQuery {
+	return &parse.UpdateQuery{
+		TableName: q.TableName,
+		Columns:   q.OnDuplicateKeyUpdate,
+		Key:       q.Key,
+	}
+}
+
+func (c *conn) updateRow(ctx context.Context, q *parse.UpdateQuery, args []driver.Value) (*resultT, error) {
+	if err := c.validateWrite(q.TableName, &q.Key, q.Columns, args); err != nil {
+		return nil, err
+	}
+	if q.If != nil && (c.meta.checksum || c.meta.packed) {
+		// the put request already has a condition
+		return nil, errors.New("if clause is not supported with checksums or packed metadata")
+	}
+	old, err := c.oldUpdateValues(ctx, q, args)
+	if err != nil {
+		return nil, err
+	}
+	if c.meta.checksum {
+		return c.updateChecksumRow(ctx, q, args, old)
+	}
+	if c.meta.packed {
+		return c.updatePackedRow(ctx, q, args, old)
+	}
+	putInput, deleteInput, err := c.newUpdateInputs(ctx, q, args)
+	if err != nil {
+		return nil, err
+	}
+	if c.meta.raw && !q.Upsert && q.If == nil {
+		// raw items have no attribute for the requests' condition
+		exists, err := c.itemExists(ctx, putInput.DomainName, putInput.ItemName)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return newResult(0), nil
 		}
-		deleteInput.Expected = putInput.Expected
+	}
+	if c.meta.txn && len(putInput.Attributes) > 0 && len(deleteInput.Attributes) > 0 {
+		return c.updateTwoPhaseRow(ctx, q, args, putInput, deleteInput, old)
+	}
+	if q.If != nil {
+		return c.updateConditionalRow(ctx, q, args, putInput, deleteInput, old)
 	}
 
 	// An update may consist of either a put or a delete, or maybe both.
@@ -349,38 +1127,38 @@ func (c *conn) updateRow(ctx context.Context, q *parse.UpdateQuery, args []drive
 	// updated and the rowcount is 1.
 	var putItemExists, delItemExists bool
 
-	group, ctx := errgroup.WithContext(ctx)
+	group, groupCtx := c.newRequestGroup(ctx)
 
 	if len(putInput.Attributes) > 0 {
 		group.Go(func() error {
 			var err error
-			_, err = c.SimpleDB.PutAttributesWithContext(ctx, putInput)
+			_, err = c.SimpleDB.PutAttributesWithContext(groupCtx, putInput, requestOptions(groupCtx)...)
 			if err != nil {
 				if hasCode(err, attributeDoesNotExist) {
 					// not an error, it just means the item does not exist
 					return nil
 				}
 				return errors.Wrap(err, "cannot put attributes").With(
-					"itemName", derefString(putInput.ItemName),
+					"itemName", c.redact(derefString(putInput.ItemName)),
 				)
 			}
 
 			// item was updated
 			putItemExists = true
-			return nil
+			return c.recordSchema(groupCtx, putInput.DomainName, putInput.Attributes)
 		})
 	}
 	if len(deleteInput.Attributes) > 0 {
 		group.Go(func() error {
 			var err error
-			_, err = c.SimpleDB.DeleteAttributesWithContext(ctx, deleteInput)
+			_, err = c.SimpleDB.DeleteAttributesWithContext(groupCtx, deleteInput, requestOptions(groupCtx)...)
 			if err != nil {
 				if hasCode(err, attributeDoesNotExist) {
 					// not an error, it just means the item does not exist
 					return nil
 				}
 				return errors.Wrap(err, "cannot delete attributes").With(
-					"itemName", derefString(deleteInput.ItemName),
+					"itemName", c.redact(derefString(deleteInput.ItemName)),
 				)
 			}
 			// item was updated
@@ -389,18 +1167,76 @@ func (c *conn) updateRow(ctx context.Context, q *parse.UpdateQuery, args []drive
 		})
 	}
 
-	if err := group.Wait(); err != nil {
+	err = group.Wait()
+	c.invalidateItem(putInput.DomainName, putInput.ItemName)
+	if err != nil {
 		return nil, err
 	}
 
 	var rowCount int
 	if putItemExists || delItemExists {
 		rowCount = 1
+		c.afterUpdate(ctx, q, putInput.DomainName, putInput.ItemName, args, old)
 	}
 	return newResult(rowCount), nil
 
 }
 
+// newInsertInput returns the put attributes request for an insert query.
+func (c *conn) newInsertInput(ctx context.Context, q *parse.InsertQuery, args []driver.Value) (*simpledb.PutAttributesInput, error) {
+	putInput, _, err := c.newPutDeleteInputs(ctx, q.TableName, q.Columns, q.Key, args)
+	if err != nil {
+		return nil, err
+	}
+	if putInput.Attributes, err = c.meta.pack(putInput.Attributes, ""); err != nil {
+		return nil, err
+	}
+	if c.meta.checksum {
+		item := mergeAttributes(nil, putInput.Attributes, nil)
+		putInput.Attributes = c.meta.addChecksum(putInput.Attributes, item)
+	}
+	if !c.meta.raw {
+		// Add a condition that the item must not already exist.
+		// The id attribute is added to every item.
+		putInput.Expected = &simpledb.UpdateCondition{
+			Exists: aws.Bool(false),
+			Name:   aws.String(c.meta.idAttr()),
+		}
+	}
+	return putInput, nil
+}
+
+// newUpdateInputs returns the put and delete attributes requests for an update query.
+// Either request may have no attributes, in which case it should not be sent.
+// When the metadata is packed, the put request has unpacked type attributes
+// and no condition, as these depend on the item's existing packed types.
+func (c *conn) newUpdateInputs(ctx context.Context, q *parse.UpdateQuery, args []driver.Value) (*simpledb.PutAttributesInput, *simpledb.DeleteAttributesInput, error) {
+	putInput, deleteInput, err := c.newPutDeleteInputs(ctx, q.TableName, q.Columns, q.Key, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !q.Upsert && !c.meta.packed && !c.meta.raw {
+		// Add a condition that the item must already exist.
+		// The id attribute is added to every item.
+		putInput.Expected = &simpledb.UpdateCondition{
+			Exists: aws.Bool(true),
+			Name:   aws.String(c.meta.idAttr()),
+			// TODO(jpj): if/when we allow int64 keys, we need to get the key type from the query
+			Value: aws.String("string"),
+		}
+		deleteInput.Expected = putInput.Expected
+	}
+	if q.If != nil {
+		cond, err := c.newIfCondition(q.If, args)
+		if err != nil {
+			return nil, nil, err
+		}
+		putInput.Expected = cond
+		deleteInput.Expected = cond
+	}
+	return putInput, deleteInput, nil
+}
+
 // newPutDeleteInputs is common to insert and update. It assembles the attributes for the put item
 // and delete item requests. Bear in mind that SimpleDB cannot store blanks, so if a column is updated
 // to a blank string, it results in the attribute being deleted.
@@ -409,12 +1245,16 @@ func (c *conn) newPutDeleteInputs(ctx context.Context, tableName string, columns
 	if err != nil {
 		return nil, nil, err
 	}
+	domainName, err := c.resolveDomainName(ctx, tableName)
+	if err != nil {
+		return nil, nil, err
+	}
 	putInput = &simpledb.PutAttributesInput{
-		DomainName: aws.String(c.getDomainName(tableName)),
+		DomainName: aws.String(domainName),
 		ItemName:   aws.String(itemName),
 	}
 	deleteInput = &simpledb.DeleteAttributesInput{
-		DomainName: aws.String(c.getDomainName(tableName)),
+		DomainName: aws.String(domainName),
 		ItemName:   aws.String(itemName),
 	}
 	addPut := func(name, value string) {
@@ -425,8 +1265,11 @@ func (c *conn) newPutDeleteInputs(ctx context.Context, tableName string, columns
 		})
 	}
 	addType := func(name, value string) {
+		if c.meta.raw {
+			return
+		}
 		putInput.Attributes = append(putInput.Attributes, &simpledb.ReplaceableAttribute{
-			Name:    aws.String(typeColumnName(name)),
+			Name:    aws.String(c.meta.typeAttr(name)),
 			Replace: aws.Bool(true),
 			Value:   aws.String(value),
 		})
@@ -437,48 +1280,60 @@ func (c *conn) newPutDeleteInputs(ctx context.Context, tableName string, columns
 		})
 	}
 
-	// Every item has this attribute, which is used in the expected update condition,
-	// and forms the difference between an insert and an update.
-	addPut("sql:id", "string")
+	// Every item has a type for its id. Its attribute, or the packed types, is used
+	// in the expected update condition, and forms the difference between an insert
+	// and an update.
+	addType("id", "string")
 
 	for _, col := range columns {
-		v, err := col.GetValue(args)
+		if c.meta.checksum && !c.meta.packed && col.ColumnName == checksumColumn {
+			// its type attribute would be the checksum attribute
+			return nil, nil, errors.New("column name is reserved for checksums").With(
+				"column", col.ColumnName,
+			)
+		}
+		if !c.meta.packed && c.meta.isDerivedAttr(c.meta.typeAttr(col.ColumnName)) {
+			// its type attribute would hold values derived from another column
+			return nil, nil, errors.New("column name is reserved for derived attributes").With(
+				"column", col.ColumnName,
+			)
+		}
+		if c.meta.txn && !c.meta.packed && col.ColumnName == txnColumn {
+			// its type attribute would be the marker of pending updates
+			return nil, nil, errors.New("column name is reserved for two-phase updates").With(
+				"column", col.ColumnName,
+			)
+		}
+		typeName, value, err := c.encodeColumnValue(col, args)
 		if err != nil {
 			return nil, nil, err
 		}
-		if v == nil {
-			addType(col.ColumnName, "null")
+		addType(col.ColumnName, typeName)
+		if value == "" {
+			// cannot store an empty string
 			addDelete(col.ColumnName)
 		} else {
-			switch val := v.(type) {
-			case string:
-				addType(col.ColumnName, "string")
-				if val == "" {
-					// cannot store an empty string
-					addDelete(col.ColumnName)
-				} else {
-					addPut(col.ColumnName, val)
-				}
-			case int64:
-				addType(col.ColumnName, "int64")
-				addPut(col.ColumnName, strconv.FormatInt(val, 10))
-			case float64:
-				addType(col.ColumnName, "float64")
-				addPut(col.ColumnName, strconv.FormatFloat(val, 'g', -1, 64))
-			case time.Time:
-				addType(col.ColumnName, "time")
-				addPut(col.ColumnName, val.Format(time.RFC3339))
-			case bool:
-				addType(col.ColumnName, "bool")
-				addPut(col.ColumnName, strconv.FormatBool(val))
-			case []byte:
-				addType(col.ColumnName, "binary")
-				// TODO(jpj): handle strings longer than 1024
-				addPut(col.ColumnName, base64.StdEncoding.EncodeToString(val))
-			default:
-				// We should only get one of the above types, because the args were
-				// converted in the CheckNamedValue method.
-				return nil, nil, fmt.Errorf("unexpected arg type: %v", reflect.TypeOf(v))
+			addPut(col.ColumnName, value)
+		}
+		if c.meta.isFolded(col.ColumnName) {
+			if value != "" {
+				addPut(c.meta.foldedAttr(col.ColumnName), foldCase(value))
+			} else {
+				addDelete(c.meta.foldedAttr(col.ColumnName))
+			}
+		}
+		if c.meta.isSearched(col.ColumnName) {
+			words, err := columnWords(typeName, value)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "cannot record words").With(
+					"column", col.ColumnName,
+				)
+			}
+			for _, word := range words {
+				addPut(c.meta.wordsAttr(col.ColumnName), word)
+			}
+			if len(words) == 0 {
+				addDelete(c.meta.wordsAttr(col.ColumnName))
 			}
 		}
 	}
@@ -486,10 +1341,78 @@ func (c *conn) newPutDeleteInputs(ctx context.Context, tableName string, columns
 	return putInput, deleteInput, nil
 }
 
-func typeColumnName(columnName string) string {
-	// TODO(jpj): this fn probably needs to be in the parse package,
-	// because it needs to inject column names into the select statements
-	return "sql:" + columnName
+// encodeColumnValue returns the type name and the SimpleDB attribute value
+// for the value of a column, encoded according to the connection's settings.
+func (c *conn) encodeColumnValue(col parse.Column, args []driver.Value) (typeName string, value string, err error) {
+	v, err := col.GetValue(args)
+	if err != nil {
+		return "", "", err
+	}
+	typeName, value, err = encodeValue(v)
+	if err != nil {
+		if r, ok := v.(*big.Rat); ok {
+			err = c.withValue(err, r.RatString())
+		}
+		return "", "", err
+	}
+	if t, ok := v.(time.Time); ok && c.legacyTimeFormat {
+		typeName, value = encodeLegacyTime(t)
+	}
+	if b, ok := v.([]byte); ok && c.compactBinary {
+		typeName, value = encodeCompactBinary(b)
+	}
+	if typeName == "string" && value == "" && c.emptyStringSentinel != "" {
+		typeName, value = "empty", c.emptyStringSentinel
+	}
+	return typeName, value, nil
+}
+
+// encodeValue returns the type name and the SimpleDB attribute value for a
+// value. The attribute value is blank for nil values and empty strings, neither
+// of which can be stored in SimpleDB.
+func encodeValue(v driver.Value) (typeName string, value string, err error) {
+	switch val := v.(type) {
+	case nil:
+		return "null", "", nil
+	case string:
+		return "string", val, nil
+	case int64:
+		return "int64", strconv.FormatInt(val, 10), nil
+	case uint64:
+		// zero-padded so that values sort in numeric order
+		return "uint64", fmt.Sprintf("%020d", val), nil
+	case *big.Int:
+		return "bigint", val.String(), nil
+	case *big.Rat:
+		value, err := encodeDecimal(val)
+		return "decimal", value, err
+	case float64:
+		return "float64", strconv.FormatFloat(val, 'g', -1, 64), nil
+	case time.Time:
+		typeName, value := encodeTime(val)
+		return typeName, value, nil
+	case bool:
+		return "bool", strconv.FormatBool(val), nil
+	case []byte:
+		// TODO(jpj): handle strings longer than 1024
+		return "binary", base64.StdEncoding.EncodeToString(val), nil
+	default:
+		// We should only get one of the above types, because the args were
+		// converted in the CheckNamedValue method.
+		return "", "", fmt.Errorf("unexpected arg type: %v", reflect.TypeOf(v))
+	}
+}
+
+// isIDLexeme returns true if a lexeme of a where clause is the id column,
+// which can be quoted with backticks. It is not a string literal, which
+// is quoted with single or double quotes.
+func isIDLexeme(lexeme string) bool {
+	return strings.EqualFold(lexeme, "id") || strings.EqualFold(lexeme, "`id`")
+}
+
+func quoteIdentifier(columnName string) string {
+	s := strings.Replace(columnName, "`", "``", -1)
+	return "`" + s + "`"
 }
 
 func quoteString(s string) string {
@@ -0,0 +1,103 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// Backoff limits for AwaitConsistent.
+const (
+	minConsistencyBackoff = 50 * time.Millisecond
+	maxConsistencyBackoff = time.Second
+)
+
+// AwaitConsistent waits until an eventually consistent read of an item returns
+// the same result as a consistent read. This is useful after modifying an item,
+// to ensure that subsequent queries, which do not use consistent reads, see the
+// modification.
+//
+// The item is identified by its table and id. If columns are specified, the
+// eventually consistent read must return the same values for the columns;
+// otherwise it only has to agree on whether the item exists.
+//
+// AwaitConsistent polls with an exponential backoff, and returns an error
+// if ctx is done before the reads agree. Use context.WithTimeout to
+// limit the time spent waiting.
+func AwaitConsistent(ctx context.Context, db *sql.DB, table string, id string, columns ...string) error {
+	selectColumns := append([]string{"id"}, columns...)
+	for i, columnName := range selectColumns {
+		selectColumns[i] = quoteIdentifier(columnName)
+	}
+	query := "select " + strings.Join(selectColumns, ", ") +
+		" from " + quoteIdentifier(table) +
+		" where id = ?"
+
+	want, err := readValues(ctx, db, "consistent "+query, id, len(selectColumns))
+	if err != nil {
+		return err
+	}
+	backoff := minConsistencyBackoff
+	for {
+		got, err := readValues(ctx, db, query, id, len(selectColumns))
+		if err != nil {
+			return err
+		}
+		if reflect.DeepEqual(got, want) {
+			return nil
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "item is not consistent").With(
+				"table", table,
+				"id", id,
+			)
+		}
+		if backoff *= 2; backoff > maxConsistencyBackoff {
+			backoff = maxConsistencyBackoff
+		}
+	}
+}
+
+// readValues returns the values of the columns of an item, or nil
+// if the item does not exist.
+func readValues(ctx context.Context, db *sql.DB, query string, id string, n int) ([]interface{}, error) {
+	values := make([]interface{}, n)
+	dest := make([]interface{}, n)
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	err := db.QueryRowContext(ctx, query, id).Scan(dest...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// retryConsistent returns true if an eventually consistent select query is
+// run again with a consistent read, because it failed with one of the
+// Connector's ConsistentRetryCodes, or because it found no rows when the
+// query has an expect_rows hint.
+func (c *conn) retryConsistent(q *parse.SelectQuery, err error, empty bool) bool {
+	if q.ConsistentRead {
+		return false
+	}
+	if err != nil {
+		for _, code := range c.consistentRetryCodes {
+			if hasCode(err, code) {
+				return true
+			}
+		}
+		return false
+	}
+	return empty && q.ExpectRows
+}
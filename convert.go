@@ -0,0 +1,41 @@
+package simpledbsql
+
+import (
+	"database/sql/driver"
+	"reflect"
+
+	"github.com/jjeffery/errors"
+)
+
+// convertValue converts an argument to a value that can be stored, using the
+// default converter of database/sql. If the argument cannot be converted, the
+// error suggests how to pass values of common types that have no conversion.
+func convertValue(arg interface{}) (driver.Value, error) {
+	v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+	if err == nil {
+		return v, nil
+	}
+	t := reflect.TypeOf(arg)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return nil, err
+	}
+	var hint string
+	switch t.Kind() {
+	case reflect.Struct:
+		hint = "cannot store struct, implement driver.Valuer for its type, such as by encoding it as JSON"
+	case reflect.Map:
+		hint = "cannot store map, implement driver.Valuer for its type, such as by encoding it as JSON, or store each value in its own column"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			hint = "cannot store byte array, convert it to a []byte"
+		} else {
+			hint = "cannot store slice or array, implement driver.Valuer for its type, or store each element in its own column"
+		}
+	default:
+		return nil, err
+	}
+	return nil, errors.Wrap(err, hint).With("type", reflect.TypeOf(arg).String())
+}
@@ -0,0 +1,32 @@
+package simpledbsql
+
+import (
+	"database/sql/driver"
+	"time"
+
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// addCreated returns an insert statement that sets the Connector's
+// CreatedColumn to the current time, unless the statement sets it, together
+// with the args with the time added. The time is in UTC, so that its values
+// sort in time order. Other statements are returned unchanged. Parsed
+// statements are shared, so the insert statement is copied.
+func (c *conn) addCreated(q *parse.Query, args []driver.Value) (*parse.Query, []driver.Value) {
+	if q.Insert == nil || c.createdColumn == "" {
+		return q, args
+	}
+	for _, col := range q.Insert.Columns {
+		if col.ColumnName == c.createdColumn {
+			return q, args
+		}
+	}
+	insert := *q.Insert
+	insert.Columns = append(insert.Columns[:len(insert.Columns):len(insert.Columns)], parse.Column{
+		ColumnName: c.createdColumn,
+		Ordinal:    len(args),
+	})
+	created := *q
+	created.Insert = &insert
+	return &created, append(args[:len(args):len(args)], time.Now().UTC())
+}
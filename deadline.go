@@ -0,0 +1,65 @@
+package simpledbsql
+
+import (
+	"context"
+	"time"
+
+	"github.com/jjeffery/errors"
+)
+
+// ErrPartialResult is the cause of the error that ends the rows of a select
+// statement whose context deadline is exceeded after it has returned some of
+// its rows, if the Connector's PartialResults is set. Callers can test for it
+// with errors.Is, and decide whether to use the rows that were returned.
+var ErrPartialResult = errors.New("partial result")
+
+// partialResultError is the error for a select statement that returned some
+// of its rows before its context deadline was exceeded. It unwraps to the
+// deadline error, and also satisfies errors.Is for ErrPartialResult.
+type partialResultError struct {
+	err error
+}
+
+func (e *partialResultError) Error() string {
+	return ErrPartialResult.Error() + ": " + e.err.Error()
+}
+
+// Cause returns the deadline error, for compatibility with errors.Cause.
+func (e *partialResultError) Cause() error {
+	return e.err
+}
+
+// Unwrap returns the deadline error.
+func (e *partialResultError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether target is ErrPartialResult.
+func (e *partialResultError) Is(target error) bool {
+	return target == ErrPartialResult
+}
+
+// deadlineError returns the error of a select statement, with a description
+// of the statement's progress if its context deadline has been exceeded:
+// the statement, the page that was being selected, the number of rows
+// returned, and the time elapsed since the statement started.
+func (g *selectGuard) deadlineError(ctx context.Context, err error) error {
+	if g == nil || err == nil || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	if s := queryStatsFromContext(ctx); s != nil {
+		s.addDeadlineExceeded()
+	}
+	e := errors.Wrap(err, "select deadline exceeded").With(
+		"page", g.pages,
+		"rows", g.rows,
+		"elapsed", time.Since(g.start).String(),
+	)
+	if g.statement != "" {
+		e = e.With("statement", g.statement)
+	}
+	if g.partialResults && g.rows > 0 {
+		return &partialResultError{err: e}
+	}
+	return e
+}
@@ -0,0 +1,120 @@
+package simpledbsql
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/jjeffery/errors"
+)
+
+// Decimal is a string containing a decimal number, such as "123.45".
+// A Decimal arg is stored in a decimal column, and is returned from
+// a select statement as a *big.Rat. Args of type *big.Rat are also
+// stored in decimal columns.
+type Decimal string
+
+// Limits of values stored in decimal columns.
+const (
+	decimalIntegerDigits  = 18
+	decimalFractionDigits = 12
+)
+
+// decimalScale is the value of one unit in the last fractional digit.
+var decimalScale = new(big.Int).Exp(big.NewInt(10), big.NewInt(decimalFractionDigits), nil)
+
+// encodeDecimal returns the attribute value for a decimal. Values have a fixed
+// number of integer and fractional digits, and negative values have a leading
+// "-" followed by the nines' complement of their digits, so that the attribute
+// values sort in numeric order.
+func encodeDecimal(r *big.Rat) (string, error) {
+	n := new(big.Int).Mul(r.Num(), decimalScale)
+	n, rem := n.QuoRem(n, r.Denom(), new(big.Int))
+	if rem.Sign() != 0 {
+		return "", errors.New("decimal has too many fractional digits").With(
+			"maxFractionDigits", decimalFractionDigits,
+		)
+	}
+	digits := new(big.Int).Abs(n).String()
+	if len(digits) > decimalIntegerDigits+decimalFractionDigits {
+		return "", errors.New("decimal has too many integer digits").With(
+			"maxIntegerDigits", decimalIntegerDigits,
+		)
+	}
+	digits = strings.Repeat("0", decimalIntegerDigits+decimalFractionDigits-len(digits)) + digits
+	prefix := ""
+	if n.Sign() < 0 {
+		prefix = "-"
+		digits = ninesComplement(digits)
+	}
+	return prefix + digits[:decimalIntegerDigits] + "." + digits[decimalIntegerDigits:], nil
+}
+
+// decodeDecimal parses an attribute value written by encodeDecimal.
+func decodeDecimal(value string) (*big.Rat, bool) {
+	negative := strings.HasPrefix(value, "-")
+	digits := strings.Replace(strings.TrimPrefix(value, "-"), ".", "", 1)
+	if negative {
+		digits = ninesComplement(digits)
+	}
+	n, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, false
+	}
+	if negative {
+		n.Neg(n)
+	}
+	return new(big.Rat).SetFrac(n, decimalScale), true
+}
+
+// Scan implements the sql.Scanner interface, so that a Decimal can be the
+// destination of a decimal column, including a field of a struct scanned by
+// libraries such as sqlx and scany. The value of a null column is blank.
+func (d *Decimal) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = ""
+	case *big.Rat:
+		*d = Decimal(formatDecimal(v))
+	case *big.Int:
+		*d = Decimal(v.String())
+	case string:
+		*d = Decimal(v)
+	case []byte:
+		*d = Decimal(v)
+	case int64:
+		*d = Decimal(new(big.Int).SetInt64(v).String())
+	default:
+		return errors.New("cannot scan into Decimal").With("type", reflect.TypeOf(src).String())
+	}
+	return nil
+}
+
+// formatDecimal returns the text of a decimal, without trailing zeros.
+func formatDecimal(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	s := strings.TrimRight(r.FloatString(decimalFractionDigits), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// parseDecimal parses the text of a Decimal.
+func parseDecimal(s Decimal) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(string(s)))
+	if !ok {
+		return nil, errors.New("invalid decimal")
+	}
+	return r, nil
+}
+
+// ninesComplement replaces each decimal digit d in s with 9-d.
+func ninesComplement(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= '0' && c <= '9' {
+			b[i] = '9' - (c - '0')
+		}
+	}
+	return string(b)
+}
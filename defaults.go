@@ -0,0 +1,140 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// applyDefaults applies the Connector's defaults to a select statement,
+// unless the statement overrides them. The select query is replaced by a
+// modified copy, as the original can be shared by the parse cache.
+func (c *conn) applyDefaults(q *parse.Query) {
+	if q.Select == nil {
+		return
+	}
+	sq := *q.Select
+	if c.consistentRead && !sq.EventualRead {
+		sq.ConsistentRead = true
+	}
+	if c.defaultSelectLimit > 0 && sq.Key == nil && !hasLimit(sq.WhereClause) {
+		whereClause := append([]string(nil), sq.WhereClause...)
+		sq.WhereClause = append(whereClause, " ", "limit", " ", strconv.Itoa(c.defaultSelectLimit))
+	}
+	q.Select = &sq
+}
+
+// addColumnDefaults returns an insert statement that sets the columns of its
+// table that have defaults in the Connector's ColumnDefaults, and that it does
+// not set itself, together with the args with the default values added. The
+// defaults are converted as args are, so they are recorded with their types.
+// Other statements are returned unchanged. Parsed statements are shared, so
+// the insert statement is copied.
+func (c *conn) addColumnDefaults(q *parse.Query, args []driver.Value) (*parse.Query, []driver.Value, error) {
+	if q.Insert == nil {
+		return q, args, nil
+	}
+	defaults := c.columnDefaults[q.Insert.TableName]
+	if len(defaults) == 0 {
+		return q, args, nil
+	}
+	set := make(map[string]bool, len(q.Insert.Columns))
+	for _, col := range q.Insert.Columns {
+		set[col.ColumnName] = true
+	}
+	var columnNames []string
+	for columnName := range defaults {
+		if !set[columnName] && !parse.IsID(columnName) {
+			columnNames = append(columnNames, columnName)
+		}
+	}
+	if len(columnNames) == 0 {
+		return q, args, nil
+	}
+	sort.Strings(columnNames)
+	insert := *q.Insert
+	insert.Columns = insert.Columns[:len(insert.Columns):len(insert.Columns)]
+	args = args[:len(args):len(args)]
+	for _, columnName := range columnNames {
+		value := defaults[columnName]
+		if f, ok := value.(func() interface{}); ok {
+			value = f()
+		}
+		arg := driver.NamedValue{Ordinal: len(args) + 1, Value: value}
+		if err := c.CheckNamedValue(&arg); err != nil {
+			return nil, nil, errors.Wrap(err, "invalid column default").With(
+				"table", q.Insert.TableName,
+				"column", columnName,
+			)
+		}
+		insert.Columns = append(insert.Columns, parse.Column{
+			ColumnName: columnName,
+			Ordinal:    len(args),
+		})
+		args = append(args, arg.Value)
+	}
+	completed := *q
+	completed.Insert = &insert
+	return &completed, args, nil
+}
+
+// hasLimit returns true if the lexemes of a where clause include a limit clause.
+func hasLimit(whereClause []string) bool {
+	for _, lexeme := range whereClause {
+		if strings.EqualFold(lexeme, "limit") {
+			return true
+		}
+	}
+	return false
+}
+
+// withTimeout returns a context that is canceled when the statement timeout
+// expires. The Connector's StatementTimeout is replaced by the statement's
+// max_execution_time hint. If there is no timeout, ctx is returned with a
+// nil cancel function. The hints of a query with multiple statements are
+// ignored, and q is nil.
+func (c *conn) withTimeout(ctx context.Context, q *parse.Query) (context.Context, context.CancelFunc) {
+	timeout := c.statementTimeout
+	if q != nil && q.Select != nil && q.Select.MaxTime > 0 {
+		timeout = time.Duration(q.Select.MaxTime) * time.Millisecond
+	}
+	if timeout <= 0 {
+		return ctx, nil
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutRows cancels the context of a query with a statement timeout
+// when its rows are closed, because the rows are read using the context
+// after the query returns.
+type timeoutRows struct {
+	driver.Rows
+	cancel context.CancelFunc
+}
+
+func (rows *timeoutRows) Close() error {
+	err := rows.Rows.Close()
+	rows.cancel()
+	return err
+}
+
+func (rows *timeoutRows) HasNextResultSet() bool {
+	if rs, ok := rows.Rows.(driver.RowsNextResultSet); ok {
+		return rs.HasNextResultSet()
+	}
+	return false
+}
+
+func (rows *timeoutRows) NextResultSet() error {
+	if rs, ok := rows.Rows.(driver.RowsNextResultSet); ok {
+		return rs.NextResultSet()
+	}
+	return io.EOF
+}
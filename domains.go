@@ -0,0 +1,125 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
+	"github.com/jjeffery/errors"
+)
+
+// domainCache caches the names of the SimpleDB domains, which are listed by
+// show tables and create table if not exists statements. The names expire
+// after the TTL, and are discarded when a table is created or dropped.
+// A nil cache lists the domains each time.
+type domainCache struct {
+	ttl        time.Duration
+	mutex      sync.Mutex
+	names      []string
+	expires    time.Time
+	generation int // incremented by invalidate
+}
+
+func newDomainCache(ttl time.Duration) *domainCache {
+	return &domainCache{ttl: ttl}
+}
+
+// list returns the names of the domains, in sorted order.
+func (dc *domainCache) list(ctx context.Context, sdb simpledbiface.SimpleDBAPI) ([]string, error) {
+	if dc == nil {
+		return listDomains(ctx, sdb)
+	}
+	dc.mutex.Lock()
+	if dc.names != nil && time.Now().Before(dc.expires) {
+		names := dc.names
+		dc.mutex.Unlock()
+		return names, nil
+	}
+	generation := dc.generation
+	dc.mutex.Unlock()
+
+	names, err := listDomains(ctx, sdb)
+	if err != nil {
+		return nil, err
+	}
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+	if dc.generation == generation {
+		// not invalidated while the domains were listed
+		dc.names = names
+		dc.expires = time.Now().Add(dc.ttl)
+	}
+	return names, nil
+}
+
+// invalidate discards the cached names after a domain is created or deleted.
+func (dc *domainCache) invalidate() {
+	if dc == nil {
+		return
+	}
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+	dc.names = nil
+	dc.generation++
+}
+
+// listDomains returns the names of all domains, in sorted order.
+func listDomains(ctx context.Context, sdb simpledbiface.SimpleDBAPI) ([]string, error) {
+	names := []string{}
+	input := &simpledb.ListDomainsInput{}
+	for {
+		output, err := sdb.ListDomainsWithContext(ctx, input, requestOptions(ctx)...)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot list simpledb domains")
+		}
+		for _, domainName := range output.DomainNames {
+			names = append(names, aws.StringValue(domainName))
+		}
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// domainExists returns true if the domain is listed.
+func (c *conn) domainExists(ctx context.Context, domainName string) (bool, error) {
+	names, err := c.domains.list(ctx, c.SimpleDB)
+	if err != nil {
+		return false, err
+	}
+	i := sort.SearchStrings(names, domainName)
+	return i < len(names) && names[i] == domainName, nil
+}
+
+// showTables returns a row for each table. If the connection has a Schema,
+// the tables are the domains whose names have the Schema prefix, which is
+// removed from the table names.
+func (c *conn) showTables(ctx context.Context) (driver.Rows, error) {
+	names, err := c.domains.list(ctx, c.SimpleDB)
+	if err != nil {
+		return nil, err
+	}
+	rows := &valueRows{
+		columns: []string{"table"},
+	}
+	for _, name := range names {
+		if c.Schema != "" {
+			prefix := c.Schema + "."
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			name = strings.TrimPrefix(name, prefix)
+		}
+		rows.values = append(rows.values, []driver.Value{name})
+	}
+	return rows, nil
+}
@@ -4,10 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"net/http"
 	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
 	"github.com/jjeffery/errors"
 )
@@ -18,52 +19,131 @@ func init() {
 
 // Driver implements the driver.Driver interface.
 type Driver struct {
-	mutex sync.Mutex
-	sdb   simpledbiface.SimpleDBAPI
+	mutex   sync.Mutex
+	sdb     simpledbiface.SimpleDBAPI
+	clients map[string]simpledbiface.SimpleDBAPI // clients for each data source name
 }
 
 // Open returns a new connection to the database.
-// The name is currently ignored and should be a blank
-// string, but in future may include parameters like
-// region, profile, consistent-read, schema, etc.
+//
+// The name is a data source name, which is blank for the default settings,
+// or a URL query string of parameters that change the settings of the AWS
+// SDK session that the driver constructs:
+//
+//	role_arn      ARN of an IAM role that the driver assumes
+//	external_id   external id required by the trust policy of the role
+//	session_name  name of the assumed role session
+//	timeout       time limit for each HTTP request, such as "30s"
+//	proxy         URL of an HTTP proxy, such as "http://proxy:3128"
+//
+// For example, "role_arn=arn:aws:iam::123456789012:role/app&external_id=xyz"
+// accesses SimpleDB with the credentials of a role in another account.
 func (d *Driver) Open(name string) (driver.Conn, error) {
 	d.mutex.Lock()
 	sdb := d.sdb
+	if sdb == nil {
+		sdb = d.clients[name]
+	}
 	d.mutex.Unlock()
 
 	if sdb == nil {
-		sess, err := session.NewSessionWithOptions(session.Options{
-			// this option obtains the region setting from the ~/.aws/config file
-			// if it is set
-			SharedConfigState: session.SharedConfigEnable,
-		})
+		cfg, err := parseDSN(name)
+		if err != nil {
+			return nil, err
+		}
+		client, err := cfg.newSimpleDB()
 		if err != nil {
 			return nil, err
 		}
 		d.mutex.Lock()
-		if d.sdb == nil {
-			d.sdb = simpledb.New(sess)
+		if d.clients == nil {
+			d.clients = make(map[string]simpledbiface.SimpleDBAPI)
+		}
+		if d.clients[name] == nil {
+			d.clients[name] = client
 		}
-		sdb = d.sdb
+		sdb = d.clients[name]
 		d.mutex.Unlock()
 	}
 	c := &conn{
-		SimpleDB: sdb,
+		SimpleDB:  wrapSimpleDB(sdb, nil),
+		maxGroups: defaultMaxGroups,
 	}
 	return c, nil
 }
 
+// wrapSimpleDB returns the SimpleDB API of a connection, which wraps sdb
+// in the same way for connections opened by the Driver and by a Connector.
+// The limiters are nil if requests are not rate limited.
+func wrapSimpleDB(sdb simpledbiface.SimpleDBAPI, limiters *domainLimiters) simpledbiface.SimpleDBAPI {
+	sdb = &contextAPI{SimpleDBAPI: sdb}
+	sdb = &accessAPI{SimpleDBAPI: sdb}
+	if limiters != nil {
+		sdb = &rateLimitAPI{SimpleDBAPI: sdb, limiters: limiters}
+	}
+	sdb = &statsAPI{SimpleDBAPI: sdb}
+	return sdb
+}
+
 // Connector implements the driver.Connector interface,
 // and is useful for passing to the sql.OpenDB function.
+// A Connector should not be copied after its first use.
 type Connector struct {
 	// SimpleDB is the AWS SDK handle used for all SimpleDB operations.
+	// It can be nil if RoleARN or HTTPClient is set, in which case the
+	// Connector constructs its own handle.
 	SimpleDB simpledbiface.SimpleDBAPI
 
+	// RoleARN, if not blank, is the ARN of an IAM role that the Connector
+	// assumes, so that an application can access the SimpleDB domains of
+	// another account without constructing a session with the role's
+	// credentials itself. The Connector constructs a handle with a session
+	// whose region and credentials are obtained from the environment and
+	// the ~/.aws/config file, and which assumes the role. SimpleDB must be
+	// nil if RoleARN is set.
+	RoleARN string
+
+	// ExternalID is the external id passed when assuming RoleARN,
+	// if the trust policy of the role requires one.
+	ExternalID string
+
+	// RoleSessionName is the name of the session when assuming RoleARN.
+	// If blank, the AWS SDK generates a name.
+	RoleSessionName string
+
+	// HTTPClient, if not nil, is the HTTP client used for the requests of
+	// the handle that the Connector constructs, such as a client whose
+	// transport sends requests via an egress proxy. SimpleDB must be nil
+	// if HTTPClient is set.
+	HTTPClient *http.Client
+
+	// Secondary, if not nil, is the AWS SDK handle of a SimpleDB in another
+	// region, which SimpleDB does not replicate to. If a read request fails
+	// because SimpleDB is unavailable, it is sent to Secondary instead.
+	// Subsequent pages of a select statement are not read from Secondary.
+	Secondary simpledbiface.SimpleDBAPI
+
+	// DualWrite, if true, causes every request that modifies SimpleDB to be
+	// sent to Secondary after it succeeds, so that Secondary has a copy of
+	// the data written by the driver. The update conditions of the requests
+	// are checked only by SimpleDB. If the request to Secondary fails, the
+	// statement fails, even though SimpleDB was modified.
+	DualWrite bool
+
 	// Schema is used to derive the SimpleDB domain name from the
 	// table name in the SQL. If Schema is not blank, then it is
 	// prefixed in front of any table name with a period. So if
 	// Schema is "dev" and table name is "tbl" then the corresponding
 	// SimpleDB domain would be "dev.tbl".
+	//
+	// A table name that already contains a period, such as "prod.tbl"
+	// or `prod`.`tbl`, is a fully-qualified domain name, and is not
+	// prefixed with Schema.
+	//
+	// A table name prefixed with "@", such as "@prod.tbl" or "@tbl", is the
+	// domain name itself, and is not resolved by TableNameFunc,
+	// SynonymResolver, Synonyms or Schema. This allows one statement to
+	// address a domain of another environment.
 	Schema string
 
 	// Synonyms is a map of table names to their corresponding SimpleDB
@@ -73,20 +153,681 @@ type Connector struct {
 	//
 	// If a table name has an entry in Synonyms, Schema is ignored.
 	Synonyms map[string]string
+
+	// SchemaExclusions is a list of table names that are not prefixed
+	// with Schema. This is useful for addressing shared domains from a
+	// connection whose other tables are namespaced per environment.
+	// Entries can be patterns, using the syntax of path.Match, so the entry
+	// "global_*" matches all table names starting with "global_".
+	SchemaExclusions []string
+
+	// SynonymResolver, if not nil, is consulted for the domain name of each
+	// table before Synonyms and Schema. If it returns a domain name for
+	// the table, Synonyms and Schema are ignored.
+	SynonymResolver SynonymResolver
+
+	// TableNameFunc, if not nil, derives the table name used for each
+	// statement from the table name in the SQL, before the table name is
+	// resolved by SynonymResolver, Synonyms and Schema. Its context is the
+	// statement's context, so the table name can depend on the request,
+	// such as a tenant id in the context, for an application that stores
+	// each tenant's data in separate domains. If it returns an error, the
+	// statement fails.
+	TableNameFunc func(ctx context.Context, tableName string) (string, error)
+
+	// RequestOptions are applied to every SimpleDB request made by the
+	// driver, after the driver's own options, so that an application can
+	// instrument the requests of the AWS SDK, for example by adding handlers
+	// to the request's Handlers for custom signing, headers or logging:
+	//
+	//	func(r *request.Request) {
+	//		r.Handlers.Build.PushBack(func(r *request.Request) {
+	//			r.HTTPRequest.Header.Set("X-Trace-Id", traceID(r.Context()))
+	//		})
+	//	}
+	RequestOptions []request.Option
+
+	// LogRequest, if not nil, is called before every SimpleDB request
+	// made by the driver. The operation is the name of the SimpleDB API
+	// operation (eg "PutAttributes"), and input is the corresponding
+	// input structure from the AWS SDK (eg *simpledb.PutAttributesInput).
+	LogRequest func(ctx context.Context, operation string, input interface{})
+
+	// DryRun, if true, prevents the driver from sending any request that
+	// would modify SimpleDB. Statements are parsed and their requests are
+	// built and passed to LogRequest as normal, but the requests are not sent
+	// and the statement reports success. Select statements are unaffected.
+	//
+	// DryRun is useful for validating migrations and bulk scripts against
+	// a production database.
+	DryRun bool
+
+	// RequestsPerSecond, if greater than zero, limits the rate of SimpleDB
+	// requests sent to each domain by all connections created by the Connector.
+	// Requests that would exceed the limit wait until they are permitted, or
+	// until their context is done. This prevents bulk jobs from triggering
+	// throttling that affects other clients of the same domain.
+	RequestsPerSecond float64
+
+	// RequestBurst is the maximum number of requests that can be sent to
+	// a domain at once without waiting for the rate limit. It only applies
+	// if RequestsPerSecond is greater than zero, and defaults to 1.
+	RequestBurst int
+
+	// MaxConnectionRequests, if greater than zero, is the maximum number
+	// of SimpleDB requests that a single connection can have in flight at once,
+	// across the concurrent requests of its statements and the requests of
+	// a TableWriter created by NewTableWriter, which share a connection.
+	MaxConnectionRequests int
+
+	// ItemCache, if not nil, is used to cache items retrieved by select
+	// statements of the form "select ... where id = ?". Items are invalidated
+	// when they are modified using a connection created by the Connector.
+	// Consistent-read select statements always bypass the cache.
+	// See LRUItemCache for an in-memory implementation.
+	ItemCache ItemCache
+
+	// RecordSchema, if true, causes the driver to record the type of each
+	// column written by insert and update statements in a reserved item in
+	// each domain. See SchemaItemName. The recorded schema is returned by
+	// TableSchema, and is checked against the expected schema by VerifySchema.
+	//
+	// Each type is recorded once per column by each Connector, so the cost
+	// is an occasional additional PutAttributes request.
+	RecordSchema bool
+
+	// AfterInsert, if not nil, is called after an insert statement inserts
+	// an item. It is useful for publishing changes to other systems.
+	AfterInsert func(ctx context.Context, change *Change)
+
+	// AfterUpdate, if not nil, is called after an update statement updates an
+	// existing item, including an insert statement that updates an item using
+	// an "on duplicate key update" clause. The change contains the new
+	// values of the columns and the values they replaced.
+	AfterUpdate func(ctx context.Context, change *Change)
+
+	// AfterDelete, if not nil, is called after a delete statement. It is
+	// called even if the item did not exist, as SimpleDB does not report
+	// whether anything was deleted.
+	//
+	// None of the hooks are called when DryRun is set.
+	AfterDelete func(ctx context.Context, change *Change)
+
+	// Invalidator, if not nil, is called with the items modified by insert,
+	// update and delete statements, so that caches of the items, such as
+	// Redis or memcached, can be invalidated without wrapping every call to
+	// ExecContext. Like the hooks, it is called after each successful
+	// modification, and is not called when DryRun is set. It is also called
+	// once for each batch of items written by Load or a TableWriter, with
+	// operation "insert", and deleted by Vacuum, with operation "delete".
+	Invalidator Invalidator
+
+	// BatchInvalidations, if true, causes the items modified by all of the
+	// statements in a call to ExecContext to be passed to a single call of
+	// the Invalidator after the last statement, including when a statement
+	// fails. Otherwise the Invalidator is called after each modification.
+	BatchInvalidations bool
+
+	// AuditTable, if not blank, is the name of a table in which the driver
+	// records every insert, update and delete statement. The table's domain
+	// is created by the driver if it does not exist.
+	//
+	// Each statement is recorded in an item of the audit table before it is
+	// run, with the following columns:
+	//
+	//	changedAt  time the statement was run
+	//	tableName  table modified by the statement
+	//	itemId     id of the item modified by the statement
+	//	operation  "insert", "update" or "delete"
+	//	statement  text of the statement, with placeholders
+	//	status     AuditPending, AuditApplied, AuditUnchanged or AuditFailed
+	//	old.<col>  value of each modified column before the statement
+	//	new.<col>  value of each modified column after the statement
+	//
+	// The status is updated after the statement has run. Because the old
+	// values are read before each statement, auditing requires an additional
+	// two or three requests per statement. Statements are not recorded
+	// when DryRun is set.
+	AuditTable string
+
+	// TTLColumn, if not blank, is the name of a column that holds the
+	// time at which an item expires. The column's values are either times,
+	// or int64 values containing the number of seconds since the Unix epoch.
+	// Select statements and QueryMaps do not return items that have expired,
+	// and Vacuum deletes them. Items without a value in the column do not
+	// expire. Dump and DumpTable include expired items.
+	TTLColumn string
+
+	// LegacyTimeFormat, if true, causes insert and update statements to
+	// write times in the format used by earlier versions of the driver,
+	// which is RFC3339 with second precision, and without the name of the
+	// time's location. Set this while tables are shared with applications
+	// that use an earlier version. Times in either format can be read
+	// regardless of this setting.
+	LegacyTimeFormat bool
+
+	// EmptyStringSentinel, if not blank, is stored by insert and update
+	// statements in place of empty strings. SimpleDB cannot store empty
+	// strings, so by default the driver stores only the column's type,
+	// and other applications reading the domain cannot tell an empty
+	// string from a null. The type of a sentinel value is recorded as
+	// "empty", so the driver reads it as an empty string regardless of
+	// this setting, and a string that happens to equal the sentinel is
+	// not mistaken for an empty string.
+	EmptyStringSentinel string
+
+	// MetadataPrefix is the prefix of the names of the attributes in which
+	// the driver records the type of each column. Defaults to
+	// DefaultMetadataPrefix, which is "sql:". Change it if the prefix
+	// collides with attributes written by other applications sharing the
+	// domains. Attributes whose names start with the prefix are not
+	// returned by QueryMaps.
+	MetadataPrefix string
+
+	// PackedMetadata, if true, causes the driver to record the types of all
+	// of an item's columns in a single attribute, named with MetadataPrefix
+	// followed by "types", instead of one attribute for each column. This
+	// halves the number of attributes, but an update statement must read
+	// the item's types before it can write them, and the types of all of the
+	// item's columns must fit in one attribute value. Items written with and
+	// without PackedMetadata cannot be read using the other setting.
+	PackedMetadata bool
+
+	// RawAttributes, if true, causes the driver to ignore type metadata, for
+	// querying domains written by other applications. All values are read as
+	// strings, including attributes whose names start with MetadataPrefix.
+	// Insert and update statements do not write type metadata, and values of
+	// other types are written as their text representation. Because there is
+	// no attribute present in every item, insert and update statements read
+	// the item to check whether it exists, which requires an additional request
+	// and is not atomic. PackedMetadata is ignored when RawAttributes is set.
+	RawAttributes bool
+
+	// MaxSelectRows, if greater than zero, is the maximum number of rows that
+	// a select statement can return. Reading the next row returns an error
+	// instead, which protects services from accidentally scanning an entire
+	// domain because of a missing where clause. A statement can replace the
+	// limit with a hint, such as "select /*+ max_rows(10000) */ ...".
+	// The limit applies to QueryContext and QueryMaps, but not to Dump.
+	MaxSelectRows int
+
+	// MaxSelectPages, if greater than zero, is the maximum number of pages of
+	// results that a select statement can request from SimpleDB. A page holds
+	// up to 100 items by default, and up to 1MB of data. A statement can
+	// replace the limit with a max_pages hint. The limit applies to
+	// QueryContext and QueryMaps, but not to Dump.
+	MaxSelectPages int
+
+	// Redactor, if not nil, controls how item names and values appear in
+	// error messages, and in the requests passed to LogRequest. The item names
+	// and values of requests are replaced, as are the string literals of select
+	// expressions, but attribute names and type metadata are not. See
+	// HashRedactor and OmitRedactor.
+	Redactor Redactor
+
+	// IdempotentInserts, if true, makes insert statements safe to retry after
+	// the response to a successful PutAttributes request is lost, such as when
+	// the request times out. When the AWS SDK retries such a request, the item
+	// already exists, and the insert would fail with a duplicate key error.
+	// Instead, the item is read with a consistent read, and the insert succeeds
+	// if the item has exactly the values being inserted. This requires an
+	// additional request, but only for a duplicate key after a retry.
+	IdempotentInserts bool
+
+	// DefaultSelectLimit, if greater than zero, is added as a limit clause
+	// to select statements that do not have one, other than "where id = ?"
+	// statements. As for any limit clause, it is the number of items in each
+	// page of results, and is combined with MaxSelectPages to limit the
+	// number of rows that a select statement can fetch. The limit applies
+	// to QueryContext and QueryMaps.
+	DefaultSelectLimit int
+
+	// ConsistentRead, if true, causes select statements to perform
+	// consistent reads, unless they have an "eventual" hint, such as
+	// "select /*+ eventual */ ...". Consistent reads bypass the ItemCache.
+	// The default applies to QueryContext and QueryMaps.
+	ConsistentRead bool
+
+	// StatementTimeout, if greater than zero, is the maximum time that a
+	// statement can run, including the time taken to read its rows. When
+	// it expires, the statement's context is canceled, and the statement
+	// fails with an error that is context.DeadlineExceeded according to
+	// errors.Is. A select statement can replace the timeout with a hint
+	// in milliseconds, such as "select /*+ max_execution_time(500) */ ...".
+	// The timeout applies to QueryContext and ExecContext.
+	StatementTimeout time.Duration
+
+	// ParseCacheSize, if greater than zero, is the number of parsed
+	// statements that the Connector caches, keyed by the text of the
+	// statement. Services that run the same statements at a high rate
+	// avoid parsing them each time. Statements with placeholders are
+	// cached once, regardless of their args.
+	ParseCacheSize int
+
+	// CompactBinary, if true, causes insert and update statements to store
+	// each binary value using Ascii85 encoding when it is shorter than base64
+	// encoding, which is usually the case. Ascii85 inflates values by 25%
+	// rather than 33%, so larger values fit within the 1024 byte limit of
+	// SimpleDB attribute values. The encoding is recorded in the column's
+	// type as "binary:ascii85", so values in either encoding can be read
+	// regardless of this setting, but other applications reading the domain
+	// must understand the encoding.
+	CompactBinary bool
+
+	// RetryMissingItems, if true, causes an eventually consistent "where id = ?"
+	// select statement that finds no item to repeat the lookup with a consistent
+	// read before returning no rows. An item inserted moments before might not
+	// yet be visible to an eventually consistent read, so this avoids spurious
+	// sql.ErrNoRows errors, at the cost of a second request for items that do
+	// not exist.
+	RetryMissingItems bool
+
+	// ConsistentRetryCodes lists the SimpleDB error codes, such as
+	// "ServiceUnavailable", for which an eventually consistent select
+	// statement is run again with a consistent read. A select statement with
+	// an expect_rows hint, such as "select /*+ expect_rows */ id from tbl",
+	// is also run again with a consistent read if it returns no rows, which
+	// suits reading rows written moments before. Select statements whose long
+	// in lists are split into batches are not run again.
+	ConsistentRetryCodes []string
+
+	// DomainCacheTTL, if greater than zero, is how long the Connector caches
+	// the names of the SimpleDB domains, which are listed by "show tables"
+	// statements. A "create table if not exists" statement does not create
+	// a domain whose name is cached. Creating or dropping a table discards
+	// the cached names, but domains created or deleted by other clients
+	// are not seen until the names expire.
+	DomainCacheTTL time.Duration
+
+	// SpoolThreshold, if greater than zero, causes a select statement with
+	// more than one page of results to fetch its pages in the background,
+	// rather than when its rows are read. Up to SpoolThreshold fetched rows
+	// wait in memory to be read, and any more are written to a temporary
+	// file, which is removed when the rows are closed. This suits exports,
+	// whose fetching is not slowed by a slow reader of the rows, but pages
+	// are fetched until the rows are closed, even if the reader has stopped.
+	// Select statements whose long in lists are split into batches do not
+	// fetch pages in the background.
+	SpoolThreshold int
+
+	// SpoolDir is the directory of the temporary files of SpoolThreshold.
+	// If blank, the default directory for temporary files is used.
+	SpoolDir string
+
+	// Checksums, if true, causes insert and update statements to write an
+	// attribute containing a checksum of all of the item's attributes, whose
+	// name is the word "checksum" with MetadataPrefix. Because an update can
+	// consist of separate put and delete requests, an interrupted update can
+	// leave an item partially written. The checksum of the item then does
+	// not match, which is reported to OnChecksumMismatch when the item is read
+	// by a "select *" query with QueryMaps, or by a "where id = ?" query that
+	// reads all of its attributes, such as when ItemCache is set.
+	//
+	// Each update reads the item with a consistent read to calculate its
+	// checksum, and the put request is conditional on the checksum read, so
+	// an update requires an additional request, and is retried if the item
+	// changes concurrently. Unless PackedMetadata is set, a column named
+	// "checksum" cannot be written. Checksums is ignored when RawAttributes
+	// is set, and items written by Load do not have a checksum.
+	Checksums bool
+
+	// OnChecksumMismatch, if not nil, is called when an item read by the
+	// driver has a checksum that does not match its attributes. See Checksums.
+	OnChecksumMismatch func(ctx context.Context, mismatch *ChecksumMismatch)
+
+	// TwoPhaseUpdates, if true, causes an update statement that both puts and
+	// deletes attributes, such as one that sets a column to null, to mark the
+	// item until the update completes. An update that puts and deletes
+	// attributes is not atomic, because SimpleDB requires separate requests.
+	// The first request puts the attributes together with an attribute whose
+	// name is the word "txn" with MetadataPrefix, which records the attributes
+	// to delete, and the second request deletes them together with the marker.
+	// Reads of an item with the marker ignore the attributes it records, so an
+	// interrupted update is read as if it had completed. Set TwoPhaseUpdates
+	// on every Connector that reads the domains. Unless PackedMetadata is set,
+	// a column named "txn" cannot be written.
+	TwoPhaseUpdates bool
+
+	// RepairPendingUpdates, if true, causes reads that find an item marked by
+	// an update that did not complete to complete it, by deleting the attributes
+	// recorded in the marker. See TwoPhaseUpdates, which must also be set.
+	RepairPendingUpdates bool
+
+	// OnBulkProgress, if not nil, is called after each batch of items is
+	// modified by an update or delete statement whose where clause selects
+	// the ids of the items with a subquery, such as
+	//  update tbl set a = ? where id in (select id from tbl where b = ?)
+	// Such statements select all of the ids with a consistent read, and
+	// then modify the items in batches of 25, using the SimpleDB batch APIs.
+	// They are not recorded in the AuditTable.
+	OnBulkProgress func(ctx context.Context, progress *BulkProgress)
+
+	// CaseInsensitiveColumns are the names of columns that are compared
+	// ignoring case, which SimpleDB cannot do. When a value is written to
+	// one of these columns, its folded (lower case) form is also written, to
+	// an attribute whose name is the column name prefixed by MetadataPrefix
+	// and "folded:". The =, !=, <>, like, not like and in predicates of a
+	// select statement that compare the column with string literals or
+	// placeholders are translated to compare the folded attribute with the
+	// folded values, except on the column in the order by clause. Items
+	// written before a column is declared do not have the folded attribute
+	// until the column is updated. CaseInsensitiveColumns is ignored when
+	// RawAttributes is set.
+	CaseInsensitiveColumns []string
+
+	// SearchColumns are the names of text columns whose words can be matched
+	// by a select statement, for basic keyword search. When a string is
+	// written to one of these columns, its words, which are sequences of
+	// letters and digits in lower case, are also written as the values of
+	// an attribute whose name is the column name prefixed by MetadataPrefix
+	// and "words:". A value can have at most 100 different words. The
+	// predicate "match(column, ?)" selects items whose column contains all
+	// of the words of the arg, ignoring case, such as
+	//  select id, title from articles where match(body, 'quick fox')
+	// SearchColumns is ignored when RawAttributes is set.
+	SearchColumns []string
+
+	// MaxGroups is the maximum number of groups of a select statement with
+	// a group by clause, such as
+	//  select status, count(*) from tbl group by status
+	// SimpleDB cannot group items, so the driver reads the grouped columns of
+	// every item that matches the where clause, and holds the aggregates of
+	// each group in memory. A statement with more groups returns an error,
+	// which protects services from grouping by a column with too many values.
+	// A statement can replace the limit with a max_groups hint. Defaults to
+	// 1000. Set to a negative number for no limit.
+	MaxGroups int
+
+	// ConstrainSortColumn, if true, causes the predicate "column is not null"
+	// to be added to a select statement whose order by column is not in any
+	// of the predicates of its where clause, which SimpleDB requires. Items
+	// without a value in the column are not selected, as they would not be
+	// by any predicate that SimpleDB accepts. By default such statements
+	// return an error before any request is sent.
+	ConstrainSortColumn bool
+
+	// PartialResults, if true, changes the error that ends the rows of a
+	// select statement whose context deadline is exceeded after it has
+	// returned some rows, such as when its StatementTimeout expires while
+	// it is selecting its pages, so that the error is ErrPartialResult
+	// according to errors.Is. The rows already returned are valid, and
+	// the caller can decide whether to use them. The error remains
+	// context.DeadlineExceeded according to errors.Is, and in either case
+	// describes the statement, the page being selected, the number of
+	// rows returned and the time elapsed.
+	PartialResults bool
+
+	// IDGenerator, if not nil, generates the item names of rows inserted by
+	// insert statements without an id column, which are otherwise an error.
+	// The generated id can be returned with a returning clause. See
+	// UUIDv7Generator, ULIDGenerator, KSUIDGenerator and SnowflakeGenerator,
+	// which generate ids that sort in the order that they were created.
+	IDGenerator IDGenerator
+
+	// CreatedColumn, if not blank, is the name of a column that insert
+	// statements set to the time that they insert an item, unless they set
+	// the column themselves. The times are in UTC, so that they sort in the
+	// order that items were inserted, and recent items can be selected with
+	// "order by created desc limit 10", even if ids are not in time order.
+	// The predicate "created is not null" is added to such statements, as
+	// SimpleDB requires. Updates do not change the column.
+	CreatedColumn string
+
+	// ScanPolicy controls select statements whose where clause has no
+	// predicate that SimpleDB can evaluate using its indexes, because there
+	// is no where clause, or it only has "is null" and "is not null"
+	// predicates. Such statements scan the entire table, which is usually
+	// a mistake. The default allows them. ScanWarn passes them to OnScan,
+	// and ScanError fails them, which catches accidental scans during
+	// development. The policy applies to QueryContext and QueryMaps.
+	ScanPolicy ScanPolicy
+
+	// OnScan, if not nil, is called before a select statement that scans
+	// an entire table runs, if the ScanPolicy is ScanWarn.
+	OnScan func(ctx context.Context, scan *Scan)
+
+	// ColumnDefaults, if not nil, maps table names to the default values of
+	// their columns. Insert statements set each column of the table that has
+	// a default, unless they set the column themselves, so that other tools
+	// reading the domain see fully-populated items. A default is a value that
+	// can be passed as an arg, and is recorded with the type of that value,
+	// or a func() interface{}, which is called for each insert.
+	ColumnDefaults map[string]map[string]interface{}
+
+	// ValidateWrite, if not nil, is called before an item is written, so that
+	// the application can enforce invariants, such as required columns and
+	// ranges of values, in one place. It is passed the table name, and the
+	// value of each column written, keyed by column name, with a nil value for
+	// null. The "id" column contains the item name, except for an update with
+	// a subquery, which writes the same columns to every item it selects. An
+	// update only passes the columns that it sets, and an insert includes its
+	// generated id, created time and column defaults. If ValidateWrite returns
+	// an error, the item is not written, and the statement, the Add method of
+	// a TableWriter, or Load returns the error. Load passes the columns of
+	// each item in its input, unless LoadOptions.SkipValidation is set.
+	// It is called when DryRun is set.
+	ValidateWrite func(table string, columns map[string]interface{}) error
+
+	mutex    sync.Mutex
+	sdb      simpledbiface.SimpleDBAPI // handle constructed for RoleARN or HTTPClient
+	limiters *domainLimiters
+	schemas  *schemaRecorder
+	audit    *auditLog
+	parsed   *parseCache
+	domains  *domainCache
 }
 
 // Connect returns a connection to the database.
 func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
-	if c.SimpleDB == nil {
-		return nil, errors.New("SimpleDB cannot be nil")
+	sdb, err := c.getSimpleDB()
+	if err != nil {
+		return nil, err
+	}
+	if c.Secondary != nil {
+		sdb = &failoverAPI{SimpleDBAPI: sdb, secondary: c.Secondary, dualWrite: c.DualWrite}
+	}
+	if len(c.RequestOptions) > 0 {
+		sdb = &optionsAPI{SimpleDBAPI: sdb, opts: c.RequestOptions}
+	}
+	sdb = wrapSimpleDB(sdb, c.getLimiters())
+	if c.DryRun {
+		sdb = &dryRunAPI{SimpleDBAPI: sdb}
 	}
+	meta := metadata{
+		prefix:   c.MetadataPrefix,
+		packed:   c.PackedMetadata && !c.RawAttributes,
+		raw:      c.RawAttributes,
+		checksum: c.Checksums && !c.RawAttributes,
+		txn:      c.TwoPhaseUpdates && !c.RawAttributes,
+	}
+	if len(c.CaseInsensitiveColumns) > 0 && !c.RawAttributes {
+		meta.folded = make(map[string]bool, len(c.CaseInsensitiveColumns))
+		for _, columnName := range c.CaseInsensitiveColumns {
+			meta.folded[columnName] = true
+		}
+	}
+	if len(c.SearchColumns) > 0 && !c.RawAttributes {
+		meta.searched = make(map[string]bool, len(c.SearchColumns))
+		for _, columnName := range c.SearchColumns {
+			meta.searched[columnName] = true
+		}
+	}
+	if c.LogRequest != nil {
+		log := c.LogRequest
+		if c.Redactor != nil {
+			ir := inputRedactor{redactor: c.Redactor, meta: meta}
+			log = func(ctx context.Context, operation string, input interface{}) {
+				c.LogRequest(ctx, operation, ir.redactInput(input))
+			}
+		}
+		sdb = &loggingAPI{SimpleDBAPI: sdb, log: log}
+	}
+	var hooks hooks
+	if !c.DryRun {
+		hooks.AfterInsert = c.AfterInsert
+		hooks.AfterUpdate = c.AfterUpdate
+		hooks.AfterDelete = c.AfterDelete
+		hooks.Invalidator = c.Invalidator
+		hooks.BatchInvalidations = c.BatchInvalidations
+	}
+	hooks.ValidateWrite = c.ValidateWrite
 	return &conn{
-		SimpleDB: c.SimpleDB,
-		Schema:   c.Schema,
-		Synonyms: c.Synonyms,
+		SimpleDB:             sdb,
+		Schema:               c.Schema,
+		Synonyms:             c.Synonyms,
+		SchemaExclusions:     c.SchemaExclusions,
+		SynonymResolver:      c.SynonymResolver,
+		TableNameFunc:        c.TableNameFunc,
+		ItemCache:            c.ItemCache,
+		requestSem:           newSemaphore(c.MaxConnectionRequests),
+		schemas:              c.getSchemaRecorder(),
+		hooks:                hooks,
+		audit:                c.getAuditLog(),
+		ttlColumn:            c.TTLColumn,
+		legacyTimeFormat:     c.LegacyTimeFormat,
+		emptyStringSentinel:  c.EmptyStringSentinel,
+		meta:                 meta,
+		redactor:             c.Redactor,
+		maxSelectRows:        c.MaxSelectRows,
+		maxSelectPages:       c.MaxSelectPages,
+		idempotentInserts:    c.IdempotentInserts,
+		defaultSelectLimit:   c.DefaultSelectLimit,
+		consistentRead:       c.ConsistentRead,
+		statementTimeout:     c.StatementTimeout,
+		parseCache:           c.getParseCache(),
+		domains:              c.getDomainCache(),
+		spoolThreshold:       c.SpoolThreshold,
+		spoolDir:             c.SpoolDir,
+		compactBinary:        c.CompactBinary,
+		checksumMismatch:     c.OnChecksumMismatch,
+		repairPending:        c.RepairPendingUpdates,
+		bulkProgress:         c.OnBulkProgress,
+		maxGroups:            c.maxGroups(),
+		constrainSort:        c.ConstrainSortColumn,
+		partialResults:       c.PartialResults,
+		idGenerator:          c.IDGenerator,
+		createdColumn:        c.CreatedColumn,
+		scanPolicy:           c.ScanPolicy,
+		onScan:               c.OnScan,
+		columnDefaults:       c.ColumnDefaults,
+		retryMissingItems:    c.RetryMissingItems,
+		consistentRetryCodes: c.ConsistentRetryCodes,
 	}, nil
 }
 
+// maxGroups returns the maximum number of groups of a select statement,
+// which is zero if there is no limit.
+func (c *Connector) maxGroups() int {
+	switch {
+	case c.MaxGroups < 0:
+		return 0
+	case c.MaxGroups == 0:
+		return defaultMaxGroups
+	}
+	return c.MaxGroups
+}
+
+// getSimpleDB returns the SimpleDB handle of the connector, which is
+// constructed by the first call if the connector assumes a role or has
+// an HTTP client.
+func (c *Connector) getSimpleDB() (simpledbiface.SimpleDBAPI, error) {
+	if c.RoleARN == "" && c.HTTPClient == nil {
+		if c.SimpleDB == nil {
+			return nil, errors.New("SimpleDB cannot be nil")
+		}
+		return c.SimpleDB, nil
+	}
+	if c.SimpleDB != nil {
+		return nil, errors.New("cannot specify both SimpleDB and RoleARN or HTTPClient")
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.sdb == nil {
+		cfg := sessionConfig{
+			roleARN:         c.RoleARN,
+			externalID:      c.ExternalID,
+			roleSessionName: c.RoleSessionName,
+			httpClient:      c.HTTPClient,
+		}
+		sdb, err := cfg.newSimpleDB()
+		if err != nil {
+			return nil, err
+		}
+		c.sdb = sdb
+	}
+	return c.sdb, nil
+}
+
+// getLimiters returns the rate limiters shared by all connections
+// created by the connector, or nil if there is no rate limit.
+func (c *Connector) getLimiters() *domainLimiters {
+	if c.RequestsPerSecond <= 0 {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.limiters == nil {
+		c.limiters = newDomainLimiters(c.RequestsPerSecond, c.RequestBurst)
+	}
+	return c.limiters
+}
+
+// getSchemaRecorder returns the schema recorder shared by all connections
+// created by the connector, or nil if schemas are not recorded.
+func (c *Connector) getSchemaRecorder() *schemaRecorder {
+	if !c.RecordSchema {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.schemas == nil {
+		c.schemas = newSchemaRecorder()
+	}
+	return c.schemas
+}
+
+// getAuditLog returns the audit log shared by all connections created
+// by the connector, or nil if statements are not recorded.
+func (c *Connector) getAuditLog() *auditLog {
+	if c.AuditTable == "" || c.DryRun {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.audit == nil {
+		c.audit = newAuditLog(c.AuditTable)
+	}
+	return c.audit
+}
+
+// getParseCache returns the cache of parsed statements shared by all
+// connections created by the connector, or nil if there is no cache.
+func (c *Connector) getParseCache() *parseCache {
+	if c.ParseCacheSize <= 0 {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.parsed == nil {
+		c.parsed = newParseCache(c.ParseCacheSize)
+	}
+	return c.parsed
+}
+
+// getDomainCache returns the domain names cache shared by all connections
+// created by the connector, or nil if domain names are not cached.
+func (c *Connector) getDomainCache() *domainCache {
+	if c.DomainCacheTTL <= 0 {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.domains == nil {
+		c.domains = newDomainCache(c.DomainCacheTTL)
+	}
+	return c.domains
+}
+
 // Driver returns the underlying Driver of the Connector.
 func (c *Connector) Driver() driver.Driver {
 	return &Driver{
@@ -4,14 +4,29 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
 	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/fakesdb"
 	"github.com/jjeffery/simpledbsql/internal/parse"
 )
 
@@ -61,7 +76,7 @@ func TestCRUD(t *testing.T) {
 	wantRowsAffected(t, result, 1)
 	_, err = result.LastInsertId()
 	wantNotSupported(t, err)
-	waitForConsistency(t)
+	waitForConsistency(t, db, "ID1", "a", "b")
 
 	var a, b, id string
 	queries := []struct {
@@ -103,7 +118,7 @@ func TestCRUD(t *testing.T) {
 	)
 	wantNoError(t, err)
 	wantRowsAffected(t, result, 1)
-	waitForConsistency(t)
+	waitForConsistency(t, db, "ID1", "a", "b")
 
 	err = db.QueryRowContext(ctx, "select id, a, b from temp_test_table1 where id = 'ID1'").Scan(&id, &a, &b)
 	wantNoError(t, err)
@@ -125,7 +140,7 @@ func TestCRUD(t *testing.T) {
 	)
 	wantNoError(t, err)
 	wantRowsAffected(t, result, 1)
-	waitForConsistency(t)
+	waitForConsistency(t, db, "ID1", "a", "b")
 
 	var b2 sql.NullString
 	err = db.QueryRowContext(ctx, "select id, a, b from temp_test_table1 where id = 'ID1'").Scan(&id, &a, &b2)
@@ -152,7 +167,7 @@ func TestTime(t *testing.T) {
 	tm := time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC)
 	_, err := db.ExecContext(ctx, "insert into temp_test_table1(id, tm) values('ID1', ?)", tm)
 	wantNoError(t, err)
-	waitForConsistency(t)
+	waitForConsistency(t, db, "ID1", "tm")
 
 	var tm2 time.Time
 	err = db.QueryRowContext(ctx, "select tm from temp_test_table1 where id = 'ID1'").Scan(&tm2)
@@ -170,7 +185,7 @@ func TestInt64(t *testing.T) {
 	i64 := int64(42)
 	_, err := db.ExecContext(ctx, "insert into temp_test_table1(id, i64) values('ID1', ?)", i64)
 	wantNoError(t, err)
-	waitForConsistency(t)
+	waitForConsistency(t, db, "ID1", "i64")
 
 	var i64a int64
 	err = db.QueryRowContext(ctx, "select i64 from temp_test_table1 where id = 'ID1'").Scan(&i64a)
@@ -188,7 +203,7 @@ func TestFloat64(t *testing.T) {
 	f64 := float64(42)
 	_, err := db.ExecContext(ctx, "insert into temp_test_table1(id, f64) values('ID1', ?)", f64)
 	wantNoError(t, err)
-	waitForConsistency(t)
+	waitForConsistency(t, db, "ID1", "f64")
 
 	var f64a float64
 	err = db.QueryRowContext(ctx, "select f64 from temp_test_table1 where id = 'ID1'").Scan(&f64a)
@@ -206,7 +221,7 @@ func TestBool(t *testing.T) {
 	b := true
 	_, err := db.ExecContext(ctx, "insert into temp_test_table1(id, b) values('ID1', ?)", b)
 	wantNoError(t, err)
-	waitForConsistency(t)
+	waitForConsistency(t, db, "ID1", "b")
 
 	var b2 bool
 	err = db.QueryRowContext(ctx, "select b from temp_test_table1 where id = 'ID1'").Scan(&b2)
@@ -224,7 +239,7 @@ func TestBinary(t *testing.T) {
 	bin := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}
 	_, err := db.ExecContext(ctx, "insert into temp_test_table1(id, b) values('ID1', ?)", bin)
 	wantNoError(t, err)
-	waitForConsistency(t)
+	waitForConsistency(t, db, "ID1", "b")
 
 	var bin2 []byte
 	err = db.QueryRowContext(ctx, "select b from temp_test_table1 where id = 'ID1'").Scan(&bin2)
@@ -247,7 +262,7 @@ func TestDuplicateInsert(t *testing.T) {
 	)
 	wantNoError(t, err)
 	wantRowsAffected(t, result, 1)
-	waitForConsistency(t)
+	waitForConsistency(t, db, "ID1")
 
 	result, err = db.ExecContext(ctx,
 		"insert into temp_test_table1(id, a, b) values(?, ?, ?)",
@@ -271,7 +286,7 @@ func TestUpdateRowCount(t *testing.T) {
 	)
 	wantNoError(t, err)
 	wantRowsAffected(t, result, 1)
-	waitForConsistency(t)
+	waitForConsistency(t, db, "ID1")
 
 	result, err = db.ExecContext(ctx,
 		"update temp_test_table1 set a = 'xx' where id = ?",
@@ -325,6 +340,387 @@ func TestConnector(t *testing.T) {
 	}
 }
 
+func TestConnectorSession(t *testing.T) {
+	ctx := context.Background()
+	connector := Connector{
+		SimpleDB: fakesdb.New(),
+		RoleARN:  "arn:aws:iam::123456789012:role/app",
+	}
+	_, err := connector.Connect(ctx)
+	wantErrorMessageContaining(t, err, "cannot specify both SimpleDB and RoleARN")
+
+	// the role is assumed when the first request is sent
+	connector.SimpleDB = nil
+	connector.ExternalID = "xyz"
+	conn, err := connector.Connect(ctx)
+	wantNoError(t, err)
+	wantNoError(t, conn.Close())
+	if connector.sdb == nil {
+		t.Errorf("got=nil, want SimpleDB handle")
+	}
+
+	connector = Connector{SimpleDB: fakesdb.New(), HTTPClient: &http.Client{}}
+	_, err = connector.Connect(ctx)
+	wantErrorMessageContaining(t, err, "cannot specify both SimpleDB and RoleARN or HTTPClient")
+	connector.SimpleDB = nil
+	conn, err = connector.Connect(ctx)
+	wantNoError(t, err)
+	wantNoError(t, conn.Close())
+}
+
+// testDrivers is the number of drivers registered by openDriverDB.
+var testDrivers int
+
+// openDriverDB returns a database opened with sql.Open, whose connections
+// are opened by a Driver that uses sdb.
+func openDriverDB(t *testing.T, sdb simpledbiface.SimpleDBAPI) *sql.DB {
+	testDrivers++
+	driverName := fmt.Sprintf("simpledb-test-%d", testDrivers)
+	sql.Register(driverName, &Driver{sdb: sdb})
+	db, err := sql.Open(driverName, "")
+	wantNoError(t, err)
+	return db
+}
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     sessionConfig
+		errtext string
+	}{
+		{
+			name: "",
+		},
+		{
+			name: "role_arn=arn:aws:iam::123456789012:role/app&external_id=xyz&session_name=sess",
+			cfg: sessionConfig{
+				roleARN:         "arn:aws:iam::123456789012:role/app",
+				externalID:      "xyz",
+				roleSessionName: "sess",
+			},
+		},
+		{
+			name:    "region=us-east-1",
+			errtext: "unknown data source name parameter param=region",
+		},
+		{
+			name:    "external_id=xyz",
+			errtext: "external_id and session_name require role_arn",
+		},
+		{
+			name:    "role_arn=%zz",
+			errtext: "invalid data source name",
+		},
+		{
+			name:    "timeout=-1s",
+			errtext: "invalid timeout",
+		},
+		{
+			name:    "proxy=proxy:3128",
+			errtext: "invalid proxy URL",
+		},
+	}
+	for _, tt := range tests {
+		cfg, err := parseDSN(tt.name)
+		if tt.errtext != "" {
+			wantErrorMessageContaining(t, err, tt.errtext)
+			continue
+		}
+		wantNoError(t, err)
+		if got, want := *cfg, tt.cfg; got != want {
+			t.Errorf("%q: got=%+v, want=%+v", tt.name, got, want)
+		}
+	}
+
+	_, err := (&Driver{}).Open("profile=dev")
+	wantErrorMessageContaining(t, err, "unknown data source name parameter")
+
+	cfg, err := parseDSN("timeout=30s&proxy=http://proxy:3128")
+	wantNoError(t, err)
+	if got, want := cfg.httpClient.Timeout, 30*time.Second; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	req, _ := http.NewRequest("POST", "https://sdb.amazonaws.com/", nil)
+	proxy, err := cfg.httpClient.Transport.(*http.Transport).Proxy(req)
+	wantNoError(t, err)
+	if got, want := proxy.String(), "http://proxy:3128"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	var (
+		mutex      sync.Mutex
+		operations []string
+	)
+	connector := &Connector{
+		// any call to the SimpleDB API will panic
+		SimpleDB: struct{ simpledbiface.SimpleDBAPI }{},
+		DryRun:   true,
+		LogRequest: func(ctx context.Context, operation string, input interface{}) {
+			mutex.Lock()
+			operations = append(operations, operation)
+			mutex.Unlock()
+		},
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	queries := []struct {
+		query        string
+		args         []interface{}
+		rowsAffected int64
+	}{
+		{
+			query:        "create table tbl",
+			rowsAffected: 1,
+		},
+		{
+			query:        "insert into tbl(id, a) values(?, ?)",
+			args:         []interface{}{"ID1", "a"},
+			rowsAffected: 1,
+		},
+		{
+			query:        "update tbl set a = ?, b = ? where id = ?",
+			args:         []interface{}{"a", "", "ID1"},
+			rowsAffected: 1,
+		},
+		{
+			query:        "delete from tbl where id = ?",
+			args:         []interface{}{"ID1"},
+			rowsAffected: 0,
+		},
+		{
+			query:        "drop table tbl",
+			rowsAffected: 1,
+		},
+	}
+	for _, q := range queries {
+		result, err := db.ExecContext(ctx, q.query, q.args...)
+		wantNoError(t, err)
+		wantRowsAffected(t, result, q.rowsAffected)
+	}
+
+	sort.Strings(operations[2:4]) // update requests are sent concurrently
+	want := []string{
+		"CreateDomain",
+		"PutAttributes",
+		"DeleteAttributes",
+		"PutAttributes",
+		"DeleteAttributes",
+		"DeleteDomain",
+	}
+	if !reflect.DeepEqual(operations, want) {
+		t.Errorf("got=%v, want=%v", operations, want)
+	}
+}
+
+func TestSelectDomainName(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{
+			expr: "select `sql:id` from `dev.tbl` where a > 'X'",
+			want: "dev.tbl",
+		},
+		{
+			expr: "select `sql:id`, `from` from `a``b`",
+			want: "a`b",
+		},
+		{
+			expr: "select count(*) from tbl",
+			want: "tbl",
+		},
+	}
+	for tn, tt := range tests {
+		if got, want := selectDomainName(tt.expr), tt.want; got != want {
+			t.Errorf("%d: got=%q, want=%q", tn, got, want)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	connector := &Connector{
+		RequestsPerSecond: 20,
+		RequestBurst:      2,
+	}
+	limiters := connector.getLimiters()
+	if limiters == nil {
+		t.Fatal("got=nil, want=non-nil")
+	}
+	if got, want := connector.getLimiters(), limiters; got != want {
+		t.Errorf("got=%p, want=%p", got, want)
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	for _, domainName := range []string{"a", "b", "a", "b", "a"} {
+		err := limiters.wait(ctx, &domainName)
+		wantNoError(t, err)
+	}
+	// the third request for domain "a" has to wait for the limiter
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("got=%v, want=at least 40ms", elapsed)
+	}
+
+	connector = &Connector{}
+	if got := connector.getLimiters(); got != nil {
+		t.Errorf("got=%v, want=nil", got)
+	}
+}
+
+func TestRequestGroup(t *testing.T) {
+	tests := []struct {
+		c       conn
+		maxSeen int
+	}{
+		{
+			c:       conn{},
+			maxSeen: 8,
+		},
+		{
+			c:       conn{requestSem: newSemaphore(1)},
+			maxSeen: 1,
+		},
+		{
+			c:       conn{requestSem: newSemaphore(2)},
+			maxSeen: 2,
+		},
+	}
+	for tn, tt := range tests {
+		var (
+			mutex    sync.Mutex
+			inFlight int
+			maxSeen  int
+			ready    = make(chan struct{})
+		)
+		group, _ := tt.c.newRequestGroup(context.Background())
+		for i := 0; i < 8; i++ {
+			group.Go(func() error {
+				mutex.Lock()
+				inFlight++
+				if inFlight > maxSeen {
+					maxSeen = inFlight
+				}
+				if maxSeen == tt.maxSeen {
+					select {
+					case <-ready:
+					default:
+						close(ready)
+					}
+				}
+				mutex.Unlock()
+				// wait until the expected concurrency has been reached
+				<-ready
+				mutex.Lock()
+				inFlight--
+				mutex.Unlock()
+				return nil
+			})
+		}
+		wantNoError(t, group.Wait())
+		if got, want := maxSeen, tt.maxSeen; got != want {
+			t.Errorf("%d: got=%d, want=%d", tn, got, want)
+		}
+	}
+}
+
+func TestLRUItemCache(t *testing.T) {
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := &LRUItemCache{
+		Size: 2,
+		TTL:  time.Minute,
+		now:  func() time.Time { return now },
+	}
+	attrs := []*simpledb.Attribute{
+		{Name: aws.String("a"), Value: aws.String("1")},
+	}
+	wantCached := func(itemName string, want bool) {
+		t.Helper()
+		if _, got := cache.Get("tbl", itemName); got != want {
+			t.Errorf("%s: got=%v, want=%v", itemName, got, want)
+		}
+	}
+
+	cache.Put("tbl", "1", attrs, false)
+	cache.Put("tbl", "2", attrs, false)
+	wantCached("1", true)
+	cache.Put("tbl", "3", attrs, false)
+	wantCached("2", false) // least recently used
+	wantCached("1", true)
+	wantCached("3", true)
+
+	// eventually consistent reads are ignored immediately after invalidation
+	cache.Invalidate("tbl", "1")
+	wantCached("1", false)
+	cache.Put("tbl", "1", attrs, false)
+	wantCached("1", false)
+	cache.Put("tbl", "1", attrs, true)
+	wantCached("1", true)
+	cache.Invalidate("tbl", "1")
+	now = now.Add(2 * time.Second)
+	cache.Put("tbl", "1", attrs, false)
+	wantCached("1", true)
+
+	// expiry
+	now = now.Add(2 * time.Minute)
+	wantCached("1", false)
+
+	cache.Put("tbl", "1", attrs, true)
+	cache.Put("tbl2", "1", attrs, true)
+	cache.InvalidateDomain("tbl")
+	wantCached("1", false)
+	if _, ok := cache.Get("tbl2", "1"); !ok {
+		t.Errorf("got=false, want=true")
+	}
+}
+
+// getAttributesAPI is a fake SimpleDB API that counts GetAttributes requests.
+type getAttributesAPI struct {
+	simpledbiface.SimpleDBAPI
+	count int
+}
+
+func (api *getAttributesAPI) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	api.count++
+	return &simpledb.GetAttributesOutput{
+		Attributes: []*simpledb.Attribute{
+			{Name: aws.String("a"), Value: aws.String("aaa")},
+			{Name: aws.String("b"), Value: aws.String("bbb")},
+		},
+	}, nil
+}
+
+func TestItemCache(t *testing.T) {
+	ctx := context.Background()
+	api := &getAttributesAPI{}
+	connector := &Connector{
+		SimpleDB:  api,
+		ItemCache: &LRUItemCache{},
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	var a, b string
+	err := db.QueryRowContext(ctx, "select a from tbl where id = ?", "ID1").Scan(&a)
+	wantNoError(t, err)
+	err = db.QueryRowContext(ctx, "select a, b from tbl where id = ?", "ID1").Scan(&a, &b)
+	wantNoError(t, err)
+	if got, want := b, "bbb"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := api.count, 1; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	err = db.QueryRowContext(ctx, "consistent select a from tbl where id = ?", "ID1").Scan(&a)
+	wantNoError(t, err)
+	if got, want := api.count, 2; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
 // TestNotImplemented is not very useful, but it prevents our
 // code coverage metrics from being artificially lowered.
 func TestNotImplemented(t *testing.T) {
@@ -371,7 +767,13 @@ func TestErrors(t *testing.T) {
 	wantErrorMessageContaining(t, err, "not enough args supplied")
 
 	_, err = db.QueryContext(ctx, "select a, b from tbl where id = ? and b = 'x'")
-	wantErrorMessageContaining(t, err, "not enough args for select query")
+	wantErrorMessageContaining(t, err, "not enough args supplied")
+
+	_, err = db.ExecContext(ctx, "update tbl set a = ? where id = ?", "a", "id", "extra")
+	wantErrorMessageContaining(t, err, "too many args supplied")
+
+	_, err = db.ExecContext(ctx, "delete from tbl where id = ?; delete from tbl where id = ?", "id")
+	wantErrorMessageContaining(t, err, "not enough args supplied")
 }
 
 type aStringType string
@@ -397,13 +799,84 @@ func TestMakeSelectExpression(t *testing.T) {
 		{
 			query: "select id from tbl where a = ?",
 			args:  []interface{}{aStringType("X'X")},
-			want:  "select `sql:id` from `tbl` where a = 'X''X'",
+			want:  "select itemName() from `tbl` where a = 'X''X'",
+		},
+		{
+			query: "select a from tbl where id = ?",
+			args:  []interface{}{"X"},
+			want:  "select `sql:id`, `a`, `sql:a` from `tbl` where itemName() = 'X'",
+		},
+		{
+			query: "select * from tbl where a = ?",
+			args:  []interface{}{"X"},
+			want:  "select * from `tbl` where a = 'X'",
+		},
+		{
+			query: "select a from prod.tbl",
+			want:  "select `sql:id`, `a`, `sql:a` from `prod.tbl` ",
+		},
+		{
+			query: "select a from `prod`.`tbl`",
+			want:  "select `sql:id`, `a`, `sql:a` from `prod.tbl` ",
+		},
+		{
+			query: "select a from @prod.tbl",
+			want:  "select `sql:id`, `a`, `sql:a` from `prod.tbl` ",
+		},
+		{
+			query: "select a from \"prod.tbl\"",
+			want:  "select `sql:id`, `a`, `sql:a` from `prod.tbl` ",
+		},
+		{
+			query: "select id from tbl where a = $2 or b = $2 or c > $1",
+			args:  []interface{}{"X", "Y"},
+			want:  "select itemName() from `tbl` where a = 'Y' or b = 'Y' or c > 'X'",
+		},
+		{
+			query: "select a from tbl where id = $1",
+			args:  []interface{}{"X"},
+			want:  "select `sql:id`, `a`, `sql:a` from `tbl` where itemName() = 'X'",
+		},
+		{
+			query: "select a from tbl where ID between ? and ? and `Id` <> 'id' order by Id",
+			args:  []interface{}{"A", "B"},
+			want: "select `sql:id`, `a`, `sql:a` from `tbl` where itemName() between 'A' and 'B'" +
+				" and itemName() <> 'id' order by itemName()",
+		},
+		{
+			query: "select id from tbl where a is null and `b` IS NOT NULL",
+			want: "select itemName() from `tbl` where (a is null and not `sql:a` = 'string')" +
+				" and (`b` is not null or `sql:b` = 'string')",
+		},
+		{
+			query: "select id from tbl where a is not null and id is not null order by a",
+			want:  "select itemName() from `tbl` where a is not null and itemName() is not null order by a",
+		},
+		{
+			query: "select id from tbl where flag = ? and (x or not `y`) and a between b and c",
+			args:  []interface{}{true},
+			want: "select itemName() from `tbl` where flag = 'true'" +
+				" and (x = 'true' or `y` = 'false') and a between b and c",
+		},
+		{
+			query: "select id from tbl where not flag order by flag limit 10",
+			want:  "select itemName() from `tbl` where flag = 'false' order by flag limit 10",
+		},
+		{
+			query:   "select id from tbl where a is null or b > ? order by a",
+			args:    []interface{}{"X"},
+			wantErr: `order by column must be in a predicate of the where clause`,
 		},
 		{
 			query:   "select id from tbl where a = ?",
 			args:    nil,
 			wantErr: "not enough args for select query",
 		},
+		{
+			query:   "select id from tbl where a = $2",
+			args:    []interface{}{"X"},
+			wantErr: "not enough args for select query",
+		},
 	}
 	for tn, tt := range tests {
 		var args []driver.Value
@@ -413,7 +886,7 @@ func TestMakeSelectExpression(t *testing.T) {
 		q, err := parse.Parse(tt.query)
 		wantNoError(t, err)
 		c := conn{}
-		got, err := c.makeSelectExpression(q.Select, args)
+		got, err := c.makeSelectExpression(context.Background(), q.Select, args)
 		if tt.wantErr != "" {
 			wantErrorMessageContaining(t, err, tt.wantErr)
 			continue
@@ -425,6 +898,131 @@ func TestMakeSelectExpression(t *testing.T) {
 	}
 }
 
+func TestConstrainSortColumn(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			query: "select id from tbl order by a",
+			want:  "select itemName() from `tbl` where `a` is not null order by a",
+		},
+		{
+			query: "select id from tbl where b = 1 or c = 2 order by a desc limit 5",
+			want:  "select itemName() from `tbl` where (b = 1 or c = 2) and `a` is not null order by a desc limit 5",
+		},
+		{
+			query: "select id from tbl where a > '1' order by a",
+			want:  "select itemName() from `tbl` where a > '1' order by a",
+		},
+	}
+	for tn, tt := range tests {
+		q, err := parse.Parse(tt.query)
+		wantNoError(t, err)
+		c := conn{constrainSort: true}
+		got, err := c.makeSelectExpression(context.Background(), q.Select, nil)
+		wantNoError(t, err)
+		if got != tt.want {
+			t.Errorf("%d:\n got=%v\nwant=%v", tn, got, tt.want)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		query string
+		args  []driver.Value
+		want  [][]driver.Value
+	}{
+		{
+			query: "explain select a from tbl where id = ?",
+			args:  []driver.Value{"X"},
+			want: [][]driver.Value{
+				{int64(1), "GetAttributes", "dev.tbl", "X",
+					"fast path for item name lookup; eventually consistent read; attributes: a, sql:a, sql:id"},
+			},
+		},
+		{
+			query: "explain consistent select id, a from tbl where a > ?",
+			args:  []driver.Value{"X"},
+			want: [][]driver.Value{
+				{int64(1), "Select", "", nil,
+					"select `sql:id`, `a`, `sql:a` from `dev.tbl` where a > 'X'; consistent read; repeated while NextToken is returned"},
+			},
+		},
+		{
+			query: "explain select /*+ expect_rows */ id from tbl where a > ?",
+			args:  []driver.Value{"X"},
+			want: [][]driver.Value{
+				{int64(1), "Select", "", nil,
+					"select itemName() from `dev.tbl` where a > 'X'; eventually consistent read; repeated while NextToken is returned"},
+				{int64(2), "Select", "", nil,
+					"select itemName() from `dev.tbl` where a > 'X'; only if previous step finds no rows; " +
+						"consistent read; repeated while NextToken is returned"},
+			},
+		},
+		{
+			query: "explain insert into tbl(id, a) values(?, ?)",
+			args:  []driver.Value{"X", int64(1)},
+			want: [][]driver.Value{
+				{int64(1), "PutAttributes", "dev.tbl", "X",
+					"put: `sql:id` = 'string', `sql:a` = 'int64', `a` = '1'; expected: `sql:id` does not exist"},
+			},
+		},
+		{
+			query: "explain update tbl set a = ?, b = '' where id = ?",
+			args:  []driver.Value{"A", "X"},
+			want: [][]driver.Value{
+				{int64(1), "PutAttributes", "dev.tbl", "X",
+					"put: `sql:id` = 'string', `sql:a` = 'string', `a` = 'A', `sql:b` = 'string'; expected: `sql:id` = 'string'"},
+				{int64(1), "DeleteAttributes", "dev.tbl", "X",
+					"delete: `b`; expected: `sql:id` = 'string'"},
+			},
+		},
+		{
+			query: "explain insert into tbl(id, a) values(?, ?) on duplicate key update a = values(a)",
+			args:  []driver.Value{"X", "A"},
+			want: [][]driver.Value{
+				{int64(1), "PutAttributes", "dev.tbl", "X",
+					"put: `sql:id` = 'string', `sql:a` = 'string', `a` = 'A'; expected: `sql:id` does not exist"},
+				{int64(2), "PutAttributes", "dev.tbl", "X",
+					"put: `sql:id` = 'string', `sql:a` = 'string', `a` = 'A'; expected: `sql:id` = 'string'; " +
+						"only if previous step fails with ConditionalCheckFailed"},
+			},
+		},
+		{
+			query: "explain delete from tbl where id = 'X'",
+			want: [][]driver.Value{
+				{int64(1), "DeleteAttributes", "dev.tbl", "X", "all attributes"},
+			},
+		},
+		{
+			query: "explain drop table tbl",
+			want: [][]driver.Value{
+				{int64(1), "DeleteDomain", "dev.tbl", nil, ""},
+			},
+		},
+	}
+	for tn, tt := range tests {
+		q, err := parse.Parse(tt.query)
+		wantNoError(t, err)
+		c := conn{Schema: "dev"}
+		rows, err := c.explain(context.Background(), q, tt.args)
+		wantNoError(t, err)
+		var got [][]driver.Value
+		for {
+			dest := make([]driver.Value, len(rows.Columns()))
+			if err := rows.Next(dest); err != nil {
+				break
+			}
+			got = append(got, dest)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d:\n got=%v\nwant=%v", tn, got, tt.want)
+		}
+	}
+}
+
 func TestDomainName(t *testing.T) {
 	tests := []struct {
 		c          conn
@@ -453,20 +1051,151 @@ func TestDomainName(t *testing.T) {
 			tableName:  "tbl",
 			domainName: "abc",
 		},
-	}
-	for tn, tt := range tests {
-		if got, want := tt.c.getDomainName(tt.tableName), tt.domainName; got != want {
-			t.Errorf("%d: got=%q want=%q", tn, got, want)
-		}
-	}
-}
-
-func wantNoError(t *testing.T, err error) {
-	t.Helper()
-	if err != nil {
-		t.Fatalf("want no error, got %v", err)
-	}
-}
+		{
+			c: conn{
+				Schema:           "dev",
+				SchemaExclusions: []string{"shared", "global_*"},
+			},
+			tableName:  "shared",
+			domainName: "shared",
+		},
+		{
+			c: conn{
+				Schema:           "dev",
+				SchemaExclusions: []string{"shared", "global_*"},
+			},
+			tableName:  "global_config",
+			domainName: "global_config",
+		},
+		{
+			c: conn{
+				Schema:           "dev",
+				SchemaExclusions: []string{"shared", "global_*"},
+			},
+			tableName:  "tbl",
+			domainName: "dev.tbl",
+		},
+		{
+			c: conn{
+				Schema: "dev",
+			},
+			tableName:  "prod.tbl",
+			domainName: "prod.tbl",
+		},
+	}
+	for tn, tt := range tests {
+		if got, want := tt.c.getDomainName(tt.tableName), tt.domainName; got != want {
+			t.Errorf("%d: got=%q want=%q", tn, got, want)
+		}
+	}
+}
+
+func TestParseBoxUsage(t *testing.T) {
+	tests := []struct {
+		body  string
+		hours float64
+		ok    bool
+	}{
+		{
+			body: `<PutAttributesResponse><ResponseMetadata><RequestId>490206ce</RequestId>` +
+				`<BoxUsage>0.0000219907</BoxUsage></ResponseMetadata></PutAttributesResponse>`,
+			hours: 0.0000219907,
+			ok:    true,
+		},
+		{
+			body: `<Response><Errors><Error><Code>ConditionalCheckFailed</Code><Message>xxx</Message>` +
+				`<BoxUsage>0.0055590278</BoxUsage></Error></Errors><RequestID>yyy</RequestID></Response>`,
+			hours: 0.0055590278,
+			ok:    true,
+		},
+		{
+			body: `<Response></Response>`,
+		},
+	}
+	for tn, tt := range tests {
+		hours, ok := parseBoxUsage([]byte(tt.body))
+		if got, want := ok, tt.ok; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+		if got, want := hours, tt.hours; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+	}
+}
+
+func TestBoxUsageContext(t *testing.T) {
+	ctx := context.Background()
+	if got := requestOptions(ctx); len(got) != 0 {
+		t.Errorf("got=%d, want=0", len(got))
+	}
+	var usage BoxUsage
+	ctx = WithBoxUsage(ctx, &usage)
+	if got := requestOptions(ctx); len(got) != 1 {
+		t.Errorf("got=%d, want=1", len(got))
+	}
+	usage.add(0.25)
+	usage.add(0.5)
+	if got, want := usage.Hours(), 0.75; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := usage.APICalls(), 2; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	usage.Reset()
+	if got, want := usage.Hours(), 0.0; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestSynonymResolver(t *testing.T) {
+	ctx := context.Background()
+	c := conn{
+		Schema: "dev",
+		Synonyms: map[string]string{
+			"tbl2": "abc",
+		},
+		SynonymResolver: SynonymResolverFunc(func(ctx context.Context, tableName string) (string, error) {
+			switch tableName {
+			case "tbl1":
+				return "xyz", nil
+			case "bad":
+				return "", errors.New("lookup failed")
+			}
+			return "", nil
+		}),
+	}
+	tests := []struct {
+		tableName  string
+		domainName string
+		wantErr    string
+	}{
+		{tableName: "tbl1", domainName: "xyz"},
+		{tableName: "tbl2", domainName: "abc"},
+		{tableName: "tbl3", domainName: "dev.tbl3"},
+		{tableName: "bad", wantErr: "cannot resolve synonym"},
+		{tableName: "@tbl1", domainName: "tbl1"},
+		{tableName: "@tbl2", domainName: "tbl2"},
+		{tableName: "@prod.bad", domainName: "prod.bad"},
+	}
+	for tn, tt := range tests {
+		got, err := c.resolveDomainName(ctx, tt.tableName)
+		if tt.wantErr != "" {
+			wantErrorMessageContaining(t, err, tt.wantErr)
+			continue
+		}
+		wantNoError(t, err)
+		if want := tt.domainName; got != want {
+			t.Errorf("%d: got=%q want=%q", tn, got, want)
+		}
+	}
+}
+
+func wantNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+}
 
 func wantError(t *testing.T, err error) {
 	t.Helper()
@@ -522,9 +1251,12 @@ func wantRowsAffected(t *testing.T, result sql.Result, want int64) {
 	}
 }
 
-func waitForConsistency(t *testing.T) {
-	// wait for simpledb to become consistent
-	time.Sleep(500 * time.Millisecond)
+func waitForConsistency(t *testing.T, db *sql.DB, id string, columns ...string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := AwaitConsistent(ctx, db, "temp_test_table1", id, columns...)
+	wantNoError(t, err)
 }
 
 func newDB(t *testing.T) *sql.DB {
@@ -541,14 +1273,18 @@ func createTestTable(t *testing.T, db *sql.DB) {
 	wantNoError(t, err)
 	rows, err := db.QueryContext(ctx, "select id from temp_test_table1")
 	wantNoError(t, err)
+	var ids []string
 	for rows.Next() {
 		var id string
 		err = rows.Scan(&id)
 		wantNoError(t, err)
 		_, err = db.ExecContext(ctx, "delete from temp_test_table1 where id = ?", id)
 		wantNoError(t, err)
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		waitForConsistency(t, db, id)
 	}
-	waitForConsistency(t)
 }
 
 func dropTestTable(t *testing.T, db *sql.DB) {
@@ -556,3 +1292,3967 @@ func dropTestTable(t *testing.T, db *sql.DB) {
 	_, err := db.ExecContext(ctx, "drop table temp_test_table1")
 	wantNoError(t, err)
 }
+
+func TestDump(t *testing.T) {
+	ctx := context.Background()
+	connector := &Connector{SimpleDB: fakesdb.New()}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{query: "create table tbl"},
+		{query: "insert into tbl(id, a, b) values(?, ?, ?)", args: []interface{}{"ID1", "x,y", int64(1)}},
+		{query: "insert into tbl(id, a, c) values(?, ?, ?)", args: []interface{}{"ID2", "z", nil}},
+	}
+	for _, stmt := range statements {
+		_, err := db.ExecContext(ctx, stmt.query, stmt.args...)
+		wantNoError(t, err)
+	}
+
+	tests := []struct {
+		query string
+		args  []interface{}
+		want  string
+	}{
+		{
+			query: "select a, b from tbl where a = ?",
+			args:  []interface{}{"z"},
+			want:  "id,a,sql:a,b,sql:b\nID2,z,string,,\n",
+		},
+		{
+			query: "select id, b from tbl",
+			want:  "id,b,sql:b\nID1,1,int64\nID2,,\n",
+		},
+	}
+	for tn, tt := range tests {
+		var buf strings.Builder
+		err := connector.Dump(ctx, &buf, tt.query, tt.args...)
+		wantNoError(t, err)
+		if got, want := buf.String(), tt.want; got != want {
+			t.Errorf("%d: got=%q, want=%q", tn, got, want)
+		}
+	}
+
+	var buf strings.Builder
+	err := connector.DumpTable(ctx, &buf, "tbl")
+	wantNoError(t, err)
+	want := "id,a,sql:a,b,sql:b,c,sql:c\n" +
+		"ID1,\"x,y\",string,1,int64,,\n" +
+		"ID2,z,string,,,,null\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got=%q, want=%q", got, want)
+	}
+
+	err = connector.Dump(ctx, &buf, "delete from tbl where id = 'ID1'")
+	wantErrorMessageContaining(t, err, "expect select query")
+}
+
+// flakyBatchPutAPI fails the first BatchPutAttributes request.
+type flakyBatchPutAPI struct {
+	*fakesdb.DB
+	failed bool
+}
+
+func (api *flakyBatchPutAPI) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	if !api.failed {
+		api.failed = true
+		return nil, awserr.New("ServiceUnavailable", "try again", nil)
+	}
+	return api.DB.BatchPutAttributesWithContext(ctx, input, opts...)
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	connector := &Connector{SimpleDB: &flakyBatchPutAPI{DB: sdb}}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	for _, query := range []string{"create table src", "create table dst", "create table j"} {
+		_, err := db.ExecContext(ctx, query)
+		wantNoError(t, err)
+	}
+
+	var progress []int
+	opts := &LoadOptions{
+		ColumnTypes: map[string]string{"n": "int64", "t": "time"},
+		Progress:    func(count int) { progress = append(progress, count) },
+	}
+	var input strings.Builder
+	input.WriteString("id,s,n,t\n")
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&input, "ID%02d,s%d,%d,2018-01-02T03:04:05Z\n", i, i, i)
+	}
+	count, err := connector.Load(ctx, strings.NewReader(input.String()), "src", opts)
+	wantNoError(t, err)
+	if got, want := count, 30; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := progress, []int{25, 30}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	var (
+		s  string
+		n  int64
+		tm time.Time
+	)
+	err = db.QueryRowContext(ctx, "select s, n, t from src where id = 'ID07'").Scan(&s, &n, &tm)
+	wantNoError(t, err)
+	if s != "s7" || n != 7 || !tm.Equal(time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected values: %v, %v, %v", s, n, tm)
+	}
+
+	// a dump can be loaded into another table
+	var dump strings.Builder
+	err = connector.DumpTable(ctx, &dump, "src")
+	wantNoError(t, err)
+	_, err = connector.Load(ctx, strings.NewReader(dump.String()), "dst", nil)
+	wantNoError(t, err)
+	if got, want := sdb.Item("dst", "ID07"), sdb.Item("src", "ID07"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	jsonInput := `{"id": "J1", "a": 1, "b": 1.5, "c": true, "d": null, "e": "x", "t": "2018-01-02T03:04:05Z"}` + "\n"
+	_, err = connector.Load(ctx, strings.NewReader(jsonInput), "j", &LoadOptions{
+		Format:      LoadJSON,
+		ColumnTypes: map[string]string{"t": "time"},
+	})
+	wantNoError(t, err)
+	want := map[string][]string{
+		"sql:id": {"string"},
+		"a":      {"1"},
+		"sql:a":  {"int64"},
+		"b":      {"1.5"},
+		"sql:b":  {"float64"},
+		"c":      {"true"},
+		"sql:c":  {"bool"},
+		"sql:d":  {"null"},
+		"e":      {"x"},
+		"sql:e":  {"string"},
+		"t":      {"2018-01-02T03:04:05.000000000Z"},
+		"sql:t":  {"time"},
+	}
+	if got := sdb.Item("j", "J1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	_, err = connector.Load(ctx, strings.NewReader("a,b\n1,2\n"), "j", nil)
+	wantErrorMessageContaining(t, err, "missing id column")
+	_, err = connector.Load(ctx, strings.NewReader("id,n\nX,abc\n"), "j", opts)
+	wantErrorMessageContaining(t, err, "cannot convert value")
+}
+
+func TestMultipleResultSets(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{query: "create table tbl"},
+		{query: "insert into tbl(id, a) values(?, ?)", args: []interface{}{"ID1", "x"}},
+		{query: "insert into tbl(id, a) values(?, ?)", args: []interface{}{"ID2", "y"}},
+	}
+	for _, stmt := range statements {
+		_, err := db.ExecContext(ctx, stmt.query, stmt.args...)
+		wantNoError(t, err)
+	}
+
+	rows, err := db.QueryContext(ctx, "select id from tbl where a = ?; select a from tbl where id = ?;",
+		"x", "ID2")
+	wantNoError(t, err)
+	defer rows.Close()
+
+	var got [][]string
+	for {
+		var values []string
+		for rows.Next() {
+			var s string
+			wantNoError(t, rows.Scan(&s))
+			values = append(values, s)
+		}
+		got = append(got, values)
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	wantNoError(t, rows.Err())
+	if want := [][]string{{"ID1"}, {"y"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	_, err = db.QueryContext(ctx, "select id from tbl; delete from tbl where id = 'ID1'")
+	wantErrorMessageContaining(t, err, "expect select query")
+}
+
+func TestExecMultipleStatements(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb})
+	defer db.Close()
+
+	result, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a) values(?, ?);
+		insert into tbl(id, a) values('ID2', ?);
+		update tbl set a = 'z' where id = ?;
+	`, "ID1", "x", "y", "ID2")
+	wantNoError(t, err)
+	wantRowsAffected(t, result, 4)
+	if got, want := sdb.Item("tbl", "ID2")["a"], []string{"z"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	// the second insert fails, so the statements after it are not run
+	_, err = db.ExecContext(ctx, `
+		delete from tbl where id = 'ID1';
+		insert into tbl(id, a) values('ID2', 'w');
+		delete from tbl where id = 'ID2'
+	`)
+	wantErrorMessageContaining(t, err, "index=1")
+	if sdb.Item("tbl", "ID1") != nil || sdb.Item("tbl", "ID2") == nil {
+		t.Errorf("unexpected items")
+	}
+
+	// no statements are run if any statement is invalid
+	_, err = db.ExecContext(ctx, "delete from tbl where id = 'ID2'; select a from tbl")
+	wantErrorMessageContaining(t, err, "unexpected select query")
+	if sdb.Item("tbl", "ID2") == nil {
+		t.Errorf("unexpected delete")
+	}
+}
+
+func TestQueryMaps(t *testing.T) {
+	ctx := context.Background()
+	connector := &Connector{SimpleDB: fakesdb.New()}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a, b) values('ID1', ?, ?);
+		insert into tbl(id, c, d) values('ID2', ?, ?);
+	`, int64(1), "", true, nil)
+	wantNoError(t, err)
+
+	rows, err := connector.QueryMaps(ctx, "select * from tbl")
+	wantNoError(t, err)
+	var got []map[string]interface{}
+	for rows.Next() {
+		got = append(got, rows.Map())
+	}
+	wantNoError(t, rows.Err())
+	wantNoError(t, rows.Close())
+	want := []map[string]interface{}{
+		{"id": "ID1", "a": int64(1), "b": ""},
+		{"id": "ID2", "c": true, "d": nil},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	rows, err = connector.QueryMaps(ctx, "select a from tbl where id = ?", "ID1")
+	wantNoError(t, err)
+	if !rows.Next() {
+		t.Fatalf("expected a row")
+	}
+	if got, want := rows.Map(), map[string]interface{}{"id": "ID1", "a": int64(1)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if rows.Next() {
+		t.Errorf("expected one row")
+	}
+
+	_, err = db.QueryContext(ctx, "select * from tbl")
+	wantErrorMessageContaining(t, err, "use Connector.QueryMaps")
+}
+
+func TestRecordSchema(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	connector := &Connector{SimpleDB: sdb, RecordSchema: true}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a, b, c) values('ID1', ?, ?, ?);
+		insert into tbl(id, a, b) values('ID2', ?, ?);
+		update tbl set a = ? where id = 'ID1';
+	`, "x", int64(1), nil, "y", int64(2), int64(3))
+	wantNoError(t, err)
+
+	// once recorded, column types are not recorded again
+	if got, want := sdb.Calls("PutAttributes"), 5; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	schema, err := connector.TableSchema(ctx, "tbl")
+	wantNoError(t, err)
+	if want := map[string][]string{"a": {"int64", "string"}, "b": {"int64"}}; !reflect.DeepEqual(schema, want) {
+		t.Errorf("got=%v, want=%v", schema, want)
+	}
+
+	drift, err := connector.VerifySchema(ctx, "tbl", map[string]string{"a": "string", "c": "bool"})
+	wantNoError(t, err)
+	want := &SchemaDrift{
+		NewColumns: []string{"b"},
+		TypeConflicts: []TypeConflict{
+			{Column: "a", Expected: "string", Recorded: []string{"int64", "string"}},
+		},
+	}
+	if !reflect.DeepEqual(drift, want) {
+		t.Errorf("got=%+v, want=%+v", drift, want)
+	}
+	if !drift.HasDrift() {
+		t.Errorf("expected drift")
+	}
+
+	// the schema item is not returned by select statements
+	var count int
+	rows, err := db.QueryContext(ctx, "select id from tbl")
+	wantNoError(t, err)
+	for rows.Next() {
+		count++
+	}
+	wantNoError(t, rows.Err())
+	if got, want := count, 2; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestChangeHooks(t *testing.T) {
+	ctx := context.Background()
+	var changes []string
+	record := func(kind string) func(context.Context, *Change) {
+		return func(ctx context.Context, change *Change) {
+			if ctx.Err() != nil {
+				t.Errorf("%s: context is done", kind)
+			}
+			changes = append(changes, fmt.Sprintf("%s %s %s %s %v %v", kind, change.Table, change.Domain, change.ID, change.Values, change.OldValues))
+		}
+	}
+	connector := &Connector{
+		SimpleDB:    fakesdb.New(),
+		AfterInsert: record("insert"),
+		AfterUpdate: record("update"),
+		AfterDelete: record("delete"),
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a, b) values('ID1', ?, ?);
+		update tbl set a = ?, b = ? where id = 'ID1';
+		update tbl set a = ? where id = 'ID2';
+		insert into tbl(id, a) values('ID1', ?) on duplicate key update a = ?;
+		delete from tbl where id = 'ID1';
+	`, "x", int64(1), "y", nil, "z", "p", "q")
+	wantNoError(t, err)
+
+	want := []string{
+		"insert tbl tbl ID1 map[a:x b:1] map[]",
+		"update tbl tbl ID1 map[a:y b:<nil>] map[a:x b:1]",
+		"update tbl tbl ID1 map[a:q] map[a:y]",
+		"delete tbl tbl ID1 map[] map[a:q b:<nil>]",
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("got=%q\nwant=%q", changes, want)
+	}
+
+	// the old values of bulk updates and deletes, and of columns with no value
+	changes = nil
+	_, err = db.ExecContext(ctx, `
+		insert into tbl(id, a) values('ID3', ?);
+		update tbl set a = ?, c = ? where id in (select id from tbl where a = ?);
+		delete from tbl where id in (select id from tbl where a = ?);
+	`, "r", "s", "t", "r", "s")
+	wantNoError(t, err)
+	want = []string{
+		"insert tbl tbl ID3 map[a:r] map[]",
+		"update tbl tbl ID3 map[a:s c:t] map[a:r c:<nil>]",
+		"delete tbl tbl ID3 map[] map[a:s c:t]",
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("got=%q\nwant=%q", changes, want)
+	}
+}
+
+func TestAuditTable(t *testing.T) {
+	ctx := context.Background()
+	connector := &Connector{SimpleDB: fakesdb.New(), AuditTable: "audit"}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a, b) values('ID1', ?, ?);
+		update tbl set a = ? where id = 'ID1';
+		update tbl set a = ? where id = 'ID2';
+		insert into tbl(id, a) values('ID1', ?) on duplicate key update b = ?;
+		delete from tbl where id = 'ID1';
+	`, "x", int64(1), "y", "z", "p", int64(2))
+	wantNoError(t, err)
+	_, err = db.ExecContext(ctx, "insert into tbl(id, a) values('ID3', ?)", "q")
+	wantNoError(t, err)
+	_, err = db.ExecContext(ctx, "insert into tbl(id, a) values('ID3', ?)", "r")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	rows, err := connector.QueryMaps(ctx, "select * from audit")
+	wantNoError(t, err)
+	var entries []map[string]interface{}
+	for rows.Next() {
+		entries = append(entries, rows.Map())
+	}
+	wantNoError(t, rows.Err())
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i]["id"].(string) < entries[j]["id"].(string)
+	})
+
+	tests := []struct {
+		operation string
+		itemID    string
+		status    string
+		statement string
+		values    map[string]interface{}
+	}{
+		{
+			operation: "insert",
+			itemID:    "ID1",
+			status:    AuditApplied,
+			statement: "insert into tbl(id, a, b) values('ID1', ?, ?)",
+			values:    map[string]interface{}{"new.a": "x", "new.b": int64(1)},
+		},
+		{
+			operation: "update",
+			itemID:    "ID1",
+			status:    AuditApplied,
+			statement: "update tbl set a = ? where id = 'ID1'",
+			values:    map[string]interface{}{"old.a": "x", "new.a": "y"},
+		},
+		{
+			operation: "update",
+			itemID:    "ID2",
+			status:    AuditUnchanged,
+			statement: "update tbl set a = ? where id = 'ID2'",
+			values:    map[string]interface{}{"new.a": "z"},
+		},
+		{
+			operation: "update",
+			itemID:    "ID1",
+			status:    AuditApplied,
+			statement: "insert into tbl(id, a) values('ID1', ?) on duplicate key update b = ?",
+			values:    map[string]interface{}{"old.a": "y", "old.b": int64(1), "new.b": int64(2)},
+		},
+		{
+			operation: "delete",
+			itemID:    "ID1",
+			status:    AuditApplied,
+			statement: "delete from tbl where id = 'ID1'",
+			values:    map[string]interface{}{"old.a": "y", "old.b": int64(2)},
+		},
+		{
+			operation: "insert",
+			itemID:    "ID3",
+			status:    AuditApplied,
+			statement: "insert into tbl(id, a) values('ID3', ?)",
+			values:    map[string]interface{}{"new.a": "q"},
+		},
+		{
+			operation: "insert",
+			itemID:    "ID3",
+			status:    AuditFailed,
+			statement: "insert into tbl(id, a) values('ID3', ?)",
+			values:    map[string]interface{}{"new.a": "r"},
+		},
+	}
+	if got, want := len(entries), len(tests); got != want {
+		t.Fatalf("got=%v, want=%v", got, want)
+	}
+	for tn, tt := range tests {
+		entry := entries[tn]
+		want := map[string]interface{}{
+			"id":        entry["id"],
+			"changedAt": entry["changedAt"],
+			"tableName": "tbl",
+			"itemId":    tt.itemID,
+			"operation": tt.operation,
+			"statement": tt.statement,
+			"status":    tt.status,
+		}
+		for k, v := range tt.values {
+			want[k] = v
+		}
+		if _, ok := entry["changedAt"].(time.Time); !ok {
+			t.Errorf("%d: changedAt: got=%T, want time.Time", tn, entry["changedAt"])
+		}
+		if !reflect.DeepEqual(entry, want) {
+			t.Errorf("%d: got=%v\nwant=%v", tn, entry, want)
+		}
+	}
+}
+
+func TestTTLColumn(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	connector := &Connector{SimpleDB: sdb, TTLColumn: "expires"}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	now := time.Now()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a, expires) values('ID1', 'a1', ?);
+		insert into tbl(id, a, expires) values('ID2', 'a2', ?);
+		insert into tbl(id, a, expires) values('ID3', 'a3', ?);
+		insert into tbl(id, a) values('ID4', 'a4');
+	`, now.Add(-time.Hour), now.Add(time.Hour), now.Add(-time.Minute).Unix())
+	wantNoError(t, err)
+
+	queryIDs := func(query string) []string {
+		t.Helper()
+		var ids []string
+		rows, err := db.QueryContext(ctx, query)
+		wantNoError(t, err)
+		for rows.Next() {
+			var id, a string
+			wantNoError(t, rows.Scan(&id, &a))
+			ids = append(ids, id)
+		}
+		wantNoError(t, rows.Err())
+		return ids
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{
+			query: "select id, a from tbl order by id",
+			want:  []string{"ID2", "ID4"},
+		},
+		{
+			query: "select id, a from tbl where id = 'ID1'",
+			want:  nil,
+		},
+		{
+			query: "select id, a from tbl where id = 'ID2'",
+			want:  []string{"ID2"},
+		},
+	}
+	for tn, tt := range tests {
+		if got := queryIDs(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d: got=%v, want=%v", tn, got, tt.want)
+		}
+	}
+
+	rows, err := connector.QueryMaps(ctx, "select * from tbl")
+	wantNoError(t, err)
+	var count int
+	for rows.Next() {
+		count++
+	}
+	wantNoError(t, rows.Err())
+	if got, want := count, 2; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	n, err := connector.Vacuum(ctx, "tbl")
+	wantNoError(t, err)
+	if got, want := n, 2; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	for _, itemName := range []string{"ID1", "ID3"} {
+		if item := sdb.Item("tbl", itemName); item != nil {
+			t.Errorf("%s: expected item to be deleted", itemName)
+		}
+	}
+	for _, itemName := range []string{"ID2", "ID4"} {
+		if item := sdb.Item("tbl", itemName); item == nil {
+			t.Errorf("%s: expected item to remain", itemName)
+		}
+	}
+
+	_, err = (&Connector{SimpleDB: sdb}).Vacuum(ctx, "tbl")
+	wantErrorMessageContaining(t, err, "TTLColumn is required")
+}
+
+// staleReadAPI returns an empty result for the first eventually
+// consistent GetAttributes requests, as if the item did not exist.
+type staleReadAPI struct {
+	*fakesdb.DB
+	staleReads int
+	reads      int
+}
+
+func (api *staleReadAPI) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	if !aws.BoolValue(input.ConsistentRead) {
+		api.reads++
+		if api.reads <= api.staleReads {
+			return &simpledb.GetAttributesOutput{}, nil
+		}
+	}
+	return api.DB.GetAttributesWithContext(ctx, input, opts...)
+}
+
+func TestAwaitConsistent(t *testing.T) {
+	ctx := context.Background()
+	sdb := &staleReadAPI{DB: fakesdb.New()}
+	db := sql.OpenDB(&Connector{SimpleDB: sdb})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a) values('ID1', 'x');
+	`)
+	wantNoError(t, err)
+
+	tests := []struct {
+		id         string
+		columns    []string
+		staleReads int
+		wantReads  int
+	}{
+		{
+			id:         "ID1",
+			staleReads: 2,
+			wantReads:  3,
+		},
+		{
+			id:         "ID1",
+			columns:    []string{"a", "b"},
+			staleReads: 1,
+			wantReads:  2,
+		},
+		{
+			// absence of the item is consistent with a stale read
+			id:         "ID2",
+			staleReads: 2,
+			wantReads:  1,
+		},
+	}
+	for tn, tt := range tests {
+		sdb.staleReads, sdb.reads = tt.staleReads, 0
+		err := AwaitConsistent(ctx, db, "tbl", tt.id, tt.columns...)
+		if err != nil {
+			t.Errorf("%d: got=%v, want=nil", tn, err)
+			continue
+		}
+		if got, want := sdb.reads, tt.wantReads; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+	}
+
+	sdb.staleReads, sdb.reads = 1000, 0
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	err = AwaitConsistent(ctx, db, "tbl", "ID1")
+	wantErrorMessageContaining(t, err, "item is not consistent")
+}
+
+func TestHexLiteral(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a, b) values('ID1', x'0102ff', X'');
+		update tbl set c = x'CAFE' where id = 'ID1';
+	`)
+	wantNoError(t, err)
+
+	var a, b, c []byte
+	err = db.QueryRowContext(ctx, "select a, b, c from tbl where id = 'ID1'").Scan(&a, &b, &c)
+	wantNoError(t, err)
+	for _, tt := range []struct {
+		got  []byte
+		want []byte
+	}{
+		{got: a, want: []byte{0x01, 0x02, 0xff}},
+		{got: b, want: []byte{}},
+		{got: c, want: []byte{0xca, 0xfe}},
+	} {
+		if string(tt.got) != string(tt.want) {
+			t.Errorf("got=%v, want=%v", tt.got, tt.want)
+		}
+	}
+}
+
+func TestNumberedPlaceholders(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a, b) values($1, $2, $2);
+		insert into tbl(id, a, b) values($2, $1, $1);
+	`, "ID1", "x", "y", "ID2")
+	wantNoError(t, err)
+
+	var ids []string
+	rows, err := db.QueryContext(ctx, "select id from tbl where a = $1 or b = $1", "x")
+	wantNoError(t, err)
+	for rows.Next() {
+		var id string
+		wantNoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	wantNoError(t, rows.Err())
+	if want := []string{"ID1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got=%v, want=%v", ids, want)
+	}
+	var a, b string
+	err = db.QueryRowContext(ctx, "select a, b from tbl where id = $1", "ID2").Scan(&a, &b)
+	wantNoError(t, err)
+	if a != "y" || b != "y" {
+		t.Errorf("got=%v,%v, want=y,y", a, b)
+	}
+}
+
+func TestUint64AndBigInt(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb})
+	defer db.Close()
+	big1, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, u, v, b) values('ID1', ?, ?, ?);
+	`, uint64(math.MaxUint64), uint64(5), big1)
+	wantNoError(t, err)
+
+	item := sdb.Item("tbl", "ID1")
+	if got, want := item["v"], []string{"00000000000000000005"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	var (
+		u, v uint64
+		b    *big.Int
+	)
+	err = db.QueryRowContext(ctx, "select u, v, b from tbl where id = 'ID1'").Scan(&u, &v, &b)
+	wantNoError(t, err)
+	if got, want := u, uint64(math.MaxUint64); got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := v, uint64(5); got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if b == nil || b.Cmp(big1) != 0 {
+		t.Errorf("got=%v, want=%v", b, big1)
+	}
+
+	// uint64 values sort in numeric order
+	_, err = db.ExecContext(ctx, "insert into tbl(id, v) values('ID2', ?)", uint64(40))
+	wantNoError(t, err)
+	var id string
+	err = db.QueryRowContext(ctx, "select id from tbl where v > ?", uint64(10)).Scan(&id)
+	wantNoError(t, err)
+	if got, want := id, "ID2"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	err = db.QueryRowContext(ctx, "select id from tbl where b = ?", big1).Scan(&id)
+	wantNoError(t, err)
+	if got, want := id, "ID1"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	// item names are strings, so integers cannot be compared with the id
+	err = db.QueryRowContext(ctx, "select id from tbl where id > ?", uint64(10)).Scan(&id)
+	wantErrorMessageContaining(t, err, "args compared with id must be strings")
+	err = db.QueryRowContext(ctx, "select id from tbl where v > $1 and itemName() in ($2, $3)", uint64(10), "ID2", big1).Scan(&id)
+	wantErrorMessageContaining(t, err, "args compared with id must be strings")
+	err = db.QueryRowContext(ctx, "select id from tbl where id >= ? and v > ?", "ID2", uint64(10)).Scan(&id)
+	wantNoError(t, err)
+	if got, want := id, "ID2"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	// a corrupt bigint value is returned as null
+	_, err = sdb.PutAttributesWithContext(ctx, &simpledb.PutAttributesInput{
+		DomainName: aws.String("tbl"),
+		ItemName:   aws.String("ID3"),
+		Attributes: []*simpledb.ReplaceableAttribute{
+			{Name: aws.String("b"), Value: aws.String("not a number")},
+			{Name: aws.String("sql:b"), Value: aws.String("bigint")},
+		},
+	})
+	wantNoError(t, err)
+	var value interface{}
+	err = db.QueryRowContext(ctx, "select b from tbl where id = 'ID3'").Scan(&value)
+	wantNoError(t, err)
+	if value != nil {
+		t.Errorf("got=%#v, want=nil", value)
+	}
+}
+
+func TestTimePrecisionAndZone(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb})
+	defer db.Close()
+	aest := time.FixedZone("AEST", 10*60*60)
+	tm1 := time.Date(2018, 1, 2, 3, 4, 5, 123456789, aest)
+	tm2 := time.Date(2018, 1, 2, 3, 4, 5, 500000000, time.UTC)
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, t1, t2) values('ID1', ?, ?);
+	`, tm1, tm2)
+	wantNoError(t, err)
+
+	item := sdb.Item("tbl", "ID1")
+	if got, want := item["sql:t1"], []string{"time:AEST"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := item["t2"], []string{"2018-01-02T03:04:05.500000000Z"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	var got1, got2 time.Time
+	err = db.QueryRowContext(ctx, "select t1, t2 from tbl where id = 'ID1'").Scan(&got1, &got2)
+	wantNoError(t, err)
+	if !got1.Equal(tm1) || got1.Format(time.RFC3339Nano+" MST") != tm1.Format(time.RFC3339Nano+" MST") {
+		t.Errorf("got=%v, want=%v", got1, tm1)
+	}
+	if !got2.Equal(tm2) || got2.Location() != time.UTC {
+		t.Errorf("got=%v, want=%v", got2, tm2)
+	}
+
+	// legacy format is written for compatibility, and can still be read
+	db2 := sql.OpenDB(&Connector{SimpleDB: sdb, LegacyTimeFormat: true})
+	defer db2.Close()
+	_, err = db2.ExecContext(ctx, "insert into tbl(id, t1) values('ID2', ?)", tm1)
+	wantNoError(t, err)
+	item = sdb.Item("tbl", "ID2")
+	if got, want := item["t1"], []string{"2018-01-02T03:04:05+10:00"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := item["sql:t1"], []string{"time"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	err = db.QueryRowContext(ctx, "select t1 from tbl where id = 'ID2'").Scan(&got1)
+	wantNoError(t, err)
+	if want := tm1.Truncate(time.Second); !got1.Equal(want) {
+		t.Errorf("got=%v, want=%v", got1, want)
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, price) values('ID1', ?);
+		insert into tbl(id, price) values('ID2', ?);
+		insert into tbl(id, price) values('ID3', ?);
+		insert into tbl(id, price) values('ID4', ?);
+	`, Decimal("19.99"), Decimal("-0.01"), big.NewRat(-25, 2), Decimal("100"))
+	wantNoError(t, err)
+
+	item := sdb.Item("tbl", "ID1")
+	if got, want := item["sql:price"], []string{"decimal"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := item["price"], []string{"000000000000000019.990000000000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	var price *big.Rat
+	err = db.QueryRowContext(ctx, "select price from tbl where id = 'ID3'").Scan(&price)
+	wantNoError(t, err)
+	if want := big.NewRat(-25, 2); price == nil || price.Cmp(want) != 0 {
+		t.Errorf("got=%v, want=%v", price, want)
+	}
+
+	// decimal args are compared with the sortable encoding
+	rows, err := db.QueryContext(ctx, "select id from tbl where price > ? and price < ? order by price", Decimal("-12.5"), Decimal("100"))
+	wantNoError(t, err)
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		wantNoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	wantNoError(t, rows.Err())
+	if want := []string{"ID2", "ID1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got=%v, want=%v", ids, want)
+	}
+
+	_, err = db.ExecContext(ctx, "insert into tbl(id, price) values('ID5', ?)", Decimal("0.0000000000001"))
+	wantErrorMessageContaining(t, err, "too many fractional digits")
+	_, err = db.ExecContext(ctx, "insert into tbl(id, price) values('ID5', ?)", Decimal("1e18"))
+	wantErrorMessageContaining(t, err, "too many integer digits")
+	_, err = db.ExecContext(ctx, "insert into tbl(id, price) values('ID5', ?)", Decimal("abc"))
+	wantErrorMessageContaining(t, err, "invalid decimal")
+}
+
+func TestEmptyStringSentinel(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb, EmptyStringSentinel: "(empty)"})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a, b, c) values('ID1', ?, ?, ?);
+	`, "", nil, "(empty)")
+	wantNoError(t, err)
+
+	item := sdb.Item("tbl", "ID1")
+	for _, tt := range []struct {
+		name string
+		want []string
+	}{
+		{name: "a", want: []string{"(empty)"}},
+		{name: "sql:a", want: []string{"empty"}},
+		{name: "b", want: nil},
+		{name: "sql:c", want: []string{"string"}},
+	} {
+		if got := item[tt.name]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got=%v, want=%v", tt.name, got, tt.want)
+		}
+	}
+
+	// empty and null values are distinct, and other readers see the sentinel
+	var id string
+	err = db.QueryRowContext(ctx, "select id from tbl where a is not null").Scan(&id)
+	wantNoError(t, err)
+
+	// the sentinel is decoded regardless of the Connector setting
+	db2 := sql.OpenDB(&Connector{SimpleDB: sdb})
+	defer db2.Close()
+	var a, b, c sql.NullString
+	err = db2.QueryRowContext(ctx, "select a, b, c from tbl where id = 'ID1'").Scan(&a, &b, &c)
+	wantNoError(t, err)
+	if !a.Valid || a.String != "" {
+		t.Errorf("a: got=%v, want empty string", a)
+	}
+	if b.Valid {
+		t.Errorf("b: got=%v, want null", b)
+	}
+	if !c.Valid || c.String != "(empty)" {
+		t.Errorf("c: got=%v, want=(empty)", c)
+	}
+}
+
+func TestMetadataPrefix(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	connector := &Connector{SimpleDB: sdb, MetadataPrefix: "_t."}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a, b) values('ID1', ?, ?);
+		update tbl set b = ? where id = 'ID1';
+	`, int64(1), "x", "")
+	wantNoError(t, err)
+
+	item := sdb.Item("tbl", "ID1")
+	want := map[string][]string{
+		"_t.id": {"string"},
+		"_t.a":  {"int64"},
+		"_t.b":  {"string"},
+		"a":     {"1"},
+	}
+	if !reflect.DeepEqual(item, want) {
+		t.Errorf("got=%v, want=%v", item, want)
+	}
+
+	for _, query := range []string{
+		"select a, b from tbl where id = 'ID1'",
+		"select a, b from tbl where a = '1'",
+	} {
+		var (
+			a int64
+			b sql.NullString
+		)
+		err = db.QueryRowContext(ctx, query).Scan(&a, &b)
+		wantNoError(t, err)
+		if a != 1 || !b.Valid || b.String != "" {
+			t.Errorf("%s: got=%v,%v, want=1,empty", query, a, b)
+		}
+	}
+
+	rows, err := connector.QueryMaps(ctx, "select * from tbl")
+	wantNoError(t, err)
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatalf("want a row, got err=%v", rows.Err())
+	}
+	if got, want := rows.Map(), map[string]interface{}{"id": "ID1", "a": int64(1), "b": ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	var buf strings.Builder
+	wantNoError(t, connector.DumpTable(ctx, &buf, "tbl"))
+	if got, want := buf.String(), "id,a,_t.a,b,_t.b\nID1,1,int64,,string\n"; got != want {
+		t.Errorf("got=%q, want=%q", got, want)
+	}
+}
+
+func TestPackedMetadata(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	connector := &Connector{SimpleDB: sdb, PackedMetadata: true}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a, b) values('ID1', ?, ?);
+		update tbl set b = ?, c = ? where id = 'ID1';
+		insert into tbl(id, a) values('ID1', ?) on duplicate key update a = values(a);
+	`, int64(1), "x", nil, true, 2.5)
+	wantNoError(t, err)
+
+	item := sdb.Item("tbl", "ID1")
+	want := map[string][]string{
+		"sql:types": {"a=float64&b=null&c=bool&id=string"},
+		"a":         {"2.5"},
+		"c":         {"true"},
+	}
+	if !reflect.DeepEqual(item, want) {
+		t.Errorf("got=%v, want=%v", item, want)
+	}
+
+	for _, query := range []string{
+		"select a, b, c from tbl where id = 'ID1'",
+		"select a, b, c from tbl where c = 'true'",
+	} {
+		var (
+			a float64
+			b sql.NullString
+			c bool
+		)
+		err = db.QueryRowContext(ctx, query).Scan(&a, &b, &c)
+		wantNoError(t, err)
+		if a != 2.5 || b.Valid || !c {
+			t.Errorf("%s: got=%v,%v,%v, want=2.5,null,true", query, a, b, c)
+		}
+	}
+
+	// update of a missing item affects no rows
+	result, err := db.ExecContext(ctx, "update tbl set a = ? where id = 'ID2'", "y")
+	wantNoError(t, err)
+	wantRowsAffected(t, result, 0)
+	if item := sdb.Item("tbl", "ID2"); item != nil {
+		t.Errorf("got=%v, want no item", item)
+	}
+
+	// dumps have unpacked types, and load packs them again
+	var buf strings.Builder
+	wantNoError(t, connector.DumpTable(ctx, &buf, "tbl"))
+	if got, want := buf.String(), "id,a,sql:a,b,sql:b,c,sql:c\nID1,2.5,float64,,null,true,bool\n"; got != want {
+		t.Errorf("got=%q, want=%q", got, want)
+	}
+	_, err = db.ExecContext(ctx, "delete from tbl where id = 'ID1'")
+	wantNoError(t, err)
+	_, err = connector.Load(ctx, strings.NewReader(buf.String()), "tbl", nil)
+	wantNoError(t, err)
+	if got := sdb.Item("tbl", "ID1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestRawAttributes(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb, RawAttributes: true})
+	defer db.Close()
+
+	// an item written by another application
+	_, err := db.ExecContext(ctx, "create table legacy")
+	wantNoError(t, err)
+	_, err = sdb.PutAttributesWithContext(ctx, &simpledb.PutAttributesInput{
+		DomainName: aws.String("legacy"),
+		ItemName:   aws.String("L1"),
+		Attributes: []*simpledb.ReplaceableAttribute{
+			{Name: aws.String("a"), Value: aws.String("1")},
+			{Name: aws.String("sql:a"), Value: aws.String("int64")},
+		},
+	})
+	wantNoError(t, err)
+
+	for _, query := range []string{
+		"select id, a, `sql:a` from legacy where id = 'L1'",
+		"select id, a, `sql:a` from legacy where a = '1'",
+	} {
+		var id, a, typ string
+		err = db.QueryRowContext(ctx, query).Scan(&id, &a, &typ)
+		wantNoError(t, err)
+		if id != "L1" || a != "1" || typ != "int64" {
+			t.Errorf("%s: got=%v,%v,%v, want=L1,1,int64", query, id, a, typ)
+		}
+	}
+	var id string
+	err = db.QueryRowContext(ctx, "select id from legacy").Scan(&id)
+	wantNoError(t, err)
+	if id != "L1" {
+		t.Errorf("got=%v, want=L1", id)
+	}
+
+	_, err = db.ExecContext(ctx, "insert into legacy(id, a) values('L2', ?)", int64(5))
+	wantNoError(t, err)
+	if got, want := sdb.Item("legacy", "L2"), map[string][]string{"a": {"5"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	_, err = db.ExecContext(ctx, "insert into legacy(id, a) values('L1', 'x')")
+	wantErrorMessageContaining(t, err, "cannot insert duplicate key")
+
+	result, err := db.ExecContext(ctx, "update legacy set a = 'y' where id = 'L3'")
+	wantNoError(t, err)
+	wantRowsAffected(t, result, 0)
+	result, err = db.ExecContext(ctx, "update legacy set a = 'y' where id = 'L1'")
+	wantNoError(t, err)
+	wantRowsAffected(t, result, 1)
+	want := map[string][]string{"a": {"y"}, "sql:a": {"int64"}}
+	if got := sdb.Item("legacy", "L1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestShowColumns(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb})
+	defer db.Close()
+
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	_, err = db.ExecContext(ctx, "insert into tbl(id, a, b) values('ID1', ?, ?)", int64(1), "x")
+	wantNoError(t, err)
+	_, err = db.ExecContext(ctx, "insert into tbl(id, a) values('ID2', ?)", "one")
+	wantNoError(t, err)
+	// an item written by another application, without type metadata
+	_, err = sdb.PutAttributesWithContext(ctx, &simpledb.PutAttributesInput{
+		DomainName: aws.String("tbl"),
+		ItemName:   aws.String("ID3"),
+		Attributes: []*simpledb.ReplaceableAttribute{
+			{Name: aws.String("c"), Value: aws.String("2.5")},
+			{Name: aws.String("c"), Value: aws.String("3.5")},
+			{Name: aws.String("d"), Value: aws.String("2018-01-02T03:04:05Z")},
+		},
+	})
+	wantNoError(t, err)
+
+	scan := func(query string) []string {
+		rows, err := db.QueryContext(ctx, query)
+		wantNoError(t, err)
+		defer rows.Close()
+		var got []string
+		for rows.Next() {
+			var column, types string
+			var count int64
+			wantNoError(t, rows.Scan(&column, &types, &count))
+			got = append(got, fmt.Sprintf("%s:%s:%d", column, types, count))
+		}
+		wantNoError(t, rows.Err())
+		return got
+	}
+
+	got := scan("show columns from tbl")
+	want := []string{"a:int64,string:2", "b:string:1", "c:float64:1", "d:time:1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	got = scan("show columns from tbl limit 1")
+	want = []string{"a:int64:1", "b:string:1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	_, err = db.ExecContext(ctx, "show columns from tbl")
+	wantErrorMessageContaining(t, err, "unexpected show columns query")
+}
+
+func TestSelectLimits(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+
+	var ors, ands, values []string
+	for i := 0; i <= maxSelectComparisons; i++ {
+		ors = append(ors, fmt.Sprintf("a = '%d'", i))
+		ands = append(ands, fmt.Sprintf("a%d >= '1'", i))
+		values = append(values, fmt.Sprintf("'%d'", i))
+	}
+	var longValues []string
+	for i := 0; i < maxInValues; i++ {
+		longValues = append(longValues, fmt.Sprintf("'%d-%s'", i, strings.Repeat("x", 500)))
+	}
+
+	tests := []struct {
+		where   string
+		errText string
+	}{
+		{
+			where: "a in (" + strings.Join(values, ", ") + ") and id > '1'",
+		},
+		{
+			where:   strings.Join(ors, " or "),
+			errText: "too many comparisons",
+		},
+		{
+			where:   strings.Join(ands, " and "),
+			errText: "too many attributes",
+		},
+		{
+			where:   "a in (" + strings.Join(longValues, ", ") + ")",
+			errText: "select expression is too long",
+		},
+	}
+	for tn, tt := range tests {
+		rows, err := db.QueryContext(ctx, "explain select id, a from tbl where "+tt.where)
+		if tt.errText == "" {
+			wantNoError(t, err)
+			rows.Close()
+			continue
+		}
+		if err == nil {
+			rows.Close()
+			t.Errorf("%d: got=nil, want=%q", tn, tt.errText)
+			continue
+		}
+		wantErrorMessageContaining(t, err, tt.errText)
+	}
+}
+
+func TestInListBatches(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	var ids []string
+	var args []interface{}
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprintf("ID%03d", i)
+		_, err = db.ExecContext(ctx, "insert into tbl(id, a, b) values(?, ?, ?)", id, fmt.Sprint(i%2), fmt.Sprintf("%02d", 50-i))
+		wantNoError(t, err)
+		ids = append(ids, "?")
+		args = append(args, id)
+	}
+	// duplicate values in separate batches
+	ids = append(ids, "?")
+	args = append(args, "ID000")
+	args = append(args, "1")
+
+	query := "select id from tbl where id in (" + strings.Join(ids, ", ") + ") and a = ?"
+	rows, err := db.QueryContext(ctx, query, args...)
+	wantNoError(t, err)
+	var got []string
+	for rows.Next() {
+		var id string
+		wantNoError(t, rows.Scan(&id))
+		got = append(got, id)
+	}
+	wantNoError(t, rows.Err())
+	rows.Close()
+	sort.Strings(got)
+	var want []string
+	for i := 1; i < 50; i += 2 {
+		want = append(want, fmt.Sprintf("ID%03d", i))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	rows, err = db.QueryContext(ctx, "explain "+query, args...)
+	wantNoError(t, err)
+	var steps int
+	for rows.Next() {
+		steps++
+	}
+	rows.Close()
+	if got, want := steps, 3; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	// the limit is the page size of each batch, so all rows are returned
+	rows, err = db.QueryContext(ctx, query+" order by id desc limit 15", args...)
+	wantNoError(t, err)
+	got = nil
+	for rows.Next() {
+		var id string
+		wantNoError(t, rows.Scan(&id))
+		got = append(got, id)
+	}
+	wantNoError(t, rows.Err())
+	rows.Close()
+	want = nil
+	for i := 49; i > 0; i -= 2 {
+		want = append(want, fmt.Sprintf("ID%03d", i))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	// the order by column is not selected, but the rows are still merged in order
+	rows, err = db.QueryContext(ctx, query+" and b > ? order by b", append(args, "")...)
+	wantNoError(t, err)
+	columns, err := rows.Columns()
+	wantNoError(t, err)
+	if got, want := columns, []string{"id"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	got = nil
+	for rows.Next() {
+		var id string
+		wantNoError(t, rows.Scan(&id))
+		got = append(got, id)
+	}
+	wantNoError(t, rows.Err())
+	rows.Close()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestMaxSelectRowsAndPages(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	connector := &Connector{SimpleDB: sdb, MaxSelectRows: 5, MaxSelectPages: 2}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = db.ExecContext(ctx, "insert into tbl(id, a) values(?, ?)", fmt.Sprintf("ID%d", i), int64(i))
+		wantNoError(t, err)
+	}
+
+	count := func(query string) (int, error) {
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		var n int
+		for rows.Next() {
+			n++
+		}
+		return n, rows.Err()
+	}
+
+	_, err = count("select id, a from tbl")
+	wantErrorMessageContaining(t, err, "too many rows")
+	n, err := count("select /*+ max_rows(10) */ id, a from tbl")
+	wantNoError(t, err)
+	if got, want := n, 10; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	_, err = count("select /*+ max_rows(10) */ id, a from tbl limit 3")
+	wantErrorMessageContaining(t, err, "too many pages")
+	n, err = count("select /*+ max_rows(10) max_pages(4) */ id, a from tbl limit 3")
+	wantNoError(t, err)
+	if got, want := n, 10; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	rows, err := connector.QueryMaps(ctx, "select * from tbl")
+	wantNoError(t, err)
+	for rows.Next() {
+	}
+	wantErrorMessageContaining(t, rows.Err(), "too many rows")
+}
+
+func TestQueryStats(t *testing.T) {
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	testQueryStats(t, db)
+
+	// statistics are also accumulated for a database opened with sql.Open
+	db = openDriverDB(t, fakesdb.New())
+	defer db.Close()
+	testQueryStats(t, db)
+}
+
+func testQueryStats(t *testing.T, db *sql.DB) {
+	ctx := context.Background()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = db.ExecContext(ctx, "insert into tbl(id, a) values(?, ?)", fmt.Sprintf("ID%d", i), int64(i))
+		wantNoError(t, err)
+	}
+
+	var stats QueryStats
+	rows, err := db.QueryContext(WithQueryStats(ctx, &stats), "select id, a from tbl limit 2")
+	wantNoError(t, err)
+	for rows.Next() {
+	}
+	wantNoError(t, rows.Close())
+	if got, want := stats.Pages(), 3; got != want {
+		t.Errorf("pages: got=%v, want=%v", got, want)
+	}
+	if got, want := stats.Items(), 5; got != want {
+		t.Errorf("items: got=%v, want=%v", got, want)
+	}
+	if got, want := stats.APICalls(), 3; got != want {
+		t.Errorf("api calls: got=%v, want=%v", got, want)
+	}
+	if stats.Elapsed() <= 0 {
+		t.Errorf("elapsed: got=%v, want>0", stats.Elapsed())
+	}
+
+	stats.Reset()
+	var a int64
+	err = db.QueryRowContext(WithQueryStats(ctx, &stats), "select a from tbl where id = 'ID3'").Scan(&a)
+	wantNoError(t, err)
+	if got, want := [3]int{stats.Pages(), stats.Items(), stats.APICalls()}, [3]int{0, 1, 1}; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	ctx := context.Background()
+	var logged []interface{}
+	db := sql.OpenDB(&Connector{
+		SimpleDB: fakesdb.New(),
+		Redactor: OmitRedactor,
+		LogRequest: func(ctx context.Context, operation string, input interface{}) {
+			logged = append(logged, input)
+		},
+	})
+	defer db.Close()
+
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	logged = nil
+	_, err = db.ExecContext(ctx, "insert into tbl(id, a) values('secret-id', ?)", "secret-value")
+	wantNoError(t, err)
+	var id string
+	err = db.QueryRowContext(ctx, "select id from tbl where a = ?", "secret-value").Scan(&id)
+	wantNoError(t, err)
+	if got, want := id, "secret-id"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	data, err := json.Marshal(logged)
+	wantNoError(t, err)
+	text := string(data)
+	if strings.Contains(text, "secret") {
+		t.Errorf("logged requests contain secret: %s", text)
+	}
+	for _, want := range []string{"[redacted]", "sql:a", "string", "where a = '[redacted]'"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("logged requests do not contain %q: %s", want, text)
+		}
+	}
+
+	_, err = db.ExecContext(ctx, "insert into tbl(id, price) values('ID1', ?)", Decimal("secret"))
+	wantErrorMessageContaining(t, err, "invalid decimal")
+	if strings.Contains(err.Error(), "secret") || !strings.Contains(err.Error(), "[redacted]") {
+		t.Errorf("got=%v, want value redacted", err)
+	}
+
+	_, err = db.ExecContext(ctx, "insert into tbl(id, a) values('secret-id', 'x')")
+	wantErrorMessageStartingWith(t, err, "cannot insert duplicate key")
+	if strings.Contains(err.Error(), "secret") || !strings.Contains(err.Error(), "[redacted]") {
+		t.Errorf("got=%v, want item name redacted", err)
+	}
+
+	if got, want := HashRedactor.Redact("abc"), "sha256:ba7816bf8f01cfea"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestSchemaItemNoRows(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{
+		SimpleDB:     fakesdb.New(),
+		RecordSchema: true,
+	})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	_, err = db.ExecContext(ctx, "insert into tbl(id, a) values('ID1', 'aaa')")
+	wantNoError(t, err)
+
+	// the schema item is not returned by the GetAttributes fast path
+	// or by the Select path
+	for _, query := range []string{
+		"select id, a from tbl where id = ?",
+		"select id, a from tbl where id = ? and a is null",
+		"select id, a from tbl where id in (?, 'ID2')",
+	} {
+		var id string
+		var a sql.NullString
+		err = db.QueryRowContext(ctx, query, SchemaItemName).Scan(&id, &a)
+		if err != sql.ErrNoRows {
+			t.Errorf("%s: got=%v, want=%v", query, err, sql.ErrNoRows)
+		}
+	}
+}
+
+// lostResponseAPI is a fake SimpleDB API that loses the response to the
+// first attempt of each PutAttributes request, so that the AWS SDK retries
+// the request.
+type lostResponseAPI struct {
+	*fakesdb.DB
+}
+
+func (api *lostResponseAPI) PutAttributesWithContext(ctx aws.Context, input *simpledb.PutAttributesInput, opts ...request.Option) (*simpledb.PutAttributesOutput, error) {
+	// the outcome of the first attempt is unknown
+	api.DB.PutAttributesWithContext(ctx, input)
+	r := &request.Request{RetryCount: 1}
+	r.ApplyOptions(opts...)
+	r.Handlers.Complete.Run(r)
+	return api.DB.PutAttributesWithContext(ctx, input)
+}
+
+func TestIdempotentInserts(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	newConnector := func(idempotent bool) *Connector {
+		return &Connector{
+			SimpleDB:          &lostResponseAPI{DB: sdb},
+			IdempotentInserts: idempotent,
+		}
+	}
+	db := sql.OpenDB(newConnector(true))
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+
+	r, err := db.ExecContext(ctx, "insert into tbl(id, a) values('ID1', 'aaa')")
+	wantNoError(t, err)
+	wantRowsAffected(t, r, 1)
+	var a string
+	err = db.QueryRowContext(ctx, "select a from tbl where id = 'ID1' /*+ consistent */").Scan(&a)
+	wantNoError(t, err)
+	if got, want := a, "aaa"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	// an existing item with different values is a duplicate key
+	_, err = sdb.PutAttributesWithContext(ctx, &simpledb.PutAttributesInput{
+		DomainName: aws.String("tbl"),
+		ItemName:   aws.String("ID2"),
+		Attributes: []*simpledb.ReplaceableAttribute{
+			{Name: aws.String("a"), Value: aws.String("xxx")},
+			{Name: aws.String("sql:a"), Value: aws.String("string")},
+			{Name: aws.String("sql:id"), Value: aws.String("string")},
+		},
+	})
+	wantNoError(t, err)
+	_, err = db.ExecContext(ctx, "insert into tbl(id, a) values('ID2', 'bbb')")
+	wantErrorMessageContaining(t, err, "duplicate key")
+
+	// without IdempotentInserts, the retried insert is a duplicate key
+	db2 := sql.OpenDB(newConnector(false))
+	defer db2.Close()
+	_, err = db2.ExecContext(ctx, "insert into tbl(id, a) values('ID3', 'ccc')")
+	wantErrorMessageContaining(t, err, "duplicate key")
+}
+
+// slowSelectAPI is a fake SimpleDB API whose Select requests do not
+// complete until their context is done.
+type slowSelectAPI struct {
+	*fakesdb.DB
+}
+
+func (api *slowSelectAPI) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestConnectorDefaults(t *testing.T) {
+	ctx := context.Background()
+	var inputs []*simpledb.SelectInput
+	connector := &Connector{
+		SimpleDB:           fakesdb.New(),
+		DefaultSelectLimit: 2,
+		ConsistentRead:     true,
+		LogRequest: func(ctx context.Context, operation string, input interface{}) {
+			if in, ok := input.(*simpledb.SelectInput); ok {
+				inputs = append(inputs, in)
+			}
+		},
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	for i := 1; i <= 3; i++ {
+		_, err = db.ExecContext(ctx, "insert into tbl(id, a) values(?, 'aaa')", fmt.Sprintf("ID%d", i))
+		wantNoError(t, err)
+	}
+
+	tests := []struct {
+		query      string
+		limit      string
+		consistent bool
+	}{
+		{"select id from tbl where a = 'aaa'", "limit 2", true},
+		{"select id from tbl where a = 'aaa' limit 1", "limit 1", true},
+		{"select /*+ eventual */ id from tbl", "limit 2", false},
+	}
+	for tn, tt := range tests {
+		inputs = nil
+		rows, err := db.QueryContext(ctx, tt.query)
+		wantNoError(t, err)
+		var count int
+		for rows.Next() {
+			count++
+		}
+		wantNoError(t, rows.Err())
+		if got, want := count, 3; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+		if len(inputs) == 0 {
+			t.Fatalf("%d: no select requests", tn)
+		}
+		expr := aws.StringValue(inputs[0].SelectExpression)
+		if !strings.HasSuffix(expr, tt.limit) || strings.Count(expr, "limit") != 1 {
+			t.Errorf("%d: got=%q, want suffix %q", tn, expr, tt.limit)
+		}
+		if got, want := aws.BoolValue(inputs[0].ConsistentRead), tt.consistent; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+	}
+
+	// statement timeout, which a hint can replace
+	slow := sql.OpenDB(&Connector{
+		SimpleDB:         &slowSelectAPI{DB: fakesdb.New()},
+		StatementTimeout: 10 * time.Millisecond,
+	})
+	defer slow.Close()
+	for _, query := range []string{
+		"select id from tbl",
+		"select /*+ max_execution_time(20) */ id from tbl",
+	} {
+		_, err = slow.QueryContext(ctx, query)
+		wantErrorMessageContaining(t, err, "deadline exceeded")
+	}
+}
+
+func TestInsertSet(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+
+	r, err := db.ExecContext(ctx, "insert into tbl set a = ?, id = ?, b = 'bbb'", "aaa", "ID1")
+	wantNoError(t, err)
+	wantRowsAffected(t, r, 1)
+	var a, b string
+	err = db.QueryRowContext(ctx, "select a, b from tbl where id = 'ID1'").Scan(&a, &b)
+	wantNoError(t, err)
+	if got, want := a+","+b, "aaa,bbb"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	r, err = db.ExecContext(ctx, "insert into tbl set id = ?, a = ? on duplicate key update a = values(a)", "ID1", "xxx")
+	wantNoError(t, err)
+	wantRowsAffected(t, r, 2)
+	err = db.QueryRowContext(ctx, "select a from tbl where id = 'ID1'").Scan(&a)
+	wantNoError(t, err)
+	if got, want := a, "xxx"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestReturning(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+
+	var (
+		id string
+		n  int64
+		b  string
+	)
+	err = db.QueryRowContext(ctx, "insert into tbl set id = ?, n = ?, b = 'bbb' returning id, n, b", "ID1", 42).Scan(&id, &n, &b)
+	wantNoError(t, err)
+	if got, want := fmt.Sprintf("%s,%d,%s", id, n, b), "ID1,42,bbb"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	// nothing is returned if the item is not written
+	err = db.QueryRowContext(ctx, "insert ignore into tbl(id, n) values(?, ?) returning n", "ID1", 43).Scan(&n)
+	if err != sql.ErrNoRows {
+		t.Errorf("got=%v, want=%v", err, sql.ErrNoRows)
+	}
+	err = db.QueryRowContext(ctx, "update tbl set n = ? where id = ? if b = 'xxx' returning n", 44, "ID1").Scan(&n)
+	if err != sql.ErrNoRows {
+		t.Errorf("got=%v, want=%v", err, sql.ErrNoRows)
+	}
+
+	err = db.QueryRowContext(ctx, "update tbl set n = ? where id = ? returning n", 45, "ID1").Scan(&n)
+	wantNoError(t, err)
+	if got, want := n, int64(45); got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	_, err = db.ExecContext(ctx, "update tbl set n = ? where id = ? returning n", 46, "ID1")
+	wantErrorMessageContaining(t, err, "use QueryContext")
+	_, err = db.QueryContext(ctx, "update tbl set n = ? where id = ? returning b", 46, "ID1")
+	wantErrorMessageContaining(t, err, "returning column is not written by the statement")
+}
+
+func TestInsertIgnore(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+
+	r, err := db.ExecContext(ctx, "insert ignore into tbl(id, a) values('ID1', ?)", "aaa")
+	wantNoError(t, err)
+	wantRowsAffected(t, r, 1)
+	r, err = db.ExecContext(ctx, "insert ignore into tbl(id, a) values('ID1', ?)", "bbb")
+	wantNoError(t, err)
+	wantRowsAffected(t, r, 0)
+	var a string
+	err = db.QueryRowContext(ctx, "select a from tbl where id = 'ID1'").Scan(&a)
+	wantNoError(t, err)
+	if got, want := a, "aaa"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	_, err = db.ExecContext(ctx, "insert into tbl(id, a) values('ID1', ?)", "bbb")
+	wantErrorMessageContaining(t, err, "duplicate key")
+}
+
+func TestSelectOnlyID(t *testing.T) {
+	ctx := context.Background()
+	var exprs []string
+	db := sql.OpenDB(&Connector{
+		SimpleDB:       fakesdb.New(),
+		RecordSchema:   true,
+		PackedMetadata: true,
+		LogRequest: func(ctx context.Context, operation string, input interface{}) {
+			if in, ok := input.(*simpledb.SelectInput); ok {
+				exprs = append(exprs, aws.StringValue(in.SelectExpression))
+			}
+		},
+	})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	for _, id := range []string{"ID1", "ID2", "ID3"} {
+		_, err = db.ExecContext(ctx, "insert into tbl(id, a) values(?, 'aaa')", id)
+		wantNoError(t, err)
+	}
+
+	rows, err := db.QueryContext(ctx, "select id from tbl where a = 'aaa'")
+	wantNoError(t, err)
+	var ids []string
+	for rows.Next() {
+		var id string
+		wantNoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	wantNoError(t, rows.Err())
+	sort.Strings(ids)
+	if got, want := strings.Join(ids, ","), "ID1,ID2,ID3"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := exprs[0], "select itemName() from `tbl` where a = 'aaa'"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestParseCache(t *testing.T) {
+	pc := newParseCache(2)
+	q1, err := pc.parse("select a from tbl where b = ?")
+	wantNoError(t, err)
+	q2, err := pc.parse("select a from tbl where b = ?")
+	wantNoError(t, err)
+	if q1 == q2 || q1.Select != q2.Select {
+		t.Errorf("want copies of the same parsed statement")
+	}
+	if _, err = pc.parse("select a from"); err == nil {
+		t.Errorf("got=nil, want=error")
+	}
+	for _, text := range []string{"select a from t2", "select a from t3"} {
+		_, err = pc.parse(text)
+		wantNoError(t, err)
+	}
+	if got, want := pc.lru.Len(), 2; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if _, ok := pc.items["select a from tbl where b = ?"]; ok {
+		t.Errorf("want oldest statement evicted")
+	}
+
+	// the defaults do not modify the cached statements
+	ctx := context.Background()
+	var exprs []string
+	db := sql.OpenDB(&Connector{
+		SimpleDB:           fakesdb.New(),
+		ParseCacheSize:     10,
+		DefaultSelectLimit: 5,
+		LogRequest: func(ctx context.Context, operation string, input interface{}) {
+			if in, ok := input.(*simpledb.SelectInput); ok {
+				exprs = append(exprs, aws.StringValue(in.SelectExpression))
+			}
+		},
+	})
+	defer db.Close()
+	_, err = db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	for i := 0; i < 2; i++ {
+		rows, err := db.QueryContext(ctx, "select a from tbl where a = ?", "aaa")
+		wantNoError(t, err)
+		wantNoError(t, rows.Close())
+	}
+	if got, want := len(exprs), 2; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	for _, expr := range exprs {
+		if got, want := strings.Count(expr, "limit"), 1; got != want {
+			t.Errorf("got=%v, want=%v: %s", got, want, expr)
+		}
+	}
+}
+
+// benchmarkItem returns an item with n string columns, and the names
+// of its columns.
+func benchmarkItem(n int, meta metadata) (*simpledb.Item, []string) {
+	columns := []string{"id"}
+	attrs := []*simpledb.ReplaceableAttribute{}
+	for i := 0; i < n; i++ {
+		column := fmt.Sprintf("col%d", i)
+		columns = append(columns, column)
+		attrs = append(attrs,
+			&simpledb.ReplaceableAttribute{Name: aws.String(column), Value: aws.String("value")},
+			&simpledb.ReplaceableAttribute{Name: aws.String(meta.typeAttr(column)), Value: aws.String("string")},
+		)
+	}
+	attrs, _ = meta.pack(attrs, "")
+	item := &simpledb.Item{Name: aws.String("ID1")}
+	for _, attr := range attrs {
+		item.Attributes = append(item.Attributes, &simpledb.Attribute{Name: attr.Name, Value: attr.Value})
+	}
+	return item, columns
+}
+
+func benchmarkSetValues(b *testing.B, meta metadata) {
+	item, columns := benchmarkItem(10, meta)
+	var cm columnMap
+	cm.setColumns(columns, meta)
+	dest := make([]driver.Value, len(columns))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cm.setValues(item, dest)
+	}
+}
+
+func BenchmarkSetValues(b *testing.B) {
+	benchmarkSetValues(b, metadata{})
+}
+
+func BenchmarkSetValuesPacked(b *testing.B) {
+	benchmarkSetValues(b, metadata{packed: true})
+}
+
+func TestCompactBinary(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb, CompactBinary: true})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+
+	data := make([]byte, 800)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	_, err = db.ExecContext(ctx, "insert into tbl(id, a, b) values('ID1', ?, ?)", data, []byte{1, 2, 3})
+	wantNoError(t, err)
+
+	output, err := sdb.GetAttributesWithContext(ctx, &simpledb.GetAttributesInput{
+		DomainName: aws.String("tbl"),
+		ItemName:   aws.String("ID1"),
+	})
+	wantNoError(t, err)
+	attrs := make(map[string]string)
+	for _, attr := range output.Attributes {
+		attrs[aws.StringValue(attr.Name)] = aws.StringValue(attr.Value)
+	}
+	if got, want := attrs["sql:a"], "binary:ascii85"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := len(attrs["a"]), 1000; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	// Ascii85 is no shorter for three bytes
+	if got, want := attrs["sql:b"], "binary"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	// values can be read regardless of the setting
+	db2 := sql.OpenDB(&Connector{SimpleDB: sdb})
+	defer db2.Close()
+	var a, b []byte
+	err = db2.QueryRowContext(ctx, "select a, b from tbl where id = 'ID1'").Scan(&a, &b)
+	wantNoError(t, err)
+	if !reflect.DeepEqual(a, data) {
+		t.Errorf("got=%v, want=%v", a, data)
+	}
+	if got, want := b, []byte{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestKeysetPagination(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	for i := 1; i <= 5; i++ {
+		_, err = db.ExecContext(ctx, "insert into tbl(id, a) values(?, 'aaa')", fmt.Sprintf("ID%d", i))
+		wantNoError(t, err)
+	}
+
+	var pages []string
+	var last string
+	for {
+		rows, err := db.QueryContext(ctx, "select id from tbl where Id > ? order by id limit 2", last)
+		wantNoError(t, err)
+		var ids []string
+		// the limit is the size of each page of results, so read one page
+		for rows.Next() && len(ids) < 2 {
+			var id string
+			wantNoError(t, rows.Scan(&id))
+			ids = append(ids, id)
+		}
+		wantNoError(t, rows.Close())
+		if len(ids) == 0 {
+			break
+		}
+		pages = append(pages, strings.Join(ids, ","))
+		last = ids[len(ids)-1]
+	}
+	if got, want := strings.Join(pages, " "), "ID1,ID2 ID3,ID4 ID5"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	var count int
+	rows, err := db.QueryContext(ctx, "select id from tbl where id between ? and ?", "ID2", "ID4")
+	wantNoError(t, err)
+	for rows.Next() {
+		count++
+	}
+	wantNoError(t, rows.Err())
+	if got, want := count, 3; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestQueryPage(t *testing.T) {
+	ctx := context.Background()
+	connector := &Connector{SimpleDB: fakesdb.New()}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	for i := 1; i <= 7; i++ {
+		a := "aaa"
+		if i%2 == 0 {
+			a = "bbb"
+		}
+		_, err = db.ExecContext(ctx, "insert into tbl(id, a) values(?, ?)", fmt.Sprintf("ID%d", i), a)
+		wantNoError(t, err)
+	}
+
+	tests := []struct {
+		query string
+		args  []interface{}
+		want  string
+	}{
+		{"select id from tbl", nil, "ID1,ID2 ID3,ID4 ID5,ID6 ID7"},
+		{"select id, a from tbl where a = ? or a = 'ccc'", []interface{}{"aaa"}, "ID1,ID3 ID5,ID7"},
+	}
+	for tn, tt := range tests {
+		var pages []string
+		var cursor string
+		for {
+			page, err := connector.QueryPage(ctx, tt.query, cursor, 2, tt.args...)
+			wantNoError(t, err)
+			var ids []string
+			for _, row := range page.Rows {
+				ids = append(ids, row["id"].(string))
+			}
+			pages = append(pages, strings.Join(ids, ","))
+			if page.Next == "" {
+				break
+			}
+			cursor = page.Next
+		}
+		if got, want := strings.Join(pages, " "), tt.want; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+	}
+
+	for _, tt := range []struct {
+		query   string
+		limit   int
+		errText string
+	}{
+		{"select id from tbl order by id", 2, "cannot have order by or limit clauses"},
+		{"select id from tbl where a > 'a' limit 5", 2, "cannot have order by or limit clauses"},
+		{"select id from tbl where id = 'ID1'", 2, "cannot page"},
+		{"delete from tbl where id = 'ID1'", 2, "expect select query"},
+		{"select id from tbl", 2500, "invalid page limit"},
+	} {
+		_, err := connector.QueryPage(ctx, tt.query, "", tt.limit)
+		wantErrorMessageContaining(t, err, tt.errText)
+	}
+}
+
+func TestRetryMissingItems(t *testing.T) {
+	ctx := context.Background()
+	api := &staleReadAPI{DB: fakesdb.New(), staleReads: 100}
+	db := sql.OpenDB(&Connector{SimpleDB: api, RetryMissingItems: true})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	_, err = db.ExecContext(ctx, "insert into tbl(id, a) values('ID1', 'aaa')")
+	wantNoError(t, err)
+
+	var a string
+	err = db.QueryRowContext(ctx, "select a from tbl where id = 'ID1'").Scan(&a)
+	wantNoError(t, err)
+	if got, want := a, "aaa"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	err = db.QueryRowContext(ctx, "select a from tbl where id = 'ID2'").Scan(&a)
+	if err != sql.ErrNoRows {
+		t.Errorf("got=%v, want=%v", err, sql.ErrNoRows)
+	}
+	if got, want := api.reads, 2; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	// without RetryMissingItems, the stale read finds no item
+	db2 := sql.OpenDB(&Connector{SimpleDB: api})
+	defer db2.Close()
+	err = db2.QueryRowContext(ctx, "select a from tbl where id = 'ID1'").Scan(&a)
+	if err != sql.ErrNoRows {
+		t.Errorf("got=%v, want=%v", err, sql.ErrNoRows)
+	}
+}
+
+func TestInvalidator(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	var calls [][]Invalidation
+	invalidator := InvalidatorFunc(func(ctx context.Context, invalidations []Invalidation) {
+		calls = append(calls, invalidations)
+	})
+	describe := func() string {
+		var s []string
+		for _, call := range calls {
+			var items []string
+			for _, inv := range call {
+				items = append(items, inv.Operation+" "+inv.Table+"/"+inv.ID)
+			}
+			s = append(s, strings.Join(items, ","))
+		}
+		return strings.Join(s, "; ")
+	}
+	const query = `
+		insert into tbl(id, a) values('ID1', 'x');
+		update tbl set a = 'y' where id = 'ID1';
+		delete from tbl where id = 'ID1';
+	`
+
+	db := sql.OpenDB(&Connector{SimpleDB: sdb, Invalidator: invalidator})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	_, err = db.ExecContext(ctx, query)
+	wantNoError(t, err)
+	if got, want := describe(), "insert tbl/ID1; update tbl/ID1; delete tbl/ID1"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	calls = nil
+	db2 := sql.OpenDB(&Connector{SimpleDB: sdb, Invalidator: invalidator, BatchInvalidations: true})
+	defer db2.Close()
+	_, err = db2.ExecContext(ctx, query)
+	wantNoError(t, err)
+	_, err = db2.ExecContext(ctx, "insert into tbl(id, a) values('ID2', 'x')")
+	wantNoError(t, err)
+	if got, want := describe(), "insert tbl/ID1,update tbl/ID1,delete tbl/ID1; insert tbl/ID2"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	// not called for a failed statement, or when DryRun is set
+	calls = nil
+	_, err = db2.ExecContext(ctx, "insert into tbl(id, a) values('ID2', 'x')")
+	wantErrorMessageContaining(t, err, "duplicate key")
+	db3 := sql.OpenDB(&Connector{SimpleDB: sdb, Invalidator: invalidator, DryRun: true})
+	defer db3.Close()
+	_, err = db3.ExecContext(ctx, "insert into tbl(id, a) values('ID3', 'x')")
+	wantNoError(t, err)
+	if got, want := len(calls), 0; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	// called once for each batch written by Load or deleted by Vacuum
+	calls = nil
+	connector := &Connector{SimpleDB: sdb, Invalidator: invalidator, TTLColumn: "expires"}
+	n, err := connector.Load(ctx, strings.NewReader("id,a,expires\nL1,x,1\nL2,y,1\n"), "tbl", &LoadOptions{
+		ColumnTypes: map[string]string{"expires": "int64"},
+	})
+	wantNoError(t, err)
+	if got, want := n, 2; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	n, err = connector.Vacuum(ctx, "tbl")
+	wantNoError(t, err)
+	if got, want := n, 2; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := describe(), "insert tbl/L1,insert tbl/L2; delete tbl/L1,delete tbl/L2"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestIsNull(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a) values('ID1', 'aaa');
+		insert into tbl(id, a) values('ID2', '');
+		insert into tbl(id, a) values('ID3', ?);
+		insert into tbl(id) values('ID4');
+	`, nil)
+	wantNoError(t, err)
+
+	// empty strings are not null, but absent columns are
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{query: "select id from tbl where a is null", want: []string{"ID3", "ID4"}},
+		{query: "select id from tbl where a is not null", want: []string{"ID1", "ID2"}},
+		{query: "select id from tbl where not a is null", want: []string{"ID1", "ID2"}},
+	} {
+		rows, err := db.QueryContext(ctx, tt.query)
+		wantNoError(t, err)
+		var got []string
+		for rows.Next() {
+			var id string
+			wantNoError(t, rows.Scan(&id))
+			got = append(got, id)
+		}
+		wantNoError(t, rows.Err())
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got=%v, want=%v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestBoolPredicates(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, flag) values('ID1', ?);
+		insert into tbl(id, flag) values('ID2', ?);
+		insert into tbl(id) values('ID3');
+	`, true, false)
+	wantNoError(t, err)
+
+	for _, tt := range []struct {
+		query string
+		args  []interface{}
+		want  []string
+	}{
+		{query: "select id from tbl where flag = ?", args: []interface{}{true}, want: []string{"ID1"}},
+		{query: "select id from tbl where flag = ?", args: []interface{}{false}, want: []string{"ID2"}},
+		{query: "select id from tbl where flag", want: []string{"ID1"}},
+		{query: "select id from tbl where not flag", want: []string{"ID2"}},
+	} {
+		rows, err := db.QueryContext(ctx, tt.query, tt.args...)
+		wantNoError(t, err)
+		var got []string
+		for rows.Next() {
+			var id string
+			wantNoError(t, rows.Scan(&id))
+			got = append(got, id)
+		}
+		wantNoError(t, rows.Err())
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %v: got=%v, want=%v", tt.query, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestLikeHelpers(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a) values('ID1', '50% off');
+		insert into tbl(id, a) values('ID2', '50 cents off');
+		insert into tbl(id, a) values('ID3', 'it''s a_b');
+		insert into tbl(id, a) values('ID4', 'its axb');
+	`)
+	wantNoError(t, err)
+
+	for _, tt := range []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "50%", want: []string{"ID1", "ID2"}},
+		{pattern: LikePrefix("50%"), want: []string{"ID1"}},
+		{pattern: LikeSuffix("% off"), want: []string{"ID1"}},
+		{pattern: LikeContains("a_b"), want: []string{"ID3"}},
+		{pattern: LikeContains("it's"), want: []string{"ID3"}},
+		{pattern: EscapeLike(`50% off`), want: []string{"ID1"}},
+	} {
+		rows, err := db.QueryContext(ctx, "select id from tbl where a like ?", tt.pattern)
+		wantNoError(t, err)
+		var got []string
+		for rows.Next() {
+			var id string
+			wantNoError(t, rows.Scan(&id))
+			got = append(got, id)
+		}
+		wantNoError(t, rows.Err())
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got=%v, want=%v", tt.pattern, got, tt.want)
+		}
+	}
+	if got, want := LikeContains(`\`), `%\\%`; got != want {
+		t.Errorf("got=%s, want=%s", got, want)
+	}
+}
+
+// staleSelectAPI is a fake SimpleDB API whose eventually consistent selects
+// find no items, or fail with an error code if it is not blank.
+type staleSelectAPI struct {
+	*fakesdb.DB
+	code       string
+	selects    int
+	consistent int
+}
+
+func (api *staleSelectAPI) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	if aws.BoolValue(input.ConsistentRead) {
+		api.consistent++
+		return api.DB.SelectWithContext(ctx, input, opts...)
+	}
+	api.selects++
+	if api.code != "" {
+		return nil, awserr.New(api.code, "try again", nil)
+	}
+	return &simpledb.SelectOutput{}, nil
+}
+
+func TestConsistentRetry(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		query          string
+		code           string
+		wantErr        string
+		wantConsistent int
+	}{
+		{query: "select /*+ expect_rows */ id from tbl where a = 'x'", wantConsistent: 1},
+		{query: "select /*+ expect_rows */ id from tbl where id = 'ID1'", wantConsistent: 0},
+		{query: "select id from tbl where a = 'x'", wantErr: "no rows"},
+		{query: "select id from tbl where a = 'x'", code: "ServiceUnavailable", wantConsistent: 1},
+		{query: "select id from tbl where a = 'x'", code: "InternalError", wantErr: "InternalError"},
+	}
+	for tn, tt := range tests {
+		api := &staleSelectAPI{DB: fakesdb.New(), code: tt.code}
+		db := sql.OpenDB(&Connector{SimpleDB: api, ConsistentRetryCodes: []string{"ServiceUnavailable"}})
+		_, err := db.ExecContext(ctx, `
+			create table tbl;
+			insert into tbl(id, a) values('ID1', 'x');
+		`)
+		wantNoError(t, err)
+		var id string
+		err = db.QueryRowContext(ctx, tt.query).Scan(&id)
+		db.Close()
+		if tt.wantErr != "" {
+			wantErrorMessageContaining(t, err, tt.wantErr)
+			continue
+		}
+		wantNoError(t, err)
+		if got, want := api.consistent, tt.wantConsistent; got != want {
+			t.Errorf("%d: got=%d consistent selects, want=%d", tn, got, want)
+		}
+	}
+}
+
+type tenantKey struct{}
+
+func TestTableNameFunc(t *testing.T) {
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{
+		SimpleDB: sdb,
+		Schema:   "dev",
+		TableNameFunc: func(ctx context.Context, tableName string) (string, error) {
+			tenant, ok := ctx.Value(tenantKey{}).(string)
+			if !ok {
+				return "", errors.New("no tenant")
+			}
+			return tenant + "_" + tableName, nil
+		},
+	})
+	defer db.Close()
+
+	for _, tenant := range []string{"t1", "t2"} {
+		ctx := context.WithValue(context.Background(), tenantKey{}, tenant)
+		_, err := db.ExecContext(ctx, `
+			create table tbl;
+			insert into tbl(id, a) values('ID1', ?);
+		`, tenant)
+		wantNoError(t, err)
+	}
+	for _, tenant := range []string{"t1", "t2"} {
+		if got, want := sdb.Item("dev."+tenant+"_tbl", "ID1")["a"], []string{tenant}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got=%v, want=%v", tenant, got, want)
+		}
+		ctx := context.WithValue(context.Background(), tenantKey{}, tenant)
+		var a string
+		err := db.QueryRowContext(ctx, "select a from tbl where id = 'ID1'").Scan(&a)
+		wantNoError(t, err)
+		if a != tenant {
+			t.Errorf("got=%q, want=%q", a, tenant)
+		}
+	}
+
+	_, err := db.ExecContext(context.Background(), "delete from tbl where id = 'ID1'")
+	wantErrorMessageContaining(t, err, "cannot derive table name")
+}
+
+// unavailableAPI is a fake SimpleDB API whose read requests fail
+// with ServiceUnavailable when it is down.
+type unavailableAPI struct {
+	*fakesdb.DB
+	down bool
+}
+
+func (api *unavailableAPI) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	if api.down {
+		return nil, awserr.New("ServiceUnavailable", "try again", nil)
+	}
+	return api.DB.SelectWithContext(ctx, input, opts...)
+}
+
+func (api *unavailableAPI) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	if api.down {
+		return nil, awserr.New("ServiceUnavailable", "try again", nil)
+	}
+	return api.DB.GetAttributesWithContext(ctx, input, opts...)
+}
+
+func TestFailover(t *testing.T) {
+	ctx := context.Background()
+	primary := &unavailableAPI{DB: fakesdb.New()}
+	secondary := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: primary, Secondary: secondary, DualWrite: true})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a) values('ID1', 'x');
+		insert into tbl(id, a) values('ID2', 'y');
+		update tbl set a = 'z' where id = 'ID2';
+		delete from tbl where id = 'ID1';
+	`)
+	wantNoError(t, err)
+
+	// the secondary has a copy of the writes
+	for _, sdb := range []*fakesdb.DB{primary.DB, secondary} {
+		if got := sdb.Item("tbl", "ID1"); len(got) != 0 {
+			t.Errorf("ID1: got=%v, want deleted", got)
+		}
+		if got, want := sdb.Item("tbl", "ID2")["a"], []string{"z"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ID2: got=%v, want=%v", got, want)
+		}
+	}
+
+	// reads fail over to the secondary
+	primary.down = true
+	for _, query := range []string{
+		"select a from tbl where id = 'ID2'",
+		"select a from tbl where a = 'z'",
+	} {
+		var a string
+		err = db.QueryRowContext(ctx, query).Scan(&a)
+		wantNoError(t, err)
+		if a != "z" {
+			t.Errorf("%s: got=%q, want=%q", query, a, "z")
+		}
+	}
+
+	// writes fail if the secondary fails
+	sdb := fakesdb.New()
+	db2 := sql.OpenDB(&Connector{SimpleDB: sdb})
+	defer db2.Close()
+	_, err = db2.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	db3 := sql.OpenDB(&Connector{SimpleDB: sdb, Secondary: fakesdb.New(), DualWrite: true})
+	defer db3.Close()
+	_, err = db3.ExecContext(ctx, "insert into tbl(id, a) values('ID1', 'x')")
+	wantErrorMessageContaining(t, err, "cannot write to secondary")
+}
+
+// listDomainsAPI is a fake SimpleDB API that counts ListDomains and
+// CreateDomain requests.
+type listDomainsAPI struct {
+	*fakesdb.DB
+	lists   int
+	creates int
+}
+
+func (api *listDomainsAPI) ListDomainsWithContext(ctx aws.Context, input *simpledb.ListDomainsInput, opts ...request.Option) (*simpledb.ListDomainsOutput, error) {
+	api.lists++
+	return api.DB.ListDomainsWithContext(ctx, input, opts...)
+}
+
+func (api *listDomainsAPI) CreateDomainWithContext(ctx aws.Context, input *simpledb.CreateDomainInput, opts ...request.Option) (*simpledb.CreateDomainOutput, error) {
+	api.creates++
+	return api.DB.CreateDomainWithContext(ctx, input, opts...)
+}
+
+func TestShowTables(t *testing.T) {
+	ctx := context.Background()
+	api := &listDomainsAPI{DB: fakesdb.New()}
+	db := sql.OpenDB(&Connector{SimpleDB: api, Schema: "dev", DomainCacheTTL: time.Hour})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl2;
+		create table tbl1;
+		create table prod.tbl3;
+	`)
+	wantNoError(t, err)
+
+	showTables := func() []string {
+		t.Helper()
+		rows, err := db.QueryContext(ctx, "show tables")
+		wantNoError(t, err)
+		defer rows.Close()
+		var names []string
+		for rows.Next() {
+			var name string
+			wantNoError(t, rows.Scan(&name))
+			names = append(names, name)
+		}
+		wantNoError(t, rows.Err())
+		return names
+	}
+	for i := 0; i < 2; i++ {
+		if got, want := showTables(), []string{"tbl1", "tbl2"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got=%v, want=%v", got, want)
+		}
+	}
+	if got, want := api.lists, 1; got != want {
+		t.Errorf("got=%d lists, want=%d", got, want)
+	}
+
+	// existing domains are not created again, and creating
+	// or dropping a domain discards the cached names
+	creates := api.creates
+	result, err := db.ExecContext(ctx, "create table if not exists tbl1")
+	wantNoError(t, err)
+	wantRowsAffected(t, result, 0)
+	if got, want := api.creates, creates; got != want {
+		t.Errorf("got=%d creates, want=%d", got, want)
+	}
+	_, err = db.ExecContext(ctx, "create table if not exists tbl4")
+	wantNoError(t, err)
+	_, err = db.ExecContext(ctx, "drop table tbl2")
+	wantNoError(t, err)
+	if got, want := showTables(), []string{"tbl1", "tbl4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestSpool(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "spool")
+	wantNoError(t, err)
+	defer os.RemoveAll(dir)
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New(), SpoolThreshold: 3, SpoolDir: dir})
+	defer db.Close()
+	_, err = db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	var want []string
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("ID%02d", i)
+		_, err = db.ExecContext(ctx, "insert into tbl(id, a) values(?, ?)", id, "x")
+		wantNoError(t, err)
+		want = append(want, id)
+	}
+
+	// pages of two rows are fetched while the rows are read, and
+	// rows beyond the first three fetched are spooled to a file
+	rows, err := db.QueryContext(ctx, "select id from tbl where a = 'x' order by id limit 2")
+	wantNoError(t, err)
+	var got []string
+	for rows.Next() {
+		if len(got) == 0 {
+			files, err := waitForSpoolFile(dir)
+			wantNoError(t, err)
+			if len(files) != 1 {
+				t.Errorf("got=%d spool files, want=1", len(files))
+			}
+		}
+		var id string
+		wantNoError(t, rows.Scan(&id))
+		got = append(got, id)
+	}
+	wantNoError(t, rows.Err())
+	wantNoError(t, rows.Close())
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("got=%d spool files after close, want=0", len(files))
+	}
+}
+
+// waitForSpoolFile waits until the spool file has been created in dir.
+func waitForSpoolFile(dir string) ([]os.FileInfo, error) {
+	for i := 0; i < 100; i++ {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil || len(files) > 0 {
+			return files, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil, nil
+}
+
+func TestChecksums(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	var mismatches []*ChecksumMismatch
+	connector := &Connector{
+		SimpleDB:  sdb,
+		Checksums: true,
+		OnChecksumMismatch: func(ctx context.Context, mismatch *ChecksumMismatch) {
+			mismatches = append(mismatches, mismatch)
+		},
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a, b) values('ID1', 'x', 1);
+		insert into tbl(id, a, b) values('ID2', 'y', 2);
+		update tbl set a = '', b = 3 where id = 'ID2';
+	`)
+	wantNoError(t, err)
+	if got := sdb.Item("tbl", "ID2")["sql:checksum"]; len(got) != 1 {
+		t.Fatalf("got=%v, want checksum", got)
+	}
+
+	result, err := db.ExecContext(ctx, "update tbl set a = 'z' where id = 'ID3'")
+	wantNoError(t, err)
+	wantRowsAffected(t, result, 0)
+
+	_, err = db.ExecContext(ctx, "insert into tbl(id, checksum) values('ID3', 'x')")
+	wantErrorMessageContaining(t, err, "column name is reserved for checksums")
+
+	scan := func() map[string]map[string]interface{} {
+		rows, err := connector.QueryMaps(ctx, "select * from tbl")
+		wantNoError(t, err)
+		items := make(map[string]map[string]interface{})
+		for rows.Next() {
+			row := rows.Map()
+			items[row["id"].(string)] = row
+		}
+		wantNoError(t, rows.Err())
+		return items
+	}
+	items := scan()
+	if len(mismatches) != 0 {
+		t.Errorf("got=%v, want no mismatches", mismatches)
+	}
+	if got, want := items["ID2"], map[string]interface{}{"id": "ID2", "a": "", "b": "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	// an attribute written without updating the checksum, as happens when
+	// an update is interrupted after its put request
+	_, err = sdb.PutAttributesWithContext(ctx, &simpledb.PutAttributesInput{
+		DomainName: aws.String("tbl"),
+		ItemName:   aws.String("ID1"),
+		Attributes: []*simpledb.ReplaceableAttribute{
+			{Name: aws.String("a"), Value: aws.String("w"), Replace: aws.Bool(true)},
+		},
+	})
+	wantNoError(t, err)
+	scan()
+	if len(mismatches) != 1 || mismatches[0].ID != "ID1" || mismatches[0].Table != "tbl" {
+		t.Fatalf("got=%v, want mismatch for ID1", mismatches)
+	}
+
+	// an update calculates the checksum of the whole item
+	_, err = db.ExecContext(ctx, "update tbl set b = 4 where id = 'ID1'")
+	wantNoError(t, err)
+	mismatches = nil
+	scan()
+	if len(mismatches) != 0 {
+		t.Errorf("got=%v, want no mismatches", mismatches)
+	}
+}
+
+// failDeleteAPI is a fake SimpleDB API whose DeleteAttributes requests fail
+// while fail is set, as if an update were interrupted after its put request.
+type failDeleteAPI struct {
+	*fakesdb.DB
+	fail bool
+}
+
+func (api *failDeleteAPI) DeleteAttributesWithContext(ctx aws.Context, input *simpledb.DeleteAttributesInput, opts ...request.Option) (*simpledb.DeleteAttributesOutput, error) {
+	if api.fail {
+		return nil, awserr.New("ServiceUnavailable", "service unavailable", nil)
+	}
+	return api.DB.DeleteAttributesWithContext(ctx, input, opts...)
+}
+
+func TestTwoPhaseUpdates(t *testing.T) {
+	ctx := context.Background()
+	sdb := &failDeleteAPI{DB: fakesdb.New()}
+	db := sql.OpenDB(&Connector{SimpleDB: sdb, TwoPhaseUpdates: true})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a, b) values('ID1', 'x', 'y');
+	`)
+	wantNoError(t, err)
+
+	result, err := db.ExecContext(ctx, "update tbl set a = 'z', b = '' where id = 'ID2'")
+	wantNoError(t, err)
+	wantRowsAffected(t, result, 0)
+
+	sdb.fail = true
+	_, err = db.ExecContext(ctx, "update tbl set a = 'z', b = '' where id = 'ID1'")
+	wantErrorMessageContaining(t, err, "cannot delete attributes")
+	sdb.fail = false
+	if got := sdb.Item("tbl", "ID1")["sql:txn"]; len(got) != 1 {
+		t.Fatalf("got=%v, want marker", got)
+	}
+
+	// reads ignore the attributes that the interrupted update deletes
+	for _, query := range []string{
+		"select a, b from tbl where id = 'ID1'",
+		"select a, b from tbl where a = 'z'",
+	} {
+		var a, b string
+		err = db.QueryRowContext(ctx, query).Scan(&a, &b)
+		wantNoError(t, err)
+		if a != "z" || b != "" {
+			t.Errorf("%s: got=(%q, %q), want=(%q, %q)", query, a, b, "z", "")
+		}
+	}
+	if got := sdb.Item("tbl", "ID1")["b"]; len(got) != 1 {
+		t.Fatalf("got=%v, want not repaired", got)
+	}
+
+	// reads that repair complete the update
+	db2 := sql.OpenDB(&Connector{SimpleDB: sdb, TwoPhaseUpdates: true, RepairPendingUpdates: true})
+	defer db2.Close()
+	var a string
+	err = db2.QueryRowContext(ctx, "select a from tbl where a = 'z'").Scan(&a)
+	wantNoError(t, err)
+	item := sdb.Item("tbl", "ID1")
+	if len(item["b"]) != 0 || len(item["sql:txn"]) != 0 {
+		t.Errorf("got=%v, want repaired", item)
+	}
+
+	// a completed update leaves no marker
+	_, err = db.ExecContext(ctx, "update tbl set a = '', b = 'w' where id = 'ID1'")
+	wantNoError(t, err)
+	item = sdb.Item("tbl", "ID1")
+	if len(item["a"]) != 0 || len(item["sql:txn"]) != 0 {
+		t.Errorf("got=%v, want completed", item)
+	}
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	connector := &Connector{SimpleDB: sdb, Checksums: true}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a) values('ID1', 'x');
+	`)
+	wantNoError(t, err)
+
+	lock, err := connector.AcquireLock(ctx, "tbl", "ID1", time.Minute)
+	wantNoError(t, err)
+	if lock.Table != "tbl" || lock.ID != "ID1" {
+		t.Errorf("got=%+v, want lock on tbl ID1", lock)
+	}
+
+	// the lock is held by the first holder
+	ctx2, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
+	defer cancel()
+	_, err = connector.AcquireLock(ctx2, "tbl", "ID1", time.Minute)
+	wantErrorMessageContaining(t, err, "cannot acquire lock")
+
+	// the lease is not a column of the item
+	rows, err := connector.QueryMaps(ctx, "select * from tbl")
+	wantNoError(t, err)
+	for rows.Next() {
+		if got, want := rows.Map(), map[string]interface{}{"id": "ID1", "a": "x"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got=%v, want=%v", got, want)
+		}
+	}
+	wantNoError(t, rows.Err())
+
+	wantNoError(t, connector.ReleaseLock(ctx, lock))
+	if got := sdb.Item("tbl", "ID1")["sql:lock"]; len(got) != 0 {
+		t.Errorf("got=%v, want released", got)
+	}
+	err = connector.ReleaseLock(ctx, lock)
+	wantErrorMessageContaining(t, err, "lock is no longer held")
+
+	// an expired lease is acquired by the next holder
+	expired, err := connector.AcquireLock(ctx, "tbl", "ID2", time.Millisecond)
+	wantNoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	lock, err = connector.AcquireLock(ctx, "tbl", "ID2", time.Minute)
+	wantNoError(t, err)
+	err = connector.ReleaseLock(ctx, expired)
+	wantErrorMessageContaining(t, err, "lock is no longer held")
+	wantNoError(t, connector.ReleaseLock(ctx, lock))
+}
+
+func TestUpdateIf(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a, b, n) values('ID1', 'x', 'y', ?);
+	`, 1)
+	wantNoError(t, err)
+
+	tests := []struct {
+		query string
+		args  []interface{}
+		rows  int64
+	}{
+		{"update tbl set a = 'z' where id = 'ID1' if a = 'w'", nil, 0},
+		{"update tbl set a = 'z' where id = 'ID2' if a = 'x'", nil, 0},
+		{"update tbl set a = 'z' where id = 'ID1' if a = 'x'", nil, 1},
+		{"update tbl set a = '', b = 'v' where id = 'ID1' if a = 'z'", nil, 1},
+		{"update tbl set b = '', n = ? where id = 'ID1' if n = ?", []interface{}{2, 1}, 1},
+		{"update tbl set n = ? where id = 'ID1' if n = ?", []interface{}{3, 1}, 0},
+	}
+	for _, tt := range tests {
+		result, err := db.ExecContext(ctx, tt.query, tt.args...)
+		wantNoError(t, err)
+		wantRowsAffected(t, result, tt.rows)
+	}
+	item := sdb.Item("tbl", "ID1")
+	if len(item["a"]) != 0 || len(item["b"]) != 0 || !reflect.DeepEqual(item["n"], []string{"2"}) {
+		t.Errorf("got=%v", item)
+	}
+
+	_, err = db.ExecContext(ctx, "update tbl set a = 'z' where id = 'ID1' if a = ''")
+	wantErrorMessageContaining(t, err, "if clause cannot expect a null or empty value")
+
+	db2 := sql.OpenDB(&Connector{SimpleDB: sdb, PackedMetadata: true})
+	defer db2.Close()
+	_, err = db2.ExecContext(ctx, "update tbl set a = 'z' where id = 'ID1' if n = ?", 2)
+	wantErrorMessageContaining(t, err, "if clause is not supported")
+}
+
+func TestDeleteIf(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, version) values('ID1', ?);
+	`, 2)
+	wantNoError(t, err)
+
+	result, err := db.ExecContext(ctx, "delete from tbl where id = 'ID1' if version = ?", 1)
+	wantNoError(t, err)
+	wantRowsAffected(t, result, 0)
+	if item := sdb.Item("tbl", "ID1"); len(item) == 0 {
+		t.Fatal("got deleted, want not deleted")
+	}
+
+	result, err = db.ExecContext(ctx, "delete from tbl where id = 'ID1' if version = ?", 2)
+	wantNoError(t, err)
+	wantRowsAffected(t, result, 1)
+	if item := sdb.Item("tbl", "ID1"); len(item) != 0 {
+		t.Errorf("got=%v, want deleted", item)
+	}
+
+	result, err = db.ExecContext(ctx, "delete from tbl where id = 'ID1' if version = ?", 2)
+	wantNoError(t, err)
+	wantRowsAffected(t, result, 0)
+}
+
+func TestBulkUpdate(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	var progress []BulkProgress
+	db := sql.OpenDB(&Connector{
+		SimpleDB: sdb,
+		OnBulkProgress: func(ctx context.Context, p *BulkProgress) {
+			progress = append(progress, *p)
+		},
+	})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	for i := 0; i < 30; i++ {
+		status := "new"
+		if i%10 == 0 {
+			status = "old"
+		}
+		_, err := db.ExecContext(ctx, "insert into tbl(id, status, note) values(?, ?, 'x')", fmt.Sprintf("ID%02d", i), status)
+		wantNoError(t, err)
+	}
+
+	result, err := db.ExecContext(ctx, "update tbl set status = ?, note = ? where id in (select id from tbl where status = ?)", "done", nil, "new")
+	wantNoError(t, err)
+	wantRowsAffected(t, result, 27)
+	if got, want := sdb.Calls("BatchPutAttributes"), 2; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := sdb.Item("tbl", "ID01")["status"], []string{"done"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got := sdb.Item("tbl", "ID01")["note"]; got != nil {
+		t.Errorf("got=%v, want=nil", got)
+	}
+	if got, want := sdb.Item("tbl", "ID10")["status"], []string{"old"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	wantProgress := []BulkProgress{
+		{Table: "tbl", Operation: "update", Count: 25, Total: 27},
+		{Table: "tbl", Operation: "update", Count: 27, Total: 27},
+	}
+	if !reflect.DeepEqual(progress, wantProgress) {
+		t.Errorf("got=%v, want=%v", progress, wantProgress)
+	}
+
+	result, err = db.ExecContext(ctx, "delete from tbl where id in (select id from tbl where status = 'old')")
+	wantNoError(t, err)
+	wantRowsAffected(t, result, 3)
+	if item := sdb.Item("tbl", "ID10"); len(item) != 0 {
+		t.Errorf("got=%v, want deleted", item)
+	}
+	if item := sdb.Item("tbl", "ID11"); len(item) == 0 {
+		t.Error("got deleted, want not deleted")
+	}
+}
+
+// rejectItemAPI fails BatchPutAttributes requests that contain an item.
+type rejectItemAPI struct {
+	*fakesdb.DB
+	itemName string
+}
+
+func (api *rejectItemAPI) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	for _, item := range input.Items {
+		if aws.StringValue(item.Name) == api.itemName {
+			return nil, awserr.New("NumberItemAttributesExceeded", "too many attributes", nil)
+		}
+	}
+	return api.DB.BatchPutAttributesWithContext(ctx, input, opts...)
+}
+
+func TestTableWriter(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	api := &rejectItemAPI{DB: sdb, itemName: "ID07"}
+	var (
+		invalidMutex sync.Mutex
+		invalidated  = make(map[string]string)
+	)
+	connector := &Connector{
+		SimpleDB: api,
+		Invalidator: InvalidatorFunc(func(ctx context.Context, invalidations []Invalidation) {
+			invalidMutex.Lock()
+			defer invalidMutex.Unlock()
+			for _, inv := range invalidations {
+				invalidated[inv.ID] = inv.Operation + " " + inv.Table
+			}
+		}),
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+
+	w := connector.NewTableWriter("tbl")
+	w.Concurrency = 2
+	for i := 0; i < 60; i++ {
+		err := w.Add(ctx, map[string]interface{}{
+			"id": fmt.Sprintf("ID%02d", i),
+			"n":  i,
+		})
+		wantNoError(t, err)
+	}
+	wantErrorMessageContaining(t, w.Add(ctx, map[string]interface{}{"n": 1}), "missing id")
+	err = w.Flush(ctx)
+	wantErrorMessageContaining(t, err, "NumberItemAttributesExceeded")
+	wantErrorMessageContaining(t, err, "failed=1")
+	if got, want := w.Count(), 59; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	var n int64
+	err = db.QueryRowContext(ctx, "consistent select n from tbl where id = 'ID42'").Scan(&n)
+	wantNoError(t, err)
+	if got, want := n, int64(42); got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if item := sdb.Item("tbl", "ID07"); len(item) != 0 {
+		t.Errorf("got=%v, want not written", item)
+	}
+	// the Invalidator is notified of the rows written
+	if got, want := len(invalidated), 59; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := invalidated["ID42"], "insert tbl"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, ok := invalidated["ID07"]; ok {
+		t.Errorf("got=%v, want not invalidated", got)
+	}
+
+	var (
+		mutex  sync.Mutex
+		failed []string
+	)
+	w.OnError = func(ctx context.Context, id string, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		failed = append(failed, id)
+	}
+	wantNoError(t, w.Add(ctx, map[string]interface{}{"id": "ID07", "n": 7}))
+	wantNoError(t, w.Add(ctx, map[string]interface{}{"id": "ID07", "n": 8}))
+	wantNoError(t, w.Flush(ctx))
+	if got, want := failed, []string{"ID07", "ID07"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+// slowItemAPI delays the first BatchPutAttributes request that contains an item.
+type slowItemAPI struct {
+	*fakesdb.DB
+	itemName string
+	delay    time.Duration
+	mutex    sync.Mutex
+	delayed  bool
+}
+
+func (api *slowItemAPI) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	for _, item := range input.Items {
+		if aws.StringValue(item.Name) == api.itemName {
+			api.mutex.Lock()
+			delay := !api.delayed
+			api.delayed = true
+			api.mutex.Unlock()
+			if delay {
+				time.Sleep(api.delay)
+			}
+		}
+	}
+	return api.DB.BatchPutAttributesWithContext(ctx, input, opts...)
+}
+
+func TestTableWriterOrder(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	connector := &Connector{SimpleDB: &slowItemAPI{DB: sdb, itemName: "ID00", delay: 50 * time.Millisecond}}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+
+	w := connector.NewTableWriter("tbl")
+	defer w.Close()
+
+	// the first batch is slow, and the rows added later with the same
+	// ids are in other batches, which must not be written first
+	addCtx, cancel := context.WithCancel(ctx)
+	for i := 0; i < 3*maxBatchItems; i++ {
+		err := w.Add(addCtx, map[string]interface{}{
+			"id": fmt.Sprintf("ID%02d", i%30),
+			"n":  i,
+		})
+		wantNoError(t, err)
+	}
+	// rows that have been added are written after the context of Add is done
+	cancel()
+	wantNoError(t, w.Flush(ctx))
+	if got, want := w.Count(), 3*maxBatchItems; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	for i := 0; i < 30; i++ {
+		var n int64
+		err = db.QueryRowContext(ctx, "consistent select n from tbl where id = ?", fmt.Sprintf("ID%02d", i)).Scan(&n)
+		wantNoError(t, err)
+		if got, want := n, int64(60+i); i < 15 && got != want {
+			t.Errorf("%d: got=%v, want=%v", i, got, want)
+		} else if want := int64(30 + i); i >= 15 && got != want {
+			t.Errorf("%d: got=%v, want=%v", i, got, want)
+		}
+	}
+
+	wantNoError(t, w.Close())
+	wantErrorMessageContaining(t, w.Add(ctx, map[string]interface{}{"id": "ID00"}), "table writer is closed")
+}
+
+// inFlightAPI records the maximum number of BatchPutAttributes
+// requests in flight at once.
+type inFlightAPI struct {
+	*fakesdb.DB
+	mutex    sync.Mutex
+	inFlight int
+	maxSeen  int
+}
+
+func (api *inFlightAPI) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	api.mutex.Lock()
+	api.inFlight++
+	if api.inFlight > api.maxSeen {
+		api.maxSeen = api.inFlight
+	}
+	api.mutex.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	api.mutex.Lock()
+	api.inFlight--
+	api.mutex.Unlock()
+	return api.DB.BatchPutAttributesWithContext(ctx, input, opts...)
+}
+
+func TestTableWriterMaxConnectionRequests(t *testing.T) {
+	ctx := context.Background()
+	api := &inFlightAPI{DB: fakesdb.New()}
+	connector := &Connector{SimpleDB: api, MaxConnectionRequests: 1}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+
+	w := connector.NewTableWriter("tbl")
+	defer w.Close()
+	w.Concurrency = 4
+	for i := 0; i < 4*maxBatchItems; i++ {
+		wantNoError(t, w.Add(ctx, map[string]interface{}{"id": fmt.Sprintf("ID%03d", i)}))
+	}
+	wantNoError(t, w.Flush(ctx))
+	if got, want := w.Count(), 4*maxBatchItems; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := api.maxSeen, 1; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+// scanStruct scans the current row into the fields of the struct that dest
+// points to, in the same way as sqlx.StructScan and scany: each column is
+// mapped to the field with a matching "db" tag or lowercased name, and it
+// is an error if a column has no field.
+func scanStruct(rows *sql.Rows, dest interface{}) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	v := reflect.ValueOf(dest).Elem()
+	fields := make(map[string]int)
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		name := f.Tag.Get("db")
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = i
+	}
+	ptrs := make([]interface{}, len(columns))
+	for i, column := range columns {
+		index, ok := fields[column]
+		if !ok {
+			return fmt.Errorf("missing destination name %s", column)
+		}
+		ptrs[i] = v.Field(index).Addr().Interface()
+	}
+	return rows.Scan(ptrs...)
+}
+
+func TestStructScan(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{
+		SimpleDB:         sdb,
+		StatementTimeout: time.Minute,
+	})
+	defer db.Close()
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, name, nickname, price, active, created) values('ID1', ?, ?, ?, ?, ?);
+		insert into tbl(id, name, price) values('ID2', ?, ?);
+	`, "one", "uno", Decimal("19.99"), true, created, "two", Decimal("5"))
+	wantNoError(t, err)
+
+	rows, err := db.QueryContext(ctx, "consistent select id, name, nickname, price, active, created from tbl where id = 'ID1' or id = 'ID2' order by id")
+	wantNoError(t, err)
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	wantNoError(t, err)
+	if got, want := columnTypes[0].ScanType(), reflect.TypeOf(""); got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if nullable, ok := columnTypes[0].Nullable(); nullable || !ok {
+		t.Errorf("got nullable=%v ok=%v, want nullable=false ok=true", nullable, ok)
+	}
+	if got, want := columnTypes[0].DatabaseTypeName(), "STRING"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if nullable, ok := columnTypes[2].Nullable(); !nullable || !ok {
+		t.Errorf("got nullable=%v ok=%v, want nullable=true ok=true", nullable, ok)
+	}
+
+	type row struct {
+		ID       string `db:"id"`
+		Name     string
+		Nickname sql.NullString
+		Price    Decimal
+		Active   *bool
+		Created  *time.Time
+	}
+	var got []row
+	for rows.Next() {
+		var r row
+		wantNoError(t, scanStruct(rows, &r))
+		got = append(got, r)
+	}
+	wantNoError(t, rows.Err())
+	active := true
+	want := []row{
+		{
+			ID:       "ID1",
+			Name:     "one",
+			Nickname: sql.NullString{String: "uno", Valid: true},
+			Price:    "19.99",
+			Active:   &active,
+			Created:  &created,
+		},
+		{
+			ID:    "ID2",
+			Name:  "two",
+			Price: "5",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%+v\nwant=%+v", got, want)
+	}
+}
+
+func TestCaseInsensitiveColumns(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb, CaseInsensitiveColumns: []string{"name"}})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, name) values('ID1', 'Alice');
+		insert into tbl(id, name) values('ID2', 'ALICE');
+		insert into tbl(id, name) values('ID3', 'Bob');
+	`)
+	wantNoError(t, err)
+	_, err = db.ExecContext(ctx, "insert into tbl(id, name) values('ID4', ?)", 42)
+	wantNoError(t, err)
+	if got, want := sdb.Item("tbl", "ID1")["sql:folded:name"], []string{"alice"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	tests := []struct {
+		query string
+		args  []interface{}
+		want  []string
+	}{
+		{
+			query: "select id, name from tbl where name = ?",
+			args:  []interface{}{"aLiCe"},
+			want:  []string{"ID1:Alice", "ID2:ALICE"},
+		},
+		{
+			query: "select id, name from tbl where name like 'B%'",
+			want:  []string{"ID3:Bob"},
+		},
+		{
+			query: "select id, name from tbl where name in ('BOB', $1)",
+			args:  []interface{}{"alice"},
+			want:  []string{"ID1:Alice", "ID2:ALICE", "ID3:Bob"},
+		},
+		{
+			query: "select id, name from tbl where name <> 'alice' and name is not null",
+			want:  []string{"ID3:Bob", "ID4:42"},
+		},
+		{
+			// predicates on the order by column are not translated
+			query: "select id, name from tbl where name >= 'a' order by name",
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		rows, err := db.QueryContext(ctx, tt.query, tt.args...)
+		wantNoError(t, err)
+		var got []string
+		for rows.Next() {
+			var id, name string
+			wantNoError(t, rows.Scan(&id, &name))
+			got = append(got, id+":"+name)
+		}
+		wantNoError(t, rows.Err())
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got=%v, want=%v", tt.query, got, tt.want)
+		}
+	}
+
+	// setting the column to null deletes the folded value
+	_, err = db.ExecContext(ctx, "update tbl set name = ? where id = 'ID2'", nil)
+	wantNoError(t, err)
+	if got := sdb.Item("tbl", "ID2")["sql:folded:name"]; len(got) != 0 {
+		t.Errorf("got=%v, want deleted", got)
+	}
+
+	// the folded value is not a column
+	c := &Connector{SimpleDB: sdb, CaseInsensitiveColumns: []string{"name"}}
+	rows, err := c.QueryMaps(ctx, "consistent select * from tbl where id = 'ID1'")
+	wantNoError(t, err)
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatal("got no rows, want one")
+	}
+	if got, want := rows.Map(), map[string]interface{}{"id": "ID1", "name": "Alice"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestSearchColumns(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb, SearchColumns: []string{"body"}})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, body) values('ID1', 'The quick brown fox');
+		insert into tbl(id, body) values('ID2', 'A quick, quick dog');
+		insert into tbl(id, body) values('ID3', 'Lazy dogs');
+	`)
+	wantNoError(t, err)
+	if got, want := sdb.Item("tbl", "ID2")["sql:words:body"], []string{"a", "quick", "dog"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	tests := []struct {
+		query string
+		args  []interface{}
+		want  []string
+	}{
+		{
+			query: "select id from tbl where match(body, ?)",
+			args:  []interface{}{"QUICK"},
+			want:  []string{"ID1", "ID2"},
+		},
+		{
+			query: "select id from tbl where match(body, 'fox quick')",
+			want:  []string{"ID1"},
+		},
+		{
+			query: "select id from tbl where id > ? and not match(body, ?) and id < ?",
+			args:  []interface{}{"ID1", "fox", "ID9"},
+			want:  []string{"ID2", "ID3"},
+		},
+		{
+			query: "select id from tbl where match(body, $2) or id = $1",
+			args:  []interface{}{"ID3", "dog"},
+			want:  []string{"ID2", "ID3"},
+		},
+	}
+	for _, tt := range tests {
+		rows, err := db.QueryContext(ctx, tt.query, tt.args...)
+		wantNoError(t, err)
+		var got []string
+		for rows.Next() {
+			var id string
+			wantNoError(t, rows.Scan(&id))
+			got = append(got, id)
+		}
+		wantNoError(t, rows.Err())
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got=%v, want=%v", tt.query, got, tt.want)
+		}
+	}
+
+	// updating the column replaces its words
+	_, err = db.ExecContext(ctx, "update tbl set body = 'Slow fox' where id = 'ID2'")
+	wantNoError(t, err)
+	if got, want := sdb.Item("tbl", "ID2")["sql:words:body"], []string{"slow", "fox"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	_, err = db.ExecContext(ctx, "update tbl set body = ? where id = 'ID2'", nil)
+	wantNoError(t, err)
+	if got := sdb.Item("tbl", "ID2")["sql:words:body"]; len(got) != 0 {
+		t.Errorf("got=%v, want deleted", got)
+	}
+
+	_, err = db.QueryContext(ctx, "select id from tbl where match(title, 'fox')")
+	wantErrorMessageContaining(t, err, "not a search column")
+	_, err = db.QueryContext(ctx, "select id from tbl where match(body, '...')")
+	wantErrorMessageContaining(t, err, "no words to match")
+}
+
+func TestAggregates(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	for _, row := range [][]interface{}{
+		{"ID1", int64(9), "b", Decimal("1.25"), 1.5},
+		{"ID2", int64(10), "a", Decimal("-2"), nil},
+		{"ID3", int64(-3), nil, Decimal("0.5"), int64(2)},
+	} {
+		_, err := db.ExecContext(ctx, "insert into tbl(id, n, s, d, f) values(?, ?, ?, ?, ?)", row...)
+		wantNoError(t, err)
+	}
+
+	tests := []struct {
+		query string
+		want  []interface{}
+	}{
+		{
+			// numbers are compared numerically, not as strings
+			query: "consistent select min(n), max(n), sum(n) from tbl",
+			want:  []interface{}{int64(-3), int64(10), int64(16)},
+		},
+		{
+			query: "consistent select min(s), max(s), max(id) from tbl",
+			want:  []interface{}{"a", "b", "ID3"},
+		},
+		{
+			query: "consistent select sum(d), min(d), sum(f) from tbl",
+			want:  []interface{}{"-0.25", "-2", 3.5},
+		},
+		{
+			query: "consistent select max(n), sum(n) from tbl where s = 'b'",
+			want:  []interface{}{int64(9), int64(9)},
+		},
+		{
+			query: "consistent select max(n), sum(d) from tbl where id = 'ID3'",
+			want:  []interface{}{int64(-3), "0.5"},
+		},
+		{
+			query: "consistent select max(n), sum(n) from tbl where s = 'z'",
+			want:  []interface{}{nil, nil},
+		},
+	}
+	for _, tt := range tests {
+		got := make([]interface{}, len(tt.want))
+		dest := make([]interface{}, len(tt.want))
+		for i := range got {
+			dest[i] = &got[i]
+		}
+		err := db.QueryRowContext(ctx, tt.query).Scan(dest...)
+		wantNoError(t, err)
+		for i, v := range got {
+			if r, ok := v.(*big.Rat); ok {
+				got[i] = formatDecimal(r)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got=%v, want=%v", tt.query, got, tt.want)
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, "consistent select max(n) from tbl")
+	wantNoError(t, err)
+	columns, err := rows.Columns()
+	wantNoError(t, err)
+	rows.Close()
+	if got, want := columns, []string{"max(n)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	var n interface{}
+	err = db.QueryRowContext(ctx, "consistent select sum(s) from tbl").Scan(&n)
+	wantErrorMessageContaining(t, err, "cannot aggregate value as a number")
+}
+
+func TestGroupBy(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New(), MaxGroups: 3})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	for _, row := range [][]interface{}{
+		{"ID1", "open", int64(9), "x"},
+		{"ID2", "closed", int64(10), "x"},
+		{"ID3", "open", int64(-3), "y"},
+		{"ID4", nil, int64(1), "y"},
+		{"ID5", "open", nil, "z"},
+	} {
+		_, err := db.ExecContext(ctx, "insert into tbl(id, status, n, k) values(?, ?, ?, ?)", row...)
+		wantNoError(t, err)
+	}
+
+	tests := []struct {
+		query string
+		want  [][]interface{}
+	}{
+		{
+			query: "consistent select status, count(*), count(n), sum(n) from tbl group by status",
+			want: [][]interface{}{
+				{nil, int64(1), int64(1), int64(1)},
+				{"closed", int64(1), int64(1), int64(10)},
+				{"open", int64(3), int64(2), int64(6)},
+			},
+		},
+		{
+			query: "consistent select count(*), max(n) from tbl where k = 'y'",
+			want: [][]interface{}{
+				{int64(2), int64(1)},
+			},
+		},
+		{
+			query: "consistent select count(*), max(n) from tbl where k = 'none'",
+			want: [][]interface{}{
+				{int64(0), nil},
+			},
+		},
+		{
+			query: "consistent select k from tbl where status = 'open' group by k",
+			want: [][]interface{}{
+				{"x"}, {"y"}, {"z"},
+			},
+		},
+		{
+			query: "consistent select k from tbl where k = 'none' group by k",
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		rows, err := db.QueryContext(ctx, tt.query)
+		wantNoError(t, err)
+		columns, err := rows.Columns()
+		wantNoError(t, err)
+		var got [][]interface{}
+		for rows.Next() {
+			row := make([]interface{}, len(columns))
+			dest := make([]interface{}, len(columns))
+			for i := range row {
+				dest[i] = &row[i]
+			}
+			wantNoError(t, rows.Scan(dest...))
+			got = append(got, row)
+		}
+		wantNoError(t, rows.Err())
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got=%v, want=%v", tt.query, got, tt.want)
+		}
+	}
+
+	var n int
+	err = db.QueryRowContext(ctx, "consistent select id, count(*) from tbl group by id").Scan(&n, &n)
+	wantErrorMessageContaining(t, err, "too many groups")
+	rows, err := db.QueryContext(ctx, "consistent select /*+ max_groups(5) */ id, count(*) from tbl group by id")
+	wantNoError(t, err)
+	rows.Close()
+}
+
+func TestArgTypeHints(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+
+	type point struct{ X, Y int }
+	tests := []struct {
+		arg  interface{}
+		want string
+	}{
+		{point{1, 2}, "cannot store struct, implement driver.Valuer"},
+		{&point{1, 2}, `type="*simpledbsql.point"`},
+		{map[string]int{"a": 1}, "cannot store map"},
+		{[]string{"a", "b"}, "cannot store slice or array"},
+		{[4]byte{1, 2, 3, 4}, "convert it to a []byte"},
+	}
+	for _, tt := range tests {
+		_, err := db.ExecContext(ctx, "insert into tbl(id, a) values('ID1', ?)", tt.arg)
+		wantErrorMessageContaining(t, err, tt.want)
+	}
+}
+
+func TestIDGenerators(t *testing.T) {
+	snowflake, err := SnowflakeGenerator(7)
+	wantNoError(t, err)
+	_, err = SnowflakeGenerator(1024)
+	wantErrorMessageContaining(t, err, "invalid snowflake node")
+
+	tests := []struct {
+		generator IDGenerator
+		pattern   string
+		interval  time.Duration // clock resolution
+	}{
+		{UUIDv7Generator, `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, time.Millisecond},
+		{ULIDGenerator, `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`, time.Millisecond},
+		{KSUIDGenerator, `^[0-9A-Za-z]{27}$`, time.Second},
+		{snowflake, `^[0-9]{19}$`, 0},
+	}
+	for tn, tt := range tests {
+		re := regexp.MustCompile(tt.pattern)
+		var ids []string
+		for i := 0; i < 3; i++ {
+			id, err := tt.generator.NewID()
+			wantNoError(t, err)
+			if !re.MatchString(id) {
+				t.Errorf("%d: got=%q, want match for %s", tn, id, tt.pattern)
+			}
+			ids = append(ids, id)
+			if i < 2 {
+				time.Sleep(tt.interval + time.Millisecond)
+			}
+		}
+		if !sort.StringsAreSorted(ids) || ids[0] == ids[1] || ids[1] == ids[2] {
+			t.Errorf("%d: got=%v, want ids in order of creation", tn, ids)
+		}
+	}
+}
+
+func TestGeneratedIDs(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	connector := &Connector{SimpleDB: sdb}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+	_, err = db.ExecContext(ctx, "insert into tbl(a) values(?)", "aaa")
+	wantErrorMessageContaining(t, err, "missing id column in insert statement")
+
+	connector.IDGenerator = IDGeneratorFunc(func() (string, error) {
+		return "GEN1", nil
+	})
+	db = sql.OpenDB(connector)
+	defer db.Close()
+	var id string
+	err = db.QueryRowContext(ctx, "insert into tbl set a = ? returning id", "aaa").Scan(&id)
+	wantNoError(t, err)
+	if got, want := id, "GEN1"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := sdb.Item("tbl", "GEN1")["a"], []string{"aaa"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestCreatedColumn(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{
+		SimpleDB:      fakesdb.New(),
+		CreatedColumn: "created",
+	})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+
+	start := time.Now()
+	var created []time.Time
+	for _, id := range []string{"ID2", "ID3", "ID1"} {
+		var t1 time.Time
+		err = db.QueryRowContext(ctx, "insert into tbl(id, a) values(?, 'a') returning created", id).Scan(&t1)
+		wantNoError(t, err)
+		created = append(created, t1)
+		time.Sleep(time.Millisecond)
+	}
+	if created[0].Before(start) || created[0].Location() != time.UTC {
+		t.Errorf("got=%v, want UTC time after %v", created[0], start)
+	}
+	old := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	_, err = db.ExecContext(ctx, "insert into tbl(id, a, created) values('ID0', 'a', ?)", old)
+	wantNoError(t, err)
+	_, err = db.ExecContext(ctx, "update tbl set a = 'b' where id = 'ID2'")
+	wantNoError(t, err)
+
+	// the order by column is constrained automatically
+	rows, err := db.QueryContext(ctx, "select id, created from tbl order by created desc limit 3")
+	wantNoError(t, err)
+	var ids []string
+	var times []time.Time
+	for len(ids) < 3 && rows.Next() {
+		var id string
+		var t1 time.Time
+		wantNoError(t, rows.Scan(&id, &t1))
+		ids = append(ids, id)
+		times = append(times, t1)
+	}
+	wantNoError(t, rows.Err())
+	rows.Close()
+	if got, want := strings.Join(ids, ","), "ID1,ID3,ID2"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if len(times) == 3 && !times[2].Equal(created[0]) {
+		t.Errorf("got=%v, want=%v", times[2], created[0])
+	}
+}
+
+func TestScanPolicy(t *testing.T) {
+	ctx := context.Background()
+	var scans []*Scan
+	connector := &Connector{
+		SimpleDB:   fakesdb.New(),
+		ScanPolicy: ScanError,
+		OnScan: func(ctx context.Context, scan *Scan) {
+			scans = append(scans, scan)
+		},
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+
+	tests := []struct {
+		query string
+		scan  bool
+	}{
+		{"select id, a from tbl", true},
+		{"select id, a from tbl limit 10", true},
+		{"select id, a from tbl where a is not null order by a limit 10", true},
+		{"select id, a from tbl where (a is null or b is not null)", true},
+		{"select id, a from tbl where a is not null and b = 'x'", false},
+		{"select id, a from tbl where id > 'ID1' order by id", false},
+		{"select id, a from tbl where not flag", false},
+		{"select /*+ scan */ id, a from tbl", false},
+	}
+	for tn, tt := range tests {
+		rows, err := db.QueryContext(ctx, tt.query)
+		if tt.scan {
+			wantErrorMessageContaining(t, err, "select scans the entire table")
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: got=%v, want=nil", tn, err)
+			continue
+		}
+		rows.Close()
+	}
+	_, err = connector.QueryMaps(ctx, "select * from tbl")
+	wantErrorMessageContaining(t, err, "select scans the entire table")
+
+	connector.ScanPolicy = ScanWarn
+	db = sql.OpenDB(connector)
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, "select id from tbl where a is null limit 10")
+	wantNoError(t, err)
+	rows.Close()
+	if len(scans) != 1 {
+		t.Fatalf("got=%d, want=1", len(scans))
+	}
+	if got, want := *scans[0], (Scan{Table: "tbl", WhereClause: "where a is null limit 10"}); got != want {
+		t.Errorf("got=%+v, want=%+v", got, want)
+	}
+}
+
+func TestInsertUpdateRow(t *testing.T) {
+	type row struct {
+		ID      string `sql:"id"`
+		Name    string
+		Age     *int64   `sql:"age"`
+		Balance *Decimal `sql:"balance"`
+		Ignored string   `sql:"-"`
+		hidden  string
+	}
+	ctx := context.Background()
+	connector := &Connector{SimpleDB: fakesdb.New()}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+
+	age := int64(30)
+	balance := Decimal("12.5")
+	result, err := InsertRow(ctx, db, "tbl", &row{ID: "ID1", Name: "alice", Age: &age, Balance: &balance, Ignored: "x", hidden: "y"})
+	wantNoError(t, err)
+	wantRowsAffected(t, result, 1)
+	_, err = InsertRow(ctx, db, "tbl", &row{ID: "ID1", Name: "alice"})
+	wantErrorMessageContaining(t, err, "duplicate")
+
+	var got struct {
+		name    string
+		age     *int64
+		balance Decimal
+		ignored sql.NullString
+	}
+	err = db.QueryRowContext(ctx, "consistent select name, age, balance, ignored from tbl where id = 'ID1'").
+		Scan(&got.name, &got.age, &got.balance, &got.ignored)
+	wantNoError(t, err)
+	if got.name != "alice" || got.age == nil || *got.age != 30 || got.balance != "12.5" || got.ignored.Valid {
+		t.Errorf("got=%+v", got)
+	}
+
+	result, err = UpdateRow(ctx, db, "tbl", &row{ID: "ID1", Name: "bob"})
+	wantNoError(t, err)
+	wantRowsAffected(t, result, 1)
+	err = db.QueryRowContext(ctx, "consistent select name, age, balance from tbl where id = 'ID1'").
+		Scan(&got.name, &got.age, &got.balance)
+	wantNoError(t, err)
+	if got.name != "bob" || got.age != nil || got.balance != "" {
+		t.Errorf("got=%+v", got)
+	}
+
+	_, err = UpdateRow(ctx, db, "tbl", &row{Name: "bob"})
+	wantErrorMessageContaining(t, err, "missing id for update")
+	_, err = InsertRow(ctx, db, "tbl", &row{Name: "carol"})
+	wantErrorMessageContaining(t, err, "missing id column in insert statement")
+	_, err = InsertRow(ctx, db, "tbl", &struct{ Name string }{Name: "carol"})
+	wantErrorMessageContaining(t, err, "missing field for id column")
+	_, err = InsertRow(ctx, db, "tbl", "carol")
+	wantErrorMessageContaining(t, err, "expect pointer to struct")
+	_, err = InsertRow(ctx, db, "tbl", nil)
+	wantErrorMessageContaining(t, err, "expect pointer to struct, got nil")
+	_, err = UpdateRow(ctx, db, "tbl", nil)
+	wantErrorMessageContaining(t, err, "expect pointer to struct, got nil")
+	_, err = UpdateRow(ctx, db, "tbl", (*row)(nil))
+	wantErrorMessageContaining(t, err, "expect pointer to struct")
+
+	connector.IDGenerator = IDGeneratorFunc(func() (string, error) {
+		return "GEN1", nil
+	})
+	db = sql.OpenDB(connector)
+	defer db.Close()
+	_, err = InsertRow(ctx, db, "tbl", &row{Name: "carol"})
+	wantNoError(t, err)
+	err = db.QueryRowContext(ctx, "consistent select name from tbl where id = 'GEN1'").Scan(&got.name)
+	wantNoError(t, err)
+	if got.name != "carol" {
+		t.Errorf("got=%v, want=carol", got.name)
+	}
+}
+
+func TestColumnDefaults(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	var calls int
+	connector := &Connector{
+		SimpleDB: sdb,
+		ColumnDefaults: map[string]map[string]interface{}{
+			"tbl": {
+				"status":  "new",
+				"count":   int64(0),
+				"price":   Decimal("1.50"),
+				"enabled": true,
+				"seq": func() interface{} {
+					calls++
+					return int64(calls)
+				},
+			},
+			"bad": {
+				"a": struct{}{},
+			},
+		},
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl; create table other; create table bad")
+	wantNoError(t, err)
+
+	_, err = db.ExecContext(ctx, "insert into tbl(id, status) values('ID1', 'old')")
+	wantNoError(t, err)
+	var seq int64
+	err = db.QueryRowContext(ctx, "insert into tbl(id) values('ID2') returning seq").Scan(&seq)
+	wantNoError(t, err)
+	if seq != 2 {
+		t.Errorf("got seq=%d, want 2", seq)
+	}
+
+	want := map[string][]string{
+		"status":      {"old"},
+		"count":       {"0"},
+		"price":       {"000000000000000001.500000000000"},
+		"enabled":     {"true"},
+		"seq":         {"1"},
+		"sql:id":      {"string"},
+		"sql:status":  {"string"},
+		"sql:count":   {"int64"},
+		"sql:price":   {"decimal"},
+		"sql:enabled": {"bool"},
+		"sql:seq":     {"int64"},
+	}
+	if got := sdb.Item("tbl", "ID1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v\nwant=%v", got, want)
+	}
+	var (
+		status string
+		price  Decimal
+	)
+	err = db.QueryRowContext(ctx, "select status, price from tbl where id = 'ID2'").Scan(&status, &price)
+	wantNoError(t, err)
+	if status != "new" || price != "1.5" {
+		t.Errorf("got=%v,%v, want=new,1.5", status, price)
+	}
+
+	// other tables and updates are unchanged
+	_, err = db.ExecContext(ctx, "insert into other(id, a) values('ID1', 'a'); update tbl set a = 'a' where id = 'ID1'")
+	wantNoError(t, err)
+	if got, want := sdb.Item("other", "ID1"), map[string][]string{"a": {"a"}, "sql:id": {"string"}, "sql:a": {"string"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if calls != 2 {
+		t.Errorf("got calls=%d, want 2", calls)
+	}
+
+	_, err = db.ExecContext(ctx, "insert into bad(id) values('ID1')")
+	wantErrorMessageContaining(t, err, "invalid column default")
+}
+
+func TestValidateWrite(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	var writes []map[string]interface{}
+	connector := &Connector{
+		SimpleDB:       sdb,
+		ColumnDefaults: map[string]map[string]interface{}{"tbl": {"status": "new"}},
+		ValidateWrite: func(table string, columns map[string]interface{}) error {
+			if table != "tbl" {
+				t.Errorf("got table=%q, want tbl", table)
+			}
+			writes = append(writes, columns)
+			if n, ok := columns["n"].(int64); ok && n < 0 {
+				return fmt.Errorf("n cannot be negative")
+			}
+			if v, ok := columns["status"]; ok && v == nil {
+				return fmt.Errorf("status is required")
+			}
+			return nil
+		},
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+
+	_, err = db.ExecContext(ctx, "insert into tbl(id, n) values('ID1', ?)", int64(1))
+	wantNoError(t, err)
+	_, err = db.ExecContext(ctx, "insert into tbl(id, n) values('ID2', ?)", int64(-1))
+	wantErrorMessageContaining(t, err, "write is not valid table=tbl: n cannot be negative")
+	if item := sdb.Item("tbl", "ID2"); item != nil {
+		t.Errorf("got=%v, want no item", item)
+	}
+	_, err = db.ExecContext(ctx, "update tbl set status = ? where id = 'ID1'", nil)
+	wantErrorMessageContaining(t, err, "status is required")
+	_, err = db.ExecContext(ctx, "insert into tbl(id, n) values('ID1', 2) on duplicate key update n = ?", int64(-2))
+	wantErrorMessageContaining(t, err, "n cannot be negative")
+	_, err = db.ExecContext(ctx, "update tbl set n = 3 where id in (select id from tbl where n = '1')")
+	wantNoError(t, err)
+
+	w := connector.NewTableWriter("tbl")
+	err = w.Add(ctx, map[string]interface{}{"id": "ID3", "n": int64(-3)})
+	wantErrorMessageContaining(t, err, "n cannot be negative")
+	err = w.Add(ctx, map[string]interface{}{"id": "ID3", "n": int64(3)})
+	wantNoError(t, err)
+	wantNoError(t, w.Flush(ctx))
+
+	opts := &LoadOptions{Format: LoadJSON}
+	_, err = connector.Load(ctx, strings.NewReader(`{"id":"ID4","n":-4}`), "tbl", opts)
+	wantErrorMessageContaining(t, err, "n cannot be negative")
+	if item := sdb.Item("tbl", "ID4"); item != nil {
+		t.Errorf("got=%v, want no item", item)
+	}
+	opts.SkipValidation = true
+	_, err = connector.Load(ctx, strings.NewReader(`{"id":"ID4","n":-4}`), "tbl", opts)
+	wantNoError(t, err)
+
+	want := []map[string]interface{}{
+		{"id": "ID1", "n": int64(1), "status": "new"},
+		{"id": "ID2", "n": int64(-1), "status": "new"},
+		{"id": "ID1", "status": nil},
+		{"id": "ID1", "n": "2", "status": "new"},
+		{"id": "ID1", "n": int64(-2)},
+		{"n": "3"},
+		{"id": "ID3", "n": int64(-3)},
+		{"id": "ID3", "n": int64(3)},
+		{"id": "ID4", "n": int64(-4)},
+	}
+	if !reflect.DeepEqual(writes, want) {
+		t.Errorf("got=%v\nwant=%v", writes, want)
+	}
+}
+
+// applyOptionsAPI is a fake SimpleDB API that applies the options
+// of each request, as the AWS SDK does.
+type applyOptionsAPI struct {
+	*fakesdb.DB
+}
+
+func (api *applyOptionsAPI) apply(operation string, opts []request.Option) {
+	r := &request.Request{Operation: &request.Operation{Name: operation}}
+	r.ApplyOptions(opts...)
+}
+
+func (api *applyOptionsAPI) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	api.apply("Select", opts)
+	return api.DB.SelectWithContext(ctx, input, opts...)
+}
+
+func (api *applyOptionsAPI) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	api.apply("GetAttributes", opts)
+	return api.DB.GetAttributesWithContext(ctx, input, opts...)
+}
+
+func (api *applyOptionsAPI) PutAttributesWithContext(ctx aws.Context, input *simpledb.PutAttributesInput, opts ...request.Option) (*simpledb.PutAttributesOutput, error) {
+	api.apply("PutAttributes", opts)
+	return api.DB.PutAttributesWithContext(ctx, input, opts...)
+}
+
+func TestRequestOptions(t *testing.T) {
+	ctx := context.Background()
+	var operations []string
+	db := sql.OpenDB(&Connector{
+		SimpleDB: &applyOptionsAPI{DB: fakesdb.New()},
+		RequestOptions: []request.Option{
+			func(r *request.Request) {
+				operations = append(operations, r.Operation.Name)
+			},
+		},
+	})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl; insert into tbl(id, a) values('ID1', 'x')")
+	wantNoError(t, err)
+	var a string
+	err = db.QueryRowContext(ctx, "select a from tbl where id = 'ID1'").Scan(&a)
+	wantNoError(t, err)
+	err = db.QueryRowContext(ctx, "select a from tbl where a = 'x'").Scan(&a)
+	wantNoError(t, err)
+
+	want := []string{"PutAttributes", "GetAttributes", "Select"}
+	if !reflect.DeepEqual(operations, want) {
+		t.Errorf("got=%v, want=%v", operations, want)
+	}
+}
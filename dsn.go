@@ -0,0 +1,120 @@
+package simpledbsql
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
+	"github.com/jjeffery/errors"
+)
+
+// sessionConfig contains the settings for an AWS SDK session that the
+// driver constructs itself, from a data source name or a Connector.
+type sessionConfig struct {
+	roleARN         string       // role to assume, if not blank
+	externalID      string       // external id required by the role's trust policy
+	roleSessionName string       // name of the assumed role session
+	httpClient      *http.Client // HTTP client for requests, nil for the default
+}
+
+// parseDSN parses a data source name, which is a URL query string
+// such as "role_arn=arn:aws:iam::123456789012:role/app&external_id=xyz".
+// A blank data source name uses the default settings.
+func parseDSN(name string) (*sessionConfig, error) {
+	values, err := url.ParseQuery(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid data source name")
+	}
+	var cfg sessionConfig
+	var timeout time.Duration
+	var proxy *url.URL
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := values.Get(key)
+		switch key {
+		case "role_arn":
+			cfg.roleARN = value
+		case "external_id":
+			cfg.externalID = value
+		case "session_name":
+			cfg.roleSessionName = value
+		case "timeout":
+			if timeout, err = time.ParseDuration(value); err != nil || timeout <= 0 {
+				return nil, errors.New("invalid timeout").With("timeout", value)
+			}
+		case "proxy":
+			if proxy, err = url.Parse(value); err != nil || proxy.Scheme == "" || proxy.Host == "" {
+				return nil, errors.New("invalid proxy URL").With("proxy", value)
+			}
+		default:
+			return nil, errors.New("unknown data source name parameter").With("param", key)
+		}
+	}
+	if cfg.roleARN == "" && (cfg.externalID != "" || cfg.roleSessionName != "") {
+		return nil, errors.New("external_id and session_name require role_arn")
+	}
+	if timeout > 0 || proxy != nil {
+		cfg.httpClient = newHTTPClient(timeout, proxy)
+	}
+	return &cfg, nil
+}
+
+// newHTTPClient returns an HTTP client with a timeout for each request, if
+// timeout is not zero, which sends requests via a proxy, if proxy is not nil.
+// Otherwise the proxy is obtained from the environment, as for the default
+// HTTP client.
+func newHTTPClient(timeout time.Duration, proxy *url.URL) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if proxy != nil {
+		// same settings as http.DefaultTransport, other than the proxy
+		client.Transport = &http.Transport{
+			Proxy: http.ProxyURL(proxy),
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		}
+	}
+	return client
+}
+
+// newSimpleDB returns a SimpleDB client with a new session, whose region
+// and credentials are obtained from the environment and the ~/.aws/config
+// file. If a role is specified, the client assumes the role.
+func (cfg *sessionConfig) newSimpleDB() (simpledbiface.SimpleDBAPI, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		// the default HTTP client is used if httpClient is nil
+		Config: aws.Config{HTTPClient: cfg.httpClient},
+		// this option obtains the region setting from the ~/.aws/config file
+		// if it is set
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cfg.roleARN == "" {
+		return simpledb.New(sess), nil
+	}
+	creds := stscreds.NewCredentials(sess, cfg.roleARN, func(p *stscreds.AssumeRoleProvider) {
+		if cfg.externalID != "" {
+			p.ExternalID = aws.String(cfg.externalID)
+		}
+		p.RoleSessionName = cfg.roleSessionName
+	})
+	return simpledb.New(sess, aws.NewConfig().WithCredentials(creds)), nil
+}
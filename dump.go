@@ -0,0 +1,207 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/csv"
+	"io"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// Dump writes the result of a select query to w in CSV format.
+//
+// The first record is a header containing the column names. The first column
+// is always "id", and each column selected by the query is followed by a
+// column containing its type metadata, named with the Connector's
+// MetadataPrefix. For example, the query "select name, age from users"
+// produces the header:
+//
+//	id,name,sql:name,age,sql:age
+//
+// Values are written exactly as they are stored in SimpleDB, so a dump
+// preserves the type of every value, including nulls. Types are written
+// to separate columns even if the Connector has PackedMetadata set.
+//
+// Dump retrieves the results one page at a time, so the result does not
+// have to fit in memory. Requests are subject to the rate limits
+// of the Connector.
+func (c *Connector) Dump(ctx context.Context, w io.Writer, query string, args ...interface{}) error {
+	cn, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	q, err := cn.parseCache.parse(query)
+	if err != nil {
+		return err
+	}
+	if q.Select == nil || q.Explain {
+		return errors.New("expect select query for Dump")
+	}
+	if err := checkArgs(q.Placeholders, len(args)); err != nil {
+		return err
+	}
+	values, err := convertArgs(args)
+	if err != nil {
+		return err
+	}
+	selectExpression, err := cn.makeSelectExpression(ctx, q.Select, values)
+	if err != nil {
+		return err
+	}
+	var columns []string
+	for _, columnName := range q.Select.ColumnNames {
+		if !parse.IsID(columnName) {
+			columns = append(columns, columnName)
+		}
+	}
+	input := &simpledb.SelectInput{
+		ConsistentRead:   aws.Bool(q.Select.ConsistentRead),
+		SelectExpression: aws.String(selectExpression),
+	}
+	return cn.dump(ctx, w, columns, input)
+}
+
+// DumpTable writes all items in a table to w in CSV format. The format is
+// the same as for Dump, with a column for every attribute in the domain.
+//
+// Because the columns are not known in advance, DumpTable reads the domain
+// twice: once to determine the columns and once to write the items. Any
+// attribute added to the domain between the two passes is not written.
+func (c *Connector) DumpTable(ctx context.Context, w io.Writer, tableName string) error {
+	cn, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	domainName, err := cn.resolveDomainName(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	newInput := func() *simpledb.SelectInput {
+		return &simpledb.SelectInput{
+			ConsistentRead:   aws.Bool(true),
+			SelectExpression: aws.String("select * from " + quoteIdentifier(domainName)),
+		}
+	}
+
+	columnSet := make(map[string]bool)
+	err = cn.selectPages(ctx, newInput(), func(items []*simpledb.Item) error {
+		for _, item := range items {
+			if isSchemaItem(item) {
+				continue
+			}
+			for _, attr := range item.Attributes {
+				name := derefString(attr.Name)
+				if !cn.meta.isMetadata(name) && !parse.IsID(name) {
+					columnSet[name] = true
+				}
+			}
+			// columns with a type but no value
+			for name := range cn.meta.columnTypes(item.Attributes) {
+				if !parse.IsID(name) {
+					columnSet[name] = true
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot read table").With(
+			"table", tableName,
+			"domain", domainName,
+		)
+	}
+	columns := make([]string, 0, len(columnSet))
+	for name := range columnSet {
+		columns = append(columns, name)
+	}
+	sort.Strings(columns)
+
+	return cn.dump(ctx, w, columns, newInput())
+}
+
+// connect returns a connection for use by the Connector's own methods.
+func (c *Connector) connect(ctx context.Context) (*conn, error) {
+	dc, err := c.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return dc.(*conn), nil
+}
+
+func (c *conn) dump(ctx context.Context, w io.Writer, columns []string, input *simpledb.SelectInput) error {
+	cw := csv.NewWriter(w)
+	header := []string{"id"}
+	for _, column := range columns {
+		header = append(header, column, c.meta.typeAttr(column))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(header))
+	err := c.selectPages(ctx, input, func(items []*simpledb.Item) error {
+		for _, item := range items {
+			if isSchemaItem(item) {
+				continue
+			}
+			attrs := make(map[string]string, len(item.Attributes))
+			for _, attr := range item.Attributes {
+				attrs[derefString(attr.Name)] = derefString(attr.Value)
+			}
+			// types are written unpacked, even when the metadata is packed
+			for columnName, typeName := range c.meta.columnTypes(item.Attributes) {
+				attrs[c.meta.typeAttr(columnName)] = typeName
+			}
+			record[0] = derefString(item.Name)
+			for i, name := range header[1:] {
+				record[i+1] = attrs[name]
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// selectPages calls fn for each page of items returned by a select request.
+func (c *conn) selectPages(ctx context.Context, input *simpledb.SelectInput, fn func(items []*simpledb.Item) error) error {
+	for {
+		output, err := c.SimpleDB.SelectWithContext(ctx, input, requestOptions(ctx)...)
+		if err != nil {
+			return err
+		}
+		if err := fn(output.Items); err != nil {
+			return err
+		}
+		if output.NextToken == nil {
+			return nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// convertArgs converts arguments to the values accepted by the driver, in the
+// same way that the database/sql package does for statement arguments.
+func convertArgs(args []interface{}) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		v, err := convertValue(arg)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid argument").With("index", i)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,214 @@
+// Package dynamodbexport copies SimpleDB items to a DynamoDB table.
+//
+// Items are read using the simpledbsql driver, so their values have the types
+// recorded by the driver when they were written: int64 and float64 values
+// become DynamoDB numbers, bool values become DynamoDB booleans, and so on.
+// This makes the package useful for migrating an application from SimpleDB
+// to DynamoDB.
+package dynamodbexport
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/jjeffery/errors"
+)
+
+// maxBatchItems is the maximum number of items in a BatchWriteItem request.
+const maxBatchItems = 25
+
+// Exporter copies the rows returned by a select query to a DynamoDB table.
+type Exporter struct {
+	// DB is the database handle, opened using the simpledbsql driver.
+	DB *sql.DB
+
+	// DynamoDB is the AWS SDK handle used to write items.
+	DynamoDB dynamodbiface.DynamoDBAPI
+
+	// TableName is the name of the DynamoDB table.
+	TableName string
+
+	// AttributeNames maps column names to DynamoDB attribute names. Columns
+	// that are not in the map keep their names. The item name is in the "id"
+	// column, so map "id" to the name of the table's partition key if it is
+	// not "id".
+	AttributeNames map[string]string
+
+	// MaxRetries is the number of times unprocessed items are resent to
+	// DynamoDB before giving up. Defaults to 5.
+	MaxRetries int
+
+	// Progress, if not nil, is called after each batch of items has been
+	// written, with the total number of items written so far.
+	Progress func(count int)
+}
+
+func (e *Exporter) maxRetries() int {
+	if e.MaxRetries <= 0 {
+		return 5
+	}
+	return e.MaxRetries
+}
+
+func (e *Exporter) attributeName(columnName string) string {
+	if name, ok := e.AttributeNames[columnName]; ok {
+		return name
+	}
+	return columnName
+}
+
+// Export runs a select query and writes each row to the DynamoDB table, and
+// returns the number of items written. The query must select the id column,
+// eg "select id, name, age from users".
+//
+// Null values are not written, as DynamoDB items have no fixed set of
+// attributes. Time values are written as strings in RFC3339 format.
+// If an error occurs, the items in batches prior to the error remain written.
+func (e *Exporter) Export(ctx context.Context, query string, args ...interface{}) (int, error) {
+	rows, err := e.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	var hasID bool
+	for _, column := range columns {
+		if column == "id" {
+			hasID = true
+		}
+	}
+	if !hasID {
+		return 0, errors.New("query must select the id column")
+	}
+
+	var (
+		count    int
+		requests []*dynamodb.WriteRequest
+	)
+	flush := func() error {
+		if len(requests) == 0 {
+			return nil
+		}
+		if err := e.batchWrite(ctx, requests); err != nil {
+			return errors.Wrap(err, "cannot write items").With(
+				"table", e.TableName,
+				"count", count,
+			)
+		}
+		count += len(requests)
+		requests = nil
+		if e.Progress != nil {
+			e.Progress(count)
+		}
+		return nil
+	}
+
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return count, err
+		}
+		item := make(map[string]*dynamodb.AttributeValue, len(columns))
+		for i, column := range columns {
+			av, err := attributeValue(values[i])
+			if err != nil {
+				return count, errors.Wrap(err, "cannot convert value").With("column", column)
+			}
+			if av != nil {
+				item[e.attributeName(column)] = av
+			}
+		}
+		requests = append(requests, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{Item: item},
+		})
+		if len(requests) == maxBatchItems {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	if err := flush(); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+// batchWrite sends a BatchWriteItem request, and resends any unprocessed
+// items with an exponential backoff.
+func (e *Exporter) batchWrite(ctx context.Context, requests []*dynamodb.WriteRequest) error {
+	backoff := 100 * time.Millisecond
+	for retry := 0; ; retry++ {
+		input := &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{
+				e.TableName: requests,
+			},
+		}
+		output, err := e.DynamoDB.BatchWriteItemWithContext(ctx, input)
+		if err != nil {
+			if !hasCode(err, dynamodb.ErrCodeProvisionedThroughputExceededException) {
+				return err
+			}
+		} else {
+			requests = output.UnprocessedItems[e.TableName]
+			if len(requests) == 0 {
+				return nil
+			}
+		}
+		if retry >= e.maxRetries() {
+			if err != nil {
+				return err
+			}
+			return errors.New("items not processed").With("unprocessed", len(requests))
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// attributeValue converts a value returned by the simpledbsql driver to
+// a DynamoDB attribute value, or nil for a null value.
+func attributeValue(v interface{}) (*dynamodb.AttributeValue, error) {
+	switch val := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return &dynamodb.AttributeValue{S: aws.String(val)}, nil
+	case int64:
+		return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(val, 10))}, nil
+	case float64:
+		return &dynamodb.AttributeValue{N: aws.String(strconv.FormatFloat(val, 'g', -1, 64))}, nil
+	case bool:
+		return &dynamodb.AttributeValue{BOOL: aws.Bool(val)}, nil
+	case time.Time:
+		return &dynamodb.AttributeValue{S: aws.String(val.Format(time.RFC3339Nano))}, nil
+	case []byte:
+		return &dynamodb.AttributeValue{B: val}, nil
+	}
+	return nil, errors.New("unsupported value type")
+}
+
+func hasCode(err error, code string) bool {
+	if coder, ok := err.(interface{ Code() string }); ok {
+		return code == coder.Code()
+	}
+	return false
+}
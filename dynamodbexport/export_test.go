@@ -0,0 +1,104 @@
+package dynamodbexport
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/jjeffery/simpledbsql"
+	"github.com/jjeffery/simpledbsql/internal/fakesdb"
+)
+
+// fakeDynamoDB records the items written, and leaves the first
+// item of the first request unprocessed.
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	calls int
+	items []map[string]*dynamodb.AttributeValue
+}
+
+func (api *fakeDynamoDB) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	api.calls++
+	output := &dynamodb.BatchWriteItemOutput{}
+	for tableName, requests := range input.RequestItems {
+		if api.calls == 1 {
+			output.UnprocessedItems = map[string][]*dynamodb.WriteRequest{
+				tableName: requests[:1],
+			}
+			requests = requests[1:]
+		}
+		for _, req := range requests {
+			api.items = append(api.items, req.PutRequest.Item)
+		}
+	}
+	return output, nil
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&simpledbsql.Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{query: "create table users"},
+		{query: "insert into users(id, name, age, admin, note) values(?, ?, ?, ?, ?)", args: []interface{}{"U1", "alice", int64(30), true, nil}},
+		{query: "insert into users(id, name, age, admin, note) values(?, ?, ?, ?, ?)", args: []interface{}{"U2", "bob", 1.5, false, "x"}},
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ddb := &fakeDynamoDB{}
+	var progress []int
+	exporter := Exporter{
+		DB:             db,
+		DynamoDB:       ddb,
+		TableName:      "Users",
+		AttributeNames: map[string]string{"id": "UserID"},
+		Progress:       func(count int) { progress = append(progress, count) },
+	}
+	count, err := exporter.Export(ctx, "select id, name, age, admin, note from users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := count, 2; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := ddb.calls, 2; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := progress, []int{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	want := []map[string]*dynamodb.AttributeValue{
+		{
+			"UserID": {S: aws.String("U2")},
+			"name":   {S: aws.String("bob")},
+			"age":    {N: aws.String("1.5")},
+			"admin":  {BOOL: aws.Bool(false)},
+			"note":   {S: aws.String("x")},
+		},
+		{
+			"UserID": {S: aws.String("U1")},
+			"name":   {S: aws.String("alice")},
+			"age":    {N: aws.String("30")},
+			"admin":  {BOOL: aws.Bool(true)},
+		},
+	}
+	if got := ddb.items; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	if _, err := exporter.Export(ctx, "select name from users"); err == nil {
+		t.Errorf("expected error")
+	}
+}
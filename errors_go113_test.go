@@ -0,0 +1,148 @@
+//go:build go1.13
+// +build go1.13
+
+package simpledbsql
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/simpledbsql/internal/fakesdb"
+)
+
+// canceledAPI is a fake SimpleDB API that fails requests with a
+// RequestCanceled error if their context is done, as the AWS SDK does.
+type canceledAPI struct {
+	*fakesdb.DB
+}
+
+func (api *canceledAPI) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, awserr.New(request.CanceledErrorCode, "request context canceled", err)
+	}
+	return api.DB.SelectWithContext(ctx, input, opts...)
+}
+
+func (api *canceledAPI) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, awserr.New(request.CanceledErrorCode, "request context canceled", err)
+	}
+	return api.DB.GetAttributesWithContext(ctx, input, opts...)
+}
+
+func TestErrorsIsAs(t *testing.T) {
+	db := sql.OpenDB(&Connector{SimpleDB: &canceledAPI{DB: fakesdb.New()}})
+	defer db.Close()
+	testErrorsIsAs(t, db)
+
+	// connections opened by the driver wrap errors in the same way
+	db = openDriverDB(t, &canceledAPI{DB: fakesdb.New()})
+	defer db.Close()
+	testErrorsIsAs(t, db)
+}
+
+func testErrorsIsAs(t *testing.T, db *sql.DB) {
+	_, err := db.ExecContext(context.Background(), "create table tbl")
+	wantNoError(t, err)
+
+	// the connection is opened before the context is canceled
+	conn, err := db.Conn(context.Background())
+	wantNoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, query := range []string{
+		"select id, a from tbl where a = 'aaa'",
+		"select id, a from tbl where id = 'ID1'",
+	} {
+		var id, a string
+		err = conn.QueryRowContext(ctx, query).Scan(&id, &a)
+		if !stderrors.Is(err, context.Canceled) {
+			t.Errorf("%s: got=%v, want context.Canceled", query, err)
+		}
+	}
+
+	// errors returned by SimpleDB are available with errors.As
+	_, err = db.QueryContext(context.Background(), "select id from missing_tbl")
+	var awsErr awserr.Error
+	if !stderrors.As(err, &awsErr) {
+		t.Fatalf("got=%v, want awserr.Error", err)
+	}
+	if got, want := awsErr.Code(), "NoSuchDomain"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	// and for canceled requests
+	_, err = conn.QueryContext(ctx, "select id from tbl where a = 'aaa'")
+	if !stderrors.As(err, &awsErr) {
+		t.Fatalf("got=%v, want awserr.Error", err)
+	}
+	if got, want := awsErr.Code(), request.CanceledErrorCode; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+// slowPageAPI is a fake SimpleDB API whose Select requests for pages
+// after the first do not complete until their context is done.
+type slowPageAPI struct {
+	*fakesdb.DB
+}
+
+func (api *slowPageAPI) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	if input.NextToken != nil {
+		<-ctx.Done()
+		return nil, awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+	}
+	return api.DB.SelectWithContext(ctx, input, opts...)
+}
+
+func TestPartialResults(t *testing.T) {
+	for _, partialResults := range []bool{false, true} {
+		sdb := fakesdb.New()
+		db := sql.OpenDB(&Connector{
+			SimpleDB:         &slowPageAPI{DB: sdb},
+			StatementTimeout: 20 * time.Millisecond,
+			PartialResults:   partialResults,
+		})
+		defer db.Close()
+		ctx := context.Background()
+		_, err := db.ExecContext(ctx, "create table tbl")
+		wantNoError(t, err)
+		for _, id := range []string{"ID1", "ID2", "ID3"} {
+			_, err = db.ExecContext(ctx, "insert into tbl(id, a) values(?, 'aaa')", id)
+			wantNoError(t, err)
+		}
+
+		var stats QueryStats
+		rows, err := db.QueryContext(WithQueryStats(ctx, &stats), "select id from tbl where a = 'aaa' limit 2")
+		wantNoError(t, err)
+		var count int
+		for rows.Next() {
+			count++
+		}
+		err = rows.Err()
+		rows.Close()
+		if got, want := count, 2; got != want {
+			t.Errorf("%v: got=%v, want=%v", partialResults, got, want)
+		}
+		if !stderrors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%v: got=%v, want context.DeadlineExceeded", partialResults, err)
+		}
+		if got, want := stderrors.Is(err, ErrPartialResult), partialResults; got != want {
+			t.Errorf("%v: got=%v, want=%v", partialResults, got, want)
+		}
+		for _, s := range []string{"select deadline exceeded", "page=2", "rows=2", "limit 2"} {
+			wantErrorMessageContaining(t, err, s)
+		}
+		if got, want := stats.DeadlinesExceeded(), 1; got != want {
+			t.Errorf("%v: got=%v, want=%v", partialResults, got, want)
+		}
+	}
+}
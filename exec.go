@@ -0,0 +1,33 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/jjeffery/errors"
+)
+
+// Exec runs a query that does not return rows, such as an insert, update or
+// delete statement, without the database/sql package, and returns the number
+// of rows affected. It runs the query in the same way as the ExecContext
+// method of a sql.DB opened with the Connector, and converts the arguments
+// in the same way, but without the overhead of a connection pool. Programs
+// that read rows without database/sql use QueryMaps or QueryPage.
+func (c *Connector) Exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	cn, err := c.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	values := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+		if err := cn.CheckNamedValue(&values[i]); err != nil {
+			return 0, errors.Wrap(err, "invalid argument").With("index", i)
+		}
+	}
+	result, err := cn.ExecContext(ctx, query, values)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,441 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// explainColumns are the columns returned by an explain query.
+// Operations with the same step number are sent concurrently.
+var explainColumns = []string{"step", "operation", "domain", "item_name", "detail"}
+
+// explainRows builds the rows returned by an explain query.
+type explainRows struct {
+	rows valueRows
+	step int64
+}
+
+func newExplainRows() *explainRows {
+	return &explainRows{
+		rows: valueRows{
+			columns: explainColumns,
+		},
+	}
+}
+
+// nextStep increments the step number for subsequent operations.
+func (er *explainRows) nextStep() {
+	er.step++
+}
+
+func (er *explainRows) add(operation string, domainName *string, itemName *string, details ...string) {
+	var details2 []string
+	for _, detail := range details {
+		if detail != "" {
+			details2 = append(details2, detail)
+		}
+	}
+	var item driver.Value
+	if itemName != nil {
+		item = *itemName
+	}
+	er.rows.values = append(er.rows.values, []driver.Value{
+		er.step,
+		operation,
+		derefString(domainName),
+		item,
+		strings.Join(details2, "; "),
+	})
+}
+
+// explain returns rows describing the SimpleDB API operations that
+// would be performed for the query, without performing them.
+func (c *conn) explain(ctx context.Context, q *parse.Query, args []driver.Value) (driver.Rows, error) {
+	q, args, err := c.completeInsert(q, args)
+	if err != nil {
+		return nil, err
+	}
+	er := newExplainRows()
+	er.nextStep()
+
+	switch {
+	case q.Select != nil && q.Select.Key != nil:
+		input, err := c.newGetAttributesInput(ctx, q.Select, args)
+		if err != nil {
+			return nil, err
+		}
+		er.add("GetAttributes", input.DomainName, input.ItemName,
+			"fast path for item name lookup",
+			describeConsistentRead(input.ConsistentRead),
+			describeAttributeNames(input.AttributeNames),
+			describeAggregates(q.Select),
+		)
+		if (c.retryMissingItems || q.Select.ExpectRows) && !aws.BoolValue(input.ConsistentRead) {
+			er.nextStep()
+			er.add("GetAttributes", input.DomainName, input.ItemName,
+				"only if previous step finds no item",
+				describeConsistentRead(aws.Bool(true)),
+				describeAttributeNames(input.AttributeNames),
+			)
+		}
+	case q.Select != nil:
+		queries, err := splitInList(q.Select)
+		if err != nil {
+			return nil, err
+		}
+		for i, query := range queries {
+			selectExpression, err := c.makeSelectExpression(ctx, query, args)
+			if err != nil {
+				return nil, err
+			}
+			if i > 0 {
+				er.nextStep()
+			}
+			batch := ""
+			if len(queries) > 1 {
+				batch = "batch " + strconv.Itoa(i+1) + " of " + strconv.Itoa(len(queries)) + " of long in list"
+				if parseOrderBy(query.WhereClause).column != "" {
+					batch += ", merged in order"
+				}
+			}
+			er.add("Select", nil, nil,
+				selectExpression,
+				describeConsistentRead(&q.Select.ConsistentRead),
+				"repeated while NextToken is returned",
+				batch,
+				describeAggregates(q.Select),
+			)
+			if len(queries) == 1 && q.Select.ExpectRows && !q.Select.ConsistentRead {
+				er.nextStep()
+				er.add("Select", nil, nil,
+					selectExpression,
+					"only if previous step finds no rows",
+					describeConsistentRead(aws.Bool(true)),
+					"repeated while NextToken is returned",
+				)
+			}
+		}
+	case q.Insert != nil:
+		putInput, err := c.newInsertInput(ctx, q.Insert, args)
+		if err != nil {
+			return nil, err
+		}
+		condition := describeUpdateCondition(putInput.Expected)
+		if c.meta.raw {
+			er.addExistsCheck(putInput.DomainName, putInput.ItemName)
+			condition = "only if item does not exist"
+		}
+		var ignore string
+		if q.Insert.Ignore {
+			ignore = "duplicate key ignored"
+		}
+		er.add("PutAttributes", putInput.DomainName, putInput.ItemName,
+			describePutAttributes(putInput.Attributes),
+			condition,
+			ignore,
+		)
+		if q.Insert.OnDuplicateKeyUpdate != nil {
+			er.nextStep()
+			condition = "only if previous step fails with " + conditionalCheckFailed
+			if c.meta.raw {
+				condition = "only if item exists"
+			}
+			if err := c.explainUpdate(ctx, er, newDuplicateKeyUpdateQuery(q.Insert), args, condition); err != nil {
+				return nil, err
+			}
+		}
+	case q.Update != nil && q.Update.Subquery != nil:
+		if err := c.explainBulkUpdate(ctx, er, q.Update, args); err != nil {
+			return nil, err
+		}
+	case q.Delete != nil && q.Delete.Subquery != nil:
+		domainName, err := c.resolveDomainName(ctx, q.Delete.TableName)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.explainSubquery(ctx, er, q.Delete.Subquery, q.Delete.SubqueryArgs, args); err != nil {
+			return nil, err
+		}
+		er.add("BatchDeleteAttributes", &domainName, nil,
+			"all attributes",
+			describeBatches(),
+		)
+	case q.Update != nil:
+		if err := c.explainUpdate(ctx, er, q.Update, args); err != nil {
+			return nil, err
+		}
+	case q.Delete != nil:
+		deleteInput, err := c.newDeleteInput(ctx, q.Delete, args)
+		if err != nil {
+			return nil, err
+		}
+		er.add("DeleteAttributes", deleteInput.DomainName, deleteInput.ItemName,
+			"all attributes",
+			describeUpdateCondition(deleteInput.Expected),
+		)
+	case q.CreateTable != nil:
+		domainName, err := c.resolveDomainName(ctx, q.CreateTable.TableName)
+		if err != nil {
+			return nil, err
+		}
+		if q.CreateTable.IfNotExists && c.domains != nil {
+			er.add("ListDomains", nil, nil, "unless domain names are cached")
+			er.nextStep()
+			er.add("CreateDomain", &domainName, nil, "only if domain is not listed")
+			break
+		}
+		er.add("CreateDomain", &domainName, nil)
+	case q.DropTable != nil:
+		domainName, err := c.resolveDomainName(ctx, q.DropTable.TableName)
+		if err != nil {
+			return nil, err
+		}
+		er.add("DeleteDomain", &domainName, nil)
+	case q.ShowTables != nil:
+		er.add("ListDomains", nil, nil,
+			"unless domain names are cached",
+			"repeated while NextToken is returned",
+		)
+	case q.ShowColumns != nil:
+		input, err := c.newShowColumnsInput(ctx, q.ShowColumns)
+		if err != nil {
+			return nil, err
+		}
+		detail := "repeated while NextToken is returned"
+		if q.ShowColumns.Limit > 0 {
+			detail = "repeated until " + strconv.Itoa(q.ShowColumns.Limit) + " items are sampled"
+		}
+		er.add("Select", nil, nil,
+			derefString(input.SelectExpression),
+			detail,
+		)
+	default:
+		return nil, errors.New("unsupported query for explain")
+	}
+
+	return &er.rows, nil
+}
+
+func (c *conn) explainUpdate(ctx context.Context, er *explainRows, q *parse.UpdateQuery, args []driver.Value, details ...string) error {
+	putInput, deleteInput, err := c.newUpdateInputs(ctx, q, args)
+	if err != nil {
+		return err
+	}
+	if c.meta.checksum {
+		return c.explainChecksumUpdate(er, putInput, deleteInput, details...)
+	}
+	if c.meta.packed {
+		return c.explainPackedUpdate(er, putInput, deleteInput, details...)
+	}
+	if c.meta.raw && !q.Upsert {
+		er.addExistsCheck(putInput.DomainName, putInput.ItemName, details...)
+	}
+	if c.meta.txn && len(putInput.Attributes) > 0 && len(deleteInput.Attributes) > 0 {
+		return c.explainTwoPhaseUpdate(er, putInput, deleteInput, details...)
+	}
+	if len(putInput.Attributes) > 0 {
+		er.add("PutAttributes", putInput.DomainName, putInput.ItemName, append([]string{
+			describePutAttributes(putInput.Attributes),
+			describeUpdateCondition(putInput.Expected),
+		}, details...)...)
+	}
+	if len(deleteInput.Attributes) > 0 {
+		er.add("DeleteAttributes", deleteInput.DomainName, deleteInput.ItemName, append([]string{
+			describeDeleteAttributes(deleteInput.Attributes),
+			describeUpdateCondition(deleteInput.Expected),
+		}, details...)...)
+	}
+	return nil
+}
+
+// explainBulkUpdate describes the operations of bulkUpdate.
+func (c *conn) explainBulkUpdate(ctx context.Context, er *explainRows, q *parse.UpdateQuery, args []driver.Value) error {
+	putInput, deleteInput, err := c.newPutDeleteInputs(ctx, q.TableName, q.Columns, parse.Key{Value: aws.String("")}, args)
+	if err != nil {
+		return err
+	}
+	if err := c.explainSubquery(ctx, er, q.Subquery, q.SubqueryArgs, args); err != nil {
+		return err
+	}
+	if len(putInput.Attributes) > 0 {
+		er.add("BatchPutAttributes", putInput.DomainName, nil,
+			describePutAttributes(putInput.Attributes),
+			describeBatches(),
+		)
+		er.nextStep()
+	}
+	if len(deleteInput.Attributes) > 0 {
+		er.add("BatchDeleteAttributes", deleteInput.DomainName, nil,
+			describeDeleteAttributes(deleteInput.Attributes),
+			describeBatches(),
+		)
+	}
+	return nil
+}
+
+// explainSubquery describes the select request of the subquery of an update
+// or delete statement, and increments the step number for subsequent operations.
+func (c *conn) explainSubquery(ctx context.Context, er *explainRows, q *parse.SelectQuery, ordinal int, args []driver.Value) error {
+	if ordinal > len(args) {
+		return errors.New("not enough args for select query")
+	}
+	selectExpression, err := c.makeSelectExpression(ctx, q, args[ordinal:])
+	if err != nil {
+		return err
+	}
+	er.add("Select", nil, nil,
+		selectExpression,
+		describeConsistentRead(aws.Bool(true)),
+		"repeated while NextToken is returned",
+	)
+	er.nextStep()
+	return nil
+}
+
+func describeBatches() string {
+	return "repeated for each batch of " + strconv.Itoa(maxBatchItems) + " selected items"
+}
+
+// addExistsCheck describes the read that checks whether a raw item exists,
+// and increments the step number for subsequent operations.
+func (er *explainRows) addExistsCheck(domainName *string, itemName *string, details ...string) {
+	er.add("GetAttributes", domainName, itemName, append([]string{
+		"check whether item exists",
+		describeConsistentRead(aws.Bool(true)),
+		describeAttributeNames(nil),
+	}, details...)...)
+	er.nextStep()
+}
+
+// explainPackedUpdate describes the operations of updatePackedRow.
+func (c *conn) explainPackedUpdate(er *explainRows, putInput *simpledb.PutAttributesInput, deleteInput *simpledb.DeleteAttributesInput, details ...string) error {
+	attrs, err := c.meta.pack(putInput.Attributes, "")
+	if err != nil {
+		return err
+	}
+	er.add("GetAttributes", putInput.DomainName, putInput.ItemName, append([]string{
+		"read packed types",
+		describeConsistentRead(aws.Bool(true)),
+		describeAttributeNames(aws.StringSlice([]string{c.meta.packedAttr()})),
+	}, details...)...)
+	er.nextStep()
+	er.add("PutAttributes", putInput.DomainName, putInput.ItemName, append([]string{
+		describePutAttributes(attrs),
+		"packed types merged with those read",
+		"expected: " + quoteIdentifier(c.meta.packedAttr()) + " unchanged",
+	}, details...)...)
+	if len(deleteInput.Attributes) > 0 {
+		er.nextStep()
+		er.add("DeleteAttributes", deleteInput.DomainName, deleteInput.ItemName, append([]string{
+			describeDeleteAttributes(deleteInput.Attributes),
+		}, details...)...)
+	}
+	return nil
+}
+
+// explainChecksumUpdate describes the operations of updateChecksumRow.
+func (c *conn) explainChecksumUpdate(er *explainRows, putInput *simpledb.PutAttributesInput, deleteInput *simpledb.DeleteAttributesInput, details ...string) error {
+	attrs, err := c.meta.pack(putInput.Attributes, "")
+	if err != nil {
+		return err
+	}
+	er.add("GetAttributes", putInput.DomainName, putInput.ItemName, append([]string{
+		"read item for checksum",
+		describeConsistentRead(aws.Bool(true)),
+		describeAttributeNames(nil),
+	}, details...)...)
+	er.nextStep()
+	er.add("PutAttributes", putInput.DomainName, putInput.ItemName, append([]string{
+		describePutAttributes(attrs),
+		"checksum of item merged with update",
+		"expected: " + quoteIdentifier(c.meta.checksumAttr()) + " unchanged",
+	}, details...)...)
+	if len(deleteInput.Attributes) > 0 {
+		er.nextStep()
+		er.add("DeleteAttributes", deleteInput.DomainName, deleteInput.ItemName, append([]string{
+			describeDeleteAttributes(deleteInput.Attributes),
+		}, details...)...)
+	}
+	return nil
+}
+
+// explainTwoPhaseUpdate describes the operations of updateTwoPhaseRow.
+func (c *conn) explainTwoPhaseUpdate(er *explainRows, putInput *simpledb.PutAttributesInput, deleteInput *simpledb.DeleteAttributesInput, details ...string) error {
+	marker, err := c.meta.pendingMarker(deleteInput.Attributes)
+	if err != nil {
+		return err
+	}
+	attrs := append(putInput.Attributes[:len(putInput.Attributes):len(putInput.Attributes)], marker)
+	er.add("PutAttributes", putInput.DomainName, putInput.ItemName, append([]string{
+		describePutAttributes(attrs),
+		describeUpdateCondition(putInput.Expected),
+	}, details...)...)
+	er.nextStep()
+	deleted := append(deleteInput.Attributes[:len(deleteInput.Attributes):len(deleteInput.Attributes)], &simpledb.DeletableAttribute{
+		Name: marker.Name,
+	})
+	er.add("DeleteAttributes", deleteInput.DomainName, deleteInput.ItemName, append([]string{
+		describeDeleteAttributes(deleted),
+		"expected: " + quoteIdentifier(c.meta.txnAttr()) + " unchanged",
+	}, details...)...)
+	return nil
+}
+
+func describeConsistentRead(consistentRead *bool) string {
+	if consistentRead != nil && *consistentRead {
+		return "consistent read"
+	}
+	return "eventually consistent read"
+}
+
+func describeAttributeNames(names []*string) string {
+	if len(names) == 0 {
+		return "attributes: all"
+	}
+	return "attributes: " + joinStrings(names)
+}
+
+func describePutAttributes(attrs []*simpledb.ReplaceableAttribute) string {
+	var list []string
+	for _, attr := range attrs {
+		list = append(list, quoteIdentifier(derefString(attr.Name))+" = "+quoteString(derefString(attr.Value)))
+	}
+	return "put: " + strings.Join(list, ", ")
+}
+
+func describeDeleteAttributes(attrs []*simpledb.DeletableAttribute) string {
+	var list []string
+	for _, attr := range attrs {
+		list = append(list, quoteIdentifier(derefString(attr.Name)))
+	}
+	return "delete: " + strings.Join(list, ", ")
+}
+
+func describeUpdateCondition(cond *simpledb.UpdateCondition) string {
+	if cond == nil {
+		return ""
+	}
+	name := quoteIdentifier(derefString(cond.Name))
+	if cond.Exists != nil && !*cond.Exists {
+		return "expected: " + name + " does not exist"
+	}
+	if cond.Value != nil {
+		return "expected: " + name + " = " + quoteString(*cond.Value)
+	}
+	return "expected: " + name + " exists"
+}
+
+func joinStrings(list []*string) string {
+	strs := make([]string, 0, len(list))
+	for _, s := range list {
+		strs = append(strs, derefString(s))
+	}
+	return strings.Join(strs, ", ")
+}
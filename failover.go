@@ -0,0 +1,150 @@
+package simpledbsql
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
+	"github.com/jjeffery/errors"
+)
+
+// checks that the wrapper implements the SimpleDBAPI interface
+var _ simpledbiface.SimpleDBAPI = (*failoverAPI)(nil)
+
+// failoverCodes are the error codes of failed requests that are sent to the
+// secondary SimpleDB, because the primary SimpleDB or the network to it
+// is unavailable.
+var failoverCodes = []string{
+	"ServiceUnavailable",
+	"InternalError",
+	"RequestError",
+	request.ErrCodeResponseTimeout,
+}
+
+// isFailover returns true if a failed request is sent to the secondary SimpleDB.
+func isFailover(ctx aws.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	for _, code := range failoverCodes {
+		if hasCode(err, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// failoverAPI sends read requests to the secondary SimpleDB, usually in
+// another region, when the primary SimpleDB fails. A select request for a
+// subsequent page is not sent to the secondary, because its next token is
+// only valid for the primary. If dualWrite is true, requests that modify
+// SimpleDB are sent to the secondary after they succeed with the primary.
+// The update conditions of requests sent to the secondary are removed,
+// because they have been checked by the primary.
+type failoverAPI struct {
+	simpledbiface.SimpleDBAPI
+	secondary simpledbiface.SimpleDBAPI
+	dualWrite bool
+}
+
+// secondaryError returns the error of a request to the secondary SimpleDB
+// that modifies SimpleDB after the request to the primary succeeded.
+func secondaryError(err error, operation string) error {
+	return errors.Wrap(err, "cannot write to secondary").With(
+		"operation", operation,
+	)
+}
+
+func (api *failoverAPI) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	output, err := api.SimpleDBAPI.SelectWithContext(ctx, input, opts...)
+	if isFailover(ctx, err) && input.NextToken == nil {
+		return api.secondary.SelectWithContext(ctx, input, opts...)
+	}
+	return output, err
+}
+
+func (api *failoverAPI) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.GetAttributesWithContext(ctx, input, opts...)
+	if isFailover(ctx, err) {
+		return api.secondary.GetAttributesWithContext(ctx, input, opts...)
+	}
+	return output, err
+}
+
+func (api *failoverAPI) ListDomainsWithContext(ctx aws.Context, input *simpledb.ListDomainsInput, opts ...request.Option) (*simpledb.ListDomainsOutput, error) {
+	output, err := api.SimpleDBAPI.ListDomainsWithContext(ctx, input, opts...)
+	if isFailover(ctx, err) && input.NextToken == nil {
+		return api.secondary.ListDomainsWithContext(ctx, input, opts...)
+	}
+	return output, err
+}
+
+func (api *failoverAPI) PutAttributesWithContext(ctx aws.Context, input *simpledb.PutAttributesInput, opts ...request.Option) (*simpledb.PutAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.PutAttributesWithContext(ctx, input, opts...)
+	if err != nil || !api.dualWrite {
+		return output, err
+	}
+	secondaryInput := *input
+	secondaryInput.Expected = nil
+	if _, err := api.secondary.PutAttributesWithContext(ctx, &secondaryInput, opts...); err != nil {
+		return nil, secondaryError(err, "PutAttributes")
+	}
+	return output, nil
+}
+
+func (api *failoverAPI) DeleteAttributesWithContext(ctx aws.Context, input *simpledb.DeleteAttributesInput, opts ...request.Option) (*simpledb.DeleteAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.DeleteAttributesWithContext(ctx, input, opts...)
+	if err != nil || !api.dualWrite {
+		return output, err
+	}
+	secondaryInput := *input
+	secondaryInput.Expected = nil
+	if _, err := api.secondary.DeleteAttributesWithContext(ctx, &secondaryInput, opts...); err != nil {
+		return nil, secondaryError(err, "DeleteAttributes")
+	}
+	return output, nil
+}
+
+func (api *failoverAPI) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.BatchPutAttributesWithContext(ctx, input, opts...)
+	if err != nil || !api.dualWrite {
+		return output, err
+	}
+	if _, err := api.secondary.BatchPutAttributesWithContext(ctx, input, opts...); err != nil {
+		return nil, secondaryError(err, "BatchPutAttributes")
+	}
+	return output, nil
+}
+
+func (api *failoverAPI) BatchDeleteAttributesWithContext(ctx aws.Context, input *simpledb.BatchDeleteAttributesInput, opts ...request.Option) (*simpledb.BatchDeleteAttributesOutput, error) {
+	output, err := api.SimpleDBAPI.BatchDeleteAttributesWithContext(ctx, input, opts...)
+	if err != nil || !api.dualWrite {
+		return output, err
+	}
+	if _, err := api.secondary.BatchDeleteAttributesWithContext(ctx, input, opts...); err != nil {
+		return nil, secondaryError(err, "BatchDeleteAttributes")
+	}
+	return output, nil
+}
+
+func (api *failoverAPI) CreateDomainWithContext(ctx aws.Context, input *simpledb.CreateDomainInput, opts ...request.Option) (*simpledb.CreateDomainOutput, error) {
+	output, err := api.SimpleDBAPI.CreateDomainWithContext(ctx, input, opts...)
+	if err != nil || !api.dualWrite {
+		return output, err
+	}
+	if _, err := api.secondary.CreateDomainWithContext(ctx, input, opts...); err != nil {
+		return nil, secondaryError(err, "CreateDomain")
+	}
+	return output, nil
+}
+
+func (api *failoverAPI) DeleteDomainWithContext(ctx aws.Context, input *simpledb.DeleteDomainInput, opts ...request.Option) (*simpledb.DeleteDomainOutput, error) {
+	output, err := api.SimpleDBAPI.DeleteDomainWithContext(ctx, input, opts...)
+	if err != nil || !api.dualWrite {
+		return output, err
+	}
+	if _, err := api.secondary.DeleteDomainWithContext(ctx, input, opts...); err != nil {
+		return nil, secondaryError(err, "DeleteDomain")
+	}
+	return output, nil
+}
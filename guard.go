@@ -0,0 +1,68 @@
+package simpledbsql
+
+import (
+	"time"
+
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// selectGuard limits the number of pages and rows fetched by a select
+// statement, and records its progress for deadlineError. A nil guard has
+// no limits.
+type selectGuard struct {
+	maxRows  int
+	maxPages int
+	rows     int
+	pages    int
+
+	start          time.Time
+	statement      string // redacted select expression, if known
+	partialResults bool   // see Connector.PartialResults
+}
+
+// newSelectGuard returns the guard for a select statement. The limits of the
+// Connector are replaced by the statement's max_rows and max_pages hints.
+func (c *conn) newSelectGuard(q *parse.SelectQuery) *selectGuard {
+	g := &selectGuard{
+		maxRows:        c.maxSelectRows,
+		maxPages:       c.maxSelectPages,
+		start:          time.Now(),
+		partialResults: c.partialResults,
+	}
+	if q.MaxRows > 0 {
+		g.maxRows = q.MaxRows
+	}
+	if q.MaxPages > 0 {
+		g.maxPages = q.MaxPages
+	}
+	return g
+}
+
+// page is called before each page of results is selected.
+func (g *selectGuard) page() error {
+	if g == nil {
+		return nil
+	}
+	g.pages++
+	if g.maxPages > 0 && g.pages > g.maxPages {
+		return errors.New("select fetched too many pages, narrow the where clause or raise the limit with a max_pages hint").With(
+			"maxPages", g.maxPages,
+		)
+	}
+	return nil
+}
+
+// row is called before each row is returned.
+func (g *selectGuard) row() error {
+	if g == nil {
+		return nil
+	}
+	g.rows++
+	if g.maxRows > 0 && g.rows > g.maxRows {
+		return errors.New("select fetched too many rows, narrow the where clause or raise the limit with a max_rows hint").With(
+			"maxRows", g.maxRows,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// Change describes a modification made to an item by an insert, update
+// or delete statement. It is passed to the AfterInsert, AfterUpdate
+// and AfterDelete hooks of the Connector.
+type Change struct {
+	Table  string // table name in the statement
+	Domain string // SimpleDB domain name
+	ID     string // item name
+
+	// Values contains the value of each column set by the statement, keyed
+	// by column name. A nil value indicates that the column was set to null.
+	// Columns not set by the statement are unchanged, and are not included.
+	// Values is nil for a delete.
+	Values map[string]interface{}
+
+	// OldValues contains the values that the statement replaced, keyed by
+	// column name. For an update, it has an entry for each column in Values,
+	// which is nil if the column had no value. For a delete, it contains
+	// every column of the item, and is nil if the item did not exist.
+	// OldValues is nil for an insert.
+	//
+	// The old values are read with a consistent GetAttributes request for
+	// each item before the statement runs, but only if the Connector has
+	// an AfterUpdate or AfterDelete hook. Another client can modify the item
+	// between the read and the statement.
+	OldValues map[string]interface{}
+}
+
+// Invalidation identifies an item modified by a statement.
+type Invalidation struct {
+	Table     string // table name in the statement
+	Domain    string // SimpleDB domain name
+	ID        string // item name
+	Operation string // "insert", "update" or "delete"
+}
+
+// Invalidator is notified of the items modified by statements, so that
+// cached copies of the items can be invalidated. See Connector.Invalidator.
+type Invalidator interface {
+	Invalidate(ctx context.Context, invalidations []Invalidation)
+}
+
+// InvalidatorFunc is an adapter that allows an ordinary function
+// to be used as an Invalidator.
+type InvalidatorFunc func(ctx context.Context, invalidations []Invalidation)
+
+// Invalidate calls f(ctx, invalidations).
+func (f InvalidatorFunc) Invalidate(ctx context.Context, invalidations []Invalidation) {
+	f(ctx, invalidations)
+}
+
+// hooks are the functions called before and after an item is modified.
+type hooks struct {
+	ValidateWrite      func(table string, columns map[string]interface{}) error
+	AfterInsert        func(ctx context.Context, change *Change)
+	AfterUpdate        func(ctx context.Context, change *Change)
+	AfterDelete        func(ctx context.Context, change *Change)
+	Invalidator        Invalidator
+	BatchInvalidations bool
+}
+
+// newChange returns the change made by a statement that sets columns.
+func newChange(tableName string, domainName, itemName *string, columns []parse.Column, args []driver.Value) *Change {
+	change := &Change{
+		Table:  tableName,
+		Domain: derefString(domainName),
+		ID:     derefString(itemName),
+		Values: make(map[string]interface{}, len(columns)),
+	}
+	for _, col := range columns {
+		// any error has already been reported when building the request
+		v, _ := col.GetValue(args)
+		change.Values[col.ColumnName] = v
+	}
+	return change
+}
+
+// validateWrite passes the columns written to an item by a statement to the
+// Connector's ValidateWrite hook. The item name is passed as the "id" column,
+// unless key is nil.
+func (c *conn) validateWrite(tableName string, key *parse.Key, columns []parse.Column, args []driver.Value) error {
+	if c.hooks.ValidateWrite == nil {
+		return nil
+	}
+	values := make(map[string]interface{}, len(columns)+1)
+	if key != nil {
+		id, err := key.String(args)
+		if err != nil {
+			return err
+		}
+		values["id"] = id
+	}
+	for _, col := range columns {
+		v, err := col.GetValue(args)
+		if err != nil {
+			return err
+		}
+		values[col.ColumnName] = v
+	}
+	return c.validateValues(tableName, values)
+}
+
+// validateValues passes the values of the columns written to an item to the
+// Connector's ValidateWrite hook.
+func (c *conn) validateValues(tableName string, values map[string]interface{}) error {
+	if c.hooks.ValidateWrite == nil {
+		return nil
+	}
+	if err := c.hooks.ValidateWrite(tableName, values); err != nil {
+		return errors.Wrap(err, "write is not valid").With("table", tableName)
+	}
+	return nil
+}
+
+func (c *conn) afterInsert(ctx context.Context, q *parse.InsertQuery, domainName, itemName *string, args []driver.Value) {
+	c.invalidate(ctx, q.TableName, domainName, itemName, "insert")
+	if c.hooks.AfterInsert != nil {
+		c.hooks.AfterInsert(ctx, newChange(q.TableName, domainName, itemName, q.Columns, args))
+	}
+}
+
+func (c *conn) afterUpdate(ctx context.Context, q *parse.UpdateQuery, domainName, itemName *string, args []driver.Value, old map[string]interface{}) {
+	c.invalidate(ctx, q.TableName, domainName, itemName, "update")
+	if c.hooks.AfterUpdate != nil {
+		change := newChange(q.TableName, domainName, itemName, q.Columns, args)
+		change.OldValues = old
+		c.hooks.AfterUpdate(ctx, change)
+	}
+}
+
+func (c *conn) afterDelete(ctx context.Context, q *parse.DeleteQuery, domainName, itemName *string, old map[string]interface{}) {
+	c.invalidate(ctx, q.TableName, domainName, itemName, "delete")
+	if c.hooks.AfterDelete != nil {
+		c.hooks.AfterDelete(ctx, &Change{
+			Table:     q.TableName,
+			Domain:    derefString(domainName),
+			ID:        derefString(itemName),
+			OldValues: old,
+		})
+	}
+}
+
+// oldUpdateValues returns the values of the columns that an update statement
+// sets, before the statement runs, for the Connector's AfterUpdate hook.
+// It returns nil if there is no hook.
+func (c *conn) oldUpdateValues(ctx context.Context, q *parse.UpdateQuery, args []driver.Value) (map[string]interface{}, error) {
+	if c.hooks.AfterUpdate == nil {
+		return nil, nil
+	}
+	itemName, err := q.Key.String(args)
+	if err != nil {
+		return nil, err
+	}
+	return c.oldColumnValues(ctx, q.TableName, itemName, q.Columns)
+}
+
+// oldColumnValues returns the values of the columns of an item, with an
+// entry for each column, which is nil if the item has no value for it.
+func (c *conn) oldColumnValues(ctx context.Context, tableName string, itemName string, columns []parse.Column) (map[string]interface{}, error) {
+	values, err := c.getOldValues(ctx, tableName, itemName, appendColumnNames(nil, columns))
+	if err != nil {
+		return nil, err
+	}
+	old := make(map[string]interface{}, len(columns))
+	for _, col := range columns {
+		old[col.ColumnName] = values[col.ColumnName]
+	}
+	return old, nil
+}
+
+// oldDeleteValues returns the values of an item before a delete statement
+// runs, for the Connector's AfterDelete hook. It returns nil if there is no
+// hook, or if the item does not exist.
+func (c *conn) oldDeleteValues(ctx context.Context, tableName string, itemName string) (map[string]interface{}, error) {
+	if c.hooks.AfterDelete == nil {
+		return nil, nil
+	}
+	return c.getOldValues(ctx, tableName, itemName, nil)
+}
+
+// invalidate passes a modified item to the Invalidator, or adds it to the
+// batch of invalidations if the Invalidator is called once per ExecContext.
+func (c *conn) invalidate(ctx context.Context, tableName string, domainName, itemName *string, operation string) {
+	if c.hooks.Invalidator == nil {
+		return
+	}
+	inv := Invalidation{
+		Table:     tableName,
+		Domain:    derefString(domainName),
+		ID:        derefString(itemName),
+		Operation: operation,
+	}
+	if c.batchingInvalidations {
+		c.invalidations = append(c.invalidations, inv)
+		return
+	}
+	c.hooks.Invalidator.Invalidate(ctx, []Invalidation{inv})
+}
+
+// invalidateItems passes the items modified by a batch request to the
+// Invalidator in a single call. It is used by Load, Vacuum and the
+// TableWriter, which modify items without running statements.
+func (c *conn) invalidateItems(ctx context.Context, tableName string, domainName *string, itemNames []*string, operation string) {
+	if c.hooks.Invalidator == nil || len(itemNames) == 0 {
+		return
+	}
+	invalidations := make([]Invalidation, 0, len(itemNames))
+	for _, itemName := range itemNames {
+		invalidations = append(invalidations, Invalidation{
+			Table:     tableName,
+			Domain:    derefString(domainName),
+			ID:        derefString(itemName),
+			Operation: operation,
+		})
+	}
+	c.hooks.Invalidator.Invalidate(ctx, invalidations)
+}
+
+// beginInvalidations starts a batch of invalidations for a call to
+// ExecContext, if the Connector batches invalidations. It returns the
+// function that passes the batch to the Invalidator.
+func (c *conn) beginInvalidations(ctx context.Context) func() {
+	if c.hooks.Invalidator == nil || !c.hooks.BatchInvalidations {
+		return func() {}
+	}
+	c.batchingInvalidations = true
+	return func() {
+		invalidations := c.invalidations
+		c.batchingInvalidations = false
+		c.invalidations = nil
+		if len(invalidations) > 0 {
+			c.hooks.Invalidator.Invalidate(ctx, invalidations)
+		}
+	}
+}
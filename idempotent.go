@@ -0,0 +1,56 @@
+package simpledbsql
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+)
+
+// retryCountOption returns an AWS SDK request option that sets count
+// to the number of times the AWS SDK retried the request.
+func retryCountOption(count *int) request.Option {
+	return func(r *request.Request) {
+		r.Handlers.Complete.PushBack(func(r *request.Request) {
+			*count = r.RetryCount
+		})
+	}
+}
+
+// insertApplied reports whether a retried insert's put request was applied
+// by an earlier attempt, whose response was lost. It was applied if the
+// item, read with a consistent read, has exactly the attributes of the put
+// request. Otherwise the item was written by another statement, and the
+// insert is a duplicate key.
+func (c *conn) insertApplied(ctx context.Context, putInput *simpledb.PutAttributesInput) (bool, error) {
+	input := &simpledb.GetAttributesInput{
+		DomainName:     putInput.DomainName,
+		ItemName:       putInput.ItemName,
+		ConsistentRead: aws.Bool(true),
+	}
+	output, err := c.SimpleDB.GetAttributesWithContext(ctx, input, requestOptions(ctx)...)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot verify retried insert").With(
+			"itemName", c.redact(derefString(putInput.ItemName)),
+		)
+	}
+	type attribute struct {
+		name  string
+		value string
+	}
+	want := make(map[attribute]bool, len(putInput.Attributes))
+	for _, attr := range putInput.Attributes {
+		want[attribute{name: derefString(attr.Name), value: derefString(attr.Value)}] = true
+	}
+	got := make(map[attribute]bool, len(output.Attributes))
+	for _, attr := range output.Attributes {
+		a := attribute{name: derefString(attr.Name), value: derefString(attr.Value)}
+		if !want[a] {
+			return false, nil
+		}
+		got[a] = true
+	}
+	return len(got) == len(want), nil
+}
@@ -0,0 +1,190 @@
+package simpledbsql
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// IDGenerator generates the item names of rows inserted by insert statements
+// that do not have an id column, such as "insert into tbl(a, b) values(?, ?)".
+// The generated id can be returned with a returning clause.
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+// IDGeneratorFunc is an adapter that allows an ordinary function
+// to be used as an IDGenerator.
+type IDGeneratorFunc func() (string, error)
+
+// NewID calls f().
+func (f IDGeneratorFunc) NewID() (string, error) {
+	return f()
+}
+
+// The built-in generators generate ids that start with the time they were
+// generated, so that item names sort in the order that they were created,
+// and recent items can be selected with a range of ids, such as
+// "where id > ? order by id desc".
+var (
+	// UUIDv7Generator generates version 7 UUIDs, such as
+	// "01890a5d-ac96-774b-bcce-b302099a8057", which sort by the
+	// millisecond that they were generated.
+	UUIDv7Generator IDGenerator = IDGeneratorFunc(newUUIDv7)
+
+	// ULIDGenerator generates ULIDs, such as "01ARZ3NDEKTSV4RRFFQ69G5FAV",
+	// which sort by the millisecond that they were generated.
+	ULIDGenerator IDGenerator = IDGeneratorFunc(newULID)
+
+	// KSUIDGenerator generates KSUIDs, such as "0ujtsYcgvSTl8PAuAdqWYSMnLOv",
+	// which sort by the second that they were generated.
+	KSUIDGenerator IDGenerator = IDGeneratorFunc(newKSUID)
+)
+
+// randomBytes fills b with random bytes.
+func randomBytes(b []byte) error {
+	if _, err := rand.Read(b); err != nil {
+		return errors.Wrap(err, "cannot generate id")
+	}
+	return nil
+}
+
+func newUUIDv7() (string, error) {
+	var b [16]byte
+	if err := randomBytes(b[6:]); err != nil {
+		return "", err
+	}
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint16(b[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:], uint32(ms))
+	b[6] = b[6]&0x0f | 0x70 // version 7
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+	s := hex.EncodeToString(b[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:], nil
+}
+
+// crockfordAlphabet is the base 32 alphabet of ULIDs.
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func newULID() (string, error) {
+	var b [16]byte
+	if err := randomBytes(b[6:]); err != nil {
+		return "", err
+	}
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint16(b[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:], uint32(ms))
+	return encodeFixed(b[:], crockfordAlphabet, 26), nil
+}
+
+// base62Alphabet is the alphabet of KSUIDs, in which
+// digits sort before upper case and lower case letters.
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// ksuidEpoch is the start of the timestamps of KSUIDs, in seconds
+// since the Unix epoch.
+const ksuidEpoch = 1400000000
+
+func newKSUID() (string, error) {
+	var b [20]byte
+	if err := randomBytes(b[4:]); err != nil {
+		return "", err
+	}
+	binary.BigEndian.PutUint32(b[0:], uint32(time.Now().Unix()-ksuidEpoch))
+	return encodeFixed(b[:], base62Alphabet, 27), nil
+}
+
+// encodeFixed encodes b as a big-endian number in the digits of alphabet,
+// padded with leading zero digits to length n, so that the encodings of
+// byte slices of the same length sort in the same order as the slices.
+func encodeFixed(b []byte, alphabet string, n int) string {
+	num := new(big.Int).SetBytes(b)
+	base := big.NewInt(int64(len(alphabet)))
+	digit := new(big.Int)
+	s := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		num.DivMod(num, base, digit)
+		s[i] = alphabet[digit.Int64()]
+	}
+	return string(s)
+}
+
+// snowflakeEpoch is the start of the timestamps of snowflake ids,
+// in milliseconds since the Unix epoch, which is the epoch of Twitter's
+// snowflake ids.
+const snowflakeEpoch = 1288834974657
+
+// SnowflakeGenerator returns a generator of snowflake ids, which combine
+// the millisecond that they were generated, a node number between 0 and
+// 1023, and a sequence number. Each node generating ids for the same table
+// must have a different node number. Ids are 19 digit numbers, padded with
+// leading zeros so that they sort in the order that they were generated.
+// Up to 4096 ids are generated each millisecond.
+func SnowflakeGenerator(node int) (IDGenerator, error) {
+	if node < 0 || node >= 1024 {
+		return nil, errors.New("invalid snowflake node").With("node", node)
+	}
+	return &snowflake{node: int64(node)}, nil
+}
+
+type snowflake struct {
+	node     int64
+	mutex    sync.Mutex
+	last     int64 // millisecond of the last id
+	sequence int64 // sequence number of the last id in that millisecond
+}
+
+func (sf *snowflake) NewID() (string, error) {
+	sf.mutex.Lock()
+	defer sf.mutex.Unlock()
+	ms := time.Now().UnixNano()/int64(time.Millisecond) - snowflakeEpoch
+	if ms < sf.last {
+		// the clock went backwards, so keep using the last millisecond
+		ms = sf.last
+	}
+	if ms == sf.last {
+		sf.sequence++
+		if sf.sequence >= 4096 {
+			// wait for the next millisecond
+			for ms <= sf.last {
+				time.Sleep(time.Millisecond / 10)
+				ms = time.Now().UnixNano()/int64(time.Millisecond) - snowflakeEpoch
+			}
+			sf.sequence = 0
+		}
+	} else {
+		sf.sequence = 0
+	}
+	sf.last = ms
+	return fmt.Sprintf("%019d", ms<<22|sf.node<<12|sf.sequence), nil
+}
+
+// generateKey returns an insert statement without an id column with the
+// item name generated by the Connector's IDGenerator. Other statements
+// are returned unchanged. Parsed statements are shared, so the insert
+// statement is copied.
+func (c *conn) generateKey(q *parse.Query) (*parse.Query, error) {
+	if q.Insert == nil || !q.Insert.GenerateKey {
+		return q, nil
+	}
+	if c.idGenerator == nil {
+		return nil, errors.New("missing id column in insert statement")
+	}
+	id, err := c.idGenerator.NewID()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot generate id").With("table", q.Insert.TableName)
+	}
+	insert := *q.Insert
+	insert.Key = parse.Key{Value: &id}
+	insert.GenerateKey = false
+	generated := *q
+	generated.Insert = &insert
+	return &generated, nil
+}
@@ -0,0 +1,437 @@
+// Package fakesdb provides an in-memory implementation of the SimpleDB API
+// for use in tests that cannot access AWS.
+//
+// The implementation supports the subset of the SimpleDB API used by the
+// simpledbsql driver. It is eventually consistent in the sense that it is
+// always consistent, which is a valid (if unhelpful) special case.
+package fakesdb
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
+)
+
+// Error codes returned by the fake.
+const (
+	ErrCodeConditionalCheckFailed = "ConditionalCheckFailed"
+	ErrCodeAttributeDoesNotExist  = "AttributeDoesNotExist"
+	ErrCodeNoSuchDomain           = "NoSuchDomain"
+	ErrCodeInvalidQueryExpression = "InvalidQueryExpression"
+)
+
+// defaultLimit is the number of items returned by Select if no limit is specified.
+const defaultLimit = 100
+
+// checks that DB implements the SimpleDBAPI interface
+var _ simpledbiface.SimpleDBAPI = (*DB)(nil)
+
+// DB is an in-memory SimpleDB database. It is safe for concurrent use.
+// Methods of the SimpleDBAPI interface that are not implemented panic.
+type DB struct {
+	simpledbiface.SimpleDBAPI
+
+	mutex   sync.Mutex
+	domains map[string]*domain
+	calls   map[string]int
+}
+
+type domain struct {
+	items map[string]*item
+}
+
+type item struct {
+	name  string
+	attrs map[string][]string
+}
+
+func (it *item) has(name, value string) bool {
+	for _, v := range it.attrs[name] {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// New returns a new, empty database.
+func New() *DB {
+	return &DB{
+		domains: make(map[string]*domain),
+		calls:   make(map[string]int),
+	}
+}
+
+// Calls returns the number of times the named operation
+// (eg "PutAttributes") has been called.
+func (db *DB) Calls(operation string) int {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.calls[operation]
+}
+
+// DomainNames returns the names of all domains in sorted order.
+func (db *DB) DomainNames() []string {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	var names []string
+	for name := range db.domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Item returns a copy of the attributes of an item, or nil if it does not exist.
+func (db *DB) Item(domainName, itemName string) map[string][]string {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	d, ok := db.domains[domainName]
+	if !ok {
+		return nil
+	}
+	it, ok := d.items[itemName]
+	if !ok {
+		return nil
+	}
+	attrs := make(map[string][]string, len(it.attrs))
+	for name, values := range it.attrs {
+		attrs[name] = append([]string(nil), values...)
+	}
+	return attrs
+}
+
+func (db *DB) begin(operation string) {
+	db.mutex.Lock()
+	db.calls[operation]++
+}
+
+func (db *DB) end() {
+	db.mutex.Unlock()
+}
+
+func (db *DB) getDomain(name *string) (*domain, error) {
+	d, ok := db.domains[aws.StringValue(name)]
+	if !ok {
+		return nil, awserr.New(ErrCodeNoSuchDomain, "The specified domain does not exist.", nil)
+	}
+	return d, nil
+}
+
+// CreateDomainWithContext implements the SimpleDBAPI interface.
+func (db *DB) CreateDomainWithContext(ctx aws.Context, input *simpledb.CreateDomainInput, opts ...request.Option) (*simpledb.CreateDomainOutput, error) {
+	db.begin("CreateDomain")
+	defer db.end()
+	name := aws.StringValue(input.DomainName)
+	if _, ok := db.domains[name]; !ok {
+		db.domains[name] = &domain{items: make(map[string]*item)}
+	}
+	return &simpledb.CreateDomainOutput{}, nil
+}
+
+// DeleteDomainWithContext implements the SimpleDBAPI interface.
+func (db *DB) DeleteDomainWithContext(ctx aws.Context, input *simpledb.DeleteDomainInput, opts ...request.Option) (*simpledb.DeleteDomainOutput, error) {
+	db.begin("DeleteDomain")
+	defer db.end()
+	delete(db.domains, aws.StringValue(input.DomainName))
+	return &simpledb.DeleteDomainOutput{}, nil
+}
+
+// ListDomainsWithContext implements the SimpleDBAPI interface.
+func (db *DB) ListDomainsWithContext(ctx aws.Context, input *simpledb.ListDomainsInput, opts ...request.Option) (*simpledb.ListDomainsOutput, error) {
+	db.begin("ListDomains")
+	defer db.end()
+	var names []string
+	for name := range db.domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	limit := int(aws.Int64Value(input.MaxNumberOfDomains))
+	start, _ := strconv.Atoi(aws.StringValue(input.NextToken))
+	output := &simpledb.ListDomainsOutput{}
+	for i := start; i < len(names); i++ {
+		if limit > 0 && len(output.DomainNames) == limit {
+			output.NextToken = aws.String(strconv.Itoa(i))
+			break
+		}
+		output.DomainNames = append(output.DomainNames, aws.String(names[i]))
+	}
+	return output, nil
+}
+
+// DomainMetadataWithContext implements the SimpleDBAPI interface.
+func (db *DB) DomainMetadataWithContext(ctx aws.Context, input *simpledb.DomainMetadataInput, opts ...request.Option) (*simpledb.DomainMetadataOutput, error) {
+	db.begin("DomainMetadata")
+	defer db.end()
+	d, err := db.getDomain(input.DomainName)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	var valueCount int64
+	for _, it := range d.items {
+		for name, values := range it.attrs {
+			names[name] = true
+			valueCount += int64(len(values))
+		}
+	}
+	return &simpledb.DomainMetadataOutput{
+		ItemCount:           aws.Int64(int64(len(d.items))),
+		AttributeNameCount:  aws.Int64(int64(len(names))),
+		AttributeValueCount: aws.Int64(valueCount),
+	}, nil
+}
+
+// GetAttributesWithContext implements the SimpleDBAPI interface.
+func (db *DB) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	db.begin("GetAttributes")
+	defer db.end()
+	d, err := db.getDomain(input.DomainName)
+	if err != nil {
+		return nil, err
+	}
+	output := &simpledb.GetAttributesOutput{}
+	it, ok := d.items[aws.StringValue(input.ItemName)]
+	if !ok {
+		return output, nil
+	}
+	var names []string
+	if len(input.AttributeNames) == 0 {
+		names = sortedNames(it.attrs)
+	} else {
+		for _, name := range input.AttributeNames {
+			names = append(names, aws.StringValue(name))
+		}
+	}
+	output.Attributes = attributes(it, names)
+	return output, nil
+}
+
+// PutAttributesWithContext implements the SimpleDBAPI interface.
+func (db *DB) PutAttributesWithContext(ctx aws.Context, input *simpledb.PutAttributesInput, opts ...request.Option) (*simpledb.PutAttributesOutput, error) {
+	db.begin("PutAttributes")
+	defer db.end()
+	d, err := db.getDomain(input.DomainName)
+	if err != nil {
+		return nil, err
+	}
+	itemName := aws.StringValue(input.ItemName)
+	if err := checkExpected(d.items[itemName], input.Expected); err != nil {
+		return nil, err
+	}
+	d.put(itemName, input.Attributes)
+	return &simpledb.PutAttributesOutput{}, nil
+}
+
+// BatchPutAttributesWithContext implements the SimpleDBAPI interface.
+func (db *DB) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	db.begin("BatchPutAttributes")
+	defer db.end()
+	d, err := db.getDomain(input.DomainName)
+	if err != nil {
+		return nil, err
+	}
+	for _, ri := range input.Items {
+		d.put(aws.StringValue(ri.Name), ri.Attributes)
+	}
+	return &simpledb.BatchPutAttributesOutput{}, nil
+}
+
+// DeleteAttributesWithContext implements the SimpleDBAPI interface.
+func (db *DB) DeleteAttributesWithContext(ctx aws.Context, input *simpledb.DeleteAttributesInput, opts ...request.Option) (*simpledb.DeleteAttributesOutput, error) {
+	db.begin("DeleteAttributes")
+	defer db.end()
+	d, err := db.getDomain(input.DomainName)
+	if err != nil {
+		return nil, err
+	}
+	itemName := aws.StringValue(input.ItemName)
+	if err := checkExpected(d.items[itemName], input.Expected); err != nil {
+		return nil, err
+	}
+	d.delete(itemName, input.Attributes)
+	return &simpledb.DeleteAttributesOutput{}, nil
+}
+
+// BatchDeleteAttributesWithContext implements the SimpleDBAPI interface.
+func (db *DB) BatchDeleteAttributesWithContext(ctx aws.Context, input *simpledb.BatchDeleteAttributesInput, opts ...request.Option) (*simpledb.BatchDeleteAttributesOutput, error) {
+	db.begin("BatchDeleteAttributes")
+	defer db.end()
+	d, err := db.getDomain(input.DomainName)
+	if err != nil {
+		return nil, err
+	}
+	for _, di := range input.Items {
+		d.delete(aws.StringValue(di.Name), di.Attributes)
+	}
+	return &simpledb.BatchDeleteAttributesOutput{}, nil
+}
+
+// SelectWithContext implements the SimpleDBAPI interface.
+func (db *DB) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	db.begin("Select")
+	defer db.end()
+	stmt, err := parseSelect(aws.StringValue(input.SelectExpression))
+	if err != nil {
+		return nil, awserr.New(ErrCodeInvalidQueryExpression, err.Error(), nil)
+	}
+	d, err := db.getDomain(&stmt.domainName)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*item
+	for _, it := range d.items {
+		if stmt.where == nil || stmt.where.eval(it) {
+			matches = append(matches, it)
+		}
+	}
+	stmt.sort(matches)
+
+	if stmt.count {
+		if stmt.limit > 0 && len(matches) > stmt.limit {
+			matches = matches[:stmt.limit]
+		}
+		return &simpledb.SelectOutput{
+			Items: []*simpledb.Item{
+				{
+					Name: aws.String("Domain"),
+					Attributes: []*simpledb.Attribute{
+						{Name: aws.String("Count"), Value: aws.String(strconv.Itoa(len(matches)))},
+					},
+				},
+			},
+		}, nil
+	}
+
+	limit := stmt.limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	start, _ := strconv.Atoi(aws.StringValue(input.NextToken))
+	output := &simpledb.SelectOutput{}
+	for i := start; i < len(matches); i++ {
+		if len(output.Items) == limit {
+			output.NextToken = aws.String(strconv.Itoa(i))
+			break
+		}
+		it := matches[i]
+		names := stmt.columns
+		if stmt.all {
+			names = sortedNames(it.attrs)
+		}
+		output.Items = append(output.Items, &simpledb.Item{
+			Name:       aws.String(it.name),
+			Attributes: attributes(it, names),
+		})
+	}
+	return output, nil
+}
+
+func (d *domain) put(itemName string, attrs []*simpledb.ReplaceableAttribute) {
+	it, ok := d.items[itemName]
+	if !ok {
+		it = &item{name: itemName, attrs: make(map[string][]string)}
+	}
+	// replace happens before any values are added
+	for _, attr := range attrs {
+		if aws.BoolValue(attr.Replace) {
+			delete(it.attrs, aws.StringValue(attr.Name))
+		}
+	}
+	for _, attr := range attrs {
+		name, value := aws.StringValue(attr.Name), aws.StringValue(attr.Value)
+		if !it.has(name, value) {
+			it.attrs[name] = append(it.attrs[name], value)
+		}
+	}
+	if len(it.attrs) > 0 {
+		d.items[itemName] = it
+	}
+}
+
+func (d *domain) delete(itemName string, attrs []*simpledb.DeletableAttribute) {
+	it, ok := d.items[itemName]
+	if !ok {
+		return
+	}
+	if len(attrs) == 0 {
+		delete(d.items, itemName)
+		return
+	}
+	for _, attr := range attrs {
+		name := aws.StringValue(attr.Name)
+		if attr.Value == nil {
+			delete(it.attrs, name)
+			continue
+		}
+		var values []string
+		for _, v := range it.attrs[name] {
+			if v != *attr.Value {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			delete(it.attrs, name)
+		} else {
+			it.attrs[name] = values
+		}
+	}
+	if len(it.attrs) == 0 {
+		delete(d.items, itemName)
+	}
+}
+
+func checkExpected(it *item, cond *simpledb.UpdateCondition) error {
+	if cond == nil {
+		return nil
+	}
+	name := aws.StringValue(cond.Name)
+	var values []string
+	if it != nil {
+		values = it.attrs[name]
+	}
+	if cond.Exists != nil && !*cond.Exists {
+		if len(values) > 0 {
+			return awserr.New(ErrCodeConditionalCheckFailed, "Conditional check failed. Attribute ("+name+") value exists", nil)
+		}
+		return nil
+	}
+	if len(values) == 0 {
+		return awserr.New(ErrCodeAttributeDoesNotExist, "Attribute ("+name+") does not exist", nil)
+	}
+	if cond.Value != nil {
+		if len(values) != 1 || values[0] != *cond.Value {
+			return awserr.New(ErrCodeConditionalCheckFailed, "Conditional check failed. Attribute ("+name+") value is ("+values[0]+") but was expected ("+*cond.Value+")", nil)
+		}
+	}
+	return nil
+}
+
+func sortedNames(attrs map[string][]string) []string {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func attributes(it *item, names []string) []*simpledb.Attribute {
+	var attrs []*simpledb.Attribute
+	for _, name := range names {
+		for _, value := range it.attrs[name] {
+			attrs = append(attrs, &simpledb.Attribute{
+				Name:  aws.String(name),
+				Value: aws.String(value),
+			})
+		}
+	}
+	return attrs
+}
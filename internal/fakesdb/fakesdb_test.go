@@ -0,0 +1,127 @@
+package fakesdb
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+)
+
+func TestSelect(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+	db.CreateDomainWithContext(ctx, &simpledb.CreateDomainInput{DomainName: aws.String("d")})
+	put := func(item string, kv ...string) {
+		input := &simpledb.PutAttributesInput{DomainName: aws.String("d"), ItemName: aws.String(item)}
+		for i := 0; i < len(kv); i += 2 {
+			input.Attributes = append(input.Attributes, &simpledb.ReplaceableAttribute{
+				Name:  aws.String(kv[i]),
+				Value: aws.String(kv[i+1]),
+			})
+		}
+		if _, err := db.PutAttributesWithContext(ctx, input); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("1", "a", "x", "b", "10")
+	put("2", "a", "y", "b", "20", "c", "z")
+	put("3", "a", "xy", "b", "30", "b", "05")
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"select * from d", []string{"1", "2", "3"}},
+		{"select * from `d` where a = 'x'", []string{"1"}},
+		{"select * from d where a like 'x%'", []string{"1", "3"}},
+		{"select * from d where a not like 'x%'", []string{"2"}},
+		{"select * from d where c is null", []string{"1", "3"}},
+		{"select * from d where c is not null", []string{"2"}},
+		{"select * from d where b > '15'", []string{"2", "3"}},
+		{"select * from d where every(b) > '15'", []string{"2"}},
+		{"select * from d where b between '10' and '20'", []string{"1", "2"}},
+		{"select * from d where itemName() in ('1', '3')", []string{"1", "3"}},
+		{"select * from d where a = 'x' or (b = '20' and not c = 'q')", []string{"1", "2"}},
+		{"select * from d where a >= 'y'", []string{"2"}},
+		{"select * from d where b is not null order by b desc", []string{"3", "2", "1"}},
+		{"select * from d order by itemName() desc limit 2", []string{"3", "2"}},
+	}
+	for tn, tt := range tests {
+		var got []string
+		var nextToken *string
+		for {
+			output, err := db.SelectWithContext(ctx, &simpledb.SelectInput{
+				SelectExpression: aws.String(tt.expr),
+				NextToken:        nextToken,
+			})
+			if err != nil {
+				t.Fatalf("%d: %v", tn, err)
+			}
+			for _, item := range output.Items {
+				got = append(got, *item.Name)
+			}
+			if output.NextToken == nil || strings.Contains(tt.expr, "limit") {
+				// limit is a page size, so only check the first page
+				break
+			}
+			nextToken = output.NextToken
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d: %s: got=%v, want=%v", tn, tt.expr, got, tt.want)
+		}
+	}
+
+	output, err := db.SelectWithContext(ctx, &simpledb.SelectInput{
+		SelectExpression: aws.String("select count(*) from d where a like 'x%'"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := *output.Items[0].Attributes[0].Value, "2"; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
+
+func TestExpected(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+	db.CreateDomainWithContext(ctx, &simpledb.CreateDomainInput{DomainName: aws.String("d")})
+	put := func(value string, expected *simpledb.UpdateCondition) error {
+		_, err := db.PutAttributesWithContext(ctx, &simpledb.PutAttributesInput{
+			DomainName: aws.String("d"),
+			ItemName:   aws.String("1"),
+			Attributes: []*simpledb.ReplaceableAttribute{
+				{Name: aws.String("a"), Value: aws.String(value), Replace: aws.Bool(true)},
+			},
+			Expected: expected,
+		})
+		return err
+	}
+	code := func(err error) string {
+		if err, ok := err.(awserr.Error); ok {
+			return err.Code()
+		}
+		return ""
+	}
+
+	notExists := &simpledb.UpdateCondition{Name: aws.String("a"), Exists: aws.Bool(false)}
+	if err := put("1", notExists); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := code(put("2", notExists)), ErrCodeConditionalCheckFailed; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if err := put("2", &simpledb.UpdateCondition{Name: aws.String("a"), Value: aws.String("1")}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := code(put("3", &simpledb.UpdateCondition{Name: aws.String("b"), Value: aws.String("1")})), ErrCodeAttributeDoesNotExist; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := db.Item("d", "1"), map[string][]string{"a": {"2"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}
@@ -0,0 +1,394 @@
+package fakesdb
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jjeffery/simpledbsql/internal/lex"
+)
+
+// selectStmt is a parsed SimpleDB select expression.
+type selectStmt struct {
+	domainName string
+	all        bool     // select *
+	count      bool     // select count(*)
+	columns    []string // attribute names, empty for itemName()
+	where      expr
+	orderBy    string
+	desc       bool
+	limit      int
+}
+
+// expr is a node in a where clause.
+type expr interface {
+	eval(it *item) bool
+}
+
+type andExpr struct{ left, right expr }
+type orExpr struct{ left, right expr }
+type notExpr struct{ expr expr }
+
+func (e andExpr) eval(it *item) bool { return e.left.eval(it) && e.right.eval(it) }
+func (e orExpr) eval(it *item) bool  { return e.left.eval(it) || e.right.eval(it) }
+func (e notExpr) eval(it *item) bool { return !e.expr.eval(it) }
+
+// predicate is a comparison against the values of an attribute.
+type predicate struct {
+	attr  string // empty for itemName()
+	every bool
+	match func(v string) bool
+	isNil *bool // for "is null" and "is not null"
+}
+
+func (p predicate) eval(it *item) bool {
+	var values []string
+	if p.attr == "" {
+		values = []string{it.name}
+	} else {
+		values = it.attrs[p.attr]
+	}
+	if p.isNil != nil {
+		return (len(values) == 0) == *p.isNil
+	}
+	if len(values) == 0 {
+		return false
+	}
+	for _, v := range values {
+		if p.match(v) != p.every {
+			return !p.every
+		}
+	}
+	return p.every
+}
+
+func (s *selectStmt) sort(items []*item) {
+	sort.Slice(items, func(i, j int) bool {
+		vi, vj := sortValue(items[i], s.orderBy), sortValue(items[j], s.orderBy)
+		if vi == vj {
+			vi, vj = items[i].name, items[j].name
+		}
+		if s.desc {
+			return vi > vj
+		}
+		return vi < vj
+	})
+}
+
+func sortValue(it *item, attr string) string {
+	if attr == itemNameAttr {
+		return it.name
+	}
+	if values := it.attrs[attr]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// itemNameAttr is used for order by itemName(), and cannot clash
+// with an attribute name because attribute names are not empty.
+const itemNameAttr = ""
+
+type parser struct {
+	tokens []string
+	kinds  []lex.Token
+	pos    int
+}
+
+func parseSelect(expression string) (*selectStmt, error) {
+	p := &parser{}
+	scan := lex.New(strings.NewReader(expression))
+	scan.IgnoreWhiteSpace = true
+	for scan.Scan() {
+		if scan.Token() == lex.TokenComment {
+			continue
+		}
+		p.tokens = append(p.tokens, scan.Text())
+		p.kinds = append(p.kinds, scan.Token())
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	return p.parseSelect()
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *parser) accept(tokens ...string) bool {
+	for i, tok := range tokens {
+		if p.pos+i >= len(p.tokens) || !strings.EqualFold(p.tokens[p.pos+i], tok) {
+			return false
+		}
+	}
+	p.pos += len(tokens)
+	return true
+}
+
+func (p *parser) expect(tokens ...string) error {
+	if !p.accept(tokens...) {
+		return fmt.Errorf("expected %q, found %q", strings.Join(tokens, " "), p.peek())
+	}
+	return nil
+}
+
+func (p *parser) parseSelect() (*selectStmt, error) {
+	var stmt selectStmt
+	if err := p.expect("select"); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.accept("*"):
+		stmt.all = true
+	case p.accept("count", "(", "*", ")"):
+		stmt.count = true
+	case p.accept("itemName", "(", ")"):
+	default:
+		for {
+			stmt.columns = append(stmt.columns, lex.Unquote(p.next()))
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if err := p.expect("from"); err != nil {
+		return nil, err
+	}
+	stmt.domainName = lex.Unquote(p.next())
+	if p.accept("where") {
+		where, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.where = where
+	}
+	if p.accept("order", "by") {
+		if p.accept("itemName", "(", ")") {
+			stmt.orderBy = itemNameAttr
+		} else {
+			stmt.orderBy = lex.Unquote(p.next())
+		}
+		if p.accept("desc") {
+			stmt.desc = true
+		} else {
+			p.accept("asc")
+		}
+	}
+	if p.accept("limit") {
+		n, err := strconv.Atoi(p.next())
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit: %v", err)
+		}
+		stmt.limit = n
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.peek())
+	}
+	return &stmt, nil
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") || p.accept("intersection") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.accept("not") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr: e}, nil
+	}
+	if p.accept("(") {
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *parser) parsePredicate() (expr, error) {
+	var pred predicate
+	switch {
+	case p.accept("itemName", "(", ")"):
+	case p.accept("every", "("):
+		pred.every = true
+		pred.attr = lex.Unquote(p.next())
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	default:
+		pred.attr = lex.Unquote(p.next())
+	}
+
+	switch op := strings.ToLower(p.next()); op {
+	case "=", "<>", "<", ">":
+		if (op == "<" || op == ">") && p.accept("=") {
+			// the scanner returns "<=" and ">=" as separate tokens
+			op += "="
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		pred.match = compare(op, value)
+	case "like":
+		match, err := p.parseLike()
+		if err != nil {
+			return nil, err
+		}
+		pred.match = match
+	case "not":
+		if err := p.expect("like"); err != nil {
+			return nil, err
+		}
+		match, err := p.parseLike()
+		if err != nil {
+			return nil, err
+		}
+		pred.match = func(v string) bool { return !match(v) }
+	case "is":
+		isNil := !p.accept("not")
+		if err := p.expect("null"); err != nil {
+			return nil, err
+		}
+		pred.isNil = &isNil
+	case "between":
+		lower, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("and"); err != nil {
+			return nil, err
+		}
+		upper, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		pred.match = func(v string) bool { return v >= lower && v <= upper }
+	case "in":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		set := make(map[string]bool)
+		for {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			set[value] = true
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		pred.match = func(v string) bool { return set[v] }
+	default:
+		return nil, fmt.Errorf("unexpected operator %q", op)
+	}
+	return pred, nil
+}
+
+func (p *parser) parseValue() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", fmt.Errorf("expected value")
+	}
+	tok, kind := p.next(), p.kinds[p.pos-1]
+	if kind == lex.TokenLiteral || strings.HasPrefix(tok, `"`) {
+		// the scanner treats double quotes as identifiers, but
+		// SimpleDB treats them as string literals
+		return lex.Unquote(tok), nil
+	}
+	return "", fmt.Errorf("expected value, found %q", tok)
+}
+
+func (p *parser) parseLike() (func(string) bool, error) {
+	pattern, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; {
+		case ch == '%':
+			sb.WriteString("(?s:.*)")
+		case ch == '_':
+			sb.WriteString("(?s:.)")
+		case ch == '\\' && i+1 < len(pattern):
+			// "\%", "\_" and "\\" match the escaped character
+			i++
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	sb.WriteString("$")
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString, nil
+}
+
+func compare(op string, value string) func(string) bool {
+	switch op {
+	case "=":
+		return func(v string) bool { return v == value }
+	case "<>":
+		return func(v string) bool { return v != value }
+	case "<":
+		return func(v string) bool { return v < value }
+	case "<=":
+		return func(v string) bool { return v <= value }
+	case ">":
+		return func(v string) bool { return v > value }
+	default: // ">="
+		return func(v string) bool { return v >= value }
+	}
+}
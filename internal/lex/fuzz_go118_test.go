@@ -0,0 +1,58 @@
+//go:build go1.18
+// +build go1.18
+
+package lex
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func FuzzScanner(f *testing.F) {
+	for _, sql := range []string{
+		"select * from [from] t where t.id = 'one'",
+		"select `a``b`, \"c\" from {tbl} where a <> ? and b = $12 -- comment",
+		"/* hint */ insert into tbl(id, a) values(x'0a', n'it''s')",
+		"update tbl set a = 1.5e-3, b = .5 where id = '1'",
+		"'unterminated",
+		"/* unterminated",
+		"select ~ from tbl",
+	} {
+		f.Add(sql)
+	}
+	f.Fuzz(func(t *testing.T, sql string) {
+		scanner := New(strings.NewReader(sql))
+		var tokens []string
+		var keywords []bool
+		for scanner.Scan() {
+			if len(tokens) > len(sql) {
+				t.Fatalf("%q: more tokens than bytes", sql)
+			}
+			if scanner.Text() == "" {
+				t.Fatalf("%q: empty token %v", sql, scanner.Token())
+			}
+			tokens = append(tokens, scanner.Text())
+			keywords = append(keywords, scanner.Token() == TokenKeyword)
+		}
+		if scanner.Err() != nil || !utf8.ValidString(sql) {
+			return
+		}
+		// without errors, the tokens are the text of the input,
+		// except that keywords are in lower case
+		rest := sql
+		for i, token := range tokens {
+			if len(token) > len(rest) {
+				t.Fatalf("%q: token %q is past the end of the input", sql, token)
+			}
+			text := rest[:len(token)]
+			if text != token && !(keywords[i] && strings.ToLower(text) == token) {
+				t.Fatalf("%q: got token %q, want %q", sql, token, text)
+			}
+			rest = rest[len(token):]
+		}
+		if rest != "" {
+			t.Errorf("%q: no token for %q", sql, rest)
+		}
+	})
+}
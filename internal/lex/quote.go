@@ -51,9 +51,21 @@ func IsQuoted(ident string) bool {
 }
 
 // Unquote will unquote an identifier, if it is quoted.
+// A multi-part identifier, such as `dev`.`tbl`, has each of
+// its parts unquoted, and the parts are joined with periods.
 // If the syntax of the identifier is not valid the result is
 // undefined.
 func Unquote(ident string) string {
+	if parts := splitParts(ident); len(parts) > 1 {
+		for i, part := range parts {
+			parts[i] = unquotePart(part)
+		}
+		return strings.Join(parts, ".")
+	}
+	return unquotePart(ident)
+}
+
+func unquotePart(ident string) string {
 	for _, qp := range quotePairs {
 		if qp.isQuoted(ident) {
 			return qp.unQuote(ident)
@@ -62,6 +74,59 @@ func Unquote(ident string) string {
 	return ident
 }
 
+// splitParts splits a multi-part identifier into its parts, which are
+// separated by periods. It returns nil if ident is not a valid multi-part
+// identifier.
+func splitParts(ident string) []string {
+	var parts []string
+	for {
+		n := partLength(ident)
+		if n == 0 {
+			return nil
+		}
+		parts = append(parts, ident[:n])
+		ident = ident[n:]
+		if ident == "" {
+			return parts
+		}
+		if ident[0] != '.' {
+			return nil
+		}
+		ident = ident[1:]
+	}
+}
+
+// partLength returns the length of the first part of a multi-part
+// identifier, or zero if it does not start with a valid part.
+func partLength(ident string) int {
+	for _, qp := range quotePairs {
+		if !strings.HasPrefix(ident, qp.start) {
+			continue
+		}
+		i := len(qp.start)
+		for {
+			j := strings.Index(ident[i:], qp.end)
+			if j < 0 {
+				return 0
+			}
+			i += j + len(qp.end)
+			if !strings.HasPrefix(ident[i:], qp.end) {
+				return i
+			}
+			// escaped end quote
+			i += len(qp.end)
+		}
+	}
+	n := strings.IndexByte(ident, '.')
+	if n < 0 {
+		n = len(ident)
+	}
+	if strings.ContainsAny(ident[:n], "\"`[]'{}") {
+		return 0
+	}
+	return n
+}
+
 // Quote the identifer using the start and end quote strings.
 // If the end quote string occurs in ident, it is escaped.
 func Quote(ident, start, end string) string {
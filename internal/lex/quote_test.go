@@ -88,3 +88,25 @@ func TestQuote(t *testing.T) {
 		}
 	}
 }
+
+func TestUnquoteMultiPart(t *testing.T) {
+	tests := []struct {
+		ident string
+		want  string
+	}{
+		{ident: "dev.tbl", want: "dev.tbl"},
+		{ident: "`dev`.`tbl`", want: "dev.tbl"},
+		{ident: `"dev".tbl`, want: "dev.tbl"},
+		{ident: "[dev].[my tbl]", want: "dev.my tbl"},
+		{ident: `"dev.tbl"`, want: "dev.tbl"},
+		{ident: "`a``b`.`c.d`", want: "a`b.c.d"},
+		{ident: "'a.b'", want: "a.b"},
+		{ident: "x'0a'", want: "x'0a'"},
+		{ident: "`dev`.", want: "`dev`."},
+	}
+	for i, tt := range tests {
+		if got := Unquote(tt.ident); got != tt.want {
+			t.Errorf("%d: got=%s, want=%s", i, got, tt.want)
+		}
+	}
+}
@@ -30,8 +30,8 @@ const (
 )
 
 const (
-	eof       = rune(0)
-	operators = "%&()*+,-./:;<=>?^|{}"
+	eof       = rune(-1) // not rune(0), so that a NUL character is illegal input
+	operators = "%&()*+,-./:;<=>?@^|{}"
 )
 
 var (
@@ -130,6 +130,14 @@ func (s *Scanner) Scan() bool {
 		s.unread(ch2)
 		return s.setToken(TokenOperator, runeToString(ch))
 	}
+	if ch == '/' {
+		ch2 := s.read()
+		if ch2 == '*' {
+			return s.scanBlockComment()
+		}
+		s.unread(ch2)
+		return s.setToken(TokenOperator, runeToString(ch))
+	}
 	if ch == '[' {
 		return s.scanDelimitedIdentifier('[', ']')
 	}
@@ -178,6 +186,13 @@ func (s *Scanner) Scan() bool {
 	if ch == '?' {
 		return s.scanPlaceholder(ch)
 	}
+	if ch == '$' {
+		ch2 := s.read()
+		s.unread(ch2)
+		if isDigit(ch2) {
+			return s.scanNumberedPlaceholder(ch)
+		}
+	}
 	if strings.ContainsRune(operators, ch) {
 		return s.setToken(TokenOperator, runeToString(ch))
 	}
@@ -229,6 +244,26 @@ func (s *Scanner) scanComment(prefix string) bool {
 	return s.setToken(TokenComment, buf.String())
 }
 
+// scanBlockComment scans a comment of the form "/* ... */". The
+// opening "/*" has already been read.
+func (s *Scanner) scanBlockComment() bool {
+	var buf bytes.Buffer
+	buf.WriteString("/*")
+	var prev rune
+	for {
+		ch := s.read()
+		if ch == eof {
+			return s.setToken(TokenIllegal, buf.String())
+		}
+		buf.WriteRune(ch)
+		if prev == '*' && ch == '/' {
+			break
+		}
+		prev = ch
+	}
+	return s.setToken(TokenComment, buf.String())
+}
+
 func (s *Scanner) scanDelimitedIdentifier(startCh rune, endCh rune) bool {
 	var buf bytes.Buffer
 	buf.WriteRune(startCh)
@@ -334,6 +369,21 @@ func (s *Scanner) scanPlaceholder(startCh rune) bool {
 	return s.setToken(TokenPlaceholder, buf.String())
 }
 
+// scanNumberedPlaceholder scans a PostgreSQL-style placeholder, such as "$1".
+func (s *Scanner) scanNumberedPlaceholder(startCh rune) bool {
+	var buf bytes.Buffer
+	buf.WriteRune(startCh)
+	for {
+		ch := s.read()
+		if !isDigit(ch) {
+			s.unread(ch)
+			break
+		}
+		buf.WriteRune(ch)
+	}
+	return s.setToken(TokenPlaceholder, buf.String())
+}
+
 func (s *Scanner) read() rune {
 	ch, _, err := s.r.ReadRune()
 	if err != nil {
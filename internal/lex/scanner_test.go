@@ -118,6 +118,20 @@ func TestScan(t *testing.T) {
 				{TokenEOF, ""},
 			},
 		},
+		{ // block comments
+			sql: "select /*+ consistent */ a/b/**/",
+			tokens: []tokenLexeme{
+				{TokenKeyword, "select"},
+				{TokenWhiteSpace, " "},
+				{TokenComment, "/*+ consistent */"},
+				{TokenWhiteSpace, " "},
+				{TokenIdent, "a"},
+				{TokenOperator, "/"},
+				{TokenIdent, "b"},
+				{TokenComment, "/**/"},
+				{TokenEOF, ""},
+			},
+		},
 		{ // literals
 			sql: "'literal ''string''',x'1010',X'1010',n'abc',N'abc',xy,X,nm,N,",
 			tokens: []tokenLexeme{
@@ -142,6 +156,26 @@ func TestScan(t *testing.T) {
 				{TokenEOF, ""},
 			},
 		},
+		{ // numbered placeholders
+			sql: "$1,$23 $",
+			tokens: []tokenLexeme{
+				{TokenPlaceholder, "$1"},
+				{TokenOperator, ","},
+				{TokenPlaceholder, "$23"},
+				{TokenWhiteSpace, " "},
+				{TokenIllegal, "$"},
+				{TokenEOF, ""},
+			},
+			errText: `unrecognised input near "$"`,
+		},
+		{ // unterminated block comment
+			sql: "/* missing end",
+			tokens: []tokenLexeme{
+				{TokenIllegal, "/* missing end"},
+				{TokenEOF, ""},
+			},
+			errText: `unrecognised input near "/* missing end"`,
+		},
 		{ // illegal quoted literal
 			sql: "'missing quote",
 			tokens: []tokenLexeme{
@@ -180,6 +214,16 @@ func TestScan(t *testing.T) {
 			},
 			errText: `unrecognised input near "\x03"`,
 		},
+		{ // NUL is illegal, and does not end the input
+			sql: "a\x00b",
+			tokens: []tokenLexeme{
+				{TokenIdent, "a"},
+				{TokenIllegal, "\x00"},
+				{TokenIdent, "b"},
+				{TokenEOF, ""},
+			},
+			errText: `unrecognised input near "\x00"`,
+		},
 		{ // white space
 			sql: " a  b\r\nc\td \v\t\r\n  e\n\n",
 			tokens: []tokenLexeme{
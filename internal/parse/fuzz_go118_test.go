@@ -0,0 +1,55 @@
+//go:build go1.18
+// +build go1.18
+
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzParse(f *testing.F) {
+	for _, query := range []string{
+		"select a, b, c from tbl where id = ?",
+		"consistent select * from `tbl` where a > 'x' and b is not null order by a desc limit 10",
+		"select /*+ max_rows(5) eventual */ count(*), max(a) from tbl where b = $1 group by c",
+		"explain select id from tbl where a like 'x%' or b in ('1', '2')",
+		"insert into tbl(id, a, b) values(?, ?, x'0a0b') on duplicate key update a = values(a)",
+		"insert ignore into tbl set id = 'ID1', a = 1.5 returning a",
+		"update tbl set a = ?, b = null where id = ? if c = 'x'",
+		"upsert tbl set a = 1 where id in (select id from tbl where b = ?)",
+		"delete from tbl where id = '1' if a = 'x'",
+		"create table tbl; drop table if exists tbl",
+		"show columns from tbl; show tables",
+		"select a from tbl where id = ? and ?",
+		"update tbl set a = a + 1 where id = ?",
+	} {
+		f.Add(query)
+	}
+	f.Fuzz(func(t *testing.T, query string) {
+		q, err := Parse(query)
+		if err != nil {
+			if q != nil {
+				t.Errorf("%q: got query with error %v", query, err)
+			}
+			if strings.HasPrefix(err.Error(), "cannot parse query") {
+				t.Errorf("%q: %v", query, err)
+			}
+			return
+		}
+		if q == nil {
+			t.Fatalf("%q: got nil query, want query or error", query)
+		}
+		if q.Placeholders < 0 {
+			t.Errorf("%q: got %d placeholders", query, q.Placeholders)
+		}
+
+		stmts, err := Split(query)
+		if err != nil {
+			return
+		}
+		for _, stmt := range stmts {
+			Parse(stmt.Text)
+		}
+	})
+}
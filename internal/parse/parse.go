@@ -3,9 +3,11 @@ package parse
 
 import (
 	"database/sql/driver"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/jjeffery/simpledbsql/internal/lex"
@@ -13,21 +15,63 @@ import (
 
 // Query is the representation of a single parsed query.
 type Query struct {
+	Explain     bool // if true, describe the query instead of running it
 	Select      *SelectQuery
 	Insert      *InsertQuery
 	Update      *UpdateQuery
 	Delete      *DeleteQuery
 	CreateTable *CreateTableQuery
 	DropTable   *DropTableQuery
+	ShowColumns *ShowColumnsQuery
+	ShowTables  *ShowTablesQuery
+
+	// Placeholders is the number of arguments used by the query's
+	// placeholders. Numbered placeholders can be reused, so it is the
+	// highest number of a "$n" placeholder.
+	Placeholders int
 }
 
 // SelectQuery is the representation of a select query.
 type SelectQuery struct {
 	ConsistentRead bool
+	AllColumns     bool // "select *", in which case ColumnNames is empty
 	ColumnNames    []string
 	TableName      string
 	WhereClause    []string // lexemes starting with "WHERE"
 	Key            *Key     // if non-nil, indicates a "where id = ?" query
+	MaxRows        int      // from a max_rows hint, or zero
+	MaxPages       int      // from a max_pages hint, or zero
+	EventualRead   bool     // from an eventual hint
+	MaxTime        int      // from a max_execution_time hint in milliseconds, or zero
+	ExpectRows     bool     // from an expect_rows hint
+	AllowScan      bool     // from a scan hint
+
+	// Aggregates are the items of the select list when it contains aggregate
+	// functions, such as "max(a)", or the query has a group by clause. If not
+	// empty, ColumnNames contains the names of the columns that are aggregated
+	// or grouped.
+	Aggregates []Aggregate
+	GroupBy    []string // columns in the group by clause
+	MaxGroups  int      // from a max_groups hint, or zero
+
+	// UnconstrainedSort is the column in the order by clause, if no predicate
+	// in the where clause constrains it, which SimpleDB requires.
+	UnconstrainedSort string
+}
+
+// Aggregate is an item of a select list that contains aggregate functions.
+// An item without a function is a column in the group by clause.
+type Aggregate struct {
+	Function   string // "count", "min", "max" or "sum", or blank
+	ColumnName string // "*" for "count(*)"
+}
+
+// String returns the aggregate as it appears in a select list, such as "max(a)".
+func (a Aggregate) String() string {
+	if a.Function == "" {
+		return a.ColumnName
+	}
+	return a.Function + "(" + a.ColumnName + ")"
 }
 
 // InsertQuery is the representation of an insert query.
@@ -35,6 +79,24 @@ type InsertQuery struct {
 	TableName string
 	Columns   []Column
 	Key       Key
+
+	// OnDuplicateKeyUpdate contains the columns to update if the
+	// item already exists, as specified in an "on duplicate key update"
+	// clause. If nil, the clause was not present.
+	OnDuplicateKeyUpdate []Column
+
+	// Ignore is true for an "insert ignore" query, which does nothing
+	// if the item already exists.
+	Ignore bool
+
+	// GenerateKey is true if there is no id column, in which case the
+	// item name is generated when the statement is run.
+	GenerateKey bool
+
+	// Returning contains the columns of a "returning" clause, whose
+	// written values are returned as a row. If nil, the clause was not
+	// present.
+	Returning []string
 }
 
 // UpdateQuery is the representation of an update query.
@@ -43,17 +105,36 @@ type UpdateQuery struct {
 	Upsert    bool
 	Columns   []Column
 	Key       Key
+	If        *Column // expected value of the "if" clause, if not nil
+
+	// Subquery selects the ids of the items to update, as specified in a
+	// "where id in (select id ...)" clause. If nil, Key is the item name.
+	// SubqueryArgs is the ordinal of the first argument of the subquery's
+	// "?" placeholders.
+	Subquery     *SelectQuery
+	SubqueryArgs int
+
+	// Returning contains the columns of a "returning" clause, as it
+	// does for an InsertQuery.
+	Returning []string
 }
 
 // DeleteQuery is the representation of a delete query.
 type DeleteQuery struct {
 	TableName string
 	Key       Key
+	If        *Column // expected value of the "if" clause, if not nil
+
+	// Subquery and SubqueryArgs select the ids of the items to delete,
+	// as they do for an UpdateQuery.
+	Subquery     *SelectQuery
+	SubqueryArgs int
 }
 
 // CreateTableQuery is the representation of a create table query.
 type CreateTableQuery struct {
-	TableName string
+	TableName   string
+	IfNotExists bool
 }
 
 // DropTableQuery is the representation of a drop table query.
@@ -61,12 +142,22 @@ type DropTableQuery struct {
 	TableName string
 }
 
+// ShowTablesQuery is the representation of a show tables query.
+type ShowTablesQuery struct{}
+
+// ShowColumnsQuery is the representation of a show columns query.
+type ShowColumnsQuery struct {
+	TableName string
+	Limit     int // number of items sampled, or zero for all items
+}
+
 // Column represents a column in the query
 // and the placeholder or value it is associated with.
 type Column struct {
 	ColumnName string  // name of associated column
 	Ordinal    int     // zero-based placeholder ordinal
 	Value      *string // if non-nil, then a literal value
+	Binary     []byte  // if non-nil, then a hex literal value
 }
 
 // GetValue gets the value for a column, either from the placeholder
@@ -75,6 +166,9 @@ func (col *Column) GetValue(values []driver.Value) (driver.Value, error) {
 	if col.Value != nil {
 		return *col.Value, nil
 	}
+	if col.Binary != nil {
+		return col.Binary, nil
+	}
 	if col.Ordinal < 0 || col.Ordinal >= len(values) {
 		return nil, fmt.Errorf("internal error: ordinal=%d, value len=%d", col.Ordinal, len(values))
 	}
@@ -115,15 +209,109 @@ func Parse(query string) (*Query, error) {
 	return p.parse(query)
 }
 
+// Statement is a single statement in a query that contains one or
+// more statements separated by semicolons.
+type Statement struct {
+	Text         string // text of the statement, without the semicolon
+	Placeholders int    // number of arguments used by the statement's placeholders
+}
+
+// Split splits a query into statements separated by semicolons.
+// Semicolons in quoted strings and comments do not separate statements,
+// and empty statements are discarded.
+func Split(query string) ([]Statement, error) {
+	var (
+		stmts []Statement
+		stmt  Statement
+		buf   strings.Builder
+	)
+	add := func() {
+		stmt.Text = strings.TrimSpace(buf.String())
+		if stmt.Text != "" {
+			stmts = append(stmts, stmt)
+		}
+		stmt = Statement{}
+		buf.Reset()
+	}
+	var positional int
+	lexer := lex.New(strings.NewReader(query))
+	for lexer.Scan() {
+		if lexer.Text() == ";" {
+			add()
+			positional = 0
+			continue
+		}
+		if lexer.Token() == lex.TokenPlaceholder {
+			// numbered placeholders can be reused, so the statement
+			// uses as many arguments as the highest number
+			ordinal, ok := NumberedPlaceholder(lexer.Text())
+			if !ok {
+				positional++
+				ordinal = positional - 1
+			}
+			if ordinal >= stmt.Placeholders {
+				stmt.Placeholders = ordinal + 1
+			}
+		}
+		buf.WriteString(lexer.Text())
+	}
+	if err := lexer.Err(); err != nil {
+		return nil, err
+	}
+	add()
+	return stmts, nil
+}
+
+// NumberedPlaceholder returns the zero-based argument ordinal of a
+// PostgreSQL-style numbered placeholder, such as "$1". It returns false
+// if text is not a numbered placeholder.
+func NumberedPlaceholder(text string) (int, bool) {
+	if !strings.HasPrefix(text, "$") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(text[1:])
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n - 1, true
+}
+
 type parser struct {
 	lexer            *lex.Scanner
 	query            Query
 	placeholderIndex int
+	placeholderStyle string // "?" or "$", depending on the first placeholder
 	lexemes          []string
+	hints            []string // optimizer hints before the current token
+}
+
+// ordinal returns the zero-based argument ordinal of the current
+// placeholder token.
+func (p *parser) ordinal() int {
+	if ordinal, ok := NumberedPlaceholder(p.text()); ok {
+		return ordinal
+	}
+	return p.placeholderIndex
 }
 
 func (p *parser) next() bool {
 	if p.token() == lex.TokenPlaceholder {
+		style := p.text()[:1]
+		if style == "$" {
+			if _, ok := NumberedPlaceholder(p.text()); !ok {
+				p.errorf("invalid placeholder %q", p.text())
+			}
+		}
+		if p.placeholderStyle == "" {
+			p.placeholderStyle = style
+		} else if p.placeholderStyle != style {
+			p.errorf("cannot mix ? and $n placeholders")
+		}
+
+		if ordinal := p.ordinal(); ordinal >= p.query.Placeholders {
+			p.query.Placeholders = ordinal + 1
+		}
+
 		// keep a track of how many placeholders
 		// are behind us, so when the curent token
 		// is a placeholder, then placeholderIndex
@@ -131,9 +319,11 @@ func (p *parser) next() bool {
 		p.placeholderIndex++
 	}
 	p.lexer.Scan()
+	p.hints = nil
 	for {
 		if p.token() == lex.TokenComment {
-			// ignore all comments
+			// ignore all comments, except for hints
+			p.hints = append(p.hints, parseHints(p.text())...)
 			p.lexer.Scan()
 			continue
 		}
@@ -184,9 +374,13 @@ func (p *parser) expectEOF() {
 	}
 }
 
+// syntaxError is the value of the panic raised by errorf,
+// which parse recovers and returns as an error.
+type syntaxError string
+
 func (p *parser) errorf(format string, args ...interface{}) {
 	msg := fmt.Sprintf(format, args...)
-	panic(msg)
+	panic(syntaxError(msg))
 }
 
 func (p *parser) parse(query string) (q *Query, err error) {
@@ -196,15 +390,23 @@ func (p *parser) parse(query string) (q *Query, err error) {
 
 	defer func() {
 		if e := recover(); e != nil {
-			msg, ok := e.(string)
-			if !ok {
-				panic(e)
+			q = nil
+			if msg, ok := e.(syntaxError); ok {
+				err = errors.New(string(msg))
+				return
 			}
-			err = errors.New(msg)
+			// Any other panic is a bug in the parser. Return it as an
+			// error, because a panic would escape through database/sql
+			// and crash the program.
+			err = fmt.Errorf("cannot parse query: %v", e)
 		}
 	}()
 
 	p.next()
+	if strings.EqualFold(p.text(), "explain") {
+		p.query.Explain = true
+		p.next()
+	}
 	text := p.text()
 	switch strings.ToLower(text) {
 	case "select", "consistent":
@@ -219,6 +421,8 @@ func (p *parser) parse(query string) (q *Query, err error) {
 		p.parseCreateTable()
 	case "drop":
 		p.parseDropTable()
+	case "show":
+		p.parseShow()
 	default:
 		if p.token() == lex.TokenKeyword {
 			p.errorf("unexpected keyword %q", text)
@@ -237,9 +441,121 @@ func (p *parser) parseSelect() {
 		p.expectText("select")
 	}
 	p.next()
+	if hasHint(p.hints, "consistent") {
+		p.query.Select.ConsistentRead = true
+	}
+	if hasHint(p.hints, "eventual") {
+		if p.query.Select.ConsistentRead {
+			p.errorf("conflicting hints %q and %q", "consistent", "eventual")
+		}
+		p.query.Select.EventualRead = true
+	}
+	p.query.Select.ExpectRows = hasHint(p.hints, "expect_rows")
+	p.query.Select.AllowScan = hasHint(p.hints, "scan")
+	p.query.Select.MaxRows = p.hintValue("max_rows")
+	p.query.Select.MaxPages = p.hintValue("max_pages")
+	p.query.Select.MaxTime = p.hintValue("max_execution_time")
+	p.query.Select.MaxGroups = p.hintValue("max_groups")
 	p.parseSelectColumnList()
 	p.parseSelectFromClause()
 	p.parseSelectWhereClause()
+	p.setSelectColumns()
+	p.query.Select.UnconstrainedSort = unconstrainedSort(p.query.Select.WhereClause)
+}
+
+// unconstrainedSort returns the column in the order by clause of a where
+// clause, if SimpleDB would reject the query because the column is not in
+// any of the predicates, or only in an "is null" predicate. It returns a
+// blank string if there is no order by clause, or it sorts by id.
+func unconstrainedSort(whereClause []string) string {
+	var words []string // lexemes that are not white space
+	for _, lexeme := range whereClause {
+		if strings.TrimSpace(lexeme) != "" {
+			words = append(words, lexeme)
+		}
+	}
+	order := -1
+	for i := 0; i+2 < len(words); i++ {
+		if strings.EqualFold(words[i], "order") && strings.EqualFold(words[i+1], "by") {
+			order = i
+			break
+		}
+	}
+	if order < 0 {
+		return ""
+	}
+	column := lex.Unquote(words[order+2])
+	if IsID(column) || strings.EqualFold(column, "itemName") {
+		return ""
+	}
+	for i := 0; i < order; i++ {
+		if strings.HasPrefix(words[i], "'") || strings.HasPrefix(words[i], `"`) || lex.Unquote(words[i]) != column {
+			// a string literal, or another column
+			continue
+		}
+		if i+2 < order && strings.EqualFold(words[i+1], "is") && strings.EqualFold(words[i+2], "null") {
+			continue
+		}
+		return ""
+	}
+	return column
+}
+
+// parseHints returns the hints in an optimizer hint comment, which
+// has the form "/*+ hint ... */". It returns nil for other comments.
+func parseHints(comment string) []string {
+	if !strings.HasPrefix(comment, "/*+") {
+		return nil
+	}
+	comment = strings.TrimSuffix(strings.TrimPrefix(comment, "/*+"), "*/")
+	return strings.Fields(comment)
+}
+
+func hasHint(hints []string, hint string) bool {
+	for _, h := range hints {
+		if strings.EqualFold(h, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// hintValue returns the value of a hint that has the form "name(n)",
+// or zero if there is no such hint. The value must be positive.
+func (p *parser) hintValue(name string) int {
+	for _, hint := range p.hints {
+		prefix := name + "("
+		if len(hint) <= len(prefix) || !strings.EqualFold(hint[:len(prefix)], prefix) || !strings.HasSuffix(hint, ")") {
+			continue
+		}
+		n, err := strconv.Atoi(hint[len(prefix) : len(hint)-1])
+		if err != nil || n <= 0 {
+			p.errorf("invalid hint %q", hint)
+		}
+		return n
+	}
+	return 0
+}
+
+// parseTableName parses a table name and returns it unquoted. A table name
+// can have multiple parts separated by periods, such as "dev.tbl".
+func (p *parser) parseTableName() string {
+	var marker string
+	if p.text() == "@" {
+		// "@" marks a domain name, which is not resolved by the driver
+		marker = "@"
+		p.next()
+	}
+	p.expect(lex.TokenIdent)
+	text := p.text()
+	p.next()
+	for p.text() == "." {
+		p.next()
+		p.expect(lex.TokenIdent)
+		text += "." + p.text()
+		p.next()
+	}
+	return marker + lex.Unquote(text)
 }
 
 // IsID returns true if name corresponds to the special
@@ -250,25 +566,110 @@ func IsID(name string) bool {
 }
 
 func (p *parser) parseSelectColumnList() {
-	expectIdent := func() {
+	if p.text() == "*" {
+		p.query.Select.AllColumns = true
+		p.next()
+		return
+	}
+	var items []Aggregate
+	expectItem := func() {
 		p.expect(lex.TokenIdent)
-		name := lex.Unquote(p.text())
-		p.query.Select.ColumnNames = append(p.query.Select.ColumnNames, name)
+		item := Aggregate{ColumnName: lex.Unquote(p.text())}
 		p.next()
+		if function := strings.ToLower(item.ColumnName); isAggregateFunction(function) && p.text() == "(" {
+			p.next()
+			item.Function = function
+			if function == "count" && p.text() == "*" {
+				item.ColumnName = "*"
+			} else {
+				p.expect(lex.TokenIdent)
+				item.ColumnName = lex.Unquote(p.text())
+			}
+			p.next()
+			p.expectText(")")
+			p.next()
+		}
+		items = append(items, item)
 	}
-	expectIdent()
+	expectItem()
 	for p.text() == "," {
 		p.next()
-		expectIdent()
+		expectItem()
+	}
+	p.query.Select.Aggregates = items
+}
+
+// setSelectColumns sets the column names of a select query from the items
+// of its select list, which are aggregates if any of them has a function,
+// or if the query has a group by clause.
+func (p *parser) setSelectColumns() {
+	q := p.query.Select
+	items := q.Aggregates
+	q.Aggregates = nil
+	var aggregated bool
+	for _, item := range items {
+		if item.Function != "" {
+			aggregated = true
+		}
+	}
+	if !aggregated && len(q.GroupBy) == 0 {
+		for _, item := range items {
+			q.ColumnNames = append(q.ColumnNames, item.ColumnName)
+		}
+		return
+	}
+	if q.AllColumns {
+		p.errorf("cannot use group by with select *")
+	}
+	addColumn := func(name string) {
+		for _, columnName := range q.ColumnNames {
+			if columnName == name {
+				return
+			}
+		}
+		q.ColumnNames = append(q.ColumnNames, name)
+	}
+	for _, item := range items {
+		if item.Function == "" && !hasColumn(q.GroupBy, item.ColumnName) {
+			p.errorf("column %q must be in group by clause", item.ColumnName)
+		}
+		if item.ColumnName != "*" {
+			addColumn(item.ColumnName)
+		}
+	}
+	for _, columnName := range q.GroupBy {
+		addColumn(columnName)
+	}
+	if len(q.ColumnNames) == 0 {
+		// only count(*), which needs the item names
+		addColumn("id")
+	}
+	q.Aggregates = items
+}
+
+func hasColumn(columnNames []string, name string) bool {
+	for _, columnName := range columnNames {
+		if columnName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isAggregateFunction returns true if name is the name of an aggregate
+// function that the driver computes.
+func isAggregateFunction(name string) bool {
+	switch name {
+	case "count", "min", "max", "sum":
+		return true
 	}
+	return false
 }
 
 func (p *parser) parseSelectFromClause() {
 	p.expectText("from")
 	p.next()
-	p.expect(lex.TokenIdent)
-	p.query.Select.TableName = lex.Unquote(p.text())
-	p.next()
+	p.query.Select.TableName = p.parseTableName()
 }
 
 func (p *parser) parseSelectWhereClause() {
@@ -301,7 +702,7 @@ func (p *parser) parseSelectWhereClause() {
 		value := lex.Unquote(p.text())
 		key.Value = &value
 	} else if p.token() == lex.TokenPlaceholder {
-		key.Ordinal = p.placeholderIndex
+		key.Ordinal = p.ordinal()
 	} else {
 		p.copyRemaining()
 		return
@@ -319,6 +720,10 @@ func (p *parser) parseSelectWhereClause() {
 
 func (p *parser) copyRemaining() {
 	for p.token() != lex.TokenEOF {
+		if p.token() == lex.TokenIdent && strings.EqualFold(p.text(), "group") {
+			p.parseGroupBy()
+			break
+		}
 		p.copyText()
 		p.next()
 	}
@@ -326,19 +731,55 @@ func (p *parser) copyRemaining() {
 	p.lexemes = nil
 }
 
+// parseGroupBy parses a group by clause, which is the last clause of a
+// select query. It is not part of the where clause, because the driver
+// groups the rows.
+func (p *parser) parseGroupBy() {
+	lexemes := p.lexemes
+	p.next()
+	p.expectText("by")
+	p.next()
+	for {
+		p.expect(lex.TokenIdent)
+		p.query.Select.GroupBy = append(p.query.Select.GroupBy, lex.Unquote(p.text()))
+		p.next()
+		if p.text() != "," {
+			break
+		}
+		p.next()
+	}
+	if p.token() != lex.TokenEOF {
+		p.errorf("unexpected %q after group by clause", p.text())
+	}
+	for len(lexemes) > 0 && lexemes[len(lexemes)-1] == " " {
+		lexemes = lexemes[:len(lexemes)-1]
+	}
+	p.lexemes = lexemes
+}
+
 func (p *parser) parseUpdate() {
 	p.query.Update = &UpdateQuery{}
 	if p.text() == "upsert" {
 		p.query.Update.Upsert = true
 	}
 	p.next()
-	p.expect(lex.TokenIdent)
-	p.query.Update.TableName = lex.Unquote(p.text())
-	p.next()
+	p.query.Update.TableName = p.parseTableName()
 	p.expectText("set")
 	p.next()
 	p.parseUpdateColumns()
 	p.parseUpdateWhere()
+	if strings.EqualFold(p.text(), "if") {
+		if p.query.Update.Subquery != nil {
+			p.errorf("cannot use if clause with subquery")
+		}
+		p.query.Update.If = p.parseIf()
+	}
+	if strings.EqualFold(p.text(), "returning") {
+		if p.query.Update.Subquery != nil {
+			p.errorf("cannot use returning clause with subquery")
+		}
+		p.query.Update.Returning = p.parseReturning()
+	}
 	p.expectEOF()
 }
 
@@ -358,15 +799,94 @@ func (p *parser) parseUpdateColumn() {
 	p.next()
 	p.expectText("=")
 	p.next()
-	p.expect(lex.TokenPlaceholder, lex.TokenLiteral)
+	p.parseColumnValue(&col)
+	p.query.Update.Columns = append(p.query.Update.Columns, col)
+}
+
+// parseColumnValue parses the placeholder or literal value for a column.
+// SimpleDB cannot evaluate expressions, so a value that is part of an
+// expression, such as "a || 'x'" or "n + 1", is an error.
+func (p *parser) parseColumnValue(col *Column) {
+	if p.token() != lex.TokenIdent {
+		p.expect(lex.TokenPlaceholder, lex.TokenLiteral)
+	}
+	// white space is kept, in case the value is part of an expression
+	p.lexer.IgnoreWhiteSpace = false
+	p.lexemes = nil
+	p.copyText()
+	isIdent := p.token() == lex.TokenIdent
 	if p.token() == lex.TokenPlaceholder {
-		col.Ordinal = p.placeholderIndex
-	} else {
-		value := lex.Unquote(p.text())
-		col.Value = &value
+		col.Ordinal = p.ordinal()
+	} else if !isIdent {
+		p.setLiteral(col)
 	}
-	p.query.Update.Columns = append(p.query.Update.Columns, col)
 	p.next()
+	if isIdent || isExpressionOperator(p.token(), p.text()) {
+		p.rejectExpression()
+	}
+	p.lexer.IgnoreWhiteSpace = true
+	p.lexemes = nil
+}
+
+// isExpressionOperator returns true if a token following a value
+// continues an expression.
+func isExpressionOperator(tok lex.Token, text string) bool {
+	if tok != lex.TokenOperator {
+		return false
+	}
+	switch text {
+	case ",", ")", ";":
+		return false
+	}
+	return true
+}
+
+// rejectExpression reports an error for an expression that starts with the
+// copied lexemes. The error contains the expression, up to the end of the
+// column value.
+func (p *parser) rejectExpression() {
+	var depth int
+	for p.token() != lex.TokenEOF && p.text() != ";" {
+		if depth == 0 && (p.text() == "," || p.text() == ")" || strings.EqualFold(p.text(), "where")) {
+			break
+		}
+		switch p.text() {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		p.copyText()
+		p.next()
+	}
+	statement := "insert"
+	if p.query.Update != nil {
+		statement = "update"
+	} else if p.query.Delete != nil {
+		statement = "delete"
+	}
+	p.errorf("%s statement cannot evaluate expression %q, use a placeholder or literal value",
+		statement, strings.TrimSpace(strings.Join(p.lexemes, "")))
+}
+
+// setLiteral sets the value of a column to the literal value in the current
+// token. Hex literals, such as x'0a1b', are binary values.
+func (p *parser) setLiteral(col *Column) {
+	text := p.text()
+	if isHexLiteral(text) {
+		b, err := hex.DecodeString(lex.Unquote(text[1:]))
+		if err != nil {
+			p.errorf("invalid hex literal %s", text)
+		}
+		col.Binary = b
+		return
+	}
+	value := lex.Unquote(text)
+	col.Value = &value
+}
+
+func isHexLiteral(text string) bool {
+	return len(text) >= 3 && (text[0] == 'x' || text[0] == 'X') && text[1] == '\''
 }
 
 func (p *parser) parseUpdateWhere() {
@@ -374,12 +894,17 @@ func (p *parser) parseUpdateWhere() {
 	p.next()
 	p.expectText("id")
 	p.next()
+	if strings.EqualFold(p.text(), "in") {
+		q := p.query.Update
+		q.Subquery, q.SubqueryArgs = p.parseSubquery(q.TableName)
+		return
+	}
 	p.expectText("=")
 	p.next()
 	p.expect(lex.TokenPlaceholder, lex.TokenLiteral)
 	if p.token() == lex.TokenPlaceholder {
 		p.query.Update.Key = Key{
-			Ordinal: p.placeholderIndex,
+			Ordinal: p.ordinal(),
 		}
 	} else {
 		value := lex.Unquote(p.text())
@@ -390,28 +915,193 @@ func (p *parser) parseUpdateWhere() {
 	p.next()
 }
 
+// parseSubquery parses the "in (select id from tbl where ...)" clause of an
+// update or delete statement, which selects the ids of the items to modify
+// from the statement's table. It returns the select query, and the ordinal
+// of the argument of its first "?" placeholder.
+func (p *parser) parseSubquery(tableName string) (*SelectQuery, int) {
+	p.next()
+	p.expectText("(")
+	p.next()
+	p.expectText("select")
+	ordinal := p.placeholderIndex
+	p.next()
+
+	// the select clauses are parsed into p.query.Select
+	p.query.Select = &SelectQuery{}
+	defer func() {
+		p.query.Select = nil
+	}()
+	p.parseSelectColumnList()
+	p.setSelectColumns()
+	q := p.query.Select
+	if q.AllColumns || len(q.Aggregates) > 0 || len(q.ColumnNames) != 1 || !IsID(q.ColumnNames[0]) {
+		p.errorf("subquery must select only the id column")
+	}
+	p.parseSelectFromClause()
+	if q.TableName != tableName {
+		p.errorf("subquery must select from table %q", tableName)
+	}
+	if strings.EqualFold(p.text(), "where") {
+		// need white space when copying lexemes
+		p.lexer.IgnoreWhiteSpace = false
+		for depth := 0; depth > 0 || p.text() != ")"; p.next() {
+			switch {
+			case p.token() == lex.TokenEOF:
+				p.errorf("expected %q, found end of query", ")")
+			case p.text() == "(":
+				depth++
+			case p.text() == ")":
+				depth--
+			}
+			p.copyText()
+		}
+		q.WhereClause = p.lexemes
+		p.lexemes = nil
+		p.lexer.IgnoreWhiteSpace = true
+	}
+	p.expectText(")")
+	p.next()
+	if p.placeholderStyle == "$" {
+		// numbered placeholders are not relative to the subquery
+		ordinal = 0
+	}
+	return q, ordinal
+}
+
+// parseIf parses the "if col = value" clause of an update or delete statement,
+// which is the value that the column must have for the row to be modified.
+func (p *parser) parseIf() *Column {
+	p.next()
+	p.expect(lex.TokenIdent)
+	col := Column{
+		ColumnName: lex.Unquote(p.text()),
+	}
+	if IsID(col.ColumnName) {
+		p.errorf("cannot compare id column in if clause")
+	}
+	p.next()
+	p.expectText("=")
+	p.next()
+	p.parseColumnValue(&col)
+	return &col
+}
+
 func (p *parser) parseInsert() {
 	p.query.Insert = &InsertQuery{}
 	p.next()
+	if strings.EqualFold(p.text(), "ignore") {
+		p.query.Insert.Ignore = true
+		p.next()
+	}
 	if strings.EqualFold(p.text(), "into") {
 		p.next()
 	}
-	p.expect(lex.TokenIdent)
-	p.query.Insert.TableName = lex.Unquote(p.text())
+	p.query.Insert.TableName = p.parseTableName()
+	if strings.EqualFold(p.text(), "set") {
+		p.next()
+		p.parseInsertSetList()
+	} else {
+		p.expectText("(")
+		p.next()
+		p.parseInsertColumnList()
+		p.expectText(")")
+		p.next()
+		p.expectText("values")
+		p.next()
+		p.expectText("(")
+		p.next()
+		p.parseInsertValueList()
+		p.expectText(")")
+		p.next()
+	}
+	if strings.EqualFold(p.text(), "on") {
+		if p.query.Insert.Ignore {
+			p.errorf("insert ignore cannot have an on duplicate key update clause")
+		}
+		p.parseOnDuplicateKeyUpdate()
+	}
+	if strings.EqualFold(p.text(), "returning") {
+		if p.query.Insert.OnDuplicateKeyUpdate != nil {
+			p.errorf("cannot use returning clause with on duplicate key update clause")
+		}
+		p.query.Insert.Returning = p.parseReturning()
+	}
+	p.expectEOF()
+}
+
+// parseReturning parses a "returning" clause.
+func (p *parser) parseReturning() []string {
+	var names []string
+	parseName := func() {
+		p.expect(lex.TokenIdent)
+		names = append(names, lex.Unquote(p.text()))
+		p.next()
+	}
 	p.next()
-	p.expectText("(")
+	parseName()
+	for p.text() == "," {
+		p.next()
+		parseName()
+	}
+	return names
+}
+
+func (p *parser) parseOnDuplicateKeyUpdate() {
 	p.next()
-	p.parseInsertColumnList()
-	p.expectText(")")
+	p.expectText("duplicate")
 	p.next()
-	p.expectText("values")
+	p.expectText("key")
 	p.next()
-	p.expectText("(")
+	p.expectText("update")
 	p.next()
-	p.parseInsertValueList()
-	p.expectText(")")
+	p.parseDuplicateKeyColumn()
+	for p.text() == "," {
+		p.next()
+		p.parseDuplicateKeyColumn()
+	}
+}
+
+// parseDuplicateKeyColumn parses a column assignment in an "on duplicate key update"
+// clause. In addition to placeholders and literals, the value can be "values(col)",
+// which refers to the value for the column in the insert value list.
+func (p *parser) parseDuplicateKeyColumn() {
+	p.expect(lex.TokenIdent)
+	col := Column{
+		ColumnName: lex.Unquote(p.text()),
+	}
+	if IsID(col.ColumnName) {
+		p.errorf("cannot update id column in on duplicate key update clause")
+	}
 	p.next()
-	p.expectEOF()
+	p.expectText("=")
+	p.next()
+	if p.text() == "values" {
+		p.next()
+		p.expectText("(")
+		p.next()
+		p.expect(lex.TokenIdent)
+		name := lex.Unquote(p.text())
+		var found bool
+		for _, insertCol := range p.query.Insert.Columns {
+			if insertCol.ColumnName == name {
+				col.Ordinal = insertCol.Ordinal
+				col.Value = insertCol.Value
+				col.Binary = insertCol.Binary
+				found = true
+				break
+			}
+		}
+		if !found {
+			p.errorf("unknown column %q in values()", name)
+		}
+		p.next()
+		p.expectText(")")
+		p.next()
+	} else {
+		p.parseColumnValue(&col)
+	}
+	p.query.Insert.OnDuplicateKeyUpdate = append(p.query.Insert.OnDuplicateKeyUpdate, col)
 }
 
 func (p *parser) parseInsertColumnList() {
@@ -444,19 +1134,37 @@ func (p *parser) parseInsertValueList() {
 			p.expectText(",")
 			p.next()
 		}
-		col := &p.query.Insert.Columns[i]
-		p.expect(lex.TokenPlaceholder, lex.TokenLiteral)
-		if p.token() == lex.TokenPlaceholder {
-			col.Ordinal = p.placeholderIndex
-		} else {
-			value := lex.Unquote(p.text())
-			col.Value = &value
+		p.parseColumnValue(&p.query.Insert.Columns[i])
+	}
+	p.setInsertKey()
+}
+
+// parseInsertSetList parses the column assignments of an insert statement
+// in the MySQL set form, "insert into tbl set id = ?, a = ?", which is
+// equivalent to "insert into tbl(id, a) values(?, ?)".
+func (p *parser) parseInsertSetList() {
+	parseAssignment := func() {
+		p.expect(lex.TokenIdent)
+		col := Column{
+			ColumnName: lex.Unquote(p.text()),
 		}
 		p.next()
+		p.expectText("=")
+		p.next()
+		p.parseColumnValue(&col)
+		p.query.Insert.Columns = append(p.query.Insert.Columns, col)
 	}
+	parseAssignment()
+	for p.text() == "," {
+		p.next()
+		parseAssignment()
+	}
+	p.setInsertKey()
+}
 
-	// strip out the id column in the insert statement
-	// and put it in the key field
+// setInsertKey removes the id column from the columns of an insert
+// statement, and puts its value in the key.
+func (p *parser) setInsertKey() {
 	var haveKey bool
 	columns := make([]Column, 0, len(p.query.Insert.Columns))
 	for _, col := range p.query.Insert.Columns {
@@ -464,6 +1172,9 @@ func (p *parser) parseInsertValueList() {
 			if haveKey {
 				p.errorf("duplicate id column in insert statement")
 			}
+			if col.Binary != nil {
+				p.errorf("id column cannot be a hex literal")
+			}
 			p.query.Insert.Key = Key{
 				Ordinal: col.Ordinal,
 				Value:   col.Value,
@@ -474,7 +1185,7 @@ func (p *parser) parseInsertValueList() {
 		}
 	}
 	if !haveKey {
-		p.errorf("missing id column in insert statement")
+		p.query.Insert.GenerateKey = true
 	}
 	p.query.Insert.Columns = columns
 }
@@ -485,10 +1196,14 @@ func (p *parser) parseDelete() {
 	if strings.ToLower(p.text()) == "from" {
 		p.next()
 	}
-	p.expect(lex.TokenIdent)
-	p.query.Delete.TableName = lex.Unquote(p.text())
-	p.next()
+	p.query.Delete.TableName = p.parseTableName()
 	p.parseDeleteWhere()
+	if strings.EqualFold(p.text(), "if") {
+		if p.query.Delete.Subquery != nil {
+			p.errorf("cannot use if clause with subquery")
+		}
+		p.query.Delete.If = p.parseIf()
+	}
 	p.expectEOF()
 }
 
@@ -497,12 +1212,17 @@ func (p *parser) parseDeleteWhere() {
 	p.next()
 	p.expectText("id")
 	p.next()
+	if strings.EqualFold(p.text(), "in") {
+		q := p.query.Delete
+		q.Subquery, q.SubqueryArgs = p.parseSubquery(q.TableName)
+		return
+	}
 	p.expectText("=")
 	p.next()
 	p.expect(lex.TokenPlaceholder, lex.TokenLiteral)
 	if p.token() == lex.TokenPlaceholder {
 		p.query.Delete.Key = Key{
-			Ordinal: p.placeholderIndex,
+			Ordinal: p.ordinal(),
 		}
 	} else {
 		value := lex.Unquote(p.text())
@@ -518,9 +1238,15 @@ func (p *parser) parseCreateTable() {
 	p.next()
 	p.expectText("table")
 	p.next()
-	p.expect(lex.TokenIdent)
-	p.query.CreateTable.TableName = lex.Unquote(p.text())
-	p.next()
+	if strings.EqualFold(p.text(), "if") {
+		p.next()
+		p.expectText("not")
+		p.next()
+		p.expectText("exists")
+		p.next()
+		p.query.CreateTable.IfNotExists = true
+	}
+	p.query.CreateTable.TableName = p.parseTableName()
 	p.expectEOF()
 }
 
@@ -529,8 +1255,37 @@ func (p *parser) parseDropTable() {
 	p.next()
 	p.expectText("table")
 	p.next()
-	p.expect(lex.TokenIdent)
-	p.query.DropTable.TableName = lex.Unquote(p.text())
+	p.query.DropTable.TableName = p.parseTableName()
+	p.expectEOF()
+}
+
+func (p *parser) parseShow() {
 	p.next()
+	if strings.EqualFold(p.text(), "tables") {
+		p.query.ShowTables = &ShowTablesQuery{}
+		p.next()
+		p.expectEOF()
+		return
+	}
+	p.parseShowColumns()
+}
+
+func (p *parser) parseShowColumns() {
+	p.query.ShowColumns = &ShowColumnsQuery{}
+	p.expectText("columns")
+	p.next()
+	p.expectText("from")
+	p.next()
+	p.query.ShowColumns.TableName = p.parseTableName()
+	if strings.EqualFold(p.text(), "limit") {
+		p.next()
+		p.expect(lex.TokenLiteral)
+		n, err := strconv.Atoi(p.text())
+		if err != nil || n <= 0 {
+			p.errorf("invalid limit %q", p.text())
+		}
+		p.query.ShowColumns.Limit = n
+		p.next()
+	}
 	p.expectEOF()
 }
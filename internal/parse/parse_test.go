@@ -13,7 +13,17 @@ func TestParseSelect(t *testing.T) {
 		tableName   string
 		whereClause []string
 		consistent  bool
+		allColumns  bool
 		key         *Key
+		maxRows     int
+		maxPages    int
+		eventual    bool
+		expectRows  bool
+		maxTime     int
+		aggregates  []Aggregate
+		groupBy     []string
+		maxGroups   int
+		unsorted    string
 	}{
 		{
 			query:       "select a, b, c from tbl where id = ?",
@@ -29,6 +39,12 @@ func TestParseSelect(t *testing.T) {
 				Value: stringPtr("11"),
 			},
 		},
+		{
+			query:       "select a from @prod.`tbl` where id = ?",
+			columnNames: []string{"a"},
+			tableName:   "@prod.tbl",
+			key:         &Key{},
+		},
 		{
 			query:       "select a, b, c from tbl limit 10",
 			columnNames: []string{"a", "b", "c"},
@@ -90,6 +106,119 @@ func TestParseSelect(t *testing.T) {
 			},
 			consistent: true,
 		},
+		{
+			query:      "select * from tbl where a = ?",
+			tableName:  "tbl",
+			allColumns: true,
+			whereClause: []string{
+				"where", " ", "a", " ", "=", " ", "?",
+			},
+		},
+		{
+			query:       "select /*+ consistent */ a from tbl",
+			columnNames: []string{"a"},
+			tableName:   "tbl",
+			consistent:  true,
+		},
+		{
+			query:       "SELECT /*+ other CONSISTENT */ a FROM tbl",
+			columnNames: []string{"a"},
+			tableName:   "tbl",
+			consistent:  true,
+		},
+		{
+			query:       "select /* consistent */ a from tbl",
+			columnNames: []string{"a"},
+			tableName:   "tbl",
+		},
+		{
+			query:       "select a /*+ consistent */ from tbl",
+			columnNames: []string{"a"},
+			tableName:   "tbl",
+		},
+		{
+			query:       "select /*+ consistent MAX_ROWS(100) max_pages(3) */ a from tbl",
+			columnNames: []string{"a"},
+			tableName:   "tbl",
+			consistent:  true,
+			maxRows:     100,
+			maxPages:    3,
+		},
+		{
+			query:       "select /*+ eventual max_execution_time(500) */ a from tbl",
+			columnNames: []string{"a"},
+			tableName:   "tbl",
+			eventual:    true,
+			maxTime:     500,
+		},
+		{
+			query:       "select /*+ expect_rows */ a from tbl",
+			columnNames: []string{"a"},
+			tableName:   "tbl",
+			expectRows:  true,
+		},
+		{
+			query:       "select MIN(a), max(`a`), sum(b) from tbl where c = ?",
+			columnNames: []string{"a", "b"},
+			tableName:   "tbl",
+			whereClause: []string{
+				"where", " ", "c", " ", "=", " ", "?",
+			},
+			aggregates: []Aggregate{
+				{Function: "min", ColumnName: "a"},
+				{Function: "max", ColumnName: "a"},
+				{Function: "sum", ColumnName: "b"},
+			},
+		},
+		{
+			query:       "select /*+ max_groups(20) */ a, count(*), count(c) from tbl where b > ? group by a, b",
+			columnNames: []string{"a", "c", "b"},
+			tableName:   "tbl",
+			whereClause: []string{
+				"where", " ", "b", " ", ">", " ", "?",
+			},
+			aggregates: []Aggregate{
+				{ColumnName: "a"},
+				{Function: "count", ColumnName: "*"},
+				{Function: "count", ColumnName: "c"},
+			},
+			groupBy:   []string{"a", "b"},
+			maxGroups: 20,
+		},
+		{
+			query:       "select count(*) from tbl",
+			columnNames: []string{"id"},
+			tableName:   "tbl",
+			aggregates: []Aggregate{
+				{Function: "count", ColumnName: "*"},
+			},
+		},
+		{
+			// a column named like an aggregate function
+			query:       "select max, sum from tbl",
+			columnNames: []string{"max", "sum"},
+			tableName:   "tbl",
+		},
+		{
+			query:       "select a from tbl where b = 1 order by a desc",
+			columnNames: []string{"a"},
+			tableName:   "tbl",
+			whereClause: []string{"where", " ", "b", " ", "=", " ", "1", " ", "order", " ", "by", " ", "a", " ", "desc"},
+			unsorted:    "a",
+		},
+		{
+			query:       "select a from tbl where a is null order by a",
+			columnNames: []string{"a"},
+			tableName:   "tbl",
+			whereClause: []string{"where", " ", "a", " ", "is", " ", "null", " ", "order", " ", "by", " ", "a"},
+			unsorted:    "a",
+		},
+		{
+			query:       "select a from tbl where `a` > 'a' order by a",
+			columnNames: []string{"a"},
+			tableName:   "tbl",
+			whereClause: []string{"where", " ", "`a`", " ", ">", " ", "'a'", " ", "order", " ", "by", " ", "a"},
+		},
 	}
 
 	for tn, tt := range tests {
@@ -108,9 +237,37 @@ func TestParseSelect(t *testing.T) {
 		if got, want := q.Select.ConsistentRead, tt.consistent; got != want {
 			t.Errorf("%d: got=%v, want=%v", tn, got, want)
 		}
+		if got, want := q.Select.AllColumns, tt.allColumns; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
 		if got, want := q.Select.Key, tt.key; !reflect.DeepEqual(got, want) {
 			t.Errorf("%d: got=%+v, want=%+v", tn, got, want)
 		}
+		if got, want := q.Select.MaxRows, tt.maxRows; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+		if got, want := q.Select.MaxPages, tt.maxPages; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+		if got, want := q.Select.EventualRead, tt.eventual; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+		if got, want := q.Select.MaxTime, tt.maxTime; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+		if got, want := q.Select.ExpectRows, tt.expectRows; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+		if got, want := q.Select.Aggregates, tt.aggregates; !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: got=%+v, want=%+v", tn, got, want)
+		}
+		compareStringSlices(t, tn, q.Select.GroupBy, tt.groupBy)
+		if got, want := q.Select.MaxGroups, tt.maxGroups; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+		if got, want := q.Select.UnconstrainedSort, tt.unsorted; got != want {
+			t.Errorf("%d: got=%q, want=%q", tn, got, want)
+		}
 	}
 }
 
@@ -119,6 +276,26 @@ func TestParseUpdate(t *testing.T) {
 		query string
 		upd   *UpdateQuery
 	}{
+		{
+			query: "update tbl set a = ? where id = ? if b = 'x' returning id, a",
+			upd: &UpdateQuery{
+				TableName: "tbl",
+				Columns: []Column{
+					{
+						ColumnName: "a",
+						Ordinal:    0,
+					},
+				},
+				Key: Key{
+					Ordinal: 1,
+				},
+				If: &Column{
+					ColumnName: "b",
+					Value:      stringPtr("x"),
+				},
+				Returning: []string{"id", "a"},
+			},
+		},
 		{
 			query: "update tbl set a=?, b = ? where id = ?",
 			upd: &UpdateQuery{
@@ -157,6 +334,25 @@ func TestParseUpdate(t *testing.T) {
 				},
 			},
 		},
+		{
+			query: "update tbl set a = ? where id = ? if a = ?",
+			upd: &UpdateQuery{
+				TableName: "tbl",
+				Columns: []Column{
+					{
+						ColumnName: "a",
+						Ordinal:    0,
+					},
+				},
+				Key: Key{
+					Ordinal: 1,
+				},
+				If: &Column{
+					ColumnName: "a",
+					Ordinal:    2,
+				},
+			},
+		},
 		{
 			query: "-- a comment\nuPdate `tbl` seT a=?, b ='done' where id = 'xx'",
 			upd: &UpdateQuery{
@@ -176,6 +372,41 @@ func TestParseUpdate(t *testing.T) {
 				},
 			},
 		},
+		{
+			query: "update tbl set a = ? where id in (select id from tbl where b = ? and (c = '(' or d = ?) ) ",
+			upd: &UpdateQuery{
+				TableName: "tbl",
+				Columns: []Column{
+					{
+						ColumnName: "a",
+						Ordinal:    0,
+					},
+				},
+				Subquery: &SelectQuery{
+					ColumnNames: []string{"id"},
+					TableName:   "tbl",
+					WhereClause: []string{"where", " ", "b", " ", "=", " ", "?", " ", "and", " ", "(", "c", " ", "=", " ", "'('", " ", "or", " ", "d", " ", "=", " ", "?", ")", " "},
+				},
+				SubqueryArgs: 1,
+			},
+		},
+		{
+			query: "update tbl set a = $2 where id in (select id from tbl where b = $1)",
+			upd: &UpdateQuery{
+				TableName: "tbl",
+				Columns: []Column{
+					{
+						ColumnName: "a",
+						Ordinal:    1,
+					},
+				},
+				Subquery: &SelectQuery{
+					ColumnNames: []string{"id"},
+					TableName:   "tbl",
+					WhereClause: []string{"where", " ", "b", " ", "=", " ", "$1"},
+				},
+			},
+		},
 	}
 
 	for tn, tt := range tests {
@@ -218,6 +449,22 @@ func TestParseInsert(t *testing.T) {
 				},
 			},
 		},
+		{
+			query: "insert ignore into tbl(id, a) values(?,?)",
+			ins: &InsertQuery{
+				TableName: "tbl",
+				Columns: []Column{
+					{
+						ColumnName: "a",
+						Ordinal:    1,
+					},
+				},
+				Key: Key{
+					Ordinal: 0,
+				},
+				Ignore: true,
+			},
+		},
 		{
 			query: "insert `tbl`(a,b,id) values('a','b','1')",
 			ins: &InsertQuery{
@@ -237,6 +484,147 @@ func TestParseInsert(t *testing.T) {
 				},
 			},
 		},
+		{
+			query: "insert into tbl set a = ?, b = ? returning id",
+			ins: &InsertQuery{
+				TableName: "tbl",
+				Columns: []Column{
+					{
+						ColumnName: "a",
+						Ordinal:    0,
+					},
+					{
+						ColumnName: "b",
+						Ordinal:    1,
+					},
+				},
+				GenerateKey: true,
+				Returning:   []string{"id"},
+			},
+		},
+		{
+			query: "insert ignore into tbl(id, a) values(?, ?) returning a, `id`",
+			ins: &InsertQuery{
+				TableName: "tbl",
+				Columns: []Column{
+					{
+						ColumnName: "a",
+						Ordinal:    1,
+					},
+				},
+				Key:       Key{},
+				Ignore:    true,
+				Returning: []string{"a", "id"},
+			},
+		},
+		{
+			query: "insert into tbl set a = ?, id = ?, b = 'b' on duplicate key update a = values(a)",
+			ins: &InsertQuery{
+				TableName: "tbl",
+				Columns: []Column{
+					{
+						ColumnName: "a",
+						Ordinal:    0,
+					},
+					{
+						ColumnName: "b",
+						Value:      stringPtr("b"),
+					},
+				},
+				Key: Key{
+					Ordinal: 1,
+				},
+				OnDuplicateKeyUpdate: []Column{
+					{
+						ColumnName: "a",
+						Ordinal:    0,
+					},
+				},
+			},
+		},
+		{
+			query: "insert into tbl(id, a, b) values(?, ?, 'b') on duplicate key update a = values(a), b = values(b), c = ?",
+			ins: &InsertQuery{
+				TableName: "tbl",
+				Columns: []Column{
+					{
+						ColumnName: "a",
+						Ordinal:    1,
+					},
+					{
+						ColumnName: "b",
+						Value:      stringPtr("b"),
+					},
+				},
+				Key: Key{
+					Ordinal: 0,
+				},
+				OnDuplicateKeyUpdate: []Column{
+					{
+						ColumnName: "a",
+						Ordinal:    1,
+					},
+					{
+						ColumnName: "b",
+						Value:      stringPtr("b"),
+					},
+					{
+						ColumnName: "c",
+						Ordinal:    2,
+					},
+				},
+			},
+		},
+		{
+			query: "insert into tbl(id, a, b) values($2, $1, $1) on duplicate key update b = $3",
+			ins: &InsertQuery{
+				TableName: "tbl",
+				Columns: []Column{
+					{
+						ColumnName: "a",
+						Ordinal:    0,
+					},
+					{
+						ColumnName: "b",
+						Ordinal:    0,
+					},
+				},
+				Key: Key{
+					Ordinal: 1,
+				},
+				OnDuplicateKeyUpdate: []Column{
+					{
+						ColumnName: "b",
+						Ordinal:    2,
+					},
+				},
+			},
+		},
+		{
+			query: "insert into tbl(id, a, b) values('1', x'0aFF', X'') on duplicate key update a = values(a)",
+			ins: &InsertQuery{
+				TableName: "tbl",
+				Columns: []Column{
+					{
+						ColumnName: "a",
+						Binary:     []byte{0x0a, 0xff},
+					},
+					{
+						ColumnName: "b",
+						Binary:     []byte{},
+					},
+				},
+				Key: Key{
+					Value: stringPtr("1"),
+				},
+				OnDuplicateKeyUpdate: []Column{
+					{
+						ColumnName: "a",
+						Binary:     []byte{0x0a, 0xff},
+					},
+				},
+			},
+		},
 	}
 
 	for tn, tt := range tests {
@@ -278,6 +666,29 @@ func TestParseDelete(t *testing.T) {
 				},
 			},
 		},
+		{
+			query: "delete from tbl where id = ? if version = '3'",
+			del: &DeleteQuery{
+				TableName: "tbl",
+				Key: Key{
+					Ordinal: 0,
+				},
+				If: &Column{
+					ColumnName: "version",
+					Value:      stringPtr("3"),
+				},
+			},
+		},
+		{
+			query: "delete from tbl where id in (select `id` from tbl)",
+			del: &DeleteQuery{
+				TableName: "tbl",
+				Subquery: &SelectQuery{
+					ColumnNames: []string{"id"},
+					TableName:   "tbl",
+				},
+			},
+		},
 	}
 
 	for tn, tt := range tests {
@@ -307,6 +718,25 @@ func TestParseCreateTable(t *testing.T) {
 				TableName: "tbl",
 			},
 		},
+		{
+			query: "create table dev.tbl",
+			ct: &CreateTableQuery{
+				TableName: "dev.tbl",
+			},
+		},
+		{
+			query: "create table `dev`.[my tbl]",
+			ct: &CreateTableQuery{
+				TableName: "dev.my tbl",
+			},
+		},
+		{
+			query: "create table if not exists tbl",
+			ct: &CreateTableQuery{
+				TableName:   "tbl",
+				IfNotExists: true,
+			},
+		},
 	}
 
 	for tn, tt := range tests {
@@ -354,6 +784,90 @@ func TestParseDropTable(t *testing.T) {
 	}
 }
 
+func TestParseShowTables(t *testing.T) {
+	for _, query := range []string{"show tables", "SHOW TABLES"} {
+		q, err := Parse(query)
+		if err != nil {
+			t.Errorf("%s: got=%v, want=nil", query, err)
+			continue
+		}
+		if q.ShowTables == nil {
+			t.Errorf("%s: got=nil, want=non-nil", query)
+		}
+	}
+}
+
+func TestParseShowColumns(t *testing.T) {
+	tests := []struct {
+		query string
+		sc    *ShowColumnsQuery
+	}{
+		{
+			query: "show columns from tbl",
+			sc: &ShowColumnsQuery{
+				TableName: "tbl",
+			},
+		},
+		{
+			query: "SHOW COLUMNS FROM dev.tbl LIMIT 100",
+			sc: &ShowColumnsQuery{
+				TableName: "dev.tbl",
+				Limit:     100,
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		q, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("%d: got=%v, want=nil", tn, err)
+			continue
+		}
+		if q.ShowColumns == nil {
+			t.Errorf("%d: got=nil, want=non-nil", tn)
+			continue
+		}
+		if !reflect.DeepEqual(q.ShowColumns, tt.sc) {
+			t.Errorf("%d: got=%v\n  want=%v\n", tn, q.ShowColumns, tt.sc)
+		}
+	}
+}
+
+func TestParseExplain(t *testing.T) {
+	tests := []struct {
+		query   string
+		explain bool
+	}{
+		{
+			query:   "explain select a from tbl",
+			explain: true,
+		},
+		{
+			query:   "EXPLAIN consistent select a from tbl where id = ?",
+			explain: true,
+		},
+		{
+			query:   "explain update tbl set a = ? where id = ?",
+			explain: true,
+		},
+		{
+			query:   "select a from tbl",
+			explain: false,
+		},
+	}
+
+	for tn, tt := range tests {
+		q, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("%d: got=%v, want=nil", tn, err)
+			continue
+		}
+		if got, want := q.Explain, tt.explain; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+	}
+}
+
 func TestParseErrors(t *testing.T) {
 	tests := []struct {
 		query   string
@@ -368,17 +882,113 @@ func TestParseErrors(t *testing.T) {
 			errtext: `unexpected "from"`,
 		},
 		{
-			query:   "from wherever",
-			errtext: `unexpected keyword "from"`,
+			query:   "select a, max(b) from tbl",
+			errtext: `column "a" must be in group by clause`,
+		},
+		{
+			query:   "select a, count(*) from tbl group by b",
+			errtext: `column "a" must be in group by clause`,
+		},
+		{
+			query:   "select a, count(*) from tbl group a",
+			errtext: `expected "by", found "a"`,
+		},
+		{
+			query:   "select a, count(*) from tbl group by a order by a",
+			errtext: `unexpected "order" after group by clause`,
 		},
 		{
-			query:   "insert into tbl(a, b) values(?, ?)",
-			errtext: "missing id column in insert statement",
+			query:   "select * from tbl group by a",
+			errtext: "cannot use group by with select *",
+		},
+		{
+			query:   "select sum(*) from tbl",
+			errtext: `unexpected "*"`,
+		},
+		{
+			query:   "select max(b from tbl",
+			errtext: `expected ")", found "from"`,
+		},
+		{
+			query:   "from wherever",
+			errtext: `unexpected keyword "from"`,
 		},
 		{
 			query:   "insert into tbl(id, a, b, id) values(?,?,?,?)",
 			errtext: "duplicate id column in insert statement",
 		},
+		{
+			query:   "insert into tbl(id, a) values(?, ?) on duplicate key update a = ? returning a",
+			errtext: "cannot use returning clause with on duplicate key update clause",
+		},
+		{
+			query:   "update tbl set a = ? where id in (select id from tbl where b = ?) returning a",
+			errtext: "cannot use returning clause with subquery",
+		},
+		{
+			query:   "insert into tbl set id = ?, a = ? b = ?",
+			errtext: `expected end of query, found "b"`,
+		},
+		{
+			query:   "insert into tbl(id, a) values(?, ?) on duplicate key update id = ?",
+			errtext: "cannot update id column in on duplicate key update clause",
+		},
+		{
+			query:   "insert into tbl(id, a) values(?, ?) on duplicate key update b = values(b)",
+			errtext: `unknown column "b" in values()`,
+		},
+		{
+			query:   "update tbl set a = a || 'x' where id = ?",
+			errtext: `update statement cannot evaluate expression "a || 'x'", use a placeholder or literal value`,
+		},
+		{
+			query:   "update tbl set b = 'b', n = ? + 1 where id = ?",
+			errtext: `update statement cannot evaluate expression "? + 1", use a placeholder or literal value`,
+		},
+		{
+			query:   "insert into tbl(id, a, b) values(?, concat('a', ?), ?)",
+			errtext: `insert statement cannot evaluate expression "concat('a', ?)", use a placeholder or literal value`,
+		},
+		{
+			query:   "insert into tbl(id, a) values(?, ?) on duplicate key update n = n+1",
+			errtext: `insert statement cannot evaluate expression "n+1", use a placeholder or literal value`,
+		},
+		{
+			query:   "insert into tbl(id, a) values(?, ?) on conflict do nothing",
+			errtext: `expected "duplicate", found "conflict"`,
+		},
+		{
+			query:   "show columns from tbl limit 0",
+			errtext: `invalid limit "0"`,
+		},
+		{
+			query:   "select /*+ max_rows(none) */ a from tbl",
+			errtext: `invalid hint "max_rows(none)"`,
+		},
+		{
+			query:   "insert ignore into tbl(id, a) values(?, ?) on duplicate key update a = ?",
+			errtext: "insert ignore cannot have an on duplicate key update clause",
+		},
+		{
+			query:   "consistent select /*+ eventual */ a from tbl",
+			errtext: `conflicting hints "consistent" and "eventual"`,
+		},
+		{
+			query:   "show indexes from tbl",
+			errtext: `expected "columns", found "indexes"`,
+		},
+		{
+			query:   "update tbl set a = ? where id = ? if id = ?",
+			errtext: "cannot compare id column in if clause",
+		},
+		{
+			query:   "delete from tbl where id = ? if version = ? + 1",
+			errtext: `delete statement cannot evaluate expression "? + 1", use a placeholder or literal value`,
+		},
+		{
+			query:   "update tbl set a = ? where id = ? if a = a + 1",
+			errtext: `update statement cannot evaluate expression "a + 1", use a placeholder or literal value`,
+		},
 		{
 			query:   "update x set y = ? where id = ? robins",
 			errtext: `expected end of query, found "robins"`,
@@ -387,6 +997,42 @@ func TestParseErrors(t *testing.T) {
 			query:   "update x get y = ? where id = ?",
 			errtext: `expected "set", found "get"`,
 		},
+		{
+			query:   "update x set y = $1 where id = ?",
+			errtext: "cannot mix ? and $n placeholders",
+		},
+		{
+			query:   "select a from x where b = ? or c = $1",
+			errtext: "cannot mix ? and $n placeholders",
+		},
+		{
+			query:   "delete from x where id = $0",
+			errtext: `invalid placeholder "$0"`,
+		},
+		{
+			query:   "update x set y = x'abc' where id = ?",
+			errtext: `invalid hex literal x'abc'`,
+		},
+		{
+			query:   "insert into tbl(id, a) values(x'01', ?)",
+			errtext: "id column cannot be a hex literal",
+		},
+		{
+			query:   "update tbl set a = ? where id in (select a from tbl)",
+			errtext: "subquery must select only the id column",
+		},
+		{
+			query:   "delete from tbl where id in (select id from other)",
+			errtext: `subquery must select from table "tbl"`,
+		},
+		{
+			query:   "delete from tbl where id in (select id from tbl where (a = ?)",
+			errtext: `expected ")", found end of query`,
+		},
+		{
+			query:   "update tbl set a = ? where id in (select id from tbl) if b = 'x'",
+			errtext: "cannot use if clause with subquery",
+		},
 	}
 
 	for tn, tt := range tests {
@@ -403,6 +1049,81 @@ func TestParseErrors(t *testing.T) {
 
 type aStringType string
 
+func TestParsePlaceholders(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"select a from tbl", 0},
+		{"select a from tbl where id = ?", 1},
+		{"select a from tbl where a = ? and b in (?, ?) limit 10", 3},
+		{"select a from tbl where a = $2 or b = $2", 2},
+		{"insert into tbl(id, a, b) values(?, ?, 'b') on duplicate key update b = ?", 3},
+		{"update tbl set a = ? where id in (select id from tbl where b = ?)", 2},
+		{"delete from tbl where id = $1 if a = $1", 1},
+		{"create table tbl", 0},
+	}
+	for tn, tt := range tests {
+		q, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("%d: got=%v, want=nil", tn, err)
+			continue
+		}
+		if got, want := q.Placeholders, tt.want; got != want {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []Statement
+	}{
+		{
+			query: "select a from tbl where b = ?",
+			want: []Statement{
+				{Text: "select a from tbl where b = ?", Placeholders: 1},
+			},
+		},
+		{
+			query: "select a from tbl; select b from tbl where c = ? and d = ?;",
+			want: []Statement{
+				{Text: "select a from tbl"},
+				{Text: "select b from tbl where c = ? and d = ?", Placeholders: 2},
+			},
+		},
+		{
+			query: "insert into tbl(id, a) values(?, 'x;y'); ; -- comment;\n delete from tbl where id = ?",
+			want: []Statement{
+				{Text: "insert into tbl(id, a) values(?, 'x;y')", Placeholders: 1},
+				{Text: "-- comment;\n delete from tbl where id = ?", Placeholders: 1},
+			},
+		},
+		{
+			query: "update tbl set a = $2, b = $2 where id = $1; select a from tbl where b = $1 or c = $1",
+			want: []Statement{
+				{Text: "update tbl set a = $2, b = $2 where id = $1", Placeholders: 2},
+				{Text: "select a from tbl where b = $1 or c = $1", Placeholders: 1},
+			},
+		},
+		{
+			query: " ; ",
+			want:  nil,
+		},
+	}
+	for tn, tt := range tests {
+		got, err := Split(tt.query)
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", tn, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d: got=%+v, want=%+v", tn, got, tt.want)
+		}
+	}
+}
+
 func TestKeyString(t *testing.T) {
 	tests := []struct {
 		key       Key
@@ -488,6 +1209,13 @@ func TestColumnGetValue(t *testing.T) {
 			values: []driver.Value{"a", "b", "c"},
 			val:    "z",
 		},
+		{
+			col: Column{
+				Binary: []byte{1, 2},
+			},
+			values: []driver.Value{"a", "b", "c"},
+			val:    []byte{1, 2},
+		},
 		{
 			col: Column{
 				Ordinal: 4,
@@ -504,7 +1232,7 @@ func TestColumnGetValue(t *testing.T) {
 			}
 			continue
 		}
-		if got, want := s, tt.val; got != want {
+		if got, want := s, tt.val; !reflect.DeepEqual(got, want) {
 			t.Errorf("%d: got=%v, want=%v", tn, got, want)
 		}
 	}
@@ -0,0 +1,29 @@
+package simpledbsql
+
+import "strings"
+
+// likeEscaper escapes the characters that have a special meaning
+// in the pattern of a SimpleDB like operator.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike returns s with the wildcards of a like pattern escaped,
+// so that the pattern only matches s itself. The result is an arg, such as
+// the arg of "where a like ?", and its quotes are escaped when it is quoted.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// LikePrefix returns a like pattern that matches values that start with s.
+func LikePrefix(s string) string {
+	return EscapeLike(s) + "%"
+}
+
+// LikeSuffix returns a like pattern that matches values that end with s.
+func LikeSuffix(s string) string {
+	return "%" + EscapeLike(s)
+}
+
+// LikeContains returns a like pattern that matches values that contain s.
+func LikeContains(s string) string {
+	return "%" + EscapeLike(s) + "%"
+}
@@ -0,0 +1,97 @@
+package simpledbsql
+
+import (
+	"strings"
+
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/lex"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// Limits of select expressions. SimpleDB rejects expressions that exceed
+// them with an error that does not identify the limit, so the driver
+// checks them before sending the request.
+const (
+	maxSelectExpressionLength = 8192
+	maxSelectComparisons      = 20
+	maxSelectAttributes       = 20
+	maxInValues               = 20
+)
+
+// checkSelectLimits returns a descriptive error if a select expression
+// exceeds a SimpleDB limit. The comparisons and attributes are counted
+// in the where clause of the query that produced the expression.
+func checkSelectLimits(whereClause []string, selectExpression string) error {
+	if len(selectExpression) > maxSelectExpressionLength {
+		return errors.New("select expression is too long, split the values of long in lists into batches of separate queries").With(
+			"length", len(selectExpression),
+			"maxLength", maxSelectExpressionLength,
+		)
+	}
+	for _, list := range findInLists(whereClause) {
+		if len(list.values) > maxInValues {
+			return errors.New("in list has too many values, split the values into batches of separate queries").With(
+				"values", len(list.values),
+				"maxValues", maxInValues,
+			)
+		}
+	}
+	comparisons, attributes := countPredicates(whereClause)
+	if attributes > maxSelectAttributes {
+		return errors.New("select expression has too many attributes, split the query into separate queries").With(
+			"attributes", attributes,
+			"maxAttributes", maxSelectAttributes,
+		)
+	}
+	if comparisons > maxSelectComparisons {
+		return errors.New("select expression has too many comparisons, replace or-ed equality tests with in lists").With(
+			"comparisons", comparisons,
+			"maxComparisons", maxSelectComparisons,
+		)
+	}
+	return nil
+}
+
+// countPredicates returns the number of comparisons and the number
+// of unique attributes in a where clause. The item name is not an
+// attribute, and an in list is a single comparison.
+func countPredicates(whereClause []string) (comparisons int, attributes int) {
+	scanner := lex.New(strings.NewReader(strings.Join(whereClause, "")))
+	scanner.IgnoreWhiteSpace = true
+	attributeSet := make(map[string]bool)
+	var ident, prev string
+	for scanner.Scan() {
+		text := scanner.Text()
+		if ident != "" && text != "(" {
+			// identifiers followed by "(" are functions, such as itemName()
+			attributeSet[ident] = true
+		}
+		ident = ""
+		switch scanner.Token() {
+		case lex.TokenIdent:
+			if !parse.IsID(text) {
+				ident = lex.Unquote(text)
+			}
+		case lex.TokenKeyword:
+			switch strings.ToLower(text) {
+			case "like", "between", "in", "is":
+				comparisons++
+			}
+		case lex.TokenOperator:
+			switch text {
+			case "<>", "<", ">":
+				comparisons++
+			case "=":
+				// part of "<=", ">=" or "!=" if it follows another operator
+				if prev != "<" && prev != ">" && prev != "!" {
+					comparisons++
+				}
+			}
+		}
+		prev = text
+	}
+	if ident != "" {
+		attributeSet[ident] = true
+	}
+	return comparisons, len(attributeSet)
+}
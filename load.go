@@ -0,0 +1,476 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// LoadFormat is the format of the input to Load.
+type LoadFormat int
+
+// Formats supported by Load.
+const (
+	// LoadCSV is comma-separated values, with a header record
+	// containing the column names. This is the format written by Dump.
+	LoadCSV LoadFormat = iota
+
+	// LoadJSON is newline-delimited JSON, with one object per item.
+	LoadJSON
+)
+
+// maxBatchItems is the maximum number of items in a BatchPutAttributes request.
+const maxBatchItems = 25
+
+// LoadOptions control how Load reads its input.
+type LoadOptions struct {
+	// Format is the format of the input. Defaults to LoadCSV.
+	Format LoadFormat
+
+	// ColumnTypes maps column names to the type of the column's values,
+	// which is one of "string", "int64", "uint64", "bigint", "decimal",
+	// "float64", "bool", "time" or "binary". Values are converted from their
+	// text representation: times are in RFC3339 format, optionally with
+	// fractional seconds, and binary values are base64 encoded.
+	// An empty value for any type other than string is loaded as null.
+	//
+	// Columns that are not in ColumnTypes are loaded as strings, except
+	// that JSON numbers, booleans and nulls retain their JSON type.
+	// CSV input written by Dump contains its own type metadata, which
+	// takes precedence over ColumnTypes.
+	ColumnTypes map[string]string
+
+	// MaxRetries is the number of times a failed BatchPutAttributes
+	// request is retried. Defaults to 3. Set to a negative number
+	// to disable retries.
+	MaxRetries int
+
+	// Progress, if not nil, is called after each batch of items has been
+	// loaded, with the total number of items loaded so far.
+	Progress func(count int)
+
+	// SkipValidation, if true, loads items without passing them to the
+	// Connector's ValidateWrite hook, such as when restoring items that
+	// were written by Dump and are known to be valid.
+	SkipValidation bool
+}
+
+func (opts *LoadOptions) maxRetries() int {
+	if opts.MaxRetries == 0 {
+		return 3
+	}
+	if opts.MaxRetries < 0 {
+		return 0
+	}
+	return opts.MaxRetries
+}
+
+// Load reads items from r and puts them into a table using the SimpleDB
+// BatchPutAttributes API, and returns the number of items loaded. Every
+// item must have an "id" column, which is used as the item name. Existing
+// items with the same name are overwritten, but any attributes that are not
+// in the input are left unchanged. If the Connector has PackedMetadata set,
+// the packed types of an existing item are replaced, so any columns that are
+// not in the input are subsequently read as strings.
+//
+// Load reads its input as it goes, so the input does not have to fit in memory.
+// If an error occurs, the items in batches prior to the error remain loaded.
+// Requests are subject to the rate limits of the Connector.
+func (c *Connector) Load(ctx context.Context, r io.Reader, tableName string, opts *LoadOptions) (int, error) {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+	cn, err := c.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	domainName, err := cn.resolveDomainName(ctx, tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	var reader loadReader
+	switch opts.Format {
+	case LoadCSV:
+		reader = newCSVLoadReader(r, opts.ColumnTypes, cn.meta)
+	case LoadJSON:
+		reader = newJSONLoadReader(r, opts.ColumnTypes, cn.meta)
+	default:
+		return 0, errors.New("unknown load format").With("format", opts.Format)
+	}
+
+	var (
+		count int
+		items []*simpledb.ReplaceableItem
+	)
+	flush := func() error {
+		if len(items) == 0 {
+			return nil
+		}
+		input := &simpledb.BatchPutAttributesInput{
+			DomainName: aws.String(domainName),
+			Items:      items,
+		}
+		if err := cn.batchPut(ctx, input, opts.maxRetries()); err != nil {
+			return errors.Wrap(err, "cannot load items").With(
+				"table", tableName,
+				"domain", domainName,
+				"count", count,
+			)
+		}
+		var (
+			attrs []*simpledb.ReplaceableAttribute
+			names []*string
+		)
+		for _, item := range items {
+			cn.invalidateItem(input.DomainName, item.Name)
+			attrs = append(attrs, item.Attributes...)
+			names = append(names, item.Name)
+		}
+		cn.invalidateItems(ctx, tableName, input.DomainName, names, "insert")
+		if err := cn.recordSchema(ctx, input.DomainName, attrs); err != nil {
+			return err
+		}
+		count += len(items)
+		items = nil
+		if opts.Progress != nil {
+			opts.Progress(count)
+		}
+		return nil
+	}
+
+	for {
+		item, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, errors.Wrap(err, "cannot read item").With("index", count+len(items))
+		}
+		if !opts.SkipValidation {
+			if err := cn.validateItem(tableName, item); err != nil {
+				return count, errors.Wrap(err, "cannot load item").With("index", count+len(items))
+			}
+		}
+		if item.Attributes, err = cn.meta.pack(item.Attributes, ""); err != nil {
+			return count, errors.Wrap(err, "cannot load item").With("index", count+len(items))
+		}
+		items = append(items, item)
+		if len(items) == maxBatchItems {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+// validateItem passes the values of an item read by Load to the Connector's
+// ValidateWrite hook. The item name is passed as the "id" column.
+func (c *conn) validateItem(tableName string, item *simpledb.ReplaceableItem) error {
+	if c.hooks.ValidateWrite == nil {
+		return nil
+	}
+	attrs := make([]*simpledb.Attribute, 0, len(item.Attributes))
+	for _, attr := range item.Attributes {
+		attrs = append(attrs, &simpledb.Attribute{Name: attr.Name, Value: attr.Value})
+	}
+	values := decodeItem(&simpledb.Item{Name: item.Name, Attributes: attrs}, c.meta)
+	return c.validateValues(tableName, values)
+}
+
+// batchPut sends a BatchPutAttributes request, retrying with an
+// exponential backoff if the request fails.
+func (c *conn) batchPut(ctx context.Context, input *simpledb.BatchPutAttributesInput, maxRetries int) error {
+	backoff := 100 * time.Millisecond
+	for retry := 0; ; retry++ {
+		_, err := c.SimpleDB.BatchPutAttributesWithContext(ctx, input, requestOptions(ctx)...)
+		if err == nil || retry >= maxRetries || !isRetryable(err) {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// retryableCodes are the error codes from the SimpleDB API that
+// indicate a request can succeed if it is sent again.
+var retryableCodes = []string{
+	"ServiceUnavailable",
+	"InternalError",
+	"RequestTimeout",
+}
+
+func isRetryable(err error) bool {
+	for _, code := range retryableCodes {
+		if hasCode(err, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadReader reads the items to be loaded.
+type loadReader interface {
+	// next returns the next item, or io.EOF if there are no more items.
+	next() (*simpledb.ReplaceableItem, error)
+}
+
+// loadItem builds an item for a BatchPutAttributes request.
+type loadItem struct {
+	item *simpledb.ReplaceableItem
+	meta metadata
+}
+
+func newLoadItem(meta metadata) *loadItem {
+	li := &loadItem{item: &simpledb.ReplaceableItem{}, meta: meta}
+	if !meta.raw {
+		li.put(meta.typeAttr("id"), "string")
+	}
+	return li
+}
+
+func (li *loadItem) put(name, value string) {
+	li.item.Attributes = append(li.item.Attributes, &simpledb.ReplaceableAttribute{
+		Name:    aws.String(name),
+		Value:   aws.String(value),
+		Replace: aws.Bool(true),
+	})
+}
+
+// putValue adds a value and its type to the item.
+func (li *loadItem) putValue(columnName string, v driver.Value) error {
+	typeName, value, err := encodeValue(v)
+	if err != nil {
+		return err
+	}
+	if !li.meta.raw {
+		li.put(li.meta.typeAttr(columnName), typeName)
+	}
+	if value != "" {
+		li.put(columnName, value)
+		if li.meta.isFolded(columnName) {
+			li.put(li.meta.foldedAttr(columnName), foldCase(value))
+		}
+	}
+	if li.meta.isSearched(columnName) {
+		words, err := columnWords(typeName, value)
+		if err != nil {
+			return err
+		}
+		for _, word := range words {
+			li.put(li.meta.wordsAttr(columnName), word)
+		}
+	}
+	return nil
+}
+
+// convertText converts the text representation of a value to a value of
+// the type named by typeName.
+func convertText(text string, typeName string) (driver.Value, error) {
+	if typeName == "" || typeName == "string" {
+		return text, nil
+	}
+	if text == "" {
+		return nil, nil
+	}
+	switch typeName {
+	case "int64":
+		return strconv.ParseInt(text, 10, 64)
+	case "uint64":
+		return strconv.ParseUint(text, 10, 64)
+	case "bigint":
+		n, ok := new(big.Int).SetString(text, 10)
+		if !ok {
+			return nil, errors.New("invalid bigint")
+		}
+		return n, nil
+	case "decimal":
+		return parseDecimal(Decimal(text))
+	case "float64":
+		return strconv.ParseFloat(text, 64)
+	case "bool":
+		return strconv.ParseBool(text)
+	case "time":
+		return time.Parse(time.RFC3339, text)
+	case "binary":
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return nil, errors.New("unknown column type").With("type", typeName)
+}
+
+type csvLoadReader struct {
+	r           *csv.Reader
+	columnTypes map[string]string
+	header      []string
+	hasTypes    map[string]bool // columns with type metadata in the input
+	idIndex     int
+	meta        metadata
+}
+
+func newCSVLoadReader(r io.Reader, columnTypes map[string]string, meta metadata) *csvLoadReader {
+	return &csvLoadReader{
+		r:           csv.NewReader(r),
+		columnTypes: columnTypes,
+		meta:        meta,
+	}
+}
+
+func (lr *csvLoadReader) readHeader() error {
+	header, err := lr.r.Read()
+	if err != nil {
+		if err == io.EOF {
+			return errors.New("missing header")
+		}
+		return err
+	}
+	lr.header = header
+	lr.hasTypes = make(map[string]bool)
+	lr.idIndex = -1
+	for i, name := range header {
+		if parse.IsID(name) {
+			lr.idIndex = i
+		}
+		if lr.meta.isMetadata(name) {
+			lr.hasTypes[strings.TrimPrefix(name, lr.meta.namePrefix())] = true
+		}
+	}
+	if lr.idIndex < 0 {
+		return errors.New("missing id column")
+	}
+	return nil
+}
+
+func (lr *csvLoadReader) next() (*simpledb.ReplaceableItem, error) {
+	if lr.header == nil {
+		if err := lr.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+	record, err := lr.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	li := newLoadItem(lr.meta)
+	for i, text := range record {
+		name := lr.header[i]
+		switch {
+		case i == lr.idIndex:
+			li.item.Name = aws.String(text)
+		case lr.meta.isMetadata(name) || lr.hasTypes[name]:
+			// type metadata written by Dump, so load verbatim
+			if text != "" {
+				li.put(name, text)
+			}
+		default:
+			v, err := convertText(text, lr.columnTypes[name])
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot convert value").With("column", name)
+			}
+			if err := li.putValue(name, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if derefString(li.item.Name) == "" {
+		return nil, errors.New("missing id")
+	}
+	return li.item, nil
+}
+
+type jsonLoadReader struct {
+	dec         *json.Decoder
+	columnTypes map[string]string
+	meta        metadata
+}
+
+func newJSONLoadReader(r io.Reader, columnTypes map[string]string, meta metadata) *jsonLoadReader {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &jsonLoadReader{
+		dec:         dec,
+		columnTypes: columnTypes,
+		meta:        meta,
+	}
+}
+
+func (lr *jsonLoadReader) next() (*simpledb.ReplaceableItem, error) {
+	var obj map[string]interface{}
+	if err := lr.dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	li := newLoadItem(lr.meta)
+	for _, name := range names {
+		jv := obj[name]
+		if parse.IsID(name) {
+			id, ok := jv.(string)
+			if !ok {
+				return nil, errors.New("id must be a string")
+			}
+			li.item.Name = aws.String(id)
+			continue
+		}
+		v, err := lr.convert(name, jv)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot convert value").With("column", name)
+		}
+		if err := li.putValue(name, v); err != nil {
+			return nil, err
+		}
+	}
+	if derefString(li.item.Name) == "" {
+		return nil, errors.New("missing id")
+	}
+	return li.item, nil
+}
+
+func (lr *jsonLoadReader) convert(name string, jv interface{}) (driver.Value, error) {
+	if typeName := lr.columnTypes[name]; typeName != "" {
+		switch val := jv.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			return convertText(val, typeName)
+		case json.Number:
+			return convertText(val.String(), typeName)
+		case bool:
+			return convertText(strconv.FormatBool(val), typeName)
+		}
+	} else {
+		switch val := jv.(type) {
+		case nil, string, bool:
+			return val, nil
+		case json.Number:
+			if n, err := val.Int64(); err == nil {
+				return n, nil
+			}
+			return val.Float64()
+		}
+	}
+	return nil, errors.New("unsupported JSON value")
+}
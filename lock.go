@@ -0,0 +1,211 @@
+package simpledbsql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+)
+
+// lockColumn is the name of the lock attribute without the metadata prefix.
+const lockColumn = "lock"
+
+// leasePrefix starts the value of a lock attribute, which distinguishes it
+// from the type attribute of a column named "lock", as no type starts with it.
+const leasePrefix = "lease:"
+
+// lockRetryInterval is the time AcquireLock waits before trying again to
+// acquire a lock that is held.
+const lockRetryInterval = 100 * time.Millisecond
+
+// Lock is a lease on an item, acquired by AcquireLock and released by
+// ReleaseLock. The lease ends when it expires, even if it is not released.
+type Lock struct {
+	Table   string    // table name
+	ID      string    // item name
+	Expires time.Time // time at which the lease expires
+
+	domainName string
+	value      string // value of the lock attribute
+}
+
+// lockAttr returns the name of the attribute containing an item's lease.
+func (m metadata) lockAttr() string {
+	return m.namePrefix() + lockColumn
+}
+
+// isLease returns true if an attribute contains the lease of a lock.
+func (m metadata) isLease(name string, value string) bool {
+	return name == m.lockAttr() && strings.HasPrefix(value, leasePrefix)
+}
+
+// newLease returns the value of a lock attribute, which contains the time
+// that the lease expires in nanoseconds since the Unix epoch, and a random
+// token that identifies the holder.
+func newLease(expires time.Time) (string, error) {
+	var token [8]byte
+	if _, err := rand.Read(token[:]); err != nil {
+		return "", errors.Wrap(err, "cannot generate lock token")
+	}
+	return leasePrefix + strconv.FormatInt(expires.UnixNano(), 10) + ":" + hex.EncodeToString(token[:]), nil
+}
+
+// leaseExpired returns true if the lease in the value of a lock attribute
+// has expired. An invalid lease has expired.
+func leaseExpired(value string, now time.Time) bool {
+	fields := strings.SplitN(strings.TrimPrefix(value, leasePrefix), ":", 2)
+	expires, err := strconv.ParseInt(fields[0], 10, 64)
+	return err != nil || now.UnixNano() >= expires
+}
+
+// AcquireLock acquires a lease-style lock on an item in a table, which
+// lasts until it is released by ReleaseLock, or until ttl has elapsed.
+// Writers that acquire the lock before updating an item are serialized,
+// but the lock does not prevent other statements from modifying the item.
+//
+// The lease is recorded in an attribute of the item whose name is the word
+// "lock" with MetadataPrefix, using conditional puts, so only one holder can
+// acquire it. If the lock is held, AcquireLock tries again until the lease
+// expires or is released, or until the context is done. The item does not
+// have to exist. Unless PackedMetadata is set, an item with a value in a
+// column named "lock" cannot be locked.
+func (c *Connector) AcquireLock(ctx context.Context, tableName string, id string, ttl time.Duration) (*Lock, error) {
+	cn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	domainName, err := cn.resolveDomainName(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		lock, err := cn.tryLock(ctx, domainName, id, ttl)
+		if err != nil {
+			return nil, err
+		}
+		if lock != nil {
+			lock.Table = tableName
+			return lock, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "cannot acquire lock").With(
+				"table", tableName,
+				"id", cn.redact(id),
+			)
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// tryLock acquires the lock on an item, or returns nil if the lock is held.
+func (c *conn) tryLock(ctx context.Context, domainName string, id string, ttl time.Duration) (*Lock, error) {
+	input := &simpledb.GetAttributesInput{
+		DomainName:     aws.String(domainName),
+		ItemName:       aws.String(id),
+		AttributeNames: aws.StringSlice([]string{c.meta.lockAttr()}),
+		ConsistentRead: aws.Bool(true),
+	}
+	output, err := c.SimpleDB.GetAttributesWithContext(ctx, input, requestOptions(ctx)...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get lock").With(
+			"itemName", c.redact(id),
+		)
+	}
+	now := time.Now()
+	expected := &simpledb.UpdateCondition{
+		Name:   aws.String(c.meta.lockAttr()),
+		Exists: aws.Bool(false),
+	}
+	for _, attr := range output.Attributes {
+		value := derefString(attr.Value)
+		if !c.meta.isLease(derefString(attr.Name), value) {
+			continue
+		}
+		if !leaseExpired(value, now) {
+			return nil, nil
+		}
+		expected = &simpledb.UpdateCondition{
+			Name:  aws.String(c.meta.lockAttr()),
+			Value: aws.String(value),
+		}
+	}
+
+	expires := now.Add(ttl)
+	value, err := newLease(expires)
+	if err != nil {
+		return nil, err
+	}
+	putInput := &simpledb.PutAttributesInput{
+		DomainName: aws.String(domainName),
+		ItemName:   aws.String(id),
+		Attributes: []*simpledb.ReplaceableAttribute{
+			{
+				Name:    aws.String(c.meta.lockAttr()),
+				Value:   aws.String(value),
+				Replace: aws.Bool(true),
+			},
+		},
+		Expected: expected,
+	}
+	_, err = c.SimpleDB.PutAttributesWithContext(ctx, putInput, requestOptions(ctx)...)
+	c.invalidateItem(putInput.DomainName, putInput.ItemName)
+	if err != nil {
+		if hasCode(err, conditionalCheckFailed) || hasCode(err, attributeDoesNotExist) {
+			// acquired by another holder in the meantime
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "cannot put lock").With(
+			"itemName", c.redact(id),
+		)
+	}
+	return &Lock{
+		ID:         id,
+		Expires:    expires,
+		domainName: domainName,
+		value:      value,
+	}, nil
+}
+
+// ReleaseLock releases a lock acquired by AcquireLock. It returns an error if
+// the lock is no longer held, because its lease expired and another holder
+// acquired it, in which case updates made while holding it might not have
+// been serialized.
+func (c *Connector) ReleaseLock(ctx context.Context, lock *Lock) error {
+	cn, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	input := &simpledb.DeleteAttributesInput{
+		DomainName: aws.String(lock.domainName),
+		ItemName:   aws.String(lock.ID),
+		Attributes: []*simpledb.DeletableAttribute{
+			{Name: aws.String(cn.meta.lockAttr())},
+		},
+		Expected: &simpledb.UpdateCondition{
+			Name:  aws.String(cn.meta.lockAttr()),
+			Value: aws.String(lock.value),
+		},
+	}
+	_, err = cn.SimpleDB.DeleteAttributesWithContext(ctx, input, requestOptions(ctx)...)
+	cn.invalidateItem(input.DomainName, input.ItemName)
+	if err != nil {
+		if hasCode(err, conditionalCheckFailed) || hasCode(err, attributeDoesNotExist) {
+			return errors.New("lock is no longer held").With(
+				"table", lock.Table,
+				"id", cn.redact(lock.ID),
+			)
+		}
+		return errors.Wrap(err, "cannot release lock").With(
+			"table", lock.Table,
+			"id", cn.redact(lock.ID),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package simpledbsql
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// MapRows is the result of a query returned by QueryMaps. Its cursor starts
+// before the first row, and Next is used to advance from row to row.
+type MapRows struct {
+	ctx    context.Context
+	conn   *conn
+	input  *simpledb.SelectInput
+	items  []*simpledb.Item
+	ttl    ttlFilter
+	guard  *selectGuard
+	table  string
+	all    bool // all attributes are selected, so checksums are verified
+	repair func(item *simpledb.Item)
+	row    map[string]interface{}
+	err    error
+	done   bool
+}
+
+// QueryMaps runs a select query and returns its rows as maps, which is
+// useful for domains whose items do not all have the same attributes.
+// Unlike QueryContext, QueryMaps accepts "select *" queries:
+//
+//	select * from my_table where a = ?
+//
+// Each row contains the "id" column, and the other selected columns that
+// the item has values for, decoded according to their type metadata.
+// Attributes without type metadata, which were not written by the driver,
+// are returned as strings.
+func (c *Connector) QueryMaps(ctx context.Context, query string, args ...interface{}) (*MapRows, error) {
+	cn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q, err := cn.parseCache.parse(query)
+	if err != nil {
+		return nil, err
+	}
+	if q.Select == nil || q.Explain {
+		return nil, errors.New("expect select query for QueryMaps")
+	}
+	if len(q.Select.Aggregates) > 0 {
+		return nil, errors.New("aggregate functions are not supported by QueryMaps")
+	}
+	if err := checkArgs(q.Placeholders, len(args)); err != nil {
+		return nil, err
+	}
+	cn.applyDefaults(q)
+	return cn.queryMaps(ctx, q.Select, args)
+}
+
+func (c *conn) queryMaps(ctx context.Context, q *parse.SelectQuery, args []interface{}) (*MapRows, error) {
+	if err := c.checkScan(ctx, q); err != nil {
+		return nil, err
+	}
+	values, err := convertArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	selectExpression, err := c.makeSelectExpression(ctx, q, values)
+	if err != nil {
+		return nil, err
+	}
+	repair, err := c.newRepairer(ctx, q.TableName)
+	if err != nil {
+		return nil, err
+	}
+	guard := c.newSelectGuard(q)
+	guard.statement = c.redactExpression(selectExpression)
+	return &MapRows{
+		ctx:    ctx,
+		conn:   c,
+		ttl:    c.newTTLFilter(),
+		guard:  guard,
+		table:  q.TableName,
+		all:    q.AllColumns,
+		repair: repair,
+		input: &simpledb.SelectInput{
+			ConsistentRead:   aws.Bool(q.ConsistentRead),
+			SelectExpression: aws.String(selectExpression),
+		},
+	}, nil
+}
+
+// Next prepares the next row for reading with Map. It returns false when
+// there are no more rows or an error occurred, in which case Err returns
+// the error.
+func (r *MapRows) Next() bool {
+	r.row = nil
+	for len(r.items) == 0 {
+		if r.done || r.err != nil {
+			return false
+		}
+		if err := r.guard.page(); err != nil {
+			r.err = err
+			return false
+		}
+		output, err := r.conn.SimpleDB.SelectWithContext(r.ctx, r.input, requestOptions(r.ctx)...)
+		if err != nil {
+			r.err = r.guard.deadlineError(r.ctx, err)
+			return false
+		}
+		r.items = output.Items
+		r.input.NextToken = output.NextToken
+		r.done = output.NextToken == nil
+	}
+	item := r.items[0]
+	r.items = r.items[1:]
+	if isSchemaItem(item) || r.ttl.expired(item) {
+		return r.Next()
+	}
+	if err := r.guard.row(); err != nil {
+		r.err = err
+		return false
+	}
+	if r.all {
+		r.conn.verifyChecksum(r.ctx, r.table, item)
+	}
+	if r.repair != nil {
+		r.repair(item)
+	}
+	r.row = decodeItem(item, r.conn.meta)
+	return true
+}
+
+// Map returns the current row. Each call to Next returns a new map,
+// so the caller can retain it.
+func (r *MapRows) Map() map[string]interface{} {
+	return r.row
+}
+
+// Err returns the error, if any, that was encountered during iteration.
+func (r *MapRows) Err() error {
+	return r.err
+}
+
+// Close stops iteration. Subsequent calls to Next return false.
+func (r *MapRows) Close() error {
+	r.items = nil
+	r.done = true
+	return nil
+}
@@ -0,0 +1,276 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// DefaultMetadataPrefix is the prefix of the names of the attributes in which
+// the driver records the types of columns, unless the Connector specifies
+// a different MetadataPrefix.
+const DefaultMetadataPrefix = "sql:"
+
+// metadata identifies the attributes in which the driver records the types
+// of an item's columns. Unless packed, each column has a type attribute whose
+// name is the column name with the prefix. When packed, the types of all of
+// the item's columns are recorded in a single attribute. When raw, there are
+// no metadata attributes, and all values are strings. The zero value uses
+// DefaultMetadataPrefix, and is neither packed nor raw.
+type metadata struct {
+	prefix   string
+	packed   bool
+	raw      bool
+	checksum bool            // items have a checksum attribute
+	txn      bool            // updates mark items until they complete
+	folded   map[string]bool // case-insensitive columns
+	searched map[string]bool // search columns
+}
+
+// namePrefix returns the prefix of the names of metadata attributes.
+func (m metadata) namePrefix() string {
+	if m.prefix == "" {
+		return DefaultMetadataPrefix
+	}
+	return m.prefix
+}
+
+// typeAttr returns the name of the attribute containing the type of a column.
+// When packed, the attribute is not stored, but is packed by the pack method.
+func (m metadata) typeAttr(columnName string) string {
+	return m.namePrefix() + columnName
+}
+
+// packedAttr returns the name of the attribute containing the packed types.
+func (m metadata) packedAttr() string {
+	return m.namePrefix() + "types"
+}
+
+// idAttr returns the name of an attribute that is present in every
+// item written by the driver, or a blank string when raw.
+func (m metadata) idAttr() string {
+	if m.raw {
+		return ""
+	}
+	if m.packed {
+		return m.packedAttr()
+	}
+	return m.typeAttr("id")
+}
+
+// isMetadata returns true if the named attribute contains metadata
+// rather than a column value.
+func (m metadata) isMetadata(name string) bool {
+	return !m.raw && strings.HasPrefix(name, m.namePrefix())
+}
+
+// isDerivedAttr returns true if the named attribute contains values derived
+// from the value of a column, such as the folded value of a case-insensitive
+// column or the words of a search column, rather than a column type.
+func (m metadata) isDerivedAttr(name string) bool {
+	return m.isFoldedAttr(name) || m.isWordsAttr(name)
+}
+
+// attributeNames returns the names of the attributes containing the values
+// and types of columns. When packed, the packed types are not included.
+func (m metadata) attributeNames(columnNames []string) []string {
+	names := make([]string, 0, len(columnNames)*2)
+	for _, columnName := range columnNames {
+		if parse.IsID(columnName) {
+			continue
+		}
+		names = append(names, columnName)
+		if !m.packed && !m.raw {
+			names = append(names, m.typeAttr(columnName))
+		}
+	}
+	return names
+}
+
+// columnTypes returns the types of the columns of an item, keyed by column name.
+func (m metadata) columnTypes(attrs []*simpledb.Attribute) map[string]string {
+	types := make(map[string]string, len(attrs))
+	for _, attr := range attrs {
+		m.attributeTypes(derefString(attr.Name), derefString(attr.Value), func(columnName, typeName string) {
+			types[columnName] = typeName
+		})
+	}
+	return types
+}
+
+// attributeTypes calls fn for each column type recorded in an attribute.
+func (m metadata) attributeTypes(name string, value string, fn func(columnName, typeName string)) {
+	switch {
+	case m.raw:
+		return
+	case m.checksum && name == m.checksumAttr():
+		return
+	case m.txn && name == m.txnAttr():
+		return
+	case m.isDerivedAttr(name):
+		return
+	case m.isLease(name, value):
+		return
+	case m.packed && name == m.packedAttr():
+		for columnName, typeName := range unpackTypes(value) {
+			fn(columnName, typeName)
+		}
+	case !m.packed && m.isMetadata(name):
+		fn(strings.TrimPrefix(name, m.namePrefix()), value)
+	}
+}
+
+// pack replaces the type attributes in attrs with a single attribute
+// containing the packed types, which are merged with the existing packed
+// types in oldTypes. It does nothing unless the metadata is packed.
+func (m metadata) pack(attrs []*simpledb.ReplaceableAttribute, oldTypes string) ([]*simpledb.ReplaceableAttribute, error) {
+	if !m.packed {
+		return attrs, nil
+	}
+	types := unpackTypes(oldTypes)
+	packed := make([]*simpledb.ReplaceableAttribute, 0, len(attrs))
+	for _, attr := range attrs {
+		name := derefString(attr.Name)
+		if m.isMetadata(name) && !m.isDerivedAttr(name) {
+			types[strings.TrimPrefix(name, m.namePrefix())] = derefString(attr.Value)
+		} else {
+			packed = append(packed, attr)
+		}
+	}
+	value := packTypes(types)
+	if len(value) > maxAttributeValueLength {
+		return nil, errors.New("too many columns for packed metadata").With(
+			"length", len(value),
+		)
+	}
+	return append(packed, &simpledb.ReplaceableAttribute{
+		Name:    aws.String(m.packedAttr()),
+		Value:   aws.String(value),
+		Replace: aws.Bool(true),
+	}), nil
+}
+
+// packTypes returns the packed representation of column types, which
+// is URL query encoded with the columns in sorted order.
+func packTypes(types map[string]string) string {
+	values := make(url.Values, len(types))
+	for columnName, typeName := range types {
+		values.Set(columnName, typeName)
+	}
+	return values.Encode()
+}
+
+// unpackTypes returns the column types in a packed representation. Invalid
+// entries are ignored, as they are for other invalid metadata.
+func unpackTypes(packed string) map[string]string {
+	types := make(map[string]string)
+	values, _ := url.ParseQuery(packed)
+	for columnName, typeNames := range values {
+		types[columnName] = typeNames[0]
+	}
+	return types
+}
+
+// maxPackedRetries is the number of times an update of an item with packed
+// types is retried because the item's packed types changed concurrently.
+const maxPackedRetries = 5
+
+// updatePackedRow updates an item whose column types are packed. The item's
+// packed types are read and merged with the types of the updated columns, and
+// the put request has a condition that the packed types have not changed in
+// the meantime. If they have, the update is retried.
+func (c *conn) updatePackedRow(ctx context.Context, q *parse.UpdateQuery, args []driver.Value, old map[string]interface{}) (*resultT, error) {
+	putInput, deleteInput, err := c.newUpdateInputs(ctx, q, args)
+	if err != nil {
+		return nil, err
+	}
+	attrs := putInput.Attributes
+	var marker *simpledb.ReplaceableAttribute
+	if c.meta.txn && len(deleteInput.Attributes) > 0 {
+		if marker, err = c.meta.pendingMarker(deleteInput.Attributes); err != nil {
+			return nil, err
+		}
+	}
+	for retry := 0; ; retry++ {
+		oldTypes, exists, err := c.getPackedTypes(ctx, putInput.DomainName, putInput.ItemName)
+		if err != nil {
+			return nil, err
+		}
+		if !exists && !q.Upsert {
+			return newResult(0), nil
+		}
+		if putInput.Attributes, err = c.meta.pack(attrs, oldTypes); err != nil {
+			return nil, err
+		}
+		if marker != nil {
+			putInput.Attributes = append(putInput.Attributes, marker)
+		}
+		if exists {
+			putInput.Expected = &simpledb.UpdateCondition{
+				Name:  aws.String(c.meta.packedAttr()),
+				Value: aws.String(oldTypes),
+			}
+		} else {
+			putInput.Expected = &simpledb.UpdateCondition{
+				Name:   aws.String(c.meta.packedAttr()),
+				Exists: aws.Bool(false),
+			}
+		}
+		_, err = c.SimpleDB.PutAttributesWithContext(ctx, putInput, requestOptions(ctx)...)
+		c.invalidateItem(putInput.DomainName, putInput.ItemName)
+		if err == nil {
+			break
+		}
+		if !hasCode(err, conditionalCheckFailed) || retry >= maxPackedRetries {
+			return nil, errors.Wrap(err, "cannot put attributes").With(
+				"itemName", c.redact(derefString(putInput.ItemName)),
+			)
+		}
+	}
+	if marker != nil {
+		if err := c.deletePending(ctx, deleteInput, marker); err != nil {
+			return nil, err
+		}
+	} else if len(deleteInput.Attributes) > 0 {
+		_, err = c.SimpleDB.DeleteAttributesWithContext(ctx, deleteInput, requestOptions(ctx)...)
+		c.invalidateItem(deleteInput.DomainName, deleteInput.ItemName)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot delete attributes").With(
+				"itemName", c.redact(derefString(deleteInput.ItemName)),
+			)
+		}
+	}
+	if err := c.recordSchema(ctx, putInput.DomainName, putInput.Attributes); err != nil {
+		return nil, err
+	}
+	c.afterUpdate(ctx, q, putInput.DomainName, putInput.ItemName, args, old)
+	return newResult(1), nil
+}
+
+// getPackedTypes returns the packed types of an item, and whether the item exists.
+func (c *conn) getPackedTypes(ctx context.Context, domainName *string, itemName *string) (string, bool, error) {
+	input := &simpledb.GetAttributesInput{
+		DomainName:     domainName,
+		ItemName:       itemName,
+		AttributeNames: aws.StringSlice([]string{c.meta.packedAttr()}),
+		ConsistentRead: aws.Bool(true),
+	}
+	output, err := c.SimpleDB.GetAttributesWithContext(ctx, input, requestOptions(ctx)...)
+	if err != nil {
+		return "", false, errors.Wrap(err, "cannot get packed types").With(
+			"itemName", c.redact(derefString(itemName)),
+		)
+	}
+	for _, attr := range output.Attributes {
+		if derefString(attr.Name) == c.meta.packedAttr() {
+			return derefString(attr.Value), true, nil
+		}
+	}
+	return "", false, nil
+}
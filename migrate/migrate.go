@@ -0,0 +1,251 @@
+// Package migrate applies and rolls back migrations to SimpleDB domains
+// accessed using the simpledbsql driver.
+//
+// SimpleDB has no data definition language beyond creating and deleting
+// domains, so the usual migration tools do not work with it. This package
+// records the migrations that have been applied in a dedicated domain,
+// and each migration consists of statements written in the SQL dialect
+// supported by the driver, or of Go functions, or both.
+//
+// The migrator is not safe for use by multiple processes at the same time.
+// Run migrations from a single process, such as a deployment script.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/jjeffery/errors"
+)
+
+// DefaultTableName is the name of the table used to record
+// applied migrations if the Migrator does not specify one.
+const DefaultTableName = "schema_migrations"
+
+// Migration is a single migration, which can be applied (up)
+// and optionally rolled back (down).
+type Migration struct {
+	// ID uniquely identifies the migration. Migrations are applied in
+	// ascending order of ID, so a common convention is to use a numeric
+	// prefix, eg "0001_create_users".
+	ID string
+
+	// Up applies the migration.
+	Up Step
+
+	// Down rolls back the migration. If Down is empty, the migration
+	// cannot be rolled back.
+	Down Step
+}
+
+// Step is one direction of a migration. If both SQL and Func are
+// specified, the SQL statements are executed first.
+type Step struct {
+	// SQL is a list of statements to execute in order.
+	SQL []string
+
+	// Func is called to perform any work that cannot be expressed
+	// as SQL statements.
+	Func func(ctx context.Context, db *sql.DB) error
+}
+
+func (s *Step) isEmpty() bool {
+	return len(s.SQL) == 0 && s.Func == nil
+}
+
+func (s *Step) run(ctx context.Context, db *sql.DB) error {
+	for i, query := range s.SQL {
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return errors.Wrap(err, "cannot execute statement").With(
+				"index", i,
+				"query", query,
+			)
+		}
+	}
+	if s.Func != nil {
+		return s.Func(ctx, db)
+	}
+	return nil
+}
+
+// Status describes whether a migration has been applied.
+type Status struct {
+	ID        string
+	Applied   bool
+	AppliedAt time.Time // zero if not applied
+}
+
+// Migrator applies and rolls back a list of migrations.
+type Migrator struct {
+	// DB is the database handle, opened using the simpledbsql driver.
+	DB *sql.DB
+
+	// TableName is the name of the table used to record the migrations
+	// that have been applied. Defaults to DefaultTableName.
+	TableName string
+
+	// Migrations is the list of all migrations. The order of the list
+	// is not significant, as migrations are applied in ascending order of ID.
+	Migrations []Migration
+}
+
+func (m *Migrator) tableName() string {
+	if m.TableName == "" {
+		return DefaultTableName
+	}
+	return m.TableName
+}
+
+// Migrate applies all migrations that have not yet been applied, and
+// returns the IDs of the migrations applied. If a migration fails, the
+// migrations prior to it remain applied.
+func (m *Migrator) Migrate(ctx context.Context) ([]string, error) {
+	migrations, err := m.sorted()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, migration := range migrations {
+		if _, ok := applied[migration.ID]; ok {
+			continue
+		}
+		if err := migration.Up.run(ctx, m.DB); err != nil {
+			return ids, errors.Wrap(err, "cannot apply migration").With(
+				"id", migration.ID,
+			)
+		}
+		query := "insert into " + m.tableName() + "(id, applied_at) values(?, ?)"
+		if _, err := m.DB.ExecContext(ctx, query, migration.ID, time.Now().UTC()); err != nil {
+			return ids, errors.Wrap(err, "cannot record migration").With(
+				"id", migration.ID,
+			)
+		}
+		ids = append(ids, migration.ID)
+	}
+	return ids, nil
+}
+
+// Rollback rolls back the most recently applied migrations, up to a maximum
+// of count migrations, and returns the IDs of the migrations rolled back.
+func (m *Migrator) Rollback(ctx context.Context, count int) ([]string, error) {
+	migrations, err := m.sorted()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for i := len(migrations) - 1; i >= 0 && len(ids) < count; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.ID]; !ok {
+			continue
+		}
+		if migration.Down.isEmpty() {
+			return ids, errors.New("migration cannot be rolled back").With(
+				"id", migration.ID,
+			)
+		}
+		if err := migration.Down.run(ctx, m.DB); err != nil {
+			return ids, errors.Wrap(err, "cannot roll back migration").With(
+				"id", migration.ID,
+			)
+		}
+		query := "delete from " + m.tableName() + " where id = ?"
+		if _, err := m.DB.ExecContext(ctx, query, migration.ID); err != nil {
+			return ids, errors.Wrap(err, "cannot remove migration record").With(
+				"id", migration.ID,
+			)
+		}
+		ids = append(ids, migration.ID)
+	}
+	return ids, nil
+}
+
+// Status returns the status of each migration, in the order in which they
+// are applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	migrations, err := m.sorted()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Status, 0, len(migrations))
+	for _, migration := range migrations {
+		appliedAt, ok := applied[migration.ID]
+		list = append(list, Status{
+			ID:        migration.ID,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+	return list, nil
+}
+
+// sorted returns the migrations in ascending order of ID,
+// and checks that the IDs are valid.
+func (m *Migrator) sorted() ([]Migration, error) {
+	migrations := make([]Migration, len(m.Migrations))
+	copy(migrations, m.Migrations)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].ID < migrations[j].ID
+	})
+	for i, migration := range migrations {
+		if migration.ID == "" {
+			return nil, errors.New("migration has blank ID")
+		}
+		if i > 0 && migrations[i-1].ID == migration.ID {
+			return nil, errors.New("duplicate migration ID").With(
+				"id", migration.ID,
+			)
+		}
+		if migration.Up.isEmpty() {
+			return nil, errors.New("migration has no up step").With(
+				"id", migration.ID,
+			)
+		}
+	}
+	return migrations, nil
+}
+
+// applied returns the time that each applied migration was applied,
+// keyed by migration ID. The migrations table is created if necessary.
+func (m *Migrator) applied(ctx context.Context) (map[string]time.Time, error) {
+	// create table is idempotent in SimpleDB
+	if _, err := m.DB.ExecContext(ctx, "create table "+m.tableName()); err != nil {
+		return nil, errors.Wrap(err, "cannot create migrations table")
+	}
+	query := "consistent select id, applied_at from " + m.tableName()
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot query migrations table")
+	}
+	defer rows.Close()
+	applied := make(map[string]time.Time)
+	for rows.Next() {
+		var (
+			id        string
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&id, &appliedAt); err != nil {
+			return nil, errors.Wrap(err, "cannot read migrations table")
+		}
+		applied[id] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot read migrations table")
+	}
+	return applied, nil
+}
@@ -0,0 +1,149 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/jjeffery/simpledbsql"
+	"github.com/jjeffery/simpledbsql/internal/fakesdb"
+)
+
+func TestSorted(t *testing.T) {
+	up := Step{SQL: []string{"create table t"}}
+	tests := []struct {
+		migrations []Migration
+		want       []string
+		errText    string
+	}{
+		{
+			migrations: []Migration{{ID: "2", Up: up}, {ID: "1", Up: up}, {ID: "3", Up: up}},
+			want:       []string{"1", "2", "3"},
+		},
+		{
+			migrations: []Migration{{ID: "1", Up: up}, {ID: "1", Up: up}},
+			errText:    "duplicate migration ID id=1",
+		},
+		{
+			migrations: []Migration{{ID: "", Up: up}},
+			errText:    "migration has blank ID",
+		},
+		{
+			migrations: []Migration{{ID: "1"}},
+			errText:    "migration has no up step id=1",
+		},
+	}
+	for tn, tt := range tests {
+		m := Migrator{Migrations: tt.migrations}
+		migrations, err := m.sorted()
+		if tt.errText != "" {
+			if err == nil || err.Error() != tt.errText {
+				t.Errorf("%d: got=%v, want=%v", tn, err, tt.errText)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", tn, err)
+			continue
+		}
+		var ids []string
+		for _, migration := range migrations {
+			ids = append(ids, migration.ID)
+		}
+		if got, want := ids, tt.want; !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: got=%v, want=%v", tn, got, want)
+		}
+	}
+}
+
+func TestMigrateRollback(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&simpledbsql.Connector{SimpleDB: sdb})
+	defer db.Close()
+
+	var funcCalls int
+	m := Migrator{
+		DB: db,
+		Migrations: []Migration{
+			{
+				ID:   "0002_insert",
+				Up:   Step{SQL: []string{"insert into users(id, name) values('1', 'alice')"}},
+				Down: Step{SQL: []string{"delete from users where id = '1'"}},
+			},
+			{
+				ID:   "0001_create",
+				Up:   Step{SQL: []string{"create table users"}},
+				Down: Step{SQL: []string{"drop table users"}},
+			},
+			{
+				ID: "0003_func",
+				Up: Step{Func: func(ctx context.Context, db *sql.DB) error {
+					funcCalls++
+					return nil
+				}},
+			},
+		},
+	}
+
+	ids, err := m.Migrate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids, []string{"0001_create", "0002_insert", "0003_func"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := funcCalls, 1; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if sdb.Item("users", "1") == nil {
+		t.Errorf("expected item to be inserted")
+	}
+
+	// second migrate does nothing
+	ids, err = m.Migrate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("got=%v, want none", ids)
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if !s.Applied || s.AppliedAt.IsZero() {
+			t.Errorf("%s: expected applied, got %+v", s.ID, s)
+		}
+	}
+
+	// the last migration has no down step
+	if _, err := m.Rollback(ctx, 1); err == nil {
+		t.Errorf("expected error")
+	}
+	m.Migrations = m.Migrations[:2]
+	ids, err = m.Rollback(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids, []string{"0002_insert"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if sdb.Item("users", "1") != nil {
+		t.Errorf("expected item to be deleted")
+	}
+
+	status, err = m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(status), 2; got != want {
+		t.Fatalf("got=%v, want=%v", got, want)
+	}
+	if !status[0].Applied || status[1].Applied {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
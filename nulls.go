@@ -0,0 +1,91 @@
+package simpledbsql
+
+import (
+	"strings"
+
+	"github.com/jjeffery/simpledbsql/internal/lex"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// translateNulls returns the lexemes of a where clause with its "is null"
+// and "is not null" predicates translated so that they have SQL semantics.
+//
+// SimpleDB cannot store empty strings, so an empty string column has a
+// "string" type attribute but no value attribute. A SimpleDB "is null"
+// predicate matches it, as it matches columns that are null or absent.
+// The translated predicates check the type attribute as well:
+//
+//	a is null      =>  (a is null and not `sql:a` = 'string')
+//	a is not null  =>  (a is not null or `sql:a` = 'string')
+//
+// Predicates are not translated when the metadata is raw or packed, because
+// there is no type attribute to check, or for the order by column, because
+// SimpleDB requires the sort column to be constrained by the where clause.
+func (m metadata) translateNulls(whereClause []string) []string {
+	if m.raw || m.packed {
+		return whereClause
+	}
+	orderColumn := parseOrderBy(whereClause).column
+	var translated []string
+	for i := 0; i < len(whereClause); i++ {
+		columnName, not, n := matchNullTest(whereClause[i:])
+		if n == 0 || parse.IsID(columnName) || columnName == orderColumn {
+			translated = append(translated, whereClause[i])
+			continue
+		}
+		if translated == nil {
+			translated = append(translated, whereClause[:i]...)
+		}
+		typeAttr := quoteIdentifier(m.typeAttr(columnName))
+		translated = append(translated, "(")
+		translated = append(translated, whereClause[i:i+n]...)
+		if not {
+			translated = append(translated, " ", "or", " ", typeAttr, " ", "=", " ", "'string'", ")")
+		} else {
+			translated = append(translated, " ", "and", " ", "not", " ", typeAttr, " ", "=", " ", "'string'", ")")
+		}
+		i += n - 1
+	}
+	if translated == nil {
+		return whereClause
+	}
+	return translated
+}
+
+// matchNullTest reports whether lexemes start with an "is null" or an
+// "is not null" predicate on a column. It returns the column name, whether
+// the predicate is "is not null", and the number of lexemes in the predicate,
+// which is zero if there is no match.
+func matchNullTest(lexemes []string) (columnName string, not bool, n int) {
+	if len(lexemes) == 0 || !isIdentLexeme(lexemes[0]) {
+		return "", false, 0
+	}
+	var words []string // lexemes after the column that are not white space
+	for n = 1; n < len(lexemes) && len(words) < 3; n++ {
+		if isSpaceLexeme(lexemes[n]) {
+			continue
+		}
+		words = append(words, strings.ToLower(lexemes[n]))
+		if len(words) == 2 && words[1] == "null" {
+			break
+		}
+	}
+	switch strings.Join(words, " ") {
+	case "is null":
+		return lex.Unquote(lexemes[0]), false, n + 1
+	case "is not null":
+		return lex.Unquote(lexemes[0]), true, n
+	}
+	return "", false, 0
+}
+
+// isIdentLexeme returns true if a lexeme is an identifier, such as a column name.
+func isIdentLexeme(lexeme string) bool {
+	scanner := lex.New(strings.NewReader(lexeme))
+	return scanner.Scan() && scanner.Token() == lex.TokenIdent && scanner.Text() == lexeme
+}
+
+// isSpaceLexeme returns true if a lexeme is white space.
+func isSpaceLexeme(lexeme string) bool {
+	return lexeme != "" && strings.TrimSpace(lexeme) == ""
+}
@@ -0,0 +1,103 @@
+//go:build go1.13
+// +build go1.13
+
+package simpledbsql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jjeffery/simpledbsql/internal/fakesdb"
+)
+
+func TestNullWrappers(t *testing.T) {
+	type nulls struct {
+		i   sql.NullInt64
+		i32 sql.NullInt32
+		f   sql.NullFloat64
+		b   sql.NullBool
+		t   sql.NullTime
+		d   Decimal
+		s   sql.NullString
+	}
+	valid := func(n nulls) []bool {
+		return []bool{n.i.Valid, n.i32.Valid, n.f.Valid, n.b.Valid, n.t.Valid, n.d != "", n.s.Valid}
+	}
+	connectors := map[string]func(sdb *fakesdb.DB) *Connector{
+		"default": func(sdb *fakesdb.DB) *Connector { return &Connector{SimpleDB: sdb} },
+		"prefix":  func(sdb *fakesdb.DB) *Connector { return &Connector{SimpleDB: sdb, MetadataPrefix: "_t."} },
+		"packed":  func(sdb *fakesdb.DB) *Connector { return &Connector{SimpleDB: sdb, PackedMetadata: true} },
+	}
+	for name, newConnector := range connectors {
+		ctx := context.Background()
+		db := sql.OpenDB(newConnector(fakesdb.New()))
+		defer db.Close()
+		_, err := db.ExecContext(ctx, "create table tbl")
+		wantNoError(t, err)
+		insert := "insert into tbl(id, a, b, c, d, e, f, g, z) values(?, ?, ?, ?, ?, ?, ?, ?, 'z')"
+		// null-typed attributes
+		_, err = db.ExecContext(ctx, insert, "NULL", nil, nil, nil, nil, nil, nil, nil)
+		wantNoError(t, err)
+		// present attributes
+		now := time.Now().UTC()
+		_, err = db.ExecContext(ctx, insert, "SET", int64(1), int64(2), 1.5, true, now, Decimal("2.5"), "s")
+		wantNoError(t, err)
+		// absent attributes
+		_, err = db.ExecContext(ctx, "insert into tbl(id, z) values('ABSENT', 'z')")
+		wantNoError(t, err)
+
+		for _, query := range []string{
+			// GetAttributes
+			"select a, b, c, d, e, f, g from tbl where id = ?",
+			// Select
+			"consistent select a, b, c, d, e, f, g from tbl where z = 'z' and id = ?",
+		} {
+			for _, id := range []string{"NULL", "SET", "ABSENT"} {
+				var n nulls
+				err = db.QueryRowContext(ctx, query, id).Scan(&n.i, &n.i32, &n.f, &n.b, &n.t, &n.d, &n.s)
+				if err != nil {
+					t.Errorf("%s: %s: %s: %v", name, query, id, err)
+					continue
+				}
+				for i, got := range valid(n) {
+					if want := id == "SET"; got != want {
+						t.Errorf("%s: %s: %s: column %d: got valid=%v, want %v", name, query, id, i, got, want)
+					}
+				}
+				if id == "SET" && (n.i.Int64 != 1 || n.i32.Int32 != 2 || n.f.Float64 != 1.5 ||
+					!n.b.Bool || !n.t.Time.Equal(now) || n.d != "2.5" || n.s.String != "s") {
+					t.Errorf("%s: %s: got=%+v", name, query, n)
+				}
+			}
+		}
+	}
+}
+
+func TestNullableFirstColumn(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl; insert into tbl(id, z) values('ID1', 'z')")
+	wantNoError(t, err)
+
+	// the first column is not the id, so it is nullable
+	rows, err := db.QueryContext(ctx, "select a, z from tbl where id = 'ID1'")
+	wantNoError(t, err)
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	wantNoError(t, err)
+	if nullable, ok := types[0].Nullable(); !ok || !nullable {
+		t.Errorf("got nullable=%v,%v, want true", nullable, ok)
+	}
+	if !rows.Next() {
+		t.Fatalf("want a row, got err=%v", rows.Err())
+	}
+	var a sql.NullString
+	var z string
+	wantNoError(t, rows.Scan(&a, &z))
+	if a.Valid {
+		t.Errorf("got=%v, want null", a)
+	}
+}
@@ -0,0 +1,62 @@
+package simpledbsql
+
+import (
+	"strings"
+
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// checkSort returns the lexemes of the where clause of a select query whose
+// order by column is not constrained by a predicate, as SimpleDB requires.
+// Unless the connection adds the predicate "column is not null", which it
+// always does for the created column, it returns an error, rather than
+// sending a request that fails with the less helpful InvalidSortExpression
+// error.
+func (c *conn) checkSort(q *parse.SelectQuery) ([]string, error) {
+	if q.UnconstrainedSort == "" {
+		return q.WhereClause, nil
+	}
+	if !c.constrainSort && q.UnconstrainedSort != c.createdColumn {
+		// every item inserted has a created time
+		return nil, errors.New(`order by column must be in a predicate of the where clause, such as "is not null"`).With(
+			"column", q.UnconstrainedSort,
+		)
+	}
+	return constrainSort(q.WhereClause, q.UnconstrainedSort), nil
+}
+
+// constrainSort returns the lexemes of a where clause with the predicate
+// "column is not null" added before its order by clause. Any existing
+// predicates are enclosed in parentheses:
+//
+//	where a = 1 or b = 2 order by c  =>  where (a = 1 or b = 2) and c is not null order by c
+//	order by c                       =>  where c is not null order by c
+func constrainSort(whereClause []string, columnName string) []string {
+	order := len(whereClause)
+	for i, lexeme := range whereClause {
+		if strings.EqualFold(lexeme, "order") {
+			order = i
+			break
+		}
+	}
+	var constrained []string
+	predicates := whereClause[:order]
+	for len(predicates) > 0 && isSpaceLexeme(predicates[len(predicates)-1]) {
+		predicates = predicates[:len(predicates)-1]
+	}
+	if len(predicates) > 0 && strings.EqualFold(predicates[0], "where") {
+		constrained = append(constrained, "where", " ", "(")
+		for _, lexeme := range predicates[1:] {
+			if len(constrained) == 3 && isSpaceLexeme(lexeme) {
+				continue
+			}
+			constrained = append(constrained, lexeme)
+		}
+		constrained = append(constrained, ")", " ", "and", " ")
+	} else {
+		constrained = append(constrained, "where", " ")
+	}
+	constrained = append(constrained, quoteIdentifier(columnName), " ", "is", " ", "not", " ", "null", " ")
+	return append(constrained, whereClause[order:]...)
+}
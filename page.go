@@ -0,0 +1,124 @@
+package simpledbsql
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/jjeffery/errors"
+)
+
+// Page is a page of rows returned by QueryPage.
+type Page struct {
+	// Rows contains the rows of the page in order of id, as maps
+	// like those returned by QueryMaps.
+	Rows []map[string]interface{}
+
+	// Next is the cursor for the next page, which is the id of the
+	// last row of this page. It is blank if there are no more rows.
+	Next string
+}
+
+// QueryPage runs a select query and returns a page of at most limit rows,
+// in order of id, starting after the row whose id is cursor. The first page
+// has a blank cursor, and each subsequent page has the cursor returned in
+// the Next field of the previous page. This is keyset pagination, so rows
+// are neither skipped nor repeated when rows are added or removed between
+// pages, and each page costs the same regardless of how deep it is.
+//
+// The query is written without order by and limit clauses, which are added
+// along with a comparison of the id with the cursor:
+//
+//	page, err := connector.QueryPage(ctx, "select id, a from my_table where a = ?", cursor, 100, "x")
+//
+// runs the equivalent of:
+//
+//	select id, a from my_table where (a = ?) and id > ? order by id limit 101
+//
+// The limit must be less than 2500, the largest limit that SimpleDB accepts,
+// because one more row is selected to tell whether there is a next page.
+func (c *Connector) QueryPage(ctx context.Context, query string, cursor string, limit int, args ...interface{}) (*Page, error) {
+	cn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit >= maxSelectLimit {
+		return nil, errors.New("invalid page limit").With("limit", limit)
+	}
+	q, err := cn.parseCache.parse(query)
+	if err != nil {
+		return nil, err
+	}
+	if q.Select == nil || q.Explain {
+		return nil, errors.New("expect select query for QueryPage")
+	}
+	if q.Select.Key != nil {
+		return nil, errors.New(`cannot page a "where id = ?" query`)
+	}
+	if len(q.Select.Aggregates) > 0 {
+		return nil, errors.New("cannot page a query with aggregate functions")
+	}
+	if hasLimit(q.Select.WhereClause) || parseOrderBy(q.Select.WhereClause).column != "" {
+		return nil, errors.New("query for QueryPage cannot have order by or limit clauses")
+	}
+	if err := checkArgs(q.Placeholders, len(args)); err != nil {
+		return nil, err
+	}
+	cn.applyDefaults(q)
+	sq := *q.Select
+	if sq.WhereClause, err = pageWhereClause(q.Select.WhereClause, cursor, limit+1); err != nil {
+		return nil, err
+	}
+
+	rows, err := cn.queryMaps(ctx, &sq, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	page := &Page{}
+	for rows.Next() {
+		if len(page.Rows) == limit {
+			page.Next, _ = page.Rows[limit-1]["id"].(string)
+			break
+		}
+		page.Rows = append(page.Rows, rows.Map())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// pageWhereClause returns the lexemes of a where clause that selects the
+// items after the cursor, in order of id.
+func pageWhereClause(whereClause []string, cursor string, limit int) ([]string, error) {
+	var condition []string
+	for i, lexeme := range whereClause {
+		if lexeme == " " {
+			continue
+		}
+		if !strings.EqualFold(lexeme, "where") {
+			return nil, errors.New("unexpected clause in query for QueryPage").With("clause", lexeme)
+		}
+		condition = whereClause[i+1:]
+		break
+	}
+	for len(condition) > 0 && condition[0] == " " {
+		condition = condition[1:]
+	}
+	for len(condition) > 0 && condition[len(condition)-1] == " " {
+		condition = condition[:len(condition)-1]
+	}
+
+	lexemes := []string{"where", " "}
+	if len(condition) > 0 {
+		lexemes = append(lexemes, "(")
+		lexemes = append(lexemes, condition...)
+		lexemes = append(lexemes, ")", " ", "and", " ")
+	}
+	return append(lexemes,
+		"id", " ", ">", " ", quoteString(cursor),
+		" ", "order", " ", "by", " ", "id",
+		" ", "limit", " ", strconv.Itoa(limit),
+	), nil
+}
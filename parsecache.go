@@ -0,0 +1,69 @@
+package simpledbsql
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// parseCache is an LRU cache of parsed statements, keyed by the text of
+// the statement. Parsing is deterministic, so a statement only needs to be
+// parsed once. Statements that fail to parse are not cached. A nil cache
+// parses every statement.
+type parseCache struct {
+	size  int
+	mutex sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+}
+
+type parseCacheEntry struct {
+	text  string
+	query *parse.Query
+}
+
+func newParseCache(size int) *parseCache {
+	return &parseCache{
+		size:  size,
+		lru:   list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// parse returns the parsed statement. The parsed statements in the cache are
+// shared by all connections, so the caller receives a copy of the statement
+// that it can modify. The statement's clauses are shared, and must not be
+// modified.
+func (pc *parseCache) parse(text string) (*parse.Query, error) {
+	if pc == nil {
+		return parse.Parse(text)
+	}
+	pc.mutex.Lock()
+	elem, ok := pc.items[text]
+	if ok {
+		pc.lru.MoveToFront(elem)
+	}
+	pc.mutex.Unlock()
+	if ok {
+		qc := *elem.Value.(*parseCacheEntry).query
+		return &qc, nil
+	}
+
+	q, err := parse.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	pc.mutex.Lock()
+	if _, ok := pc.items[text]; !ok {
+		pc.items[text] = pc.lru.PushFront(&parseCacheEntry{text: text, query: q})
+		for pc.lru.Len() > pc.size {
+			oldest := pc.lru.Back()
+			pc.lru.Remove(oldest)
+			delete(pc.items, oldest.Value.(*parseCacheEntry).text)
+		}
+	}
+	pc.mutex.Unlock()
+	qc := *q
+	return &qc, nil
+}
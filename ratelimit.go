@@ -0,0 +1,110 @@
+package simpledbsql
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
+	"github.com/jjeffery/simpledbsql/internal/lex"
+	"golang.org/x/time/rate"
+)
+
+// domainLimiters maintains a token-bucket rate limiter for each SimpleDB domain.
+type domainLimiters struct {
+	limit    rate.Limit
+	burst    int
+	mutex    sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newDomainLimiters(requestsPerSecond float64, burst int) *domainLimiters {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &domainLimiters{
+		limit:    rate.Limit(requestsPerSecond),
+		burst:    burst,
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+// wait blocks until a request can be sent to the domain, or until the context is done.
+func (dl *domainLimiters) wait(ctx aws.Context, domainName *string) error {
+	name := derefString(domainName)
+	dl.mutex.Lock()
+	limiter, ok := dl.limiters[name]
+	if !ok {
+		limiter = rate.NewLimiter(dl.limit, dl.burst)
+		dl.limiters[name] = limiter
+	}
+	dl.mutex.Unlock()
+	return limiter.Wait(ctx)
+}
+
+// checks that the wrapper implements the SimpleDBAPI interface
+var _ simpledbiface.SimpleDBAPI = (*rateLimitAPI)(nil)
+
+// rateLimitAPI waits for the domain's rate limiter before sending each request.
+type rateLimitAPI struct {
+	simpledbiface.SimpleDBAPI
+	limiters *domainLimiters
+}
+
+func (api *rateLimitAPI) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	domainName := selectDomainName(derefString(input.SelectExpression))
+	if err := api.limiters.wait(ctx, &domainName); err != nil {
+		return nil, err
+	}
+	return api.SimpleDBAPI.SelectWithContext(ctx, input, opts...)
+}
+
+func (api *rateLimitAPI) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	if err := api.limiters.wait(ctx, input.DomainName); err != nil {
+		return nil, err
+	}
+	return api.SimpleDBAPI.GetAttributesWithContext(ctx, input, opts...)
+}
+
+func (api *rateLimitAPI) PutAttributesWithContext(ctx aws.Context, input *simpledb.PutAttributesInput, opts ...request.Option) (*simpledb.PutAttributesOutput, error) {
+	if err := api.limiters.wait(ctx, input.DomainName); err != nil {
+		return nil, err
+	}
+	return api.SimpleDBAPI.PutAttributesWithContext(ctx, input, opts...)
+}
+
+func (api *rateLimitAPI) DeleteAttributesWithContext(ctx aws.Context, input *simpledb.DeleteAttributesInput, opts ...request.Option) (*simpledb.DeleteAttributesOutput, error) {
+	if err := api.limiters.wait(ctx, input.DomainName); err != nil {
+		return nil, err
+	}
+	return api.SimpleDBAPI.DeleteAttributesWithContext(ctx, input, opts...)
+}
+
+func (api *rateLimitAPI) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	if err := api.limiters.wait(ctx, input.DomainName); err != nil {
+		return nil, err
+	}
+	return api.SimpleDBAPI.BatchPutAttributesWithContext(ctx, input, opts...)
+}
+
+func (api *rateLimitAPI) BatchDeleteAttributesWithContext(ctx aws.Context, input *simpledb.BatchDeleteAttributesInput, opts ...request.Option) (*simpledb.BatchDeleteAttributesOutput, error) {
+	if err := api.limiters.wait(ctx, input.DomainName); err != nil {
+		return nil, err
+	}
+	return api.SimpleDBAPI.BatchDeleteAttributesWithContext(ctx, input, opts...)
+}
+
+// selectDomainName returns the domain name in a select expression.
+func selectDomainName(selectExpression string) string {
+	scanner := lex.New(strings.NewReader(selectExpression))
+	scanner.IgnoreWhiteSpace = true
+	for scanner.Scan() {
+		if scanner.Token() == lex.TokenKeyword && scanner.Text() == "from" {
+			scanner.Scan()
+			return lex.Unquote(scanner.Text())
+		}
+	}
+	return ""
+}
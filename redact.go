@@ -0,0 +1,192 @@
+package simpledbsql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/lex"
+)
+
+// Redactor controls how item names and values appear in error messages
+// and in the requests passed to the Connector's LogRequest function,
+// which may be sent to systems that should not see sensitive data.
+type Redactor interface {
+	Redact(value string) string
+}
+
+// RedactorFunc is an adapter that allows an ordinary function
+// to be used as a Redactor.
+type RedactorFunc func(value string) string
+
+// Redact calls f(value).
+func (f RedactorFunc) Redact(value string) string {
+	return f(value)
+}
+
+var (
+	// HashRedactor replaces each value with a prefix of its SHA-256 hash,
+	// such as "sha256:2c26b46b68ffc68f". Identical values have the same
+	// hash, so they can be correlated without being revealed. Values that
+	// can be guessed, such as small numbers, can be recovered from the hash.
+	HashRedactor Redactor = RedactorFunc(hashValue)
+
+	// OmitRedactor replaces each value with "[redacted]".
+	OmitRedactor Redactor = RedactorFunc(func(string) string {
+		return "[redacted]"
+	})
+)
+
+func hashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// redact returns the value as redacted by the Connector's Redactor,
+// or the value itself if there is no Redactor.
+func (c *conn) redact(value string) string {
+	if c.redactor == nil {
+		return value
+	}
+	return c.redactor.Redact(value)
+}
+
+// withValue adds a redacted value to an error about the value.
+func (c *conn) withValue(err error, value string) error {
+	if e, ok := err.(errors.Error); ok {
+		return e.With("value", c.redact(value))
+	}
+	return err
+}
+
+// redactExpression returns a select expression with its string literals
+// redacted by the Connector's Redactor, if there is one.
+func (c *conn) redactExpression(expr string) string {
+	if c.redactor == nil {
+		return expr
+	}
+	return inputRedactor{redactor: c.redactor, meta: c.meta}.redactExpression(expr)
+}
+
+// inputRedactor redacts the item names and values in SimpleDB
+// request inputs. Metadata attributes are not redacted.
+type inputRedactor struct {
+	redactor Redactor
+	meta     metadata
+}
+
+// redactInput returns a copy of a request input, with its item names
+// and values redacted. Inputs of unknown types are returned unchanged.
+func (ir inputRedactor) redactInput(input interface{}) interface{} {
+	switch in := input.(type) {
+	case *simpledb.SelectInput:
+		out := *in
+		out.SelectExpression = aws.String(ir.redactExpression(derefString(in.SelectExpression)))
+		return &out
+	case *simpledb.GetAttributesInput:
+		out := *in
+		out.ItemName = ir.redactString(in.ItemName)
+		return &out
+	case *simpledb.PutAttributesInput:
+		out := *in
+		out.ItemName = ir.redactString(in.ItemName)
+		out.Attributes = ir.redactReplaceable(in.Attributes)
+		out.Expected = ir.redactCondition(in.Expected)
+		return &out
+	case *simpledb.DeleteAttributesInput:
+		out := *in
+		out.ItemName = ir.redactString(in.ItemName)
+		out.Attributes = ir.redactDeletable(in.Attributes)
+		out.Expected = ir.redactCondition(in.Expected)
+		return &out
+	case *simpledb.BatchPutAttributesInput:
+		out := *in
+		out.Items = nil
+		for _, item := range in.Items {
+			out.Items = append(out.Items, &simpledb.ReplaceableItem{
+				Name:       ir.redactString(item.Name),
+				Attributes: ir.redactReplaceable(item.Attributes),
+			})
+		}
+		return &out
+	case *simpledb.BatchDeleteAttributesInput:
+		out := *in
+		out.Items = nil
+		for _, item := range in.Items {
+			out.Items = append(out.Items, &simpledb.DeletableItem{
+				Name:       ir.redactString(item.Name),
+				Attributes: ir.redactDeletable(item.Attributes),
+			})
+		}
+		return &out
+	}
+	return input
+}
+
+func (ir inputRedactor) redactString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	return aws.String(ir.redactor.Redact(*s))
+}
+
+// redactValue redacts the value of an attribute, unless it is metadata.
+// The values derived from column values, such as folded values, are redacted.
+func (ir inputRedactor) redactValue(name *string, value *string) *string {
+	if ir.meta.isMetadata(derefString(name)) && !ir.meta.isDerivedAttr(derefString(name)) {
+		return value
+	}
+	return ir.redactString(value)
+}
+
+func (ir inputRedactor) redactReplaceable(attrs []*simpledb.ReplaceableAttribute) []*simpledb.ReplaceableAttribute {
+	var redacted []*simpledb.ReplaceableAttribute
+	for _, attr := range attrs {
+		redacted = append(redacted, &simpledb.ReplaceableAttribute{
+			Name:    attr.Name,
+			Value:   ir.redactValue(attr.Name, attr.Value),
+			Replace: attr.Replace,
+		})
+	}
+	return redacted
+}
+
+func (ir inputRedactor) redactDeletable(attrs []*simpledb.DeletableAttribute) []*simpledb.DeletableAttribute {
+	var redacted []*simpledb.DeletableAttribute
+	for _, attr := range attrs {
+		redacted = append(redacted, &simpledb.DeletableAttribute{
+			Name:  attr.Name,
+			Value: ir.redactValue(attr.Name, attr.Value),
+		})
+	}
+	return redacted
+}
+
+func (ir inputRedactor) redactCondition(cond *simpledb.UpdateCondition) *simpledb.UpdateCondition {
+	if cond == nil {
+		return nil
+	}
+	return &simpledb.UpdateCondition{
+		Name:   cond.Name,
+		Value:  ir.redactValue(cond.Name, cond.Value),
+		Exists: cond.Exists,
+	}
+}
+
+// redactExpression redacts the string literals in a select expression.
+func (ir inputRedactor) redactExpression(expr string) string {
+	var sb strings.Builder
+	scanner := lex.New(strings.NewReader(expr))
+	for scanner.Scan() {
+		text := scanner.Text()
+		if scanner.Token() == lex.TokenLiteral && strings.HasPrefix(text, "'") {
+			value := strings.Replace(text[1:len(text)-1], "''", "'", -1)
+			text = quoteString(ir.redactor.Redact(value))
+		}
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
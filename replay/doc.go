@@ -0,0 +1,20 @@
+// Package replay records SimpleDB API traffic and replays it, so that
+// tests can run deterministically without access to AWS.
+//
+// A Recorder wraps a SimpleDB client and records every request and
+// response. Run the tests once against AWS using a Recorder, and save
+// the recording as a JSON fixture:
+//
+//	rec := replay.NewRecorder(simpledb.New(sess))
+//	db := sql.OpenDB(&simpledbsql.Connector{SimpleDB: rec})
+//	// ... run the test ...
+//	err := rec.Save(w)
+//
+// A Replayer loads the fixture and implements the SimpleDB API by returning
+// the recorded responses, including errors. Each request is matched with a
+// recorded request for the same operation and input, so requests that are
+// sent concurrently can be replayed in any order.
+//
+//	rp, err := replay.NewReplayer(r)
+//	db := sql.OpenDB(&simpledbsql.Connector{SimpleDB: rp})
+package replay
@@ -0,0 +1,92 @@
+package replay
+
+import (
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
+)
+
+// Recorder implements the SimpleDB API by sending requests to another
+// implementation, and records each request and its response. Only the
+// WithContext methods are recorded.
+type Recorder struct {
+	simpledbiface.SimpleDBAPI
+	recording recording
+}
+
+// checks that Recorder implements the SimpleDBAPI interface
+var _ simpledbiface.SimpleDBAPI = (*Recorder)(nil)
+
+// NewRecorder returns a Recorder that sends requests to api.
+func NewRecorder(api simpledbiface.SimpleDBAPI) *Recorder {
+	return &Recorder{SimpleDBAPI: api}
+}
+
+// Save writes the recorded requests and responses to w in JSON format.
+// The output can be read by NewReplayer.
+func (r *Recorder) Save(w io.Writer) error {
+	return r.recording.save(w)
+}
+
+func (r *Recorder) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	output, err := r.SimpleDBAPI.SelectWithContext(ctx, input, opts...)
+	r.recording.record("Select", input, output, err)
+	return output, err
+}
+
+func (r *Recorder) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	output, err := r.SimpleDBAPI.GetAttributesWithContext(ctx, input, opts...)
+	r.recording.record("GetAttributes", input, output, err)
+	return output, err
+}
+
+func (r *Recorder) PutAttributesWithContext(ctx aws.Context, input *simpledb.PutAttributesInput, opts ...request.Option) (*simpledb.PutAttributesOutput, error) {
+	output, err := r.SimpleDBAPI.PutAttributesWithContext(ctx, input, opts...)
+	r.recording.record("PutAttributes", input, output, err)
+	return output, err
+}
+
+func (r *Recorder) DeleteAttributesWithContext(ctx aws.Context, input *simpledb.DeleteAttributesInput, opts ...request.Option) (*simpledb.DeleteAttributesOutput, error) {
+	output, err := r.SimpleDBAPI.DeleteAttributesWithContext(ctx, input, opts...)
+	r.recording.record("DeleteAttributes", input, output, err)
+	return output, err
+}
+
+func (r *Recorder) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	output, err := r.SimpleDBAPI.BatchPutAttributesWithContext(ctx, input, opts...)
+	r.recording.record("BatchPutAttributes", input, output, err)
+	return output, err
+}
+
+func (r *Recorder) BatchDeleteAttributesWithContext(ctx aws.Context, input *simpledb.BatchDeleteAttributesInput, opts ...request.Option) (*simpledb.BatchDeleteAttributesOutput, error) {
+	output, err := r.SimpleDBAPI.BatchDeleteAttributesWithContext(ctx, input, opts...)
+	r.recording.record("BatchDeleteAttributes", input, output, err)
+	return output, err
+}
+
+func (r *Recorder) CreateDomainWithContext(ctx aws.Context, input *simpledb.CreateDomainInput, opts ...request.Option) (*simpledb.CreateDomainOutput, error) {
+	output, err := r.SimpleDBAPI.CreateDomainWithContext(ctx, input, opts...)
+	r.recording.record("CreateDomain", input, output, err)
+	return output, err
+}
+
+func (r *Recorder) DeleteDomainWithContext(ctx aws.Context, input *simpledb.DeleteDomainInput, opts ...request.Option) (*simpledb.DeleteDomainOutput, error) {
+	output, err := r.SimpleDBAPI.DeleteDomainWithContext(ctx, input, opts...)
+	r.recording.record("DeleteDomain", input, output, err)
+	return output, err
+}
+
+func (r *Recorder) ListDomainsWithContext(ctx aws.Context, input *simpledb.ListDomainsInput, opts ...request.Option) (*simpledb.ListDomainsOutput, error) {
+	output, err := r.SimpleDBAPI.ListDomainsWithContext(ctx, input, opts...)
+	r.recording.record("ListDomains", input, output, err)
+	return output, err
+}
+
+func (r *Recorder) DomainMetadataWithContext(ctx aws.Context, input *simpledb.DomainMetadataInput, opts ...request.Option) (*simpledb.DomainMetadataOutput, error) {
+	output, err := r.SimpleDBAPI.DomainMetadataWithContext(ctx, input, opts...)
+	r.recording.record("DomainMetadata", input, output, err)
+	return output, err
+}
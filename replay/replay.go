@@ -0,0 +1,145 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/jjeffery/errors"
+)
+
+// fixture is the JSON representation of a recording.
+type fixture struct {
+	Interactions []*interaction `json:"interactions"`
+}
+
+// interaction is a single request and its response.
+type interaction struct {
+	Operation string          `json:"operation"`
+	Input     json.RawMessage `json:"input"`
+	Output    json.RawMessage `json:"output,omitempty"`
+	Error     *errorInfo      `json:"error,omitempty"`
+
+	used bool
+}
+
+// errorInfo describes an error returned by a request.
+type errorInfo struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+func newErrorInfo(err error) *errorInfo {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return &errorInfo{
+			Code:    awsErr.Code(),
+			Message: awsErr.Message(),
+		}
+	}
+	return &errorInfo{Message: err.Error()}
+}
+
+func (e *errorInfo) err() error {
+	if e.Code == "" {
+		return errors.New(e.Message)
+	}
+	return awserr.New(e.Code, e.Message, nil)
+}
+
+// recording holds the interactions of a Recorder or Replayer.
+type recording struct {
+	mutex        sync.Mutex
+	interactions []*interaction
+}
+
+// record adds an interaction to the recording.
+func (r *recording) record(operation string, input interface{}, output interface{}, err error) {
+	ia := &interaction{Operation: operation}
+	ia.Input, _ = json.Marshal(input)
+	if err != nil {
+		ia.Error = newErrorInfo(err)
+	} else {
+		ia.Output, _ = json.Marshal(output)
+	}
+	r.mutex.Lock()
+	r.interactions = append(r.interactions, ia)
+	r.mutex.Unlock()
+}
+
+// replay finds the first unused interaction that matches the operation and
+// input, and unmarshals its output, or returns its error.
+func (r *recording) replay(operation string, input interface{}, output interface{}) error {
+	want, err := compactJSON(input)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, ia := range r.interactions {
+		if ia.used || ia.Operation != operation {
+			continue
+		}
+		got, err := compactJSON(ia.Input)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, want) {
+			continue
+		}
+		ia.used = true
+		if ia.Error != nil {
+			return ia.Error.err()
+		}
+		if err := json.Unmarshal(ia.Output, output); err != nil {
+			return errors.Wrap(err, "cannot unmarshal recorded output").With(
+				"operation", operation,
+			)
+		}
+		return nil
+	}
+	return errors.New("no recorded request").With(
+		"operation", operation,
+		"input", string(want),
+	)
+}
+
+// compactJSON returns the JSON encoding of v with insignificant
+// white space removed.
+func compactJSON(v interface{}) ([]byte, error) {
+	data, ok := v.(json.RawMessage)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// save writes the recording to w as JSON.
+func (r *recording) save(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	data, err := json.MarshalIndent(&fixture{Interactions: r.interactions}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// load reads a recording from r.
+func (r *recording) load(rd io.Reader) error {
+	var f fixture
+	if err := json.NewDecoder(rd).Decode(&f); err != nil {
+		return errors.Wrap(err, "cannot read recording")
+	}
+	r.interactions = f.Interactions
+	return nil
+}
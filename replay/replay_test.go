@@ -0,0 +1,89 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jjeffery/simpledbsql"
+	"github.com/jjeffery/simpledbsql/internal/fakesdb"
+)
+
+// run runs statements against db and returns the ids selected.
+func run(ctx context.Context, db *sql.DB) ([]string, error) {
+	_, err := db.ExecContext(ctx, `
+		create table tbl;
+		insert into tbl(id, a) values('ID1', 'x');
+		insert into tbl(id, a) values('ID2', 'y');
+		update tbl set a = ?, b = ? where id = 'ID1';
+	`, "z", nil)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.ExecContext(ctx, "insert into tbl(id, a) values('ID1', 'x')")
+	if err == nil || !strings.Contains(err.Error(), "duplicate key") {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, "select id from tbl where a = 'z'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func TestRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	rec := NewRecorder(fakesdb.New())
+	db := sql.OpenDB(&simpledbsql.Connector{SimpleDB: rec})
+	defer db.Close()
+	want, err := run(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := rec.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	rp, err := NewReplayer(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db2 := sql.OpenDB(&simpledbsql.Connector{SimpleDB: rp})
+	defer db2.Close()
+	got, err := run(ctx, db2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, want := rp.Unused(), 0; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+
+	// requests that were not recorded fail
+	_, err = db2.ExecContext(ctx, "delete from tbl where id = 'ID3'")
+	if err == nil || !strings.Contains(err.Error(), "no recorded request") {
+		t.Errorf("got=%v, want no recorded request", err)
+	}
+}
+
+func TestNewReplayerError(t *testing.T) {
+	_, err := NewReplayer(strings.NewReader("not json"))
+	if err == nil || !strings.Contains(err.Error(), "cannot read recording") {
+		t.Errorf("got=%v, want cannot read recording", err)
+	}
+}
@@ -0,0 +1,127 @@
+package replay
+
+import (
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
+)
+
+// Replayer implements the SimpleDB API by returning the responses recorded
+// by a Recorder. A request that does not match a recorded request returns an
+// error. Only the WithContext methods are implemented: the other methods
+// panic if called.
+type Replayer struct {
+	simpledbiface.SimpleDBAPI
+	recording recording
+}
+
+// checks that Replayer implements the SimpleDBAPI interface
+var _ simpledbiface.SimpleDBAPI = (*Replayer)(nil)
+
+// NewReplayer returns a Replayer for the recording read from r, which
+// is in the format written by Recorder.Save.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	rp := &Replayer{}
+	if err := rp.recording.load(r); err != nil {
+		return nil, err
+	}
+	return rp, nil
+}
+
+// Unused returns the number of recorded requests that have not been
+// replayed. It is useful for checking that a test sent every request
+// that was recorded.
+func (r *Replayer) Unused() int {
+	r.recording.mutex.Lock()
+	defer r.recording.mutex.Unlock()
+	var n int
+	for _, ia := range r.recording.interactions {
+		if !ia.used {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Replayer) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	output := &simpledb.SelectOutput{}
+	if err := r.recording.replay("Select", input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func (r *Replayer) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	output := &simpledb.GetAttributesOutput{}
+	if err := r.recording.replay("GetAttributes", input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func (r *Replayer) PutAttributesWithContext(ctx aws.Context, input *simpledb.PutAttributesInput, opts ...request.Option) (*simpledb.PutAttributesOutput, error) {
+	output := &simpledb.PutAttributesOutput{}
+	if err := r.recording.replay("PutAttributes", input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func (r *Replayer) DeleteAttributesWithContext(ctx aws.Context, input *simpledb.DeleteAttributesInput, opts ...request.Option) (*simpledb.DeleteAttributesOutput, error) {
+	output := &simpledb.DeleteAttributesOutput{}
+	if err := r.recording.replay("DeleteAttributes", input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func (r *Replayer) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	output := &simpledb.BatchPutAttributesOutput{}
+	if err := r.recording.replay("BatchPutAttributes", input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func (r *Replayer) BatchDeleteAttributesWithContext(ctx aws.Context, input *simpledb.BatchDeleteAttributesInput, opts ...request.Option) (*simpledb.BatchDeleteAttributesOutput, error) {
+	output := &simpledb.BatchDeleteAttributesOutput{}
+	if err := r.recording.replay("BatchDeleteAttributes", input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func (r *Replayer) CreateDomainWithContext(ctx aws.Context, input *simpledb.CreateDomainInput, opts ...request.Option) (*simpledb.CreateDomainOutput, error) {
+	output := &simpledb.CreateDomainOutput{}
+	if err := r.recording.replay("CreateDomain", input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func (r *Replayer) DeleteDomainWithContext(ctx aws.Context, input *simpledb.DeleteDomainInput, opts ...request.Option) (*simpledb.DeleteDomainOutput, error) {
+	output := &simpledb.DeleteDomainOutput{}
+	if err := r.recording.replay("DeleteDomain", input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func (r *Replayer) ListDomainsWithContext(ctx aws.Context, input *simpledb.ListDomainsInput, opts ...request.Option) (*simpledb.ListDomainsOutput, error) {
+	output := &simpledb.ListDomainsOutput{}
+	if err := r.recording.replay("ListDomains", input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func (r *Replayer) DomainMetadataWithContext(ctx aws.Context, input *simpledb.DomainMetadataInput, opts ...request.Option) (*simpledb.DomainMetadataOutput, error) {
+	output := &simpledb.DomainMetadataOutput{}
+	if err := r.recording.replay("DomainMetadata", input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
@@ -0,0 +1,56 @@
+package resolver
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultTTL is the time to live for cached domain names
+// if none is specified.
+const defaultTTL = 5 * time.Minute
+
+// cacheEntry is a cached domain name. A blank domain name is
+// cached when the lookup service has no domain name for the table.
+type cacheEntry struct {
+	domainName string
+	expires    time.Time
+}
+
+// cache is a cache of domain names keyed by table name.
+type cache struct {
+	mutex   sync.Mutex
+	entries map[string]cacheEntry
+	now     func() time.Time // for testing
+}
+
+func (c *cache) get(tableName string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[tableName]
+	if !ok || c.timeNow().After(entry.expires) {
+		return "", false
+	}
+	return entry.domainName, true
+}
+
+func (c *cache) put(tableName string, domainName string, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cacheEntry)
+	}
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	c.entries[tableName] = cacheEntry{
+		domainName: domainName,
+		expires:    c.timeNow().Add(ttl),
+	}
+}
+
+func (c *cache) timeNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql"
+)
+
+// checks that CloudFormation implements the SynonymResolver interface
+var _ simpledbsql.SynonymResolver = (*CloudFormation)(nil)
+
+// CloudFormation resolves table names to domain names using
+// the outputs of a CloudFormation stack.
+//
+// A typical template creates the domain and exports its name as an output.
+//
+//	Resources:
+//	  UsersDomain:
+//	    Type: AWS::SDB::Domain
+//	Outputs:
+//	  UsersDomain:
+//	    Value: !Ref UsersDomain
+type CloudFormation struct {
+	// CloudFormation is the AWS SDK handle used to describe the stack.
+	CloudFormation cloudformationiface.CloudFormationAPI
+
+	// StackName is the name or ID of the CloudFormation stack.
+	StackName string
+
+	// OutputKeys maps table names to the stack output key that contains
+	// the domain name. If a table name is not in OutputKeys, the output
+	// key is the same as the table name.
+	OutputKeys map[string]string
+
+	// TTL is the time that stack outputs are cached before being
+	// refreshed. Defaults to five minutes.
+	TTL time.Duration
+
+	mutex   sync.Mutex
+	outputs map[string]string
+	expires time.Time
+}
+
+// Resolve implements the simpledbsql.SynonymResolver interface.
+func (r *CloudFormation) Resolve(ctx context.Context, tableName string) (string, error) {
+	outputKey, ok := r.OutputKeys[tableName]
+	if !ok {
+		outputKey = tableName
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.outputs == nil || time.Now().After(r.expires) {
+		outputs, err := r.describeOutputs(ctx)
+		if err != nil {
+			return "", err
+		}
+		ttl := r.TTL
+		if ttl <= 0 {
+			ttl = defaultTTL
+		}
+		r.outputs = outputs
+		r.expires = time.Now().Add(ttl)
+	}
+	return r.outputs[outputKey], nil
+}
+
+func (r *CloudFormation) describeOutputs(ctx context.Context) (map[string]string, error) {
+	input := cloudformation.DescribeStacksInput{
+		StackName: aws.String(r.StackName),
+	}
+	output, err := r.CloudFormation.DescribeStacksWithContext(ctx, &input)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot describe stack").With(
+			"stack", r.StackName,
+		)
+	}
+	if len(output.Stacks) == 0 {
+		return nil, errors.New("stack not found").With(
+			"stack", r.StackName,
+		)
+	}
+	outputs := make(map[string]string)
+	for _, o := range output.Stacks[0].Outputs {
+		outputs[aws.StringValue(o.OutputKey)] = aws.StringValue(o.OutputValue)
+	}
+	return outputs, nil
+}
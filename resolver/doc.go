@@ -0,0 +1,6 @@
+// Package resolver provides implementations of the simpledbsql.SynonymResolver
+// interface, which look up SimpleDB domain names at run time.
+//
+// Domain names are cached, and refreshed after a configurable time to live,
+// so the lookup services are not called for every statement.
+package resolver
@@ -0,0 +1,127 @@
+package resolver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+type fakeCloudFormation struct {
+	cloudformationiface.CloudFormationAPI
+	calls int
+}
+
+func (f *fakeCloudFormation) DescribeStacksWithContext(ctx aws.Context, input *cloudformation.DescribeStacksInput, opts ...request.Option) (*cloudformation.DescribeStacksOutput, error) {
+	f.calls++
+	return &cloudformation.DescribeStacksOutput{
+		Stacks: []*cloudformation.Stack{
+			{
+				StackName: input.StackName,
+				Outputs: []*cloudformation.Output{
+					{OutputKey: aws.String("users"), OutputValue: aws.String("stack-UsersDomain-1AB2C3")},
+					{OutputKey: aws.String("OrdersDomain"), OutputValue: aws.String("stack-OrdersDomain-4DE5F6")},
+				},
+			},
+		},
+	}, nil
+}
+
+func TestCloudFormation(t *testing.T) {
+	ctx := context.Background()
+	cf := &fakeCloudFormation{}
+	r := &CloudFormation{
+		CloudFormation: cf,
+		StackName:      "stack",
+		OutputKeys: map[string]string{
+			"orders": "OrdersDomain",
+		},
+	}
+	tests := []struct {
+		tableName  string
+		domainName string
+	}{
+		{"users", "stack-UsersDomain-1AB2C3"},
+		{"orders", "stack-OrdersDomain-4DE5F6"},
+		{"unknown", ""},
+	}
+	for tn, tt := range tests {
+		got, err := r.Resolve(ctx, tt.tableName)
+		if err != nil {
+			t.Fatalf("%d: got=%v, want=nil", tn, err)
+		}
+		if want := tt.domainName; got != want {
+			t.Errorf("%d: got=%q, want=%q", tn, got, want)
+		}
+	}
+	if got, want := cf.calls, 1; got != want {
+		t.Errorf("got=%d, want=%d", got, want)
+	}
+}
+
+type fakeSSM struct {
+	ssmiface.SSMAPI
+	calls int
+}
+
+func (f *fakeSSM) GetParameterWithContext(ctx aws.Context, input *ssm.GetParameterInput, opts ...request.Option) (*ssm.GetParameterOutput, error) {
+	f.calls++
+	if aws.StringValue(input.Name) != "/app/dev/users" {
+		return nil, awserr.New(ssm.ErrCodeParameterNotFound, "not found", nil)
+	}
+	return &ssm.GetParameterOutput{
+		Parameter: &ssm.Parameter{
+			Name:  input.Name,
+			Value: aws.String("dev-users-7GH8I9"),
+		},
+	}, nil
+}
+
+func TestSSM(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &fakeSSM{}
+	r := &SSM{
+		SSM:    f,
+		Prefix: "/app/dev/",
+		TTL:    time.Minute,
+	}
+	r.cache.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		got, err := r.Resolve(ctx, "users")
+		if err != nil {
+			t.Fatalf("got=%v, want=nil", err)
+		}
+		if want := "dev-users-7GH8I9"; got != want {
+			t.Errorf("got=%q, want=%q", got, want)
+		}
+		got, err = r.Resolve(ctx, "orders")
+		if err != nil {
+			t.Fatalf("got=%v, want=nil", err)
+		}
+		if want := ""; got != want {
+			t.Errorf("got=%q, want=%q", got, want)
+		}
+	}
+	if got, want := f.calls, 2; got != want {
+		t.Errorf("got=%d, want=%d", got, want)
+	}
+
+	// cache expires
+	now = now.Add(2 * time.Minute)
+	_, err := r.Resolve(ctx, "users")
+	if err != nil {
+		t.Fatalf("got=%v, want=nil", err)
+	}
+	if got, want := f.calls, 3; got != want {
+		t.Errorf("got=%d, want=%d", got, want)
+	}
+}
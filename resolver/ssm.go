@@ -0,0 +1,67 @@
+package resolver
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql"
+)
+
+// checks that SSM implements the SynonymResolver interface
+var _ simpledbsql.SynonymResolver = (*SSM)(nil)
+
+// SSM resolves table names to domain names using parameters
+// in the AWS Systems Manager Parameter Store.
+type SSM struct {
+	// SSM is the AWS SDK handle used to get parameters.
+	SSM ssmiface.SSMAPI
+
+	// Prefix is prepended to the table name to form the parameter name.
+	// For example, if Prefix is "/myapp/prod/domains/", the domain name for
+	// table "users" is obtained from parameter "/myapp/prod/domains/users".
+	Prefix string
+
+	// TTL is the time that domain names are cached before being
+	// refreshed. Defaults to five minutes.
+	TTL time.Duration
+
+	cache cache
+}
+
+// Resolve implements the simpledbsql.SynonymResolver interface.
+func (r *SSM) Resolve(ctx context.Context, tableName string) (string, error) {
+	if domainName, ok := r.cache.get(tableName); ok {
+		return domainName, nil
+	}
+	name := r.Prefix + tableName
+	input := ssm.GetParameterInput{
+		Name: aws.String(name),
+	}
+	output, err := r.SSM.GetParameterWithContext(ctx, &input)
+	if err != nil {
+		if hasCode(err, ssm.ErrCodeParameterNotFound) {
+			r.cache.put(tableName, "", r.TTL)
+			return "", nil
+		}
+		return "", errors.Wrap(err, "cannot get parameter").With(
+			"name", name,
+		)
+	}
+	var domainName string
+	if output.Parameter != nil {
+		domainName = aws.StringValue(output.Parameter.Value)
+	}
+	r.cache.put(tableName, domainName, r.TTL)
+	return domainName, nil
+}
+
+func hasCode(err error, code string) bool {
+	if coder, ok := err.(interface{ Code() string }); ok {
+		return code == coder.Code()
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// returning runs an insert or update statement with a returning clause, and
+// returns a row with the values written to the columns of the clause. The
+// values are those of the statement, so the caller does not need to read the
+// item again, which an eventually consistent read might not find. There is
+// no row if the statement did not write the item, such as an insert ignore
+// of an item that exists, or an update whose if clause does not match.
+func (c *conn) returning(ctx context.Context, stmt string, q *parse.Query, args []driver.Value) (driver.Rows, error) {
+	q, args, err := c.completeInsert(q, args)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		columns []parse.Column
+		key     parse.Key
+		names   []string
+	)
+	if q.Insert != nil {
+		columns, key, names = q.Insert.Columns, q.Insert.Key, q.Insert.Returning
+	} else {
+		columns, key, names = q.Update.Columns, q.Update.Key, q.Update.Returning
+	}
+	itemName, err := key.String(args)
+	if err != nil {
+		return nil, err
+	}
+	row := make([]driver.Value, len(names))
+	for i, name := range names {
+		if parse.IsID(name) {
+			row[i] = itemName
+			continue
+		}
+		var found bool
+		for _, col := range columns {
+			// the last value of a column is the one written
+			if col.ColumnName == name {
+				if row[i], err = col.GetValue(args); err != nil {
+					return nil, err
+				}
+				found = true
+			}
+		}
+		if !found {
+			// only values known without reading the item are returned
+			return nil, errors.New("returning column is not written by the statement").With(
+				"column", name,
+			)
+		}
+	}
+
+	result, err := c.execStatement(ctx, stmt, q, args)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	rows := &valueRows{columns: names}
+	if rowsAffected > 0 {
+		rows.values = append(rows.values, row)
+	}
+	return rows, nil
+}
@@ -5,10 +5,11 @@ import (
 	"database/sql/driver"
 	"encoding/base64"
 	"io"
+	"math/big"
 	"strconv"
 	"strings"
-	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/simpledb"
 	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
 	"github.com/jjeffery/errors"
@@ -18,12 +19,20 @@ import (
 type columnMap struct {
 	columns       []string
 	colmap        map[string]int
-	itemNameIndex int // index of column corresponding to itemName
+	itemNameIndex int      // index of column corresponding to itemName, or -1
+	meta          metadata // attributes containing column types
+
+	// reused by setValues for each item, to avoid allocations
+	types       []string          // type of each column
+	packed      string            // packed types of the previous item
+	packedTypes map[string]string // unpacked types of the previous item
 }
 
-func (cm *columnMap) setColumns(columns []string) {
+func (cm *columnMap) setColumns(columns []string, meta metadata) {
 	cm.columns = columns
+	cm.meta = meta
 	cm.colmap = make(map[string]int, len(cm.columns))
+	cm.itemNameIndex = -1
 	for i, col := range columns {
 		if parse.IsID(col) {
 			cm.itemNameIndex = i
@@ -34,78 +43,146 @@ func (cm *columnMap) setColumns(columns []string) {
 }
 
 func (cm *columnMap) setValues(item *simpledb.Item, values []driver.Value) {
+	item = cm.meta.completeItem(item)
+
 	// everything starts as nil
 	for i := range values {
 		values[i] = nil
 	}
 
-	values[cm.itemNameIndex] = derefString(item.Name)
-	colTypes := make(map[string]string, len(item.Attributes))
+	if cm.itemNameIndex >= 0 {
+		values[cm.itemNameIndex] = derefString(item.Name)
+	}
+
+	if len(cm.types) != len(values) {
+		cm.types = make([]string, len(values))
+	}
+	for i := range cm.types {
+		cm.types[i] = ""
+	}
 
-	// collect the column types first
+	// columns with a type but no value
+	setType := func(colName, colType string) {
+		if index, ok := cm.colmap[colName]; ok {
+			cm.types[index] = colType
+			values[index] = zeroValue(colType)
+		}
+	}
 	for _, attr := range item.Attributes {
 		name := derefString(attr.Name)
-		if strings.HasPrefix(name, "sql:") {
-			value := derefString(attr.Value)
-			colTypes[name] = value
-			colName := strings.TrimPrefix(name, "sql:")
-			if index, ok := cm.colmap[colName]; ok {
-				switch value {
-				case "string":
-					values[index] = ""
-				case "int64":
-					values[index] = int64(0)
-				case "float64":
-					values[index] = float64(0)
-				case "bool":
-					values[index] = false
-				case "binary", "null":
-					values[index] = nil
-				}
+		if cm.meta.packed && name == cm.meta.packedAttr() {
+			// consecutive items usually have the same packed types
+			if value := derefString(attr.Value); cm.packedTypes == nil || value != cm.packed {
+				cm.packed = value
+				cm.packedTypes = unpackTypes(value)
+			}
+			for colName, colType := range cm.packedTypes {
+				setType(colName, colType)
 			}
+			continue
 		}
+		cm.meta.attributeTypes(name, derefString(attr.Value), setType)
 	}
 
+	for _, attr := range item.Attributes {
+		if index, ok := cm.colmap[derefString(attr.Name)]; ok {
+			values[index] = decodeValue(cm.types[index], derefString(attr.Value))
+		}
+	}
+}
+
+// decodeItem returns all of the values in an item, keyed by column name.
+func decodeItem(item *simpledb.Item, meta metadata) map[string]interface{} {
+	item = meta.completeItem(item)
+	values := make(map[string]interface{}, len(item.Attributes)/2+1)
+	colTypes := meta.columnTypes(item.Attributes)
+	for colName, colType := range colTypes {
+		values[colName] = zeroValue(colType)
+	}
 	for _, attr := range item.Attributes {
 		name := derefString(attr.Name)
-		value := derefString(attr.Value)
-		colType := colTypes[typeColumnName(name)]
-		if colType == "" {
-			colType = "string"
+		if !meta.isMetadata(name) {
+			values[name] = decodeValue(colTypes[name], derefString(attr.Value))
 		}
-		if index, ok := cm.colmap[name]; ok {
-			switch colType {
-			case "string":
-				values[index] = value
-			case "int64":
-				{
-					n, _ := strconv.ParseInt(value, 10, 64)
-					values[index] = n
-				}
-			case "float64":
-				{
-					n, _ := strconv.ParseFloat(value, 64)
-					values[index] = n
-				}
-			case "bool":
-				{
-					b, _ := strconv.ParseBool(value)
-					values[index] = b
-				}
-			case "time":
-				{
-					t, _ := time.Parse(time.RFC3339, value)
-					values[index] = t
-				}
-			case "binary":
-				{
-					// TODO(jpj): handle strings longer than 1024
-					data, _ := base64.StdEncoding.DecodeString(value)
-					values[index] = data
-				}
-			}
+	}
+	values["id"] = derefString(item.Name)
+	return values
+}
+
+// zeroValue returns the value of a column that has a type but no
+// attribute value, which happens because SimpleDB cannot store
+// empty strings.
+func zeroValue(colType string) driver.Value {
+	switch colType {
+	case "string", "empty":
+		return ""
+	case "int64":
+		return int64(0)
+	case "uint64":
+		return uint64(0)
+	case "float64":
+		return float64(0)
+	case "bool":
+		return false
+	}
+	return nil
+}
+
+// splitType splits a column type into its type name and its qualifier, which
+// is the name of the time's location for times, and the encoding for binary
+// values that are not base64 encoded.
+func splitType(colType string) (typeName string, qualifier string) {
+	if i := strings.IndexByte(colType, ':'); i >= 0 {
+		return colType[:i], colType[i+1:]
+	}
+	return colType, ""
+}
+
+// decodeValue converts an attribute value to a value of the column type.
+// Attributes without a type are strings.
+func decodeValue(colType string, value string) driver.Value {
+	colType, qualifier := splitType(colType)
+	switch colType {
+	case "", "string":
+		return value
+	case "empty":
+		// value is the Connector's EmptyStringSentinel
+		return ""
+	case "int64":
+		n, _ := strconv.ParseInt(value, 10, 64)
+		return n
+	case "uint64":
+		n, _ := strconv.ParseUint(value, 10, 64)
+		return n
+	case "bigint":
+		n, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			// not a typed nil, which would not be a nil driver.Value
+			return nil
 		}
+		return n
+	case "decimal":
+		r, _ := decodeDecimal(value)
+		return r
+	case "float64":
+		n, _ := strconv.ParseFloat(value, 64)
+		return n
+	case "bool":
+		b, _ := strconv.ParseBool(value)
+		return b
+	case "time":
+		t, _ := decodeTime(value, qualifier)
+		return t
+	case "binary":
+		// TODO(jpj): handle strings longer than 1024
+		if qualifier == ascii85Encoding {
+			data, _ := decodeASCII85(value)
+			return data
+		}
+		data, _ := base64.StdEncoding.DecodeString(value)
+		return data
 	}
+	return nil
 }
 
 // getAttributeRows implements the sql.Rows interface. It returns at most one row.
@@ -114,9 +191,28 @@ type getAttributesRows struct {
 	item *simpledb.Item
 }
 
-func newGetAttributeRows(columns []string) *getAttributesRows {
+// setItem sets the item returned by the rows, unless the item does
+// not exist, has expired, or is the schema item.
+func (rows *getAttributesRows) setItem(itemName string, attrs []*simpledb.Attribute, filter ttlFilter) {
+	if len(attrs) == 0 {
+		return
+	}
+	item := &simpledb.Item{
+		Name:       aws.String(itemName),
+		Attributes: attrs,
+	}
+	// The schema item is not returned, because select statements do not
+	// return it. Otherwise a query for the schema item by id would return
+	// a row when it is read by GetAttributes, but sql.ErrNoRows when the
+	// same query is sent as a select statement.
+	if !isSchemaItem(item) && !filter.expired(item) {
+		rows.item = item
+	}
+}
+
+func newGetAttributeRows(columns []string, meta metadata) *getAttributesRows {
 	rows := &getAttributesRows{}
-	rows.cm.setColumns(columns)
+	rows.cm.setColumns(columns, meta)
 	return rows
 }
 
@@ -148,20 +244,27 @@ type selectQueryRows struct {
 	simpledb simpledbiface.SimpleDBAPI
 	input    *simpledb.SelectInput
 	items    []*simpledb.Item
+	ttl      ttlFilter
+	guard    *selectGuard
+	spool    *spool                    // if not nil, pages are fetched in the background
+	repair   func(item *simpledb.Item) // if not nil, completes pending updates
 }
 
-func newRows(ctx context.Context, simpledb simpledbiface.SimpleDBAPI, columns []string, input *simpledb.SelectInput) *selectQueryRows {
+func newRows(ctx context.Context, simpledb simpledbiface.SimpleDBAPI, columns []string, meta metadata, input *simpledb.SelectInput) *selectQueryRows {
 	rows := &selectQueryRows{
 		ctx:      ctx,
 		simpledb: simpledb,
 		input:    input,
 	}
-	rows.cm.setColumns(columns)
+	rows.cm.setColumns(columns, meta)
 	return rows
 }
 
 func (rows *selectQueryRows) selectNext() error {
-	output, err := rows.simpledb.SelectWithContext(rows.ctx, rows.input)
+	if err := rows.guard.page(); err != nil {
+		return err
+	}
+	output, err := rows.simpledb.SelectWithContext(rows.ctx, rows.input, requestOptions(rows.ctx)...)
 	if err != nil {
 		return err
 	}
@@ -176,22 +279,146 @@ func (rows *selectQueryRows) Columns() []string {
 
 func (rows *selectQueryRows) Close() error {
 	rows.items = nil
+	if rows.spool != nil {
+		err := rows.spool.close()
+		rows.spool = nil
+		return err
+	}
 	return nil
 }
 
 func (rows *selectQueryRows) Next(dest []driver.Value) error {
+	item, err := rows.nextItem()
+	if err != nil {
+		if err == io.EOF {
+			return err
+		}
+		return rows.guard.deadlineError(rows.ctx, err)
+	}
+	if err := rows.guard.row(); err != nil {
+		return err
+	}
+	rows.cm.setValues(item, dest)
+	return nil
+}
+
+// nextItem returns the next item, selecting the next page of results if
+// necessary. It does not return the schema item or expired items.
+func (rows *selectQueryRows) nextItem() (*simpledb.Item, error) {
+	for {
+		item, err := rows.fetchItem()
+		if err != nil {
+			return nil, err
+		}
+		if !isSchemaItem(item) && !rows.ttl.expired(item) {
+			if rows.repair != nil {
+				rows.repair(item)
+			}
+			return item, nil
+		}
+	}
+}
+
+// fetchItem returns the next item from the spool if pages are fetched in the
+// background, otherwise it selects the next page of results if necessary.
+func (rows *selectQueryRows) fetchItem() (*simpledb.Item, error) {
+	if rows.spool != nil {
+		return rows.spool.next()
+	}
 	for len(rows.items) == 0 {
 		// if input next token is nil, that means there are no more rows
 		if rows.input.NextToken == nil {
-			return io.EOF
+			return nil, io.EOF
 		}
 		if err := rows.selectNext(); err != nil {
-			return err
+			return nil, err
 		}
 	}
 	item := rows.items[0]
 	rows.items = rows.items[1:]
-	rows.cm.setValues(item, dest)
+	return item, nil
+}
+
+// isSchemaItem returns true if the item is the reserved item that records
+// the schema of its domain, which is not returned by select statements.
+func isSchemaItem(item *simpledb.Item) bool {
+	return derefString(item.Name) == SchemaItemName
+}
+
+// multiRows implements the sql.Rows interface for a query containing multiple
+// statements. Each statement is run when its result set is requested.
+type multiRows struct {
+	ctx     context.Context
+	conn    *conn
+	stmts   []string       // text of the statements not yet run
+	queries []*parse.Query // statements not yet run
+	args    [][]driver.Value
+	rows    driver.Rows // result set of the current statement
+	index   int         // index of the current statement
+}
+
+// checks that multiRows implements the driver.RowsNextResultSet interface
+var _ driver.RowsNextResultSet = (*multiRows)(nil)
+
+func (rows *multiRows) Columns() []string {
+	return rows.rows.Columns()
+}
+
+func (rows *multiRows) Close() error {
+	rows.stmts, rows.queries = nil, nil
+	return rows.rows.Close()
+}
+
+func (rows *multiRows) Next(dest []driver.Value) error {
+	return rows.rows.Next(dest)
+}
+
+func (rows *multiRows) HasNextResultSet() bool {
+	return len(rows.queries) > 0
+}
+
+func (rows *multiRows) NextResultSet() error {
+	if len(rows.queries) == 0 {
+		return io.EOF
+	}
+	if rows.rows != nil {
+		if err := rows.rows.Close(); err != nil {
+			return err
+		}
+		rows.index++
+	}
+	stmt, q, args := rows.stmts[0], rows.queries[0], rows.args[0]
+	rows.stmts, rows.queries, rows.args = rows.stmts[1:], rows.queries[1:], rows.args[1:]
+	next, err := rows.conn.query(rows.ctx, stmt, q, args)
+	if err != nil {
+		return errors.Wrap(err, "cannot run statement").With("index", rows.index)
+	}
+	rows.rows = next
+	return nil
+}
+
+// valueRows implements the sql.Rows interface for a result set that
+// is held in memory.
+type valueRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (rows *valueRows) Columns() []string {
+	return rows.columns
+}
+
+func (rows *valueRows) Close() error {
+	rows.values = nil
+	return nil
+}
+
+func (rows *valueRows) Next(dest []driver.Value) error {
+	if len(rows.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, rows.values[0])
+	rows.values = rows.values[1:]
 	return nil
 }
 
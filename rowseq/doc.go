@@ -0,0 +1,6 @@
+// Package rowseq provides iterators over the rows returned by queries,
+// which scan each row into a value of a generic type.
+//
+// The iterators are range-over-func sequences, so this package
+// requires Go 1.23 or later.
+package rowseq
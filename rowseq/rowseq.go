@@ -0,0 +1,123 @@
+//go:build go1.23
+
+package rowseq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"reflect"
+	"strings"
+)
+
+// Query runs a query and returns a sequence of its rows, each scanned into a
+// value of type T. The query runs when the sequence is iterated, and the rows
+// are closed when iteration stops. If an error occurs, it is yielded with the
+// zero value of T and iteration stops.
+//
+// If T is a struct, each column is scanned into the field with a matching
+// "sql" struct tag, or if there is no such field, the exported field whose
+// name matches the column name ignoring case. Fields tagged `sql:"-"` are
+// ignored. It is an error for a column not to have a matching field, but
+// fields without a matching column are left unchanged.
+//
+// If T is not a struct, the query must return a single column,
+// which is scanned into the value.
+//
+//	type User struct {
+//		ID   string `sql:"id"`
+//		Name string `sql:"name"`
+//		Age  *int64 `sql:"age"` // nil if null
+//	}
+//
+//	for user, err := range rowseq.Query[User](ctx, db, "select id, name, age from users") {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(user.Name)
+//	}
+func Query[T any](ctx context.Context, db *sql.DB, query string, args ...any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+		columns, err := rows.Columns()
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		indexes, err := fieldIndexes(reflect.TypeOf(zero), columns)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		for rows.Next() {
+			var v T
+			if err := rows.Scan(scanDest(&v, indexes)...); err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// fieldIndexes returns the index of the struct field for each column,
+// or nil if typ is not a struct.
+func fieldIndexes(typ reflect.Type, columns []string) ([][]int, error) {
+	if typ == nil || typ.Kind() != reflect.Struct {
+		if len(columns) != 1 {
+			return nil, fmt.Errorf("expect one column for %v, got %d", typ, len(columns))
+		}
+		return nil, nil
+	}
+	tagged := make(map[string][]int)
+	named := make(map[string][]int)
+	for _, field := range reflect.VisibleFields(typ) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		tag := field.Tag.Get("sql")
+		switch tag {
+		case "-":
+		case "":
+			named[strings.ToLower(field.Name)] = field.Index
+		default:
+			tagged[tag] = field.Index
+		}
+	}
+	indexes := make([][]int, len(columns))
+	for i, column := range columns {
+		if index, ok := tagged[column]; ok {
+			indexes[i] = index
+		} else if index, ok := named[strings.ToLower(column)]; ok {
+			indexes[i] = index
+		} else {
+			return nil, fmt.Errorf("no field in %v for column %q", typ, column)
+		}
+	}
+	return indexes, nil
+}
+
+// scanDest returns the scan destinations for the fields of *v.
+func scanDest[T any](v *T, indexes [][]int) []any {
+	if indexes == nil {
+		return []any{v}
+	}
+	rv := reflect.ValueOf(v).Elem()
+	dest := make([]any, len(indexes))
+	for i, index := range indexes {
+		dest[i] = rv.FieldByIndex(index).Addr().Interface()
+	}
+	return dest
+}
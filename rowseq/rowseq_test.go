@@ -0,0 +1,96 @@
+//go:build go1.23
+
+package rowseq
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jjeffery/simpledbsql"
+	"github.com/jjeffery/simpledbsql/internal/fakesdb"
+)
+
+type user struct {
+	ID      string `sql:"id"`
+	Name    string
+	Age     *int64 `sql:"age"`
+	Created time.Time
+	Ignored string `sql:"-"`
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(&simpledbsql.Connector{SimpleDB: fakesdb.New()})
+	defer db.Close()
+	created := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	_, err := db.ExecContext(ctx, `
+		create table users;
+		insert into users(id, name, age, created) values('U1', 'alice', ?, ?);
+		insert into users(id, name, created) values('U2', 'bob', ?);
+	`, int64(30), created, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var users []user
+	for u, err := range Query[user](ctx, db, "select id, name, age, created from users") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+	}
+	age := int64(30)
+	want := []user{
+		{ID: "U1", Name: "alice", Age: &age, Created: created},
+		{ID: "U2", Name: "bob", Created: created},
+	}
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("got=%+v, want=%+v", users, want)
+	}
+
+	var names []string
+	for name, err := range Query[string](ctx, db, "select name from users where id > ?", "U1") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if want := []string{"bob"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got=%v, want=%v", names, want)
+	}
+
+	// stopping early
+	var count int
+	for range Query[user](ctx, db, "select id from users") {
+		count++
+		break
+	}
+	if count != 1 {
+		t.Errorf("got=%v, want=1", count)
+	}
+
+	errorTests := []struct {
+		query   string
+		errText string
+	}{
+		{"select id, unknown from users", `no field in rowseq.user for column "unknown"`},
+		{"delete from users where id = 'U1'", "expect select query for QueryContext"},
+	}
+	for tn, tt := range errorTests {
+		var gotErr error
+		for _, err := range Query[user](ctx, db, tt.query) {
+			gotErr = err
+		}
+		if gotErr == nil || gotErr.Error() != tt.errText {
+			t.Errorf("%d: got=%v, want=%v", tn, gotErr, tt.errText)
+		}
+	}
+	for _, err := range Query[string](ctx, db, "select id, name from users") {
+		if err == nil {
+			t.Errorf("expected error for multiple columns")
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package simpledbsql
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// ScanPolicy controls select statements that scan an entire table, because
+// their where clause has no predicate that SimpleDB can evaluate using its
+// indexes. A statement with a "scan" hint, such as "select /*+ scan */ ...",
+// is always allowed.
+type ScanPolicy int
+
+// Policies for select statements that scan an entire table.
+const (
+	// ScanAllow runs the statements. This is the default.
+	ScanAllow ScanPolicy = iota
+
+	// ScanWarn runs the statements, after passing each of them to the
+	// Connector's OnScan function, or to the standard logger if there
+	// is no OnScan function.
+	ScanWarn
+
+	// ScanError returns an error instead of running the statements.
+	ScanError
+)
+
+// Scan describes a select statement that scans an entire table. It is
+// passed to the OnScan hook of the Connector if its ScanPolicy is ScanWarn.
+type Scan struct {
+	Table       string // table name in the statement
+	WhereClause string // where clause of the statement, if any, with its string literals redacted
+}
+
+// checkScan applies the Connector's ScanPolicy to a select statement.
+func (c *conn) checkScan(ctx context.Context, q *parse.SelectQuery) error {
+	if c.scanPolicy == ScanAllow || q.AllowScan || !isScan(q.WhereClause) {
+		return nil
+	}
+	if c.scanPolicy == ScanError {
+		return errors.New(`select scans the entire table, add a predicate to the where clause, or a "scan" hint`).With(
+			"table", q.TableName,
+		)
+	}
+	scan := &Scan{
+		Table:       q.TableName,
+		WhereClause: c.redactExpression(strings.Join(q.WhereClause, "")),
+	}
+	if c.onScan != nil {
+		c.onScan(ctx, scan)
+	} else {
+		log.Printf("simpledbsql: select scans the entire table %q: %s", scan.Table, scan.WhereClause)
+	}
+	return nil
+}
+
+// isScan returns true if a where clause has no predicate that SimpleDB can
+// evaluate using its indexes, which includes a where clause that only has
+// "is null" and "is not null" predicates.
+func isScan(whereClause []string) bool {
+	for i := 0; i < len(whereClause); i++ {
+		lexeme := whereClause[i]
+		switch strings.ToLower(lexeme) {
+		case "order", "limit":
+			return true
+		case "where", "and", "or", "not", "intersection", "(", ")":
+			continue
+		}
+		if isSpaceLexeme(lexeme) {
+			continue
+		}
+		if _, _, n := matchNullTest(whereClause[i:]); n > 0 {
+			i += n - 1
+			continue
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,217 @@
+package simpledbsql
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+)
+
+// SchemaItemName is the name of the reserved item in each domain that records
+// the columns and types written to the domain, when the Connector has
+// RecordSchema set. The item has an attribute for each column, with one
+// value for each type that has been written to the column.
+//
+// Select statements do not return the schema item.
+const SchemaItemName = "sql:schema"
+
+// schemaRecorder records the column types written to each domain. It keeps
+// track of the types already recorded, so that each type is only recorded once
+// by each Connector.
+type schemaRecorder struct {
+	mutex    sync.Mutex
+	recorded map[schemaKey]bool
+}
+
+type schemaKey struct {
+	domainName string
+	columnName string
+	typeName   string
+}
+
+func newSchemaRecorder() *schemaRecorder {
+	return &schemaRecorder{
+		recorded: make(map[schemaKey]bool),
+	}
+}
+
+// unrecorded returns the column types in attrs that have not been recorded.
+func (sr *schemaRecorder) unrecorded(domainName string, meta metadata, attrs []*simpledb.ReplaceableAttribute) []schemaKey {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	var keys []schemaKey
+	seen := make(map[schemaKey]bool)
+	for _, attr := range attrs {
+		meta.attributeTypes(derefString(attr.Name), derefString(attr.Value), func(columnName, value string) {
+			if columnName == "id" || value == "null" {
+				return
+			}
+			// the schema records times without their location
+			typeName, _ := splitType(value)
+			if typeName == "empty" {
+				typeName = "string"
+			}
+			key := schemaKey{
+				domainName: domainName,
+				columnName: columnName,
+				typeName:   typeName,
+			}
+			if !sr.recorded[key] && !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		})
+	}
+	// packed types are unordered
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].columnName != keys[j].columnName {
+			return keys[i].columnName < keys[j].columnName
+		}
+		return keys[i].typeName < keys[j].typeName
+	})
+	return keys
+}
+
+func (sr *schemaRecorder) setRecorded(keys []schemaKey) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	for _, key := range keys {
+		sr.recorded[key] = true
+	}
+}
+
+func (sr *schemaRecorder) forgetDomain(domainName string) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	for key := range sr.recorded {
+		if key.domainName == domainName {
+			delete(sr.recorded, key)
+		}
+	}
+}
+
+// recordSchema records the types of the columns written by a put request
+// in the domain's schema item. It does nothing unless the Connector has
+// RecordSchema set.
+func (c *conn) recordSchema(ctx context.Context, domainName *string, attrs []*simpledb.ReplaceableAttribute) error {
+	if c.schemas == nil {
+		return nil
+	}
+	keys := c.schemas.unrecorded(derefString(domainName), c.meta, attrs)
+	if len(keys) == 0 {
+		return nil
+	}
+	input := &simpledb.PutAttributesInput{
+		DomainName: domainName,
+		ItemName:   aws.String(SchemaItemName),
+	}
+	for _, key := range keys {
+		// not replaced, so the attribute accumulates a value for each type
+		input.Attributes = append(input.Attributes, &simpledb.ReplaceableAttribute{
+			Name:  aws.String(key.columnName),
+			Value: aws.String(key.typeName),
+		})
+	}
+	if _, err := c.SimpleDB.PutAttributesWithContext(ctx, input, requestOptions(ctx)...); err != nil {
+		return errors.Wrap(err, "cannot record schema").With(
+			"domain", derefString(domainName),
+		)
+	}
+	c.schemas.setRecorded(keys)
+	return nil
+}
+
+// TableSchema returns the columns of a table and the types that have been
+// written to each column, as recorded in the schema item of the domain.
+// Columns are only recorded by connectors that have RecordSchema set.
+func (c *Connector) TableSchema(ctx context.Context, tableName string) (map[string][]string, error) {
+	cn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	domainName, err := cn.resolveDomainName(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	output, err := cn.SimpleDB.GetAttributesWithContext(ctx, &simpledb.GetAttributesInput{
+		DomainName:     aws.String(domainName),
+		ItemName:       aws.String(SchemaItemName),
+		ConsistentRead: aws.Bool(true),
+	}, requestOptions(ctx)...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get schema").With(
+			"table", tableName,
+			"domain", domainName,
+		)
+	}
+	schema := make(map[string][]string)
+	for _, attr := range output.Attributes {
+		name := derefString(attr.Name)
+		schema[name] = append(schema[name], derefString(attr.Value))
+	}
+	for _, typeNames := range schema {
+		sort.Strings(typeNames)
+	}
+	return schema, nil
+}
+
+// SchemaDrift describes the differences between the expected columns
+// of a table and the columns recorded in its schema item.
+type SchemaDrift struct {
+	// NewColumns are columns that have been written to the table,
+	// but are not expected. They are in sorted order.
+	NewColumns []string
+
+	// TypeConflicts are columns that have been written with a type other
+	// than the expected type, or with more than one type if the column is
+	// not expected. They are in order of column name.
+	TypeConflicts []TypeConflict
+}
+
+// TypeConflict describes a column whose values have inconsistent types.
+type TypeConflict struct {
+	Column   string
+	Expected string   // blank if the column is not expected
+	Recorded []string // types written to the column
+}
+
+// HasDrift returns true if there are any differences.
+func (d *SchemaDrift) HasDrift() bool {
+	return len(d.NewColumns) > 0 || len(d.TypeConflicts) > 0
+}
+
+// VerifySchema compares the columns recorded in the schema item of a table
+// with the expected columns, which map column names to type names, such as
+// "string" or "int64". Expected columns that have never been written are not
+// considered drift, as SimpleDB does not store null values.
+func (c *Connector) VerifySchema(ctx context.Context, tableName string, expected map[string]string) (*SchemaDrift, error) {
+	schema, err := c.TableSchema(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]string, 0, len(schema))
+	for column := range schema {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	drift := &SchemaDrift{}
+	for _, column := range columns {
+		recorded := schema[column]
+		expectedType, ok := expected[column]
+		if !ok {
+			drift.NewColumns = append(drift.NewColumns, column)
+		}
+		if (ok && (len(recorded) != 1 || recorded[0] != expectedType)) || len(recorded) > 1 {
+			drift.TypeConflicts = append(drift.TypeConflicts, TypeConflict{
+				Column:   column,
+				Expected: expectedType,
+				Recorded: recorded,
+			})
+		}
+	}
+	return drift, nil
+}
@@ -0,0 +1,183 @@
+package simpledbsql
+
+import (
+	"database/sql/driver"
+	"strings"
+	"unicode"
+
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/lex"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// wordsPrefix follows the metadata prefix in the names of the attributes
+// that hold the words of search columns.
+const wordsPrefix = "words:"
+
+// maxSearchWords is the maximum number of different words in the value
+// of a search column. Each word is a value of the words attribute, and
+// SimpleDB limits an item to 256 attribute values.
+const maxSearchWords = 100
+
+// searchWords returns the different words in s, folded so that words are
+// matched ignoring case. A word is a sequence of letters and digits.
+func searchWords(s string) []string {
+	var words []string
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(foldCase(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// columnWords returns the words to record for a value of a search column,
+// which has none unless it is a string.
+func columnWords(typeName string, value string) ([]string, error) {
+	if typeName != "string" {
+		return nil, nil
+	}
+	words := searchWords(value)
+	if len(words) > maxSearchWords {
+		return nil, errors.New("too many words for search column").With(
+			"words", len(words),
+		)
+	}
+	return words, nil
+}
+
+// isSearched returns true if the words of a column are recorded.
+func (m metadata) isSearched(columnName string) bool {
+	return m.searched[columnName]
+}
+
+// wordsAttr returns the name of the attribute containing the words
+// of a search column.
+func (m metadata) wordsAttr(columnName string) string {
+	return m.namePrefix() + wordsPrefix + columnName
+}
+
+// isWordsAttr returns true if the named attribute contains the words
+// of a search column, rather than a column type.
+func (m metadata) isWordsAttr(name string) bool {
+	return len(m.searched) > 0 && strings.HasPrefix(name, m.namePrefix()+wordsPrefix)
+}
+
+// translateMatches returns the lexemes of a where clause with its match
+// predicates translated to compare the words attribute of a search column
+// with each word of the value to match:
+//
+//	match(body, ?)  =>  (`sql:words:body` = 'quick' intersection `sql:words:body` = 'fox')
+//
+// The value is substituted in the translated predicate, so the arg of a
+// "?" placeholder is removed from the args returned.
+func (m metadata) translateMatches(whereClause []string, args []driver.Value) ([]string, []driver.Value, error) {
+	var (
+		translated []string
+		remaining  []driver.Value // args that are not substituted
+		matched    bool
+		argIndex   int // index of the next "?" placeholder
+	)
+	for i := 0; i < len(whereClause); i++ {
+		lexeme := whereClause[i]
+		if lexeme == "?" {
+			if argIndex < len(args) {
+				remaining = append(remaining, args[argIndex])
+			}
+			argIndex++
+			translated = append(translated, lexeme)
+			continue
+		}
+		columnName, valueLexeme, end := matchPredicate(whereClause, i)
+		if end < 0 {
+			translated = append(translated, lexeme)
+			continue
+		}
+		if !m.isSearched(columnName) {
+			return nil, nil, errors.New("cannot match column that is not a search column").With(
+				"column", columnName,
+			)
+		}
+		var value driver.Value
+		switch {
+		case valueLexeme == "?":
+			if argIndex >= len(args) {
+				return nil, nil, errors.New("not enough args for select query")
+			}
+			value = args[argIndex]
+			argIndex++
+		case isStringLexeme(valueLexeme):
+			value = unquoteString(valueLexeme)
+		default:
+			ordinal, _ := parse.NumberedPlaceholder(valueLexeme)
+			if ordinal >= len(args) {
+				return nil, nil, errors.New("not enough args for select query")
+			}
+			value = args[ordinal]
+		}
+		s, ok := value.(string)
+		if !ok {
+			return nil, nil, errors.New("value to match must be a string").With(
+				"column", columnName,
+			)
+		}
+		words := searchWords(s)
+		if len(words) == 0 {
+			return nil, nil, errors.New("no words to match").With(
+				"column", columnName,
+			)
+		}
+		attr := quoteIdentifier(m.wordsAttr(columnName))
+		translated = append(translated, "(")
+		for j, word := range words {
+			if j > 0 {
+				translated = append(translated, " ", "intersection", " ")
+			}
+			translated = append(translated, attr, " ", "=", " ", quoteString(word))
+		}
+		translated = append(translated, ")")
+		matched = true
+		i = end
+	}
+	if !matched {
+		return whereClause, args, nil
+	}
+	if argIndex < len(args) {
+		// args of numbered placeholders, or extra args
+		remaining = append(remaining, args[argIndex:]...)
+	}
+	return translated, remaining, nil
+}
+
+// matchPredicate reports whether the lexemes at index i of a where clause
+// are a match predicate, "match(column, value)", whose value is a string
+// literal or a placeholder. It returns the column name, the value lexeme,
+// and the index of the closing parenthesis, which is -1 if there is no match.
+func matchPredicate(whereClause []string, i int) (columnName string, value string, end int) {
+	if !strings.EqualFold(whereClause[i], "match") {
+		return "", "", -1
+	}
+	var lexemes []string // lexemes that are not white space
+	end = i
+	for len(lexemes) < 5 {
+		if end = adjacentIndex(whereClause, end, 1); end < 0 {
+			return "", "", -1
+		}
+		lexemes = append(lexemes, whereClause[end])
+	}
+	if lexemes[0] != "(" || !isIdentLexeme(lexemes[1]) || lexemes[2] != "," ||
+		!isFoldableLexeme(lexemes[3]) || lexemes[4] != ")" {
+		return "", "", -1
+	}
+	return lex.Unquote(lexemes[1]), lexemes[3], end
+}
+
+// unquoteString returns the value of a quoted string literal.
+func unquoteString(lexeme string) string {
+	quote := lexeme[:1]
+	return strings.Replace(lexeme[1:len(lexeme)-1], quote+quote, quote, -1)
+}
@@ -0,0 +1,182 @@
+package simpledbsql
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+)
+
+// spool holds the items of a select statement whose pages are fetched in the
+// background, so that fetching is not slowed by a slow reader of the rows.
+// Up to threshold items are held in memory. Once that many items are waiting
+// to be read, subsequent items are written to a temporary file, and are read
+// from the file after the items in memory.
+type spool struct {
+	threshold int
+	dir       string
+	cancel    context.CancelFunc
+	finished  chan struct{} // closed when fetching finishes
+
+	mutex       sync.Mutex
+	cond        *sync.Cond
+	items       []*simpledb.Item // in memory, read before the items in the file
+	file        *os.File
+	writeOffset int64 // end of the items written to the file
+	readOffset  int64 // start of the next item to read from the file
+	spooled     int   // number of items in the file that have not been read
+	done        bool  // all items have been fetched
+	err         error // error fetching items
+}
+
+// startSpool starts fetching the remaining pages of rows in the background.
+// The items of the page already selected are the first items of the spool.
+func startSpool(rows *selectQueryRows, threshold int, dir string) *spool {
+	ctx, cancel := context.WithCancel(rows.ctx)
+	sp := &spool{
+		threshold: threshold,
+		dir:       dir,
+		cancel:    cancel,
+		finished:  make(chan struct{}),
+		items:     rows.items,
+	}
+	sp.cond = sync.NewCond(&sp.mutex)
+	rows.items = nil
+	go sp.fetch(ctx, rows)
+	return sp
+}
+
+// fetch selects the pages of rows until there are no more pages, or until
+// the spool is closed.
+func (sp *spool) fetch(ctx context.Context, rows *selectQueryRows) {
+	defer close(sp.finished)
+	err := func() error {
+		for rows.input.NextToken != nil {
+			if err := rows.guard.page(); err != nil {
+				return err
+			}
+			output, err := rows.simpledb.SelectWithContext(ctx, rows.input, requestOptions(ctx)...)
+			if err != nil {
+				return err
+			}
+			rows.input.NextToken = output.NextToken
+			for _, item := range output.Items {
+				if err := sp.put(item); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}()
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.done = true
+	sp.err = err
+	sp.cond.Broadcast()
+}
+
+// put adds an item to the spool. Only fetch writes to the file, so the
+// file is written without holding the mutex.
+func (sp *spool) put(item *simpledb.Item) error {
+	sp.mutex.Lock()
+	if sp.file == nil && len(sp.items) < sp.threshold {
+		sp.items = append(sp.items, item)
+		sp.cond.Broadcast()
+		sp.mutex.Unlock()
+		return nil
+	}
+	sp.mutex.Unlock()
+
+	if sp.file == nil {
+		file, err := ioutil.TempFile(sp.dir, "simpledbsql-spool-")
+		if err != nil {
+			return errors.Wrap(err, "cannot create spool file")
+		}
+		sp.mutex.Lock()
+		sp.file = file
+		sp.mutex.Unlock()
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	if _, err := sp.file.WriteAt(frame, sp.writeOffset); err != nil {
+		return errors.Wrap(err, "cannot write spool file")
+	}
+
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.writeOffset += int64(len(frame))
+	sp.spooled++
+	sp.cond.Broadcast()
+	return nil
+}
+
+// next returns the next item, waiting until it has been fetched. It returns
+// io.EOF when all items have been read.
+func (sp *spool) next() (*simpledb.Item, error) {
+	sp.mutex.Lock()
+	for len(sp.items) == 0 && sp.spooled == 0 && !sp.done {
+		sp.cond.Wait()
+	}
+	if len(sp.items) > 0 {
+		item := sp.items[0]
+		sp.items = sp.items[1:]
+		sp.mutex.Unlock()
+		return item, nil
+	}
+	if sp.spooled == 0 {
+		defer sp.mutex.Unlock()
+		if sp.err != nil {
+			return nil, sp.err
+		}
+		return nil, io.EOF
+	}
+	file, offset := sp.file, sp.readOffset
+	sp.mutex.Unlock()
+
+	var size [4]byte
+	if _, err := file.ReadAt(size[:], offset); err != nil {
+		return nil, errors.Wrap(err, "cannot read spool file")
+	}
+	data := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := file.ReadAt(data, offset+4); err != nil {
+		return nil, errors.Wrap(err, "cannot read spool file")
+	}
+	var item simpledb.Item
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, errors.Wrap(err, "cannot read spool file")
+	}
+
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.readOffset = offset + 4 + int64(len(data))
+	sp.spooled--
+	return &item, nil
+}
+
+// close stops fetching and removes the spool file.
+func (sp *spool) close() error {
+	sp.cancel()
+	<-sp.finished
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.items = nil
+	if sp.file == nil {
+		return nil
+	}
+	file := sp.file
+	sp.file = nil
+	sp.spooled = 0
+	file.Close()
+	return os.Remove(file.Name())
+}
@@ -0,0 +1,202 @@
+package simpledbsql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/aws/aws-sdk-go/service/simpledb/simpledbiface"
+)
+
+// QueryStats accumulates statistics about the SimpleDB API calls made while
+// executing statements, which is useful for profiling slow queries.
+//
+// Attach a QueryStats to a context using WithQueryStats, and pass that
+// context to the QueryContext or ExecContext methods of sql.DB. The
+// statistics for a query are complete once its rows have been closed.
+// A QueryStats is safe for concurrent use.
+type QueryStats struct {
+	mutex    sync.Mutex
+	pages    int
+	items    int
+	apiCalls int
+	hours    float64
+	elapsed  time.Duration
+	deadline int
+}
+
+// Pages returns the number of pages of results returned by Select API calls.
+func (s *QueryStats) Pages() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.pages
+}
+
+// Items returns the number of items returned by SimpleDB, including
+// items that were not returned as rows, such as expired items.
+func (s *QueryStats) Items() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.items
+}
+
+// APICalls returns the number of SimpleDB API calls made.
+func (s *QueryStats) APICalls() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.apiCalls
+}
+
+// BoxUsage returns the total machine hours reported by SimpleDB. See BoxUsage.
+func (s *QueryStats) BoxUsage() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hours
+}
+
+// Elapsed returns the total time spent in SimpleDB API calls, including
+// time spent waiting for the Connector's rate limit. API calls made
+// concurrently are counted separately.
+func (s *QueryStats) Elapsed() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.elapsed
+}
+
+// DeadlinesExceeded returns the number of select statements whose context
+// deadline was exceeded while their rows were being selected.
+func (s *QueryStats) DeadlinesExceeded() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.deadline
+}
+
+// Reset sets the accumulated statistics back to zero.
+func (s *QueryStats) Reset() {
+	s.mutex.Lock()
+	s.pages = 0
+	s.items = 0
+	s.apiCalls = 0
+	s.hours = 0
+	s.elapsed = 0
+	s.deadline = 0
+	s.mutex.Unlock()
+}
+
+func (s *QueryStats) addCall(elapsed time.Duration, pages int, items int) {
+	s.mutex.Lock()
+	s.apiCalls++
+	s.elapsed += elapsed
+	s.pages += pages
+	s.items += items
+	s.mutex.Unlock()
+}
+
+func (s *QueryStats) addDeadlineExceeded() {
+	s.mutex.Lock()
+	s.deadline++
+	s.mutex.Unlock()
+}
+
+func (s *QueryStats) addBoxUsage(hours float64) {
+	s.mutex.Lock()
+	s.hours += hours
+	s.mutex.Unlock()
+}
+
+type queryStatsKeyT struct{}
+
+var queryStatsKey = queryStatsKeyT{}
+
+// WithQueryStats returns a copy of ctx that accumulates statistics
+// for all statements executed using the returned context into s.
+func WithQueryStats(ctx context.Context, s *QueryStats) context.Context {
+	return context.WithValue(ctx, queryStatsKey, s)
+}
+
+// queryStatsFromContext returns the QueryStats attached to ctx, or nil.
+func queryStatsFromContext(ctx context.Context) *QueryStats {
+	s, _ := ctx.Value(queryStatsKey).(*QueryStats)
+	return s
+}
+
+var _ simpledbiface.SimpleDBAPI = (*statsAPI)(nil)
+
+// statsAPI records each SimpleDB request in the QueryStats of its context.
+type statsAPI struct {
+	simpledbiface.SimpleDBAPI
+}
+
+// record adds a completed API call to the QueryStats of ctx, if any.
+func (api *statsAPI) record(ctx aws.Context, start time.Time, pages int, items int) {
+	if s := queryStatsFromContext(ctx); s != nil {
+		s.addCall(time.Since(start), pages, items)
+	}
+}
+
+func (api *statsAPI) SelectWithContext(ctx aws.Context, input *simpledb.SelectInput, opts ...request.Option) (*simpledb.SelectOutput, error) {
+	start := time.Now()
+	output, err := api.SimpleDBAPI.SelectWithContext(ctx, input, opts...)
+	var items int
+	if output != nil {
+		items = len(output.Items)
+	}
+	api.record(ctx, start, 1, items)
+	return output, err
+}
+
+func (api *statsAPI) GetAttributesWithContext(ctx aws.Context, input *simpledb.GetAttributesInput, opts ...request.Option) (*simpledb.GetAttributesOutput, error) {
+	start := time.Now()
+	output, err := api.SimpleDBAPI.GetAttributesWithContext(ctx, input, opts...)
+	var items int
+	if output != nil && len(output.Attributes) > 0 {
+		items = 1
+	}
+	api.record(ctx, start, 0, items)
+	return output, err
+}
+
+func (api *statsAPI) PutAttributesWithContext(ctx aws.Context, input *simpledb.PutAttributesInput, opts ...request.Option) (*simpledb.PutAttributesOutput, error) {
+	start := time.Now()
+	output, err := api.SimpleDBAPI.PutAttributesWithContext(ctx, input, opts...)
+	api.record(ctx, start, 0, 0)
+	return output, err
+}
+
+func (api *statsAPI) DeleteAttributesWithContext(ctx aws.Context, input *simpledb.DeleteAttributesInput, opts ...request.Option) (*simpledb.DeleteAttributesOutput, error) {
+	start := time.Now()
+	output, err := api.SimpleDBAPI.DeleteAttributesWithContext(ctx, input, opts...)
+	api.record(ctx, start, 0, 0)
+	return output, err
+}
+
+func (api *statsAPI) BatchPutAttributesWithContext(ctx aws.Context, input *simpledb.BatchPutAttributesInput, opts ...request.Option) (*simpledb.BatchPutAttributesOutput, error) {
+	start := time.Now()
+	output, err := api.SimpleDBAPI.BatchPutAttributesWithContext(ctx, input, opts...)
+	api.record(ctx, start, 0, 0)
+	return output, err
+}
+
+func (api *statsAPI) BatchDeleteAttributesWithContext(ctx aws.Context, input *simpledb.BatchDeleteAttributesInput, opts ...request.Option) (*simpledb.BatchDeleteAttributesOutput, error) {
+	start := time.Now()
+	output, err := api.SimpleDBAPI.BatchDeleteAttributesWithContext(ctx, input, opts...)
+	api.record(ctx, start, 0, 0)
+	return output, err
+}
+
+func (api *statsAPI) CreateDomainWithContext(ctx aws.Context, input *simpledb.CreateDomainInput, opts ...request.Option) (*simpledb.CreateDomainOutput, error) {
+	start := time.Now()
+	output, err := api.SimpleDBAPI.CreateDomainWithContext(ctx, input, opts...)
+	api.record(ctx, start, 0, 0)
+	return output, err
+}
+
+func (api *statsAPI) DeleteDomainWithContext(ctx aws.Context, input *simpledb.DeleteDomainInput, opts ...request.Option) (*simpledb.DeleteDomainOutput, error) {
+	start := time.Now()
+	output, err := api.SimpleDBAPI.DeleteDomainWithContext(ctx, input, opts...)
+	api.record(ctx, start, 0, 0)
+	return output, err
+}
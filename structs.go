@@ -0,0 +1,145 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+
+	"github.com/jjeffery/errors"
+)
+
+// InsertRow inserts a row into a table, with a column for each field of the
+// struct that row points to. Each field is written to the column named by its
+// "sql" struct tag, or if it has no tag, to the column named by its lowercased
+// field name. Fields tagged `sql:"-"`, unexported fields and embedded fields
+// are ignored. Fields that are nil pointers are inserted as null.
+//
+//	type User struct {
+//		ID   string `sql:"id"`
+//		Name string `sql:"name"`
+//		Age  *int64 `sql:"age"` // null if nil
+//	}
+//
+//	_, err := simpledbsql.InsertRow(ctx, db, "users", &User{ID: "U1", Name: "alice"})
+//
+// The field for the "id" column can be blank if the Connector has an
+// IDGenerator, in which case the id column is omitted.
+func InsertRow(ctx context.Context, db *sql.DB, table string, row interface{}) (sql.Result, error) {
+	id, columns, args, err := rowColumns(row)
+	if err != nil {
+		return nil, err
+	}
+	if id != "" {
+		columns = append([]string{"id"}, columns...)
+		args = append([]interface{}{id}, args...)
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("no columns to insert").With("type", reflect.TypeOf(row).String())
+	}
+	placeholders := make([]string, len(columns))
+	for i, column := range columns {
+		columns[i] = quoteIdentifier(column)
+		placeholders[i] = "?"
+	}
+	query := "insert into " + quoteIdentifier(table) +
+		"(" + strings.Join(columns, ", ") + ")" +
+		" values (" + strings.Join(placeholders, ", ") + ")"
+	return db.ExecContext(ctx, query, args...)
+}
+
+// UpdateRow updates the row of a table whose id is the value of the field for
+// the "id" column of the struct that row points to. Every other column that
+// has a field is set to its value, and fields that are nil pointers set their
+// columns to null. Fields are matched with columns as for InsertRow.
+func UpdateRow(ctx context.Context, db *sql.DB, table string, row interface{}) (sql.Result, error) {
+	id, columns, args, err := rowColumns(row)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, errors.New("missing id for update").With("type", reflect.TypeOf(row).String())
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("no columns to update").With("type", reflect.TypeOf(row).String())
+	}
+	for i, column := range columns {
+		columns[i] = quoteIdentifier(column) + " = ?"
+	}
+	query := "update " + quoteIdentifier(table) +
+		" set " + strings.Join(columns, ", ") +
+		" where id = ?"
+	return db.ExecContext(ctx, query, append(args, id)...)
+}
+
+// rowColumns returns the value of the id field of a struct, and the
+// names and values of its other columns.
+func rowColumns(row interface{}) (id string, columns []string, args []interface{}, err error) {
+	v := reflect.ValueOf(row)
+	if !v.IsValid() {
+		return "", nil, nil, errors.New("expect pointer to struct, got nil")
+	}
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return "", nil, nil, errors.New("expect pointer to struct").With("type", reflect.TypeOf(row).String())
+	}
+	var hasID bool
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" || f.Anonymous {
+			// unexported or embedded
+			continue
+		}
+		column := f.Tag.Get("sql")
+		switch column {
+		case "-":
+			continue
+		case "":
+			column = strings.ToLower(f.Name)
+		}
+		if strings.EqualFold(column, "id") {
+			s, ok := v.Field(i).Interface().(string)
+			if !ok {
+				return "", nil, nil, errors.New("id field must be a string").With(
+					"type", typ.String(),
+					"field", f.Name,
+				)
+			}
+			id, hasID = s, true
+			continue
+		}
+		value, err := structFieldValue(v.Field(i))
+		if err != nil {
+			return "", nil, nil, errors.Wrap(err, "cannot get field value").With(
+				"type", typ.String(),
+				"field", f.Name,
+			)
+		}
+		columns = append(columns, column)
+		args = append(args, value)
+	}
+	if !hasID {
+		return "", nil, nil, errors.New("missing field for id column").With("type", typ.String())
+	}
+	return id, columns, args, nil
+}
+
+// structFieldValue returns the value of a struct field as an argument,
+// which is nil for a nil pointer. Pointers to values such as Decimal are
+// dereferenced, so that the value is converted by its own type.
+func structFieldValue(f reflect.Value) (interface{}, error) {
+	if f.Kind() == reflect.Ptr && f.IsNil() {
+		return nil, nil
+	}
+	if valuer, ok := f.Interface().(driver.Valuer); ok {
+		return valuer.Value()
+	}
+	if f.Kind() == reflect.Ptr {
+		return structFieldValue(f.Elem())
+	}
+	return f.Interface(), nil
+}
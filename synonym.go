@@ -0,0 +1,24 @@
+package simpledbsql
+
+import "context"
+
+// SynonymResolver resolves table names to SimpleDB domain names at run time.
+// It is useful in an environment where SimpleDB domains are created by
+// CloudFormation and have randomly generated names that are not known
+// until deployment. See the resolver subpackage for implementations that
+// look up domain names in CloudFormation stack outputs and SSM parameters.
+type SynonymResolver interface {
+	// Resolve returns the domain name for a table name. If the resolver has
+	// no domain name for the table, it should return a blank string and a nil
+	// error, in which case the Synonyms and Schema of the Connector apply.
+	Resolve(ctx context.Context, tableName string) (domainName string, err error)
+}
+
+// SynonymResolverFunc is an adapter to allow the use of an ordinary
+// function as a SynonymResolver.
+type SynonymResolverFunc func(ctx context.Context, tableName string) (string, error)
+
+// Resolve implements the SynonymResolver interface by calling f(ctx, tableName).
+func (f SynonymResolverFunc) Resolve(ctx context.Context, tableName string) (string, error) {
+	return f(ctx, tableName)
+}
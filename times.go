@@ -0,0 +1,46 @@
+package simpledbsql
+
+import (
+	"time"
+)
+
+// timeFormat is the format of time values. Fractional seconds always have
+// nine digits, so that values with the same UTC offset sort in time order.
+const timeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// encodeTime returns the type name and the attribute value for a time. The
+// name of the time's location is appended to the type name, so that the
+// location can be restored when the value is decoded. The location is
+// omitted for UTC and for locations without a name.
+func encodeTime(t time.Time) (typeName string, value string) {
+	typeName = "time"
+	if zone := t.Location().String(); zone != "" && zone != "UTC" {
+		typeName += ":" + zone
+	}
+	return typeName, t.Format(timeFormat)
+}
+
+// encodeLegacyTime returns the type name and the attribute value for a time
+// in the format used by earlier versions of the driver, which have second
+// precision and do not record the time's location.
+func encodeLegacyTime(t time.Time) (typeName string, value string) {
+	return "time", t.Format(time.RFC3339)
+}
+
+// decodeTime parses a time value written by encodeTime or encodeLegacyTime.
+// If zone is not blank, the time is returned in the named location.
+func decodeTime(value string, zone string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil || zone == "" {
+		return t, err
+	}
+	_, offset := t.Zone()
+	if loc, err := time.LoadLocation(zone); err == nil {
+		if _, locOffset := t.In(loc).Zone(); locOffset == offset {
+			return t.In(loc), nil
+		}
+	}
+	// the location is not known on this system, or its rules differ
+	// from those of the system that wrote the value
+	return t.In(time.FixedZone(zone, offset)), nil
+}
@@ -0,0 +1,153 @@
+package simpledbsql
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+)
+
+// ttlFilter identifies items whose time to live has passed.
+// The zero value does not filter any items.
+type ttlFilter struct {
+	column string
+	now    time.Time
+	meta   metadata
+}
+
+// newTTLFilter returns a filter for items that have expired
+// at the current time.
+func (c *conn) newTTLFilter() ttlFilter {
+	if c.ttlColumn == "" {
+		return ttlFilter{}
+	}
+	return ttlFilter{column: c.ttlColumn, now: time.Now(), meta: c.meta}
+}
+
+// expired returns true if the item's TTL column holds a time that
+// is not after the filter's current time.
+func (f ttlFilter) expired(item *simpledb.Item) bool {
+	if f.column == "" {
+		return false
+	}
+	var value string
+	for _, attr := range item.Attributes {
+		if derefString(attr.Name) == f.column {
+			value = derefString(attr.Value)
+		}
+	}
+	colType := f.meta.columnTypes(item.Attributes)[f.column]
+	expiresAt, ok := parseExpiry(colType, value)
+	return ok && !expiresAt.After(f.now)
+}
+
+// parseExpiry parses the value of a TTL column, which is either
+// a time or an int64 containing seconds since the Unix epoch.
+func parseExpiry(colType, value string) (time.Time, bool) {
+	colType, zone := splitType(colType)
+	switch colType {
+	case "time":
+		t, err := decodeTime(value, zone)
+		return t, err == nil
+	case "int64":
+		n, err := strconv.ParseInt(value, 10, 64)
+		return time.Unix(n, 0), err == nil
+	}
+	return time.Time{}, false
+}
+
+// appendTTLColumn appends the names of the attributes of the TTL column
+// to names, unless the TTL column is already present in columnNames.
+func (c *conn) appendTTLColumn(names []string, columnNames []string) []string {
+	if c.ttlColumn == "" {
+		return names
+	}
+	for _, columnName := range columnNames {
+		if columnName == c.ttlColumn {
+			return names
+		}
+	}
+	return append(names, c.meta.attributeNames([]string{c.ttlColumn})...)
+}
+
+// Vacuum deletes the items in a table whose TTL column shows that they have
+// expired, and returns the number of items deleted. Items are deleted in
+// batches using the SimpleDB BatchDeleteAttributes API. It is an error to
+// call Vacuum if the Connector does not have a TTLColumn.
+//
+// Vacuum does not call the AfterDelete hook, and the deletions are not
+// recorded in the AuditTable.
+func (c *Connector) Vacuum(ctx context.Context, tableName string) (int, error) {
+	if c.TTLColumn == "" {
+		return 0, errors.New("TTLColumn is required for Vacuum")
+	}
+	cn, err := c.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	domainName, err := cn.resolveDomainName(ctx, tableName)
+	if err != nil {
+		return 0, err
+	}
+	var attributeNames []string
+	for _, attributeName := range cn.appendTTLColumn(nil, nil) {
+		attributeNames = append(attributeNames, quoteIdentifier(attributeName))
+	}
+	if cn.meta.packed {
+		attributeNames = append(attributeNames, quoteIdentifier(cn.meta.packedAttr()))
+	}
+	selectExpression := strings.Join([]string{
+		"select", strings.Join(attributeNames, ", "),
+		"from", quoteIdentifier(domainName),
+		"where", quoteIdentifier(c.TTLColumn), "is not null",
+	}, " ")
+	input := &simpledb.SelectInput{
+		ConsistentRead:   aws.Bool(true),
+		SelectExpression: aws.String(selectExpression),
+	}
+	filter := cn.newTTLFilter()
+
+	var count int
+	err = cn.selectPages(ctx, input, func(items []*simpledb.Item) error {
+		var expired []*simpledb.DeletableItem
+		for _, item := range items {
+			if filter.expired(item) {
+				expired = append(expired, &simpledb.DeletableItem{Name: item.Name})
+			}
+		}
+		for len(expired) > 0 {
+			n := len(expired)
+			if n > maxBatchItems {
+				n = maxBatchItems
+			}
+			batch := &simpledb.BatchDeleteAttributesInput{
+				DomainName: aws.String(domainName),
+				Items:      expired[:n],
+			}
+			if _, err := cn.SimpleDB.BatchDeleteAttributesWithContext(ctx, batch, requestOptions(ctx)...); err != nil {
+				return err
+			}
+			var names []*string
+			for _, item := range batch.Items {
+				cn.invalidateItem(batch.DomainName, item.Name)
+				names = append(names, item.Name)
+			}
+			cn.invalidateItems(ctx, tableName, batch.DomainName, names, "delete")
+			count += n
+			expired = expired[n:]
+		}
+		return nil
+	})
+	if err != nil {
+		return count, errors.Wrap(err, "cannot vacuum table").With(
+			"table", tableName,
+			"domain", domainName,
+			"count", count,
+		)
+	}
+	return count, nil
+}
@@ -0,0 +1,190 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// txnColumn is the name of the pending update marker attribute without the
+// metadata prefix. It cannot be the name of a column with type attributes.
+const txnColumn = "txn"
+
+// txnAttr returns the name of the attribute that marks an item whose update
+// has put its attributes, but has not yet deleted its deleted attributes.
+func (m metadata) txnAttr() string {
+	return m.namePrefix() + txnColumn
+}
+
+// pendingMarker returns the marker attribute put by the first phase of a
+// two-phase update. Its value records the names of the attributes that
+// are deleted by the second phase.
+func (m metadata) pendingMarker(attrs []*simpledb.DeletableAttribute) (*simpledb.ReplaceableAttribute, error) {
+	values := make(url.Values)
+	for _, attr := range attrs {
+		values.Add("delete", derefString(attr.Name))
+	}
+	value := values.Encode()
+	if len(value) > maxAttributeValueLength {
+		return nil, errors.New("too many deleted columns for two-phase update").With(
+			"length", len(value),
+		)
+	}
+	return &simpledb.ReplaceableAttribute{
+		Name:    aws.String(m.txnAttr()),
+		Value:   aws.String(value),
+		Replace: aws.Bool(true),
+	}, nil
+}
+
+// pendingDeletes returns the value of an item's marker, and the names of the
+// attributes that its pending update deletes. It returns a blank marker if
+// the item has no pending update.
+func (m metadata) pendingDeletes(attrs []*simpledb.Attribute) (marker string, names []string) {
+	if !m.txn {
+		return "", nil
+	}
+	for _, attr := range attrs {
+		if derefString(attr.Name) != m.txnAttr() {
+			continue
+		}
+		marker = derefString(attr.Value)
+		values, _ := url.ParseQuery(marker)
+		return marker, values["delete"]
+	}
+	return "", nil
+}
+
+// completeItem returns the item as it is once its pending update, if any,
+// completes, which is without the marker or the attributes it deletes.
+func (m metadata) completeItem(item *simpledb.Item) *simpledb.Item {
+	marker, names := m.pendingDeletes(item.Attributes)
+	if marker == "" {
+		return item
+	}
+	deleted := map[string]bool{m.txnAttr(): true}
+	for _, name := range names {
+		deleted[name] = true
+	}
+	completed := &simpledb.Item{Name: item.Name}
+	for _, attr := range item.Attributes {
+		if !deleted[derefString(attr.Name)] {
+			completed.Attributes = append(completed.Attributes, attr)
+		}
+	}
+	return completed
+}
+
+// updateTwoPhaseRow updates an item using a put request followed by a delete
+// request. The put request includes the marker, which records the attributes
+// to delete, and the delete request deletes them together with the marker.
+// Because each request is atomic, an item has the marker if, and only if,
+// its update has not completed.
+func (c *conn) updateTwoPhaseRow(ctx context.Context, q *parse.UpdateQuery, args []driver.Value, putInput *simpledb.PutAttributesInput, deleteInput *simpledb.DeleteAttributesInput, old map[string]interface{}) (*resultT, error) {
+	marker, err := c.meta.pendingMarker(deleteInput.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	putInput.Attributes = append(putInput.Attributes, marker)
+	_, err = c.SimpleDB.PutAttributesWithContext(ctx, putInput, requestOptions(ctx)...)
+	c.invalidateItem(putInput.DomainName, putInput.ItemName)
+	if err != nil {
+		if hasCode(err, attributeDoesNotExist) || (q.If != nil && hasCode(err, conditionalCheckFailed)) {
+			// not an error, it just means the item does not exist,
+			// or does not have the value of the if clause
+			return newResult(0), nil
+		}
+		return nil, errors.Wrap(err, "cannot put attributes").With(
+			"itemName", c.redact(derefString(putInput.ItemName)),
+		)
+	}
+	if err := c.recordSchema(ctx, putInput.DomainName, putInput.Attributes); err != nil {
+		return nil, err
+	}
+	if err := c.deletePending(ctx, deleteInput, marker); err != nil {
+		return nil, err
+	}
+	c.afterUpdate(ctx, q, putInput.DomainName, putInput.ItemName, args, old)
+	return newResult(1), nil
+}
+
+// deletePending sends the delete request of a two-phase update, which also
+// deletes the marker put by the first phase. The request has a condition that
+// the marker is unchanged. If another update has replaced the marker in the
+// meantime, the attributes are deleted without the marker, which is deleted
+// by the other update. If the marker has already been deleted, the update
+// was completed by a read that repaired the item.
+func (c *conn) deletePending(ctx context.Context, deleteInput *simpledb.DeleteAttributesInput, marker *simpledb.ReplaceableAttribute) error {
+	input := *deleteInput
+	input.Attributes = append(input.Attributes[:len(input.Attributes):len(input.Attributes)], &simpledb.DeletableAttribute{
+		Name: marker.Name,
+	})
+	input.Expected = &simpledb.UpdateCondition{
+		Name:  marker.Name,
+		Value: marker.Value,
+	}
+	_, err := c.SimpleDB.DeleteAttributesWithContext(ctx, &input, requestOptions(ctx)...)
+	if hasCode(err, conditionalCheckFailed) {
+		input = *deleteInput
+		input.Expected = nil
+		_, err = c.SimpleDB.DeleteAttributesWithContext(ctx, &input, requestOptions(ctx)...)
+	} else if hasCode(err, attributeDoesNotExist) {
+		err = nil
+	}
+	c.invalidateItem(deleteInput.DomainName, deleteInput.ItemName)
+	if err != nil {
+		return errors.Wrap(err, "cannot delete attributes").With(
+			"itemName", c.redact(derefString(deleteInput.ItemName)),
+		)
+	}
+	return nil
+}
+
+// newRepairer returns a function that repairs the items of a table read by a
+// select statement, or nil if the Connector does not repair pending updates.
+func (c *conn) newRepairer(ctx context.Context, tableName string) (func(item *simpledb.Item), error) {
+	if !c.meta.txn || !c.repairPending {
+		return nil, nil
+	}
+	domainName, err := c.resolveDomainName(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	return func(item *simpledb.Item) {
+		c.repairItem(ctx, domainName, item)
+	}, nil
+}
+
+// repairItem completes the pending update of an item that has been read,
+// by deleting the attributes recorded in its marker together with the
+// marker. The request has a condition that the marker is unchanged. Errors
+// are ignored, because the item is read as it is once the update completes
+// regardless, and the next read of the item repairs it instead.
+func (c *conn) repairItem(ctx context.Context, domainName string, item *simpledb.Item) {
+	if !c.repairPending {
+		return
+	}
+	marker, names := c.meta.pendingDeletes(item.Attributes)
+	if marker == "" {
+		return
+	}
+	input := &simpledb.DeleteAttributesInput{
+		DomainName: aws.String(domainName),
+		ItemName:   item.Name,
+		Attributes: []*simpledb.DeletableAttribute{{Name: aws.String(c.meta.txnAttr())}},
+		Expected: &simpledb.UpdateCondition{
+			Name:  aws.String(c.meta.txnAttr()),
+			Value: aws.String(marker),
+		},
+	}
+	for _, name := range names {
+		input.Attributes = append(input.Attributes, &simpledb.DeletableAttribute{Name: aws.String(name)})
+	}
+	c.SimpleDB.DeleteAttributesWithContext(ctx, input, requestOptions(ctx)...)
+	c.invalidateItem(input.DomainName, input.ItemName)
+}
@@ -0,0 +1,415 @@
+package simpledbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/simpledb"
+	"github.com/jjeffery/errors"
+	"github.com/jjeffery/simpledbsql/internal/parse"
+)
+
+// defaultWriterConcurrency is the default number of BatchPutAttributes
+// requests that a TableWriter sends at the same time.
+const defaultWriterConcurrency = 4
+
+// TableWriter writes rows to a table, coalescing them into SimpleDB
+// BatchPutAttributes requests of up to 25 items, which are sent concurrently.
+// It is designed for ETL jobs that write many rows. Create a TableWriter
+// with NewTableWriter or Connector.NewTableWriter, and set its fields before
+// the first call to Add. Call Close when the TableWriter is no longer needed.
+//
+// Rows are written as they are by Load: existing items with the same id are
+// overwritten, but any attributes that are not in the row are left unchanged.
+// If rows with the same id are added more than once, they are written in the
+// order they were added. Rows are not written by statements, so the hooks of
+// the Connector are not called, other than ValidateWrite, and the rows are
+// not recorded in the AuditTable. The Connector's Invalidator is called once
+// for each batch that is written, with operation "insert", and can be called
+// concurrently by the requests in progress.
+//
+// Add, Flush and Close must not be called concurrently.
+type TableWriter struct {
+	// Concurrency is the maximum number of BatchPutAttributes requests
+	// sent at the same time. Add waits while this many requests are in
+	// progress. Defaults to 4. The requests of a TableWriter created by
+	// Connector.NewTableWriter are also limited by MaxConnectionRequests.
+	Concurrency int
+
+	// MaxRetries is the number of times a failed BatchPutAttributes
+	// request is retried. Defaults to 3. Set to a negative number
+	// to disable retries.
+	MaxRetries int
+
+	// OnError, if not nil, is called for each row that cannot be written,
+	// with the row's id. If a batch request fails, its rows are sent in
+	// separate requests, so that only the rows that cannot be written are
+	// reported. If OnError is nil, Flush returns an error for the rows.
+	// OnError can be called concurrently by the requests in progress.
+	OnError func(ctx context.Context, id string, err error)
+
+	tableName string
+
+	// withConn calls f with a connection to the database. It is
+	// set by the function that creates the TableWriter.
+	withConn func(ctx context.Context, f func(cn *conn) error) error
+
+	connector *Connector // set by Connector.NewTableWriter
+	cn        *conn      // connection opened by the connector
+
+	ctx        context.Context // context of the batch requests
+	cancel     context.CancelFunc
+	closed     bool
+	domainName string
+	redactor   Redactor
+	items      []*simpledb.ReplaceableItem
+	names      map[string]bool // item names in items
+	sem        chan struct{}
+	wg         sync.WaitGroup
+
+	mutex    sync.Mutex
+	inflight map[string]chan struct{} // item name -> done channel of the last batch sent with the item
+	count    int                      // rows written
+	failed   int                      // rows not written since the last Flush
+	err      error                    // first error since the last Flush
+}
+
+// NewTableWriter returns a TableWriter that writes rows to a table.
+// The TableWriter opens a connection when the first row is added,
+// which it uses until it is closed.
+func (c *Connector) NewTableWriter(tableName string) *TableWriter {
+	w := &TableWriter{
+		connector: c,
+		tableName: tableName,
+	}
+	w.withConn = w.withConnectorConn
+	return w
+}
+
+// withConnectorConn calls f with the connection opened by the
+// connector, opening it the first time it is called.
+func (w *TableWriter) withConnectorConn(ctx context.Context, f func(cn *conn) error) error {
+	if w.cn == nil {
+		cn, err := w.connector.connect(ctx)
+		if err != nil {
+			return err
+		}
+		w.cn = cn
+	}
+	return f(w.cn)
+}
+
+// errWriterClosed is returned when a TableWriter is used after it is closed.
+var errWriterClosed = errors.New("table writer is closed")
+
+// init resolves the table's domain name, the first time it is called.
+func (w *TableWriter) init(ctx context.Context) error {
+	if w.closed {
+		return errWriterClosed
+	}
+	if w.sem != nil {
+		return nil
+	}
+	err := w.withConn(ctx, func(cn *conn) error {
+		domainName, err := cn.resolveDomainName(ctx, w.tableName)
+		if err != nil {
+			return err
+		}
+		w.domainName = domainName
+		w.redactor = cn.redactor
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	concurrency := w.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultWriterConcurrency
+	}
+	// the batch requests are not cancelled by the contexts passed to Add
+	// and Flush, because the rows have already been accepted
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.names = make(map[string]bool)
+	w.inflight = make(map[string]chan struct{})
+	w.sem = make(chan struct{}, concurrency)
+	return nil
+}
+
+func (w *TableWriter) maxRetries() int {
+	opts := LoadOptions{MaxRetries: w.MaxRetries}
+	return opts.maxRetries()
+}
+
+// Add adds a row to be written, keyed by column name. The row must have an
+// "id" column, which is the item name. The row is sent in a batch request
+// when there are enough rows to fill the batch, or when Flush is called.
+// Add returns an error if the row is invalid, or if ctx is done while Add
+// waits for a request to finish, in which case the row is not added.
+// Errors writing the row are reported to OnError, or returned by Flush.
+func (w *TableWriter) Add(ctx context.Context, row map[string]interface{}) error {
+	if err := w.init(ctx); err != nil {
+		return err
+	}
+	var item *simpledb.ReplaceableItem
+	err := w.withConn(ctx, func(cn *conn) error {
+		var err error
+		item, err = w.newItem(cn, row)
+		if err != nil {
+			return errors.Wrap(err, "invalid row").With(
+				"table", w.tableName,
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	name := derefString(item.Name)
+	if w.names[name] {
+		// a batch request cannot contain an item more than once
+		if err := w.send(ctx); err != nil {
+			return err
+		}
+	}
+	w.items = append(w.items, item)
+	w.names[name] = true
+	if len(w.items) == maxBatchItems {
+		// the row has been added, so it is sent by a later call if ctx is done
+		_ = w.send(ctx)
+	}
+	return nil
+}
+
+// newItem returns the item for a row.
+func (w *TableWriter) newItem(cn *conn, row map[string]interface{}) (*simpledb.ReplaceableItem, error) {
+	names := make([]string, 0, len(row))
+	for name := range row {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	li := newLoadItem(cn.meta)
+	values := make(map[string]interface{}, len(row))
+	for _, name := range names {
+		arg := driver.NamedValue{Value: row[name]}
+		if err := cn.CheckNamedValue(&arg); err != nil {
+			return nil, errors.Wrap(err, "cannot convert value").With("column", name)
+		}
+		values[name] = arg.Value
+		if parse.IsID(name) {
+			id, ok := arg.Value.(string)
+			if !ok {
+				return nil, errors.New("id must be a string")
+			}
+			li.item.Name = aws.String(id)
+			continue
+		}
+		if err := li.putValue(name, arg.Value); err != nil {
+			return nil, errors.Wrap(err, "cannot convert value").With("column", name)
+		}
+	}
+	if derefString(li.item.Name) == "" {
+		return nil, errors.New("missing id")
+	}
+	if err := cn.validateValues(w.tableName, values); err != nil {
+		return nil, err
+	}
+	var err error
+	if li.item.Attributes, err = cn.meta.pack(li.item.Attributes, ""); err != nil {
+		return nil, err
+	}
+	return li.item, nil
+}
+
+// send sends the rows that have been added in a batch request, waiting
+// while the maximum number of requests are in progress. The request waits
+// for any requests in progress that write the same items, so that rows with
+// the same id are written in the order they were added.
+func (w *TableWriter) send(ctx context.Context) error {
+	if len(w.items) == 0 {
+		return nil
+	}
+	select {
+	case w.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	items := w.items
+	w.items = nil
+	w.names = make(map[string]bool)
+	done := make(chan struct{})
+	var waits []chan struct{}
+	w.mutex.Lock()
+	for _, item := range items {
+		name := derefString(item.Name)
+		if prev, ok := w.inflight[name]; ok {
+			waits = append(waits, prev)
+		}
+		w.inflight[name] = done
+	}
+	w.mutex.Unlock()
+	w.wg.Add(1)
+	go func() {
+		defer func() {
+			w.mutex.Lock()
+			for _, item := range items {
+				name := derefString(item.Name)
+				if w.inflight[name] == done {
+					delete(w.inflight, name)
+				}
+			}
+			w.mutex.Unlock()
+			close(done)
+			<-w.sem
+			w.wg.Done()
+		}()
+		for _, wait := range waits {
+			<-wait
+		}
+		err := w.withConn(w.ctx, func(cn *conn) error {
+			w.write(cn, items)
+			return nil
+		})
+		if err != nil {
+			for _, item := range items {
+				w.fail(derefString(item.Name), err)
+			}
+		}
+	}()
+	return nil
+}
+
+// write sends a batch request. If the request fails, and it has more than one
+// item, each item is sent in a separate request to find the rows that fail.
+func (w *TableWriter) write(cn *conn, items []*simpledb.ReplaceableItem) {
+	ctx := w.ctx
+	input := &simpledb.BatchPutAttributesInput{
+		DomainName: aws.String(w.domainName),
+		Items:      items,
+	}
+	// the requests of a writer that shares a connection are
+	// limited by the connection's MaxConnectionRequests
+	err := cn.requestSem.acquire(ctx)
+	if err == nil {
+		err = cn.batchPut(ctx, input, w.maxRetries())
+		cn.requestSem.release()
+	}
+	if err != nil && len(items) > 1 && ctx.Err() == nil {
+		for _, item := range items {
+			w.write(cn, []*simpledb.ReplaceableItem{item})
+		}
+		return
+	}
+	var (
+		attrs []*simpledb.ReplaceableAttribute
+		names []*string
+	)
+	for _, item := range items {
+		cn.invalidateItem(input.DomainName, item.Name)
+		attrs = append(attrs, item.Attributes...)
+		names = append(names, item.Name)
+	}
+	if err == nil {
+		cn.invalidateItems(ctx, w.tableName, input.DomainName, names, "insert")
+		err = cn.recordSchema(ctx, input.DomainName, attrs)
+	}
+	if err != nil {
+		for _, item := range items {
+			w.fail(derefString(item.Name), err)
+		}
+		return
+	}
+	w.mutex.Lock()
+	w.count += len(items)
+	w.mutex.Unlock()
+}
+
+// fail reports a row that cannot be written.
+func (w *TableWriter) fail(id string, err error) {
+	redacted := id
+	if w.redactor != nil {
+		redacted = w.redactor.Redact(id)
+	}
+	err = errors.Wrap(err, "cannot write row").With(
+		"table", w.tableName,
+		"id", redacted,
+	)
+	if w.OnError != nil {
+		w.OnError(w.ctx, id, err)
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.failed++
+}
+
+// Flush sends the rows that have been added, and waits until all of the
+// rows have been written. Unless OnError is set, it returns an error if
+// any rows added since the previous Flush could not be written, which
+// is the error of the first such row, together with the number of rows.
+// If ctx is done, Flush returns without waiting, and the rows continue
+// to be written.
+func (w *TableWriter) Flush(ctx context.Context) error {
+	if w.closed {
+		return errWriterClosed
+	}
+	if w.sem == nil {
+		return nil
+	}
+	if err := w.send(ctx); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	err, failed := w.err, w.failed
+	w.err, w.failed = nil, 0
+	if err != nil {
+		return errors.Wrap(err, "cannot write rows").With(
+			"failed", failed,
+		)
+	}
+	return nil
+}
+
+// Close cancels any requests in progress, discards any rows that have
+// not been sent, and closes the connection opened by the TableWriter.
+// Call Flush before Close to write the rows that have been added.
+func (w *TableWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.items = nil
+	if w.cancel != nil {
+		w.cancel()
+		w.wg.Wait()
+	}
+	if w.cn == nil {
+		return nil
+	}
+	err := w.cn.Close()
+	w.cn = nil
+	return err
+}
+
+// Count returns the number of rows that have been written.
+func (w *TableWriter) Count() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.count
+}
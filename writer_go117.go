@@ -0,0 +1,38 @@
+//go:build go1.17
+// +build go1.17
+
+package simpledbsql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jjeffery/errors"
+)
+
+// NewTableWriter returns a TableWriter that writes rows to a table of a
+// database opened with the "simpledb" driver name or with a Connector.
+// Each request uses a connection from the database's pool, which is
+// returned to the pool when the request finishes.
+//
+// NewTableWriter requires go 1.17 or later. For earlier versions,
+// use Connector.NewTableWriter.
+func NewTableWriter(db *sql.DB, tableName string) *TableWriter {
+	return &TableWriter{
+		tableName: tableName,
+		withConn: func(ctx context.Context, f func(cn *conn) error) error {
+			sc, err := db.Conn(ctx)
+			if err != nil {
+				return err
+			}
+			defer sc.Close()
+			return sc.Raw(func(dc interface{}) error {
+				cn, ok := dc.(*conn)
+				if !ok {
+					return errors.New("database does not use the simpledb driver")
+				}
+				return f(cn)
+			})
+		},
+	}
+}
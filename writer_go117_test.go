@@ -0,0 +1,45 @@
+//go:build go1.17
+// +build go1.17
+
+package simpledbsql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/jjeffery/simpledbsql/internal/fakesdb"
+)
+
+func TestNewTableWriter(t *testing.T) {
+	ctx := context.Background()
+	sdb := fakesdb.New()
+	db := sql.OpenDB(&Connector{SimpleDB: sdb})
+	defer db.Close()
+	_, err := db.ExecContext(ctx, "create table tbl")
+	wantNoError(t, err)
+
+	w := NewTableWriter(db, "tbl")
+	defer w.Close()
+	for i := 0; i < 30; i++ {
+		err := w.Add(ctx, map[string]interface{}{
+			"id": fmt.Sprintf("ID%02d", i),
+			"n":  i,
+		})
+		wantNoError(t, err)
+	}
+	wantNoError(t, w.Flush(ctx))
+	if got, want := w.Count(), 30; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if item := sdb.Item("tbl", "ID29"); len(item) == 0 {
+		t.Errorf("got=%v, want written", item)
+	}
+	wantNoError(t, w.Close())
+
+	// the writer does not keep a connection from the pool
+	if got, want := db.Stats().InUse, 0; got != want {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+}